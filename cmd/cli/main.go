@@ -113,11 +113,23 @@ This will:
 	statusCmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show Stronghold status",
-		Long:  `Display the current status of the Stronghold proxy, including protection status, usage statistics, and configuration.`,
+		Long: `Display the current status of the Stronghold proxy, including protection status, usage statistics, and configuration.
+
+With --history, also show per-day requests, blocks, warnings, skipped
+scans and spend over a window such as 30d or 4w, with the busiest hosts.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return cli.Status()
+			history, _ := cmd.Flags().GetString("history")
+			days := 0
+			if history != "" {
+				var err error
+				if days, err = cli.ParseHistoryWindow(history); err != nil {
+					return err
+				}
+			}
+			return cli.Status(days)
 		},
 	}
+	statusCmd.Flags().String("history", "", "Show traffic trends over a window such as 30d or 4w")
 
 	// Health command
 	healthCmd := &cobra.Command{
@@ -184,13 +196,110 @@ Examples:
 
 Available scanning keys:
   scanning.content.enabled          - Enable content scanning (true/false)
-  scanning.content.action_on_warn   - Action on WARN (allow/warn/block)
+  scanning.content.action_on_warn   - Action on WARN (allow/warn/block/hold)
   scanning.content.action_on_block  - Action on BLOCK (allow/warn/block)
-  scanning.output.enabled           - Reserved for future output policy (not currently enforced)
-  scanning.output.action_on_warn    - Reserved output WARN action (not currently enforced)
-  scanning.output.action_on_block   - Reserved output BLOCK action (not currently enforced)
+  scanning.content.shadow           - Record content actions without enforcing them (true/false)
+  scanning.output.enabled           - Scan LLM completions for leaked credentials (true/false)
+  scanning.output.action_on_warn    - Action on WARN for LLM completions (allow/warn/block/hold)
+  scanning.output.action_on_block   - Action on BLOCK for LLM completions (allow/warn/block)
+  scanning.output.shadow            - Record LLM completion actions without enforcing them (true/false)
+  scanning.documents.enabled        - Extract and scan PDF/office documents (true/false)
+  scanning.documents.max_size       - Largest document to extract, in bytes
+  scanning.archives.enabled         - Open zip/tar/tar.gz downloads and scan members (true/false)
+  scanning.archives.max_size        - Largest archive to open, in bytes
+  scanning.archives.max_depth       - Levels of nested archives to open
+  scanning.archives.max_members     - Most archive entries to inspect
+  scanning.batch.enabled            - Coalesce concurrent small scans into one paid batch call (true/false)
+  scanning.batch.window_ms          - How long a scan waits for others to join its batch
+  scanning.batch.max_items          - Batch size that is sent without waiting (2-32)
+  scanning.batch.max_item_size      - Larger content is scanned on its own, in bytes
+  scanning.session.enabled          - Pay for scans from a prepaid session instead of one by one (true/false)
+  scanning.session.deposit          - USDC paid to open each session (0.01-10)
+  scanning.breaker.enabled          - Fail fast while the scanning API is down (true/false)
+  scanning.breaker.failure_threshold - Consecutive failures or timeouts that open the breaker (1-100)
+  scanning.breaker.cooldown         - Wait before probing the API again (e.g. 10s)
+  scanning.breaker.max_cooldown     - Longest wait after repeated failed probes (e.g. 5m)
+  scanning.llm.enabled              - Scan LLM API tool results and completions message by message (true/false)
+  scanning.llm.providers            - LLM API profiles applied (comma-separated: openai,anthropic)
+  scanning.json.sanitize            - Forward flagged JSON with the offending fields blanked (true/false)
+  scanning.pii.enabled              - Check request bodies for personal data (true/false)
+  scanning.pii.email                - Action on email addresses (allow/redact/block)
+  scanning.pii.phone                - Action on phone numbers (allow/redact/block)
+  scanning.pii.national_id          - Action on SSNs and NI numbers (allow/redact/block)
+  scanning.pii.card                 - Action on payment card numbers (allow/redact/block)
+  scanning.pii.iban                 - Action on IBANs (allow/redact/block)
+  scanning.pii.address              - Action on street addresses (allow/redact/block)
   scanning.block_threshold          - Score threshold for BLOCK (0.0-1.0)
-  scanning.fail_open                - Pass traffic if scan fails (true/false)`,
+  scanning.fail_open                - Pass traffic if scan fails (true/false)
+
+Available quarantine keys:
+  quarantine.enabled                - Keep blocked bodies for review (true/false)
+  quarantine.dir                    - Directory blocked bodies are stored in
+  quarantine.retention_days         - Days before entries are pruned
+  quarantine.max_entries            - Most entries kept
+
+Available capture keys:
+  capture.mode                      - Flows recorded without 'capture start' (off/flagged/all)
+  capture.dir                       - Directory captured flows are stored in
+  capture.max_entries               - Most flows kept; the oldest are dropped
+  capture.max_body_size             - Bodies are truncated to this many bytes
+
+Available budget keys:
+  budget.daily_limit                - USDC spent on scans per day (0 = no cap)
+  budget.monthly_limit              - USDC spent on scans per month (0 = no cap)
+  budget.per_host_daily_limit       - USDC spent per scanned host per day (0 = no cap)
+  budget.on_exceeded                - When a cap is hit (local/fail_open/fail_closed)
+  budget.ledger                     - File spend is recorded in
+
+Available upstream keys:
+  upstream.max_idle_per_host        - Idle origin connections kept per host for intercepted HTTPS
+  upstream.max_conns_per_host       - Requests wait beyond this many origin connections per host (0 = no limit)
+  upstream.idle_timeout             - Idle origin connections are closed after this (e.g. 90s)
+  upstream.http2                    - Use HTTP/2 to origins that support it (true/false)
+
+Available stats keys:
+  stats.file                        - File per-day traffic statistics are kept in
+  stats.retention_days              - Days kept in full before rolling up into months
+
+Available rules keys:
+  rules.file                        - YAML file of local detection rules (see 'stronghold rules')
+
+Available icap keys:
+  icap.enabled                      - Serve ICAP (RFC 3507) for proxies such as Squid (true/false)
+  icap.bind                         - Address the ICAP listener binds to
+  icap.port                         - ICAP port (default 1344)
+  icap.preview                      - Body bytes requested in ICAP previews (0-65536)
+  icap.sanitize                     - Replace warned text responses with sanitized text (true/false)
+
+Available ext_authz keys:
+  ext_authz.enabled                 - Answer Envoy ext_authz check requests (true/false)
+  ext_authz.bind                    - Address the ext_authz listener binds to
+  ext_authz.port                    - ext_authz port (default 9191)
+  ext_authz.path_prefix             - path_prefix of Envoy's http_service, removed from checks
+
+Available canary keys:
+  canary.file                       - JSON registry of canary credentials (see 'stronghold canary')
+
+Available hosts keys:
+  hosts.file                        - JSON record of destination hosts (see 'stronghold hosts')
+  hosts.on_first_seen               - On first contact with a new host: allow, flag or hold
+
+Available notifications keys:
+  notifications.enabled             - Send notifications to targets (see 'stronghold notify')
+  notifications.batch_window        - How long notifications are gathered into one delivery (e.g. 10s)
+  notifications.max_batch           - Most notifications in one delivery
+  notifications.rate_limit          - Most deliveries per minute to each target
+  notifications.retries             - Retries of a failed delivery before its batch is dropped
+
+Available hold keys:
+  hold.dir                          - Where held content waits (see 'stronghold pending')
+  hold.timeout                      - How long held content waits for a decision (e.g. 2m)
+  hold.on_timeout                   - Action when no decision arrives: allow, warn or block
+  hold.api_token                    - Bearer token of the proxy's admin API; empty disables it
+
+Available shadow keys:
+  shadow.enabled                    - Record every action without enforcing it (true/false)
+  shadow.file                       - Where would-be actions are recorded (see 'stronghold shadow report')`,
 	}
 
 	configGetCmd := &cobra.Command{
@@ -227,11 +336,11 @@ Examples:
 
 Available scanning keys:
   scanning.content.enabled          - Enable content scanning (true/false)
-  scanning.content.action_on_warn   - Action on WARN (allow/warn/block)
+  scanning.content.action_on_warn   - Action on WARN (allow/warn/block/hold)
   scanning.content.action_on_block  - Action on BLOCK (allow/warn/block)
-  scanning.output.enabled           - Reserved for future output policy (not currently enforced)
-  scanning.output.action_on_warn    - Reserved output WARN action (not currently enforced)
-  scanning.output.action_on_block   - Reserved output BLOCK action (not currently enforced)`,
+  scanning.output.enabled           - Scan LLM completions for leaked credentials (true/false)
+  scanning.output.action_on_warn    - Action on WARN for LLM completions (allow/warn/block/hold)
+  scanning.output.action_on_block   - Action on BLOCK for LLM completions (allow/warn/block)`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return cli.ConfigSet(args[0], args[1])
@@ -298,6 +407,17 @@ Both Base and Solana deposit addresses are shown if configured.`,
 		},
 	}
 
+	walletSpendCmd := &cobra.Command{
+		Use:   "spend",
+		Short: "Show scan spend against budget",
+		Long: `Display what the proxy has spent on x402 scan payments today and this
+month, against the caps in the budget config section, with today's spend
+broken down by scanned host.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.WalletSpend()
+		},
+	}
+
 	walletExportCmd := &cobra.Command{
 		Use:   "export",
 		Short: "Export wallet private keys to files",
@@ -374,7 +494,391 @@ but you can use this command to manually re-register if needed.`,
 		},
 	}
 
-	walletCmd.AddCommand(walletListCmd, walletBalanceCmd, walletExportCmd, walletReplaceCmd, walletLinkCmd)
+	walletCmd.AddCommand(walletListCmd, walletBalanceCmd, walletSpendCmd, walletExportCmd, walletReplaceCmd, walletLinkCmd)
+
+	// Quarantine command
+	quarantineCmd := &cobra.Command{
+		Use:   "quarantine",
+		Short: "Review, release, and delete blocked content",
+		Long: `Inspect responses the proxy blocked.
+
+Blocked bodies are stored encrypted in ~/.stronghold/quarantine together
+with their scan result, and pruned after quarantine.retention_days.`,
+	}
+
+	quarantineListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List quarantined responses",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.QuarantineList()
+		},
+	}
+
+	quarantineShowCmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a quarantined response",
+		Long: `Show the metadata and scan result of a quarantined response.
+
+The blocked body is not printed unless --body is given. Use --output to
+write it to a file instead. IDs may be abbreviated to a unique prefix.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBody, _ := cmd.Flags().GetBool("body")
+			output, _ := cmd.Flags().GetString("output")
+			return cli.QuarantineShow(args[0], printBody, output)
+		},
+	}
+	quarantineShowCmd.Flags().Bool("body", false, "Print the blocked body")
+	quarantineShowCmd.Flags().StringP("output", "o", "", "Write the blocked body to a file")
+
+	quarantineReleaseCmd := &cobra.Command{
+		Use:   "release <id>",
+		Short: "Release a false positive",
+		Long: `Release a quarantined response that was blocked by mistake.
+
+The content's SHA-256 hash is whitelisted so the next fetch of the same
+content passes the proxy without being scanned, and the entry is removed
+from quarantine.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.QuarantineRelease(args[0])
+		},
+	}
+
+	quarantineDeleteCmd := &cobra.Command{
+		Use:   "delete <id>...",
+		Short: "Delete quarantined responses",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			all, _ := cmd.Flags().GetBool("all")
+			return cli.QuarantineDelete(args, all)
+		},
+	}
+	quarantineDeleteCmd.Flags().Bool("all", false, "Delete every quarantined response")
+
+	quarantineCmd.AddCommand(quarantineListCmd, quarantineShowCmd, quarantineReleaseCmd, quarantineDeleteCmd)
+
+	// Capture command
+	captureCmd := &cobra.Command{
+		Use:   "capture",
+		Short: "Record proxied flows and export them as HAR",
+		Long: `Record the flows passing through the proxy for debugging.
+
+Recorded flows include headers, bodies up to capture.max_body_size, timing
+and the scan verdict. Authorization and cookie headers are redacted.
+Export them as HAR 1.2 to open in browser devtools.`,
+	}
+
+	captureStartCmd := &cobra.Command{
+		Use:   "start",
+		Short: "Start recording flows",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flagged, _ := cmd.Flags().GetBool("flagged")
+			return cli.CaptureStart(flagged)
+		},
+	}
+	captureStartCmd.Flags().Bool("flagged", false, "Only record flows that were warned, blocked or failed")
+
+	captureStopCmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop recording flows",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.CaptureStop()
+		},
+	}
+
+	captureStatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the capture mode and number of recorded flows",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.CaptureStatus()
+		},
+	}
+
+	captureExportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export recorded flows as a HAR file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			clear, _ := cmd.Flags().GetBool("clear")
+			return cli.CaptureExport(output, clear, version)
+		},
+	}
+	captureExportCmd.Flags().StringP("output", "o", "", "HAR file to write, or - for stdout (default stronghold-capture-<time>.har)")
+	captureExportCmd.Flags().Bool("clear", false, "Delete the recorded flows after exporting")
+
+	captureCmd.AddCommand(captureStartCmd, captureStopCmd, captureStatusCmd, captureExportCmd)
+
+	// Rules command
+	rulesCmd := &cobra.Command{
+		Use:   "rules",
+		Short: "Check and test local detection rules",
+		Long: `Local rules catch organization-specific content, such as internal
+codenames leaving the network or known-bad instructions, before any paid
+remote scan. They are read from rules.file (default ~/.stronghold/rules.yaml).
+
+Each rule has an id, a type (regex, keyword or entropy), a category,
+a severity (low, medium, high, critical), a direction (inbound for fetched
+content, outbound for request bodies, or both) and an action (allow, warn,
+block). Matches are reported in the scan result's threats by rule id.`,
+	}
+
+	rulesCheckCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Validate the rules file and list its rules",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.RulesCheck()
+		},
+	}
+
+	rulesTestCmd := &cobra.Command{
+		Use:   "test <file|->",
+		Short: "Show which rules match a file, or stdin with -",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			direction, _ := cmd.Flags().GetString("direction")
+			return cli.RulesTest(args[0], direction)
+		},
+	}
+	rulesTestCmd.Flags().String("direction", "inbound", "Evaluate rules for inbound (fetched) or outbound (sent) content")
+
+	rulesCmd.AddCommand(rulesCheckCmd, rulesTestCmd)
+
+	// Canary command
+	canaryCmd := &cobra.Command{
+		Use:   "canary",
+		Short: "Create and revoke canary credentials",
+		Long: `Canaries are fake credentials to plant in agent environments: AWS-style
+key pairs, API tokens and unguessable URLs. They have no legitimate use, so
+any request through the proxy that carries one, in its URL, headers or body,
+is blocked and logged as exfiltration. Canaries are matched locally, without
+the scanning API, even when content scanning is disabled.
+
+The registry is canary.file (default ~/.stronghold/canaries.json); hits are
+logged to canary-hits.jsonl next to it.`,
+	}
+
+	canaryCreateCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a canary and print it",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			kind, _ := cmd.Flags().GetString("kind")
+			label, _ := cmd.Flags().GetString("label")
+			prefix, _ := cmd.Flags().GetString("prefix")
+			base, _ := cmd.Flags().GetString("base-url")
+			option := prefix
+			if kind == "url" {
+				option = base
+			}
+			return cli.CanaryCreate(kind, label, option)
+		},
+	}
+	canaryCreateCmd.Flags().String("kind", "aws", "Kind of canary: aws, token or url")
+	canaryCreateCmd.Flags().String("label", "", "Where the canary is planted, shown in alerts")
+	canaryCreateCmd.Flags().String("prefix", "sk-", "Prefix of token canaries")
+	canaryCreateCmd.Flags().String("base-url", "https://files.example.com/s/", "Base of URL canaries")
+
+	canaryListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List canaries and their hits",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.CanaryList()
+		},
+	}
+
+	canaryRevokeCmd := &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Stop matching a canary",
+		Long: `Stop matching a canary, e.g. once it is removed from the environment it
+was planted in. Revoked canaries stay listed with their hits. IDs may be
+abbreviated to a unique prefix.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.CanaryRevoke(args[0])
+		},
+	}
+
+	canaryCmd.AddCommand(canaryCreateCmd, canaryListCmd, canaryRevokeCmd)
+
+	// Hosts command
+	hostsCmd := &cobra.Command{
+		Use:   "hosts",
+		Short: "List destination hosts and approve held ones",
+		Long: `List every host the proxy has sent traffic to, newest first, with when it
+was first and last seen, its request count, and the share of requests that
+were blocked or warned.
+
+With hosts.on_first_seen set to flag, first contact with a new host is
+logged, marked with X-Stronghold-New-Host and notified as new_host to the
+notification targets (see 'stronghold notify'). With hold, requests to the
+host are also blocked until it is approved.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pending, _ := cmd.Flags().GetBool("pending")
+			limit, _ := cmd.Flags().GetInt("limit")
+			return cli.HostsList(pending, limit)
+		},
+	}
+	hostsCmd.Flags().Bool("pending", false, "Only list hosts held for approval")
+	hostsCmd.Flags().Int("limit", 50, "Most hosts listed (0 for all)")
+
+	hostsApproveCmd := &cobra.Command{
+		Use:   "approve <host>",
+		Short: "Let requests to a held host through",
+		Long: `Let requests to a host held for approval through. The running proxy picks
+the approval up immediately. Hosts not seen yet can be approved ahead of
+first contact.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.HostsApprove(args[0])
+		},
+	}
+
+	hostsCmd.AddCommand(hostsApproveCmd)
+
+	// Notify command
+	notifyCmd := &cobra.Command{
+		Use:   "notify",
+		Short: "Manage where block and outage notifications are sent",
+		Long: `Notifications tell you when the proxy blocks or warns on content, a scan
+budget runs out, the scanning API is unavailable, or a new host is first
+contacted. They are POSTed to webhook targets as JSON, or as Slack or Teams
+messages, gathered into batches and rate limited per target.
+
+Targets are stored in notifications.targets; enable delivery with
+'stronghold config set notifications.enabled true' and restart the proxy.`,
+	}
+
+	notifyListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List notification targets",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.NotifyList()
+		},
+	}
+
+	notifyAddCmd := &cobra.Command{
+		Use:   "add",
+		Short: "Add or update a notification target",
+		Long: `Add a notification target, or update the one with the same name.
+
+With --secret, each delivery is signed: X-Stronghold-Signature carries
+sha256=<hex HMAC-SHA256 of the X-Stronghold-Timestamp value, ".", and the body>.
+--events limits the target to some of: block, warn, budget_exhausted,
+fail_closed, circuit_open, new_host and held.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, _ := cmd.Flags().GetString("name")
+			url, _ := cmd.Flags().GetString("url")
+			format, _ := cmd.Flags().GetString("format")
+			secret, _ := cmd.Flags().GetString("secret")
+			events, _ := cmd.Flags().GetStringSlice("events")
+			return cli.NotifyAdd(cli.NotifyTarget{
+				Name:   name,
+				URL:    url,
+				Format: format,
+				Secret: secret,
+				Events: events,
+			})
+		},
+	}
+	notifyAddCmd.Flags().String("name", "", "Name of the target")
+	notifyAddCmd.Flags().String("url", "", "URL notifications are POSTed to")
+	notifyAddCmd.Flags().String("format", "json", "Payload format: json, slack or teams")
+	notifyAddCmd.Flags().String("secret", "", "Secret deliveries are signed with")
+	notifyAddCmd.Flags().StringSlice("events", nil, "Events sent to the target (default all)")
+
+	notifyRemoveCmd := &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a notification target",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.NotifyRemove(args[0])
+		},
+	}
+
+	notifyTestCmd := &cobra.Command{
+		Use:   "test",
+		Short: "Send a test notification",
+		Long: `Send a test notification to every target, or only to --target, and report
+whether each delivery succeeded. Test notifications are sent immediately,
+whether or not notifications are enabled.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target, _ := cmd.Flags().GetString("target")
+			return cli.NotifyTest(target)
+		},
+	}
+	notifyTestCmd.Flags().String("target", "", "Only test the target with this name")
+
+	notifyCmd.AddCommand(notifyListCmd, notifyAddCmd, notifyRemoveCmd, notifyTestCmd)
+
+	// Pending, approve and deny commands
+	pendingCmd := &cobra.Command{
+		Use:   "pending",
+		Short: "List content held for a decision",
+		Long: `List content held for a human decision, oldest first, with its URL, the
+threats found, and the start of its body.
+
+Content is held when the scanner warns on it and scanning.content.action_on_warn
+(or scanning.output.action_on_warn) is hold. The proxy waits up to
+hold.timeout for 'stronghold approve' or 'stronghold deny', then applies
+hold.on_timeout.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.HoldList()
+		},
+	}
+
+	approveCmd := &cobra.Command{
+		Use:   "approve <id>",
+		Short: "Forward held content",
+		Long: `Forward content held for a decision. The waiting proxy picks the decision
+up within a second. IDs may be abbreviated to a unique prefix.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.HoldDecide(args[0], true)
+		},
+	}
+
+	denyCmd := &cobra.Command{
+		Use:   "deny <id>",
+		Short: "Block held content",
+		Long: `Block content held for a decision. Denied responses are quarantined like
+any other block. IDs may be abbreviated to a unique prefix.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cli.HoldDecide(args[0], false)
+		},
+	}
+
+	// Shadow command
+	shadowCmd := &cobra.Command{
+		Use:   "shadow",
+		Short: "Review what shadow mode would have enforced",
+		Long: `In shadow mode every scan and policy decision runs, but the original
+content is always forwarded. The action policy would have taken is sent in
+X-Stronghold-Shadow-Action, logged, and recorded in shadow.file.
+
+Shadow every policy with 'stronghold config set shadow.enabled true', or one
+with scanning.content.shadow or scanning.output.shadow, and restart the proxy.`,
+	}
+
+	shadowReportCmd := &cobra.Command{
+		Use:   "report",
+		Short: "Summarise would-be blocks by host and category",
+		Long: `Summarise the scans evaluated in shadow mode over a window such as 7d or
+4w: how many would have been blocked, or warned, sanitized or held, per
+destination host, and the threat categories behind the would-be blocks.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			since, _ := cmd.Flags().GetString("since")
+			limit, _ := cmd.Flags().GetInt("limit")
+			days, err := cli.ParseHistoryWindow(since)
+			if err != nil {
+				return err
+			}
+			return cli.ShadowReport(days, limit)
+		},
+	}
+	shadowReportCmd.Flags().String("since", "7d", "Window to report on, such as 7d or 4w")
+	shadowReportCmd.Flags().Int("limit", 20, "Most hosts listed (0 for all)")
+
+	shadowCmd.AddCommand(shadowReportCmd)
 
 	// Doctor command
 	doctorCmd := &cobra.Command{
@@ -409,6 +913,16 @@ Run this before 'stronghold init' to catch issues early.`,
 		configCmd,
 		accountCmd,
 		walletCmd,
+		quarantineCmd,
+		captureCmd,
+		rulesCmd,
+		canaryCmd,
+		hostsCmd,
+		notifyCmd,
+		pendingCmd,
+		approveCmd,
+		denyCmd,
+		shadowCmd,
 		doctorCmd,
 	)
 
@@ -43,6 +43,14 @@ export default defineConfig({
             { label: 'Enable & Disable', slug: 'proxy/enable-disable' },
             { label: 'Architecture', slug: 'proxy/architecture' },
             { label: 'Response Headers', slug: 'proxy/response-headers' },
+            { label: 'Local Rules', slug: 'proxy/rules' },
+            { label: 'Canary Credentials', slug: 'proxy/canaries' },
+            { label: 'New Destinations', slug: 'proxy/hosts' },
+            { label: 'Notifications', slug: 'proxy/notifications' },
+            { label: 'Human Approval', slug: 'proxy/hold' },
+            { label: 'Shadow Mode', slug: 'proxy/shadow' },
+            { label: 'ICAP', slug: 'proxy/icap' },
+            { label: 'Envoy ext_authz', slug: 'proxy/envoy' },
             { label: 'Configuration', slug: 'proxy/configuration' },
           ],
         },
@@ -52,6 +60,9 @@ export default defineConfig({
             { label: 'Overview', slug: 'api' },
             { label: 'POST /v1/scan/content', slug: 'api/scan-content' },
             { label: 'POST /v1/scan/output', slug: 'api/scan-output' },
+            { label: 'POST /v1/scan/batch', slug: 'api/scan-batch' },
+            { label: 'Prepaid sessions', slug: 'api/sessions' },
+            { label: 'Custom rules', slug: 'api/account-rules' },
             { label: 'GET /v1/pricing', slug: 'api/pricing' },
             { label: 'Health Checks', slug: 'api/health' },
             { label: 'Errors', slug: 'api/errors' },
@@ -89,6 +100,14 @@ export default defineConfig({
             { label: 'wallet', slug: 'cli/wallet' },
             { label: 'account', slug: 'cli/account' },
             { label: 'config', slug: 'cli/config' },
+            { label: 'quarantine', slug: 'cli/quarantine' },
+            { label: 'capture', slug: 'cli/capture' },
+            { label: 'rules', slug: 'cli/rules' },
+            { label: 'canary', slug: 'cli/canary' },
+            { label: 'hosts', slug: 'cli/hosts' },
+            { label: 'notify', slug: 'cli/notify' },
+            { label: 'pending, approve, deny', slug: 'cli/pending' },
+            { label: 'shadow', slug: 'cli/shadow' },
             { label: 'doctor', slug: 'cli/doctor' },
           ],
         },
@@ -821,7 +821,7 @@ const docTemplate = `{
         },
         "/v1/scan/output": {
             "post": {
-                "description": "Scans LLM output text for credential leaks and sensitive data exposure",
+                "description": "Scans LLM output text for credential leaks and personal data. Personal data is only checked for accounts with a PII policy, which decides what is blocked and what is redacted in sanitized_text.",
                 "consumes": [
                     "application/json"
                 ],
@@ -831,7 +831,7 @@ const docTemplate = `{
                 "tags": [
                     "scan"
                 ],
-                "summary": "Scan LLM output for credential leaks",
+                "summary": "Scan LLM output for credential leaks and personal data",
                 "parameters": [
                     {
                         "description": "Output scan request",
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"stronghold/internal/proxy"
+)
+
+// openCanaries opens the canary registry the proxy matches requests against
+func openCanaries() (*proxy.CanaryStore, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return proxy.OpenCanaries(proxy.CanaryConfig{File: config.Canary.File})
+}
+
+// CanaryCreate generates and registers a canary credential and prints what
+// to plant. For tokens, option is the prefix; for URLs, the base URL.
+func CanaryCreate(kind, label, option string) error {
+	store, err := openCanaries()
+	if err != nil {
+		return err
+	}
+
+	canary, err := store.Create(kind, label, option)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(successStyle.Render(fmt.Sprintf("✓ Created %s canary %s", canary.Kind, canary.ID)))
+	fmt.Println()
+	switch canary.Kind {
+	case proxy.CanaryAWS:
+		fmt.Printf("aws_access_key_id = %s\n", canary.Value)
+		fmt.Printf("aws_secret_access_key = %s\n", canary.Secret)
+	default:
+		fmt.Println(canary.Value)
+	}
+	fmt.Println()
+	fmt.Println("  Plant it where an agent could find it. Any request through the proxy that")
+	fmt.Println("  carries it is blocked and logged; the running proxy picks it up immediately.")
+	return nil
+}
+
+// CanaryList lists canaries with how often they were sent
+func CanaryList() error {
+	store, err := openCanaries()
+	if err != nil {
+		return err
+	}
+
+	canaries, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(canaries) == 0 {
+		fmt.Println("No canaries. Create one with 'stronghold canary create'.")
+		return nil
+	}
+
+	hits, err := store.Hits()
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int)
+	last := make(map[string]proxy.CanaryHit)
+	for _, hit := range hits {
+		counts[hit.CanaryID]++
+		last[hit.CanaryID] = hit
+	}
+
+	fmt.Printf("%-8s  %-5s  %-7s  %-16s  %4s  %-16s  %s\n", "ID", "KIND", "STATUS", "CREATED", "HITS", "LAST HIT", "LABEL")
+	for _, c := range canaries {
+		status := "active"
+		if !c.Active() {
+			status = "revoked"
+		}
+		lastHit := "-"
+		if hit, ok := last[c.ID]; ok {
+			lastHit = hit.At.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%-8s  %-5s  %-7s  %-16s  %4d  %-16s  %s\n",
+			c.ID,
+			c.Kind,
+			status,
+			c.CreatedAt.Local().Format("2006-01-02 15:04"),
+			counts[c.ID],
+			lastHit,
+			truncateString(c.Label, 40),
+		)
+	}
+
+	if len(hits) > 0 {
+		fmt.Println()
+		fmt.Println(warningStyle.Render(fmt.Sprintf("⚠ %d requests carried a canary. Recent hits:", len(hits))))
+		start := max(len(hits)-5, 0)
+		for _, hit := range hits[start:] {
+			fmt.Printf("  %s  %-8s  %-24s  %s %s\n",
+				hit.At.Local().Format("2006-01-02 15:04:05"),
+				hit.CanaryID,
+				truncateString(hit.Location, 24),
+				hit.Method,
+				truncateString(hit.URL, 60),
+			)
+		}
+	}
+	return nil
+}
+
+// CanaryRevoke stops the proxy from matching a canary, e.g. once it has
+// been removed from the environment it was planted in
+func CanaryRevoke(id string) error {
+	store, err := openCanaries()
+	if err != nil {
+		return err
+	}
+
+	canary, err := store.Revoke(id)
+	if errors.Is(err, proxy.ErrCanaryNotFound) {
+		return fmt.Errorf("no canary with ID %s", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(successStyle.Render(fmt.Sprintf("✓ Revoked %s canary %s", canary.Kind, canary.ID)))
+	return nil
+}
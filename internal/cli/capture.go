@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"stronghold/internal/proxy"
+)
+
+// openCapture opens the capture store the proxy records flows into
+func openCapture() (*proxy.CaptureStore, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	return proxy.OpenCapture(proxy.CaptureConfig{
+		Mode:        config.Capture.Mode,
+		Dir:         config.Capture.Dir,
+		MaxEntries:  config.Capture.MaxEntries,
+		MaxBodySize: config.Capture.MaxBodySize,
+	})
+}
+
+// CaptureStart starts recording flows, every flow or only flagged ones
+func CaptureStart(flaggedOnly bool) error {
+	store, err := openCapture()
+	if err != nil {
+		return err
+	}
+
+	mode := proxy.CaptureAll
+	if flaggedOnly {
+		mode = proxy.CaptureFlagged
+	}
+	if err := store.Start(mode); err != nil {
+		return err
+	}
+
+	fmt.Println(successStyle.Render("✓ Capture started (" + mode + ")"))
+	fmt.Println("  Headers and bodies of proxied flows are recorded. Credentials are redacted.")
+	fmt.Println("  Run 'stronghold capture export' to save them as HAR, then 'stronghold capture stop'.")
+	return nil
+}
+
+// CaptureStop stops an on-demand capture. Recorded flows are kept until
+// they are exported with --clear.
+func CaptureStop() error {
+	store, err := openCapture()
+	if err != nil {
+		return err
+	}
+
+	if store.State() == nil {
+		fmt.Println("No capture is running.")
+	} else {
+		if err := store.Stop(); err != nil {
+			return err
+		}
+		fmt.Println(successStyle.Render("✓ Capture stopped"))
+	}
+
+	if mode := store.ConfiguredMode(); mode != proxy.CaptureOff {
+		fmt.Printf("  capture.mode is %q in the config, so the proxy keeps recording %s flows.\n", mode, mode)
+	}
+	return nil
+}
+
+// CaptureStatus prints the capture mode and the number of recorded flows
+func CaptureStatus() error {
+	store, err := openCapture()
+	if err != nil {
+		return err
+	}
+
+	entries, err := store.Entries()
+	if err != nil {
+		return err
+	}
+
+	if state := store.State(); state != nil {
+		fmt.Printf("Capture:  %s (started %s)\n", state.Mode, state.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	} else {
+		fmt.Printf("Capture:  %s (from config)\n", store.ConfiguredMode())
+	}
+	fmt.Printf("Recorded: %d flows\n", len(entries))
+	return nil
+}
+
+// CaptureExport writes the recorded flows as a HAR 1.2 file. An output
+// path of "-" writes to stdout.
+func CaptureExport(outputPath string, clear bool, version string) error {
+	store, err := openCapture()
+	if err != nil {
+		return err
+	}
+
+	if outputPath == "" {
+		outputPath = "stronghold-capture-" + time.Now().Format("20060102-150405") + ".har"
+	}
+
+	out := os.Stdout
+	if outputPath != "-" {
+		f, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", outputPath, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	n, err := store.ExportHAR(out, version)
+	if err != nil {
+		return err
+	}
+
+	if clear {
+		if _, err := store.Clear(); err != nil {
+			return err
+		}
+	}
+
+	if outputPath != "-" {
+		fmt.Println(successStyle.Render(fmt.Sprintf("✓ Exported %d flows to %s", n, outputPath)))
+		fmt.Println("  Open it in the Network panel of your browser's devtools.")
+	}
+	return nil
+}
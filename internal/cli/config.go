@@ -57,6 +57,66 @@ type ScanTypeConfig struct {
 	Enabled       bool   `yaml:"enabled"`         // Whether this scan type is active
 	ActionOnWarn  string `yaml:"action_on_warn"`  // "allow", "warn", "block"
 	ActionOnBlock string `yaml:"action_on_block"` // "allow", "warn", "block"
+	Shadow        bool   `yaml:"shadow"`          // Record actions without enforcing them
+}
+
+// DocumentConfig controls text extraction for office documents and PDFs
+type DocumentConfig struct {
+	Enabled bool  `yaml:"enabled"`  // Extract and scan PDF/DOCX/XLSX/PPTX/ODT/RTF
+	MaxSize int64 `yaml:"max_size"` // Largest document body (bytes) buffered for extraction
+}
+
+// ArchiveConfig controls scanning of zip, tar and tar.gz downloads
+type ArchiveConfig struct {
+	Enabled    bool  `yaml:"enabled"`     // Open archives and scan their text-like members
+	MaxSize    int64 `yaml:"max_size"`    // Largest archive body (bytes) buffered for inspection
+	MaxDepth   int   `yaml:"max_depth"`   // How many levels of nested archives are opened
+	MaxMembers int   `yaml:"max_members"` // Most entries inspected per archive
+}
+
+// BatchConfig controls coalescing of small content scans into batch calls
+type BatchConfig struct {
+	Enabled     bool `yaml:"enabled"`       // Coalesce scans into /v1/scan/batch calls
+	WindowMs    int  `yaml:"window_ms"`     // How long the first scan waits for others to join
+	MaxItems    int  `yaml:"max_items"`     // A full batch is sent without waiting
+	MaxItemSize int  `yaml:"max_item_size"` // Larger content is scanned on its own (bytes)
+}
+
+// SessionConfig controls paying for scans from prepaid x402 sessions
+type SessionConfig struct {
+	Enabled bool    `yaml:"enabled"` // Pay for scans from prepaid sessions
+	Deposit float64 `yaml:"deposit"` // USDC paid to open each session
+}
+
+// BreakerConfig controls the circuit breaker in front of the scanning API
+type BreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`           // Stop calling the API after repeated failures
+	FailureThreshold int           `yaml:"failure_threshold"` // Consecutive failures or timeouts that open the breaker
+	Cooldown         time.Duration `yaml:"cooldown"`          // Wait before the first probe after opening
+	MaxCooldown      time.Duration `yaml:"max_cooldown"`      // The cooldown doubles after each failed probe up to this
+}
+
+// LLMConfig controls per-message scanning of LLM API calls
+type LLMConfig struct {
+	Enabled   bool     `yaml:"enabled"`   // Scan tool results and completions of recognized LLM API calls
+	Providers []string `yaml:"providers"` // Profiles applied: openai (Chat Completions), anthropic (Messages)
+}
+
+// JSONConfig controls handling of JSON flagged field by field
+type JSONConfig struct {
+	Sanitize bool `yaml:"sanitize"` // Forward JSON with the offending fields blanked instead of blocking or warning
+}
+
+// PIIConfig controls the personal data detectors run on outbound request
+// bodies. Each category is allow, redact or block; empty follows the default.
+type PIIConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Email      string `yaml:"email"`       // Default redact
+	Phone      string `yaml:"phone"`       // Default redact
+	NationalID string `yaml:"national_id"` // US SSNs and UK NI numbers; default block
+	Card       string `yaml:"card"`        // Luhn-valid card numbers; default block
+	IBAN       string `yaml:"iban"`        // Default block
+	Address    string `yaml:"address"`     // Street addresses; default redact
 }
 
 // ScanningConfig holds scanning behavior configuration
@@ -64,8 +124,16 @@ type ScanningConfig struct {
 	Mode           string         `yaml:"mode"`
 	BlockThreshold float64        `yaml:"block_threshold"`
 	FailOpen       bool           `yaml:"fail_open"`
-	Content        ScanTypeConfig `yaml:"content"` // Prompt injection scanning (incoming)
-	Output         ScanTypeConfig `yaml:"output"`  // Credential leak scanning (outgoing)
+	Content        ScanTypeConfig `yaml:"content"`   // Prompt injection scanning (incoming)
+	Output         ScanTypeConfig `yaml:"output"`    // Credential leak scanning (outgoing)
+	Documents      DocumentConfig `yaml:"documents"` // PDF/office document text extraction
+	Archives       ArchiveConfig  `yaml:"archives"`  // zip/tar/tar.gz member scanning
+	Batch          BatchConfig    `yaml:"batch"`     // Coalescing of small scans into batch calls
+	Session        SessionConfig  `yaml:"session"`   // Prepaid x402 sessions
+	Breaker        BreakerConfig  `yaml:"breaker"`   // Fail fast while the API is down
+	LLM            LLMConfig      `yaml:"llm"`       // Per-message scanning of LLM API calls
+	JSON           JSONConfig     `yaml:"json"`      // Handling of JSON flagged field by field
+	PII            PIIConfig      `yaml:"pii"`       // Personal data in outbound request bodies
 }
 
 // LoggingConfig holds logging configuration
@@ -74,13 +142,115 @@ type LoggingConfig struct {
 	File  string `yaml:"file"`
 }
 
-// UsageStats holds usage statistics
-type UsageStats struct {
-	RequestsToday int64   `yaml:"requests_today"`
-	BlockedToday  int64   `yaml:"blocked_today"`
-	WarnedToday   int64   `yaml:"warned_today"`
-	CostToday     float64 `yaml:"cost_today"`
-	LastReset     string  `yaml:"last_reset"`
+// QuarantineConfig controls the local store of blocked response bodies
+type QuarantineConfig struct {
+	Enabled       bool   `yaml:"enabled"`        // Keep blocked bodies for review
+	Dir           string `yaml:"dir"`            // Where quarantined bodies are stored
+	RetentionDays int    `yaml:"retention_days"` // Entries older than this are pruned
+	MaxEntries    int    `yaml:"max_entries"`    // Oldest entries are pruned beyond this count
+}
+
+// CaptureConfig controls recording of proxied flows for HAR export
+type CaptureConfig struct {
+	Mode        string `yaml:"mode"`          // off, flagged or all
+	Dir         string `yaml:"dir"`           // Where captured flows are stored
+	MaxEntries  int    `yaml:"max_entries"`   // Oldest flows are dropped beyond this count
+	MaxBodySize int    `yaml:"max_body_size"` // Bodies are truncated to this many bytes
+}
+
+// BudgetConfig caps what the proxy spends on x402 scan payments. Limits are
+// in USDC; zero means no limit.
+type BudgetConfig struct {
+	DailyLimit        float64 `yaml:"daily_limit"`          // Spend per calendar day
+	MonthlyLimit      float64 `yaml:"monthly_limit"`        // Spend per calendar month
+	PerHostDailyLimit float64 `yaml:"per_host_daily_limit"` // Spend per scanned host per day
+	OnExceeded        string  `yaml:"on_exceeded"`          // local, fail_open or fail_closed
+	Ledger            string  `yaml:"ledger"`               // Where spend is recorded
+}
+
+// UpstreamConfig controls the pool of origin connections used for intercepted HTTPS
+type UpstreamConfig struct {
+	MaxIdlePerHost  int           `yaml:"max_idle_per_host"`  // Idle connections kept per host
+	MaxConnsPerHost int           `yaml:"max_conns_per_host"` // Requests wait beyond this many connections per host (0 = no limit)
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`       // Idle connections are closed after this
+	HTTP2           bool          `yaml:"http2"`              // Negotiate HTTP/2 with origins that support it
+}
+
+// StatsConfig controls the per-day traffic statistics the proxy keeps
+type StatsConfig struct {
+	File          string `yaml:"file"`           // Where statistics are stored
+	RetentionDays int    `yaml:"retention_days"` // Days kept in full before rolling up into months
+}
+
+// RulesConfig points at the file of local detection rules
+type RulesConfig struct {
+	File string `yaml:"file"` // YAML rules file; no local rules if it does not exist
+}
+
+// ICAPConfig configures the ICAP listener for proxies such as Squid
+type ICAPConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Bind     string `yaml:"bind"`
+	Port     int    `yaml:"port"`
+	Preview  int    `yaml:"preview"`  // Body bytes requested up front
+	Sanitize bool   `yaml:"sanitize"` // Replace warned text responses with sanitized text
+}
+
+// ExtAuthzConfig configures the Envoy ext_authz listener
+type ExtAuthzConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Bind       string `yaml:"bind"`
+	Port       int    `yaml:"port"`
+	PathPrefix string `yaml:"path_prefix"` // The http_service path_prefix set in Envoy
+}
+
+// CanaryConfig points at the registry of canary credentials
+type CanaryConfig struct {
+	File string `yaml:"file"` // JSON registry written by 'stronghold canary'; no canaries if it does not exist
+}
+
+// HostsConfig controls the record of destination hosts and what happens
+// on first contact with a new one
+type HostsConfig struct {
+	File        string `yaml:"file"`              // Where destination hosts are recorded
+	OnFirstSeen string `yaml:"on_first_seen"`     // allow, flag or hold
+	Webhook     string `yaml:"webhook,omitempty"` // Deprecated: moved to a notifications target on load
+}
+
+// NotificationsConfig controls the notifications the proxy delivers to
+// webhooks. Targets are managed with 'stronghold notify'.
+type NotificationsConfig struct {
+	Enabled     bool           `yaml:"enabled"`
+	BatchWindow time.Duration  `yaml:"batch_window"` // Notifications collected into one delivery
+	MaxBatch    int            `yaml:"max_batch"`    // Most notifications in one delivery
+	RateLimit   int            `yaml:"rate_limit"`   // Most deliveries per minute to each target
+	Retries     int            `yaml:"retries"`      // Retries of a failed delivery, with backoff
+	Targets     []NotifyTarget `yaml:"targets"`
+}
+
+// NotifyTarget is a webhook notifications are delivered to
+type NotifyTarget struct {
+	Name   string   `yaml:"name"`
+	URL    string   `yaml:"url"`
+	Format string   `yaml:"format"`           // json, slack or teams
+	Secret string   `yaml:"secret,omitempty"` // Signs deliveries with HMAC-SHA256
+	Events []string `yaml:"events,omitempty"` // Events delivered; all when empty
+}
+
+// HoldConfig controls WARN content held for a human decision when an
+// action_on_warn is "hold"
+type HoldConfig struct {
+	Dir       string        `yaml:"dir"`        // Where held items wait; decided with 'stronghold approve' and 'stronghold deny'
+	Timeout   time.Duration `yaml:"timeout"`    // How long a held item waits for a decision
+	OnTimeout string        `yaml:"on_timeout"` // allow, warn or block when no decision arrives
+	APIToken  string        `yaml:"api_token"`  // Bearer token of the proxy's admin API; empty disables it
+}
+
+// ShadowConfig controls shadow mode, in which policy is evaluated and
+// recorded but not enforced
+type ShadowConfig struct {
+	Enabled bool   `yaml:"enabled"` // Shadow every policy; scanning.content.shadow and scanning.output.shadow shadow one
+	File    string `yaml:"file"`    // Where would-be actions are recorded; read by 'stronghold shadow report'
 }
 
 // CAConfig holds CA certificate configuration for MITM
@@ -91,18 +261,30 @@ type CAConfig struct {
 
 // CLIConfig holds the complete CLI configuration
 type CLIConfig struct {
-	Version     string         `yaml:"version"`
-	Proxy       ProxyConfig    `yaml:"proxy"`
-	API         APIConfig      `yaml:"api"`
-	Auth        AuthConfig     `yaml:"auth"`
-	Wallet      WalletConfig   `yaml:"wallet"`
-	Payments    PaymentsConfig `yaml:"payments"`
-	Scanning    ScanningConfig `yaml:"scanning"`
-	Logging     LoggingConfig  `yaml:"logging"`
-	Stats       UsageStats     `yaml:"stats"`
-	CA          CAConfig       `yaml:"ca"`
-	Installed   bool           `yaml:"installed"`
-	InstallDate string         `yaml:"install_date,omitempty"`
+	Version       string              `yaml:"version"`
+	Proxy         ProxyConfig         `yaml:"proxy"`
+	API           APIConfig           `yaml:"api"`
+	Auth          AuthConfig          `yaml:"auth"`
+	Wallet        WalletConfig        `yaml:"wallet"`
+	Payments      PaymentsConfig      `yaml:"payments"`
+	Scanning      ScanningConfig      `yaml:"scanning"`
+	Logging       LoggingConfig       `yaml:"logging"`
+	Quarantine    QuarantineConfig    `yaml:"quarantine"`
+	Capture       CaptureConfig       `yaml:"capture"`
+	Budget        BudgetConfig        `yaml:"budget"`
+	Upstream      UpstreamConfig      `yaml:"upstream"`
+	Stats         StatsConfig         `yaml:"stats"`
+	Rules         RulesConfig         `yaml:"rules"`
+	ICAP          ICAPConfig          `yaml:"icap"`
+	ExtAuthz      ExtAuthzConfig      `yaml:"ext_authz"`
+	Canary        CanaryConfig        `yaml:"canary"`
+	Hosts         HostsConfig         `yaml:"hosts"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	Hold          HoldConfig          `yaml:"hold"`
+	Shadow        ShadowConfig        `yaml:"shadow"`
+	CA            CAConfig            `yaml:"ca"`
+	Installed     bool                `yaml:"installed"`
+	InstallDate   string              `yaml:"install_date,omitempty"`
 }
 
 // DefaultConfig returns a default configuration
@@ -151,13 +333,104 @@ func DefaultConfig() *CLIConfig {
 				ActionOnWarn:  "warn",
 				ActionOnBlock: "block",
 			},
+			Documents: DocumentConfig{
+				Enabled: true,
+				MaxSize: DefaultDocumentMaxSize,
+			},
+			Archives: ArchiveConfig{
+				Enabled:    false,
+				MaxSize:    DefaultArchiveMaxSize,
+				MaxDepth:   DefaultArchiveMaxDepth,
+				MaxMembers: DefaultArchiveMaxMembers,
+			},
+			Batch: BatchConfig{
+				Enabled:     false,
+				WindowMs:    DefaultBatchWindowMs,
+				MaxItems:    DefaultBatchMaxItems,
+				MaxItemSize: DefaultBatchMaxItemSize,
+			},
+			Session: SessionConfig{
+				Enabled: false,
+				Deposit: DefaultSessionDeposit,
+			},
+			Breaker: BreakerConfig{
+				Enabled:          true,
+				FailureThreshold: DefaultBreakerFailureThreshold,
+				Cooldown:         DefaultBreakerCooldown,
+				MaxCooldown:      DefaultBreakerMaxCooldown,
+			},
+			LLM: LLMConfig{
+				Enabled:   true,
+				Providers: append([]string(nil), LLMProviders...),
+			},
 		},
 		Logging: LoggingConfig{
 			Level: "info",
 			File:  filepath.Join(homeDir, ".stronghold", "logs", "proxy.log"),
 		},
-		Stats: UsageStats{
-			LastReset: time.Now().Format(time.RFC3339),
+		Quarantine: QuarantineConfig{
+			Enabled:       true,
+			Dir:           filepath.Join(homeDir, ".stronghold", "quarantine"),
+			RetentionDays: DefaultQuarantineRetentionDays,
+			MaxEntries:    DefaultQuarantineMaxEntries,
+		},
+		Capture: CaptureConfig{
+			Mode:        DefaultCaptureMode,
+			Dir:         filepath.Join(homeDir, ".stronghold", "capture"),
+			MaxEntries:  DefaultCaptureMaxEntries,
+			MaxBodySize: DefaultCaptureMaxBodySize,
+		},
+		Budget: BudgetConfig{
+			DailyLimit:        DefaultBudgetDailyLimit,
+			MonthlyLimit:      DefaultBudgetMonthlyLimit,
+			PerHostDailyLimit: DefaultBudgetPerHostDailyLimit,
+			OnExceeded:        DefaultBudgetOnExceeded,
+			Ledger:            filepath.Join(homeDir, ".stronghold", "spend.json"),
+		},
+		Upstream: UpstreamConfig{
+			MaxIdlePerHost:  DefaultUpstreamMaxIdlePerHost,
+			MaxConnsPerHost: DefaultUpstreamMaxConnsPerHost,
+			IdleTimeout:     DefaultUpstreamIdleTimeout,
+			HTTP2:           true,
+		},
+		Stats: StatsConfig{
+			File:          filepath.Join(homeDir, ".stronghold", "stats.json"),
+			RetentionDays: DefaultStatsRetentionDays,
+		},
+		Rules: RulesConfig{
+			File: filepath.Join(homeDir, ".stronghold", "rules.yaml"),
+		},
+		ICAP: ICAPConfig{
+			Enabled: false,
+			Bind:    DefaultICAPBind,
+			Port:    DefaultICAPPort,
+			Preview: DefaultICAPPreview,
+		},
+		ExtAuthz: ExtAuthzConfig{
+			Enabled: false,
+			Bind:    DefaultExtAuthzBind,
+			Port:    DefaultExtAuthzPort,
+		},
+		Canary: CanaryConfig{
+			File: filepath.Join(homeDir, ".stronghold", "canaries.json"),
+		},
+		Hosts: HostsConfig{
+			File:        filepath.Join(homeDir, ".stronghold", "hosts.json"),
+			OnFirstSeen: "allow",
+		},
+		Notifications: NotificationsConfig{
+			BatchWindow: DefaultNotifyBatchWindow,
+			MaxBatch:    DefaultNotifyMaxBatch,
+			RateLimit:   DefaultNotifyRateLimit,
+			Retries:     DefaultNotifyRetries,
+		},
+		Hold: HoldConfig{
+			Dir:       filepath.Join(homeDir, ".stronghold", "holds"),
+			Timeout:   DefaultHoldTimeout,
+			OnTimeout: DefaultHoldOnTimeout,
+		},
+		Shadow: ShadowConfig{
+			File: filepath.Join(homeDir, ".stronghold", "shadow.jsonl"),
 		},
 		Installed: false,
 	}
@@ -204,6 +477,26 @@ func LoadConfig() (*CLIConfig, error) {
 	// Apply defaults for new ScanTypeConfig fields if not set
 	applyDefaultScanTypeConfig(&config.Scanning.Content)
 	applyDefaultScanTypeConfig(&config.Scanning.Output)
+	applyDefaultDocumentConfig(&config.Scanning.Documents)
+	applyDefaultArchiveConfig(&config.Scanning.Archives)
+	applyDefaultBatchConfig(&config.Scanning.Batch)
+	applyDefaultSessionConfig(&config.Scanning.Session)
+	applyDefaultBreakerConfig(&config.Scanning.Breaker)
+	applyDefaultLLMConfig(&config.Scanning.LLM)
+	applyDefaultQuarantineConfig(&config.Quarantine)
+	applyDefaultCaptureConfig(&config.Capture)
+	applyDefaultBudgetConfig(&config.Budget)
+	applyDefaultUpstreamConfig(&config.Upstream)
+	applyDefaultStatsConfig(&config.Stats)
+	applyDefaultRulesConfig(&config.Rules)
+	applyDefaultICAPConfig(&config.ICAP)
+	applyDefaultExtAuthzConfig(&config.ExtAuthz)
+	applyDefaultCanaryConfig(&config.Canary)
+	applyDefaultHostsConfig(&config.Hosts)
+	migrateHostsWebhook(&config.Hosts, &config.Notifications)
+	applyDefaultNotificationsConfig(&config.Notifications)
+	applyDefaultHoldConfig(&config.Hold)
+	applyDefaultShadowConfig(&config.Shadow)
 
 	return &config, nil
 }
@@ -219,6 +512,233 @@ func applyDefaultScanTypeConfig(cfg *ScanTypeConfig) {
 	}
 }
 
+// applyDefaultDocumentConfig sets default values for DocumentConfig if not already set
+func applyDefaultDocumentConfig(cfg *DocumentConfig) {
+	// A zero MaxSize means the config predates the documents section
+	if cfg.MaxSize == 0 {
+		cfg.Enabled = true
+		cfg.MaxSize = DefaultDocumentMaxSize
+	}
+}
+
+// applyDefaultArchiveConfig sets default values for ArchiveConfig if not already set
+func applyDefaultArchiveConfig(cfg *ArchiveConfig) {
+	// A zero MaxSize means the config predates the archives section
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = DefaultArchiveMaxSize
+		cfg.MaxDepth = DefaultArchiveMaxDepth
+		cfg.MaxMembers = DefaultArchiveMaxMembers
+	}
+}
+
+// applyDefaultBatchConfig sets default values for BatchConfig if not already set
+func applyDefaultBatchConfig(cfg *BatchConfig) {
+	// A zero MaxItems means the config predates the batch section
+	if cfg.MaxItems == 0 {
+		cfg.WindowMs = DefaultBatchWindowMs
+		cfg.MaxItems = DefaultBatchMaxItems
+		cfg.MaxItemSize = DefaultBatchMaxItemSize
+	}
+}
+
+// applyDefaultSessionConfig sets default values for SessionConfig if not already set
+func applyDefaultSessionConfig(cfg *SessionConfig) {
+	// A zero Deposit means the config predates the session section
+	if cfg.Deposit == 0 {
+		cfg.Deposit = DefaultSessionDeposit
+	}
+}
+
+// applyDefaultBreakerConfig sets default values for BreakerConfig if not already set
+func applyDefaultBreakerConfig(cfg *BreakerConfig) {
+	// A zero FailureThreshold means the config predates the breaker section
+	if cfg.FailureThreshold == 0 {
+		cfg.Enabled = true
+		cfg.FailureThreshold = DefaultBreakerFailureThreshold
+		cfg.Cooldown = DefaultBreakerCooldown
+		cfg.MaxCooldown = DefaultBreakerMaxCooldown
+	}
+}
+
+// applyDefaultLLMConfig sets default values for LLMConfig if not already set
+func applyDefaultLLMConfig(cfg *LLMConfig) {
+	// No providers means the config predates the llm section
+	if len(cfg.Providers) == 0 {
+		cfg.Enabled = true
+		cfg.Providers = append([]string(nil), LLMProviders...)
+	}
+}
+
+// applyDefaultQuarantineConfig sets default values for QuarantineConfig if not already set
+func applyDefaultQuarantineConfig(cfg *QuarantineConfig) {
+	// A zero RetentionDays means the config predates the quarantine section
+	if cfg.RetentionDays == 0 {
+		cfg.Enabled = true
+		cfg.RetentionDays = DefaultQuarantineRetentionDays
+		cfg.MaxEntries = DefaultQuarantineMaxEntries
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = filepath.Join(ConfigDir(), "quarantine")
+	}
+}
+
+// applyDefaultCaptureConfig sets default values for CaptureConfig if not already set
+func applyDefaultCaptureConfig(cfg *CaptureConfig) {
+	// A zero MaxEntries means the config predates the capture section
+	if cfg.MaxEntries == 0 {
+		cfg.Mode = DefaultCaptureMode
+		cfg.MaxEntries = DefaultCaptureMaxEntries
+		cfg.MaxBodySize = DefaultCaptureMaxBodySize
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = filepath.Join(ConfigDir(), "capture")
+	}
+}
+
+// applyDefaultBudgetConfig sets default values for BudgetConfig if not already set
+func applyDefaultBudgetConfig(cfg *BudgetConfig) {
+	// An empty OnExceeded means the config predates the budget section
+	if cfg.OnExceeded == "" {
+		cfg.DailyLimit = DefaultBudgetDailyLimit
+		cfg.MonthlyLimit = DefaultBudgetMonthlyLimit
+		cfg.PerHostDailyLimit = DefaultBudgetPerHostDailyLimit
+		cfg.OnExceeded = DefaultBudgetOnExceeded
+	}
+	if cfg.Ledger == "" {
+		cfg.Ledger = filepath.Join(ConfigDir(), "spend.json")
+	}
+}
+
+// applyDefaultUpstreamConfig sets default values for UpstreamConfig if not already set
+func applyDefaultUpstreamConfig(cfg *UpstreamConfig) {
+	// A zero MaxIdlePerHost means the config predates the upstream section
+	if cfg.MaxIdlePerHost == 0 {
+		cfg.MaxIdlePerHost = DefaultUpstreamMaxIdlePerHost
+		cfg.MaxConnsPerHost = DefaultUpstreamMaxConnsPerHost
+		cfg.IdleTimeout = DefaultUpstreamIdleTimeout
+		cfg.HTTP2 = true
+	}
+}
+
+// applyDefaultStatsConfig sets default values for StatsConfig if not already set
+func applyDefaultStatsConfig(cfg *StatsConfig) {
+	// A zero RetentionDays means the config predates the stats section
+	if cfg.RetentionDays == 0 {
+		cfg.RetentionDays = DefaultStatsRetentionDays
+	}
+	if cfg.File == "" {
+		cfg.File = filepath.Join(ConfigDir(), "stats.json")
+	}
+}
+
+// applyDefaultRulesConfig sets default values for RulesConfig if not already set
+func applyDefaultRulesConfig(cfg *RulesConfig) {
+	if cfg.File == "" {
+		cfg.File = filepath.Join(ConfigDir(), "rules.yaml")
+	}
+}
+
+// applyDefaultICAPConfig sets default values for ICAPConfig if not already set
+func applyDefaultICAPConfig(cfg *ICAPConfig) {
+	// A zero Port means the config predates the icap section
+	if cfg.Port == 0 {
+		cfg.Port = DefaultICAPPort
+		cfg.Preview = DefaultICAPPreview
+	}
+	if cfg.Bind == "" {
+		cfg.Bind = DefaultICAPBind
+	}
+}
+
+// applyDefaultExtAuthzConfig sets default values for ExtAuthzConfig if not already set
+func applyDefaultExtAuthzConfig(cfg *ExtAuthzConfig) {
+	// A zero Port means the config predates the ext_authz section
+	if cfg.Port == 0 {
+		cfg.Port = DefaultExtAuthzPort
+	}
+	if cfg.Bind == "" {
+		cfg.Bind = DefaultExtAuthzBind
+	}
+}
+
+// applyDefaultCanaryConfig sets default values for CanaryConfig if not already set
+func applyDefaultCanaryConfig(cfg *CanaryConfig) {
+	if cfg.File == "" {
+		cfg.File = filepath.Join(ConfigDir(), "canaries.json")
+	}
+}
+
+// applyDefaultHostsConfig sets default values for HostsConfig if not already set
+func applyDefaultHostsConfig(cfg *HostsConfig) {
+	if cfg.File == "" {
+		cfg.File = filepath.Join(ConfigDir(), "hosts.json")
+	}
+	if cfg.OnFirstSeen == "" {
+		cfg.OnFirstSeen = "allow"
+	}
+}
+
+// migrateHostsWebhook moves the hosts.webhook of an older config to a
+// notification target subscribed to new_host, as the proxy does on load,
+// so the next save drops the old key
+func migrateHostsWebhook(hosts *HostsConfig, notifications *NotificationsConfig) {
+	if hosts.Webhook == "" {
+		return
+	}
+	target := NotifyTarget{
+		Name:   HostsWebhookTarget,
+		URL:    hosts.Webhook,
+		Format: "json",
+		Events: []string{"new_host"},
+	}
+	hosts.Webhook = ""
+	for _, t := range notifications.Targets {
+		if t.Name == target.Name {
+			return
+		}
+	}
+	if len(notifications.Targets) == 0 {
+		notifications.Enabled = true
+	}
+	notifications.Targets = append(notifications.Targets, target)
+}
+
+// applyDefaultNotificationsConfig sets default values for NotificationsConfig if not already set
+func applyDefaultNotificationsConfig(cfg *NotificationsConfig) {
+	if cfg.BatchWindow == 0 {
+		cfg.BatchWindow = DefaultNotifyBatchWindow
+	}
+	if cfg.MaxBatch == 0 {
+		cfg.MaxBatch = DefaultNotifyMaxBatch
+	}
+	if cfg.RateLimit == 0 {
+		cfg.RateLimit = DefaultNotifyRateLimit
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = DefaultNotifyRetries
+	}
+}
+
+// applyDefaultHoldConfig sets default values for HoldConfig if not already set
+func applyDefaultHoldConfig(cfg *HoldConfig) {
+	if cfg.Dir == "" {
+		cfg.Dir = filepath.Join(ConfigDir(), "holds")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultHoldTimeout
+	}
+	if cfg.OnTimeout == "" {
+		cfg.OnTimeout = DefaultHoldOnTimeout
+	}
+}
+
+// applyDefaultShadowConfig sets default values for ShadowConfig if not already set
+func applyDefaultShadowConfig(cfg *ShadowConfig) {
+	if cfg.File == "" {
+		cfg.File = filepath.Join(ConfigDir(), "shadow.jsonl")
+	}
+}
+
 // Save saves the configuration to disk
 func (c *CLIConfig) Save() error {
 	configDir := ConfigDir()
@@ -263,20 +783,6 @@ func (c *CLIConfig) IsPortAvailable() bool {
 	return IsPortAvailable(addr)
 }
 
-// ResetDailyStats resets daily statistics if needed
-func (c *CLIConfig) ResetDailyStats() {
-	lastReset, _ := time.Parse(time.RFC3339, c.Stats.LastReset)
-	now := time.Now()
-
-	if lastReset.Day() != now.Day() || lastReset.Month() != now.Month() || lastReset.Year() != now.Year() {
-		c.Stats.RequestsToday = 0
-		c.Stats.BlockedToday = 0
-		c.Stats.WarnedToday = 0
-		c.Stats.CostToday = 0
-		c.Stats.LastReset = now.Format(time.RFC3339)
-	}
-}
-
 // Platform returns the current platform
 func Platform() string {
 	return runtime.GOOS
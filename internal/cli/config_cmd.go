@@ -2,10 +2,14 @@ package cli
 
 import (
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"stronghold/internal/pii"
 )
 
 // ConfigGet retrieves a configuration value by key using dot notation
@@ -44,6 +48,80 @@ func ConfigGet(key string) error {
 		fmt.Printf("enabled: %v\n", v.Enabled)
 		fmt.Printf("action_on_warn: %s\n", v.ActionOnWarn)
 		fmt.Printf("action_on_block: %s\n", v.ActionOnBlock)
+		fmt.Printf("shadow: %v\n", v.Shadow)
+	case DocumentConfig:
+		fmt.Printf("enabled: %v\n", v.Enabled)
+		fmt.Printf("max_size: %d\n", v.MaxSize)
+	case QuarantineConfig:
+		fmt.Printf("enabled: %v\n", v.Enabled)
+		fmt.Printf("dir: %s\n", v.Dir)
+		fmt.Printf("retention_days: %d\n", v.RetentionDays)
+		fmt.Printf("max_entries: %d\n", v.MaxEntries)
+	case CaptureConfig:
+		fmt.Printf("mode: %s\n", v.Mode)
+		fmt.Printf("dir: %s\n", v.Dir)
+		fmt.Printf("max_entries: %d\n", v.MaxEntries)
+		fmt.Printf("max_body_size: %d\n", v.MaxBodySize)
+	case BudgetConfig:
+		fmt.Printf("daily_limit: %.2f\n", v.DailyLimit)
+		fmt.Printf("monthly_limit: %.2f\n", v.MonthlyLimit)
+		fmt.Printf("per_host_daily_limit: %.2f\n", v.PerHostDailyLimit)
+		fmt.Printf("on_exceeded: %s\n", v.OnExceeded)
+		fmt.Printf("ledger: %s\n", v.Ledger)
+	case UpstreamConfig:
+		fmt.Printf("max_idle_per_host: %d\n", v.MaxIdlePerHost)
+		fmt.Printf("max_conns_per_host: %d\n", v.MaxConnsPerHost)
+		fmt.Printf("idle_timeout: %s\n", v.IdleTimeout)
+		fmt.Printf("http2: %v\n", v.HTTP2)
+	case StatsConfig:
+		fmt.Printf("file: %s\n", v.File)
+		fmt.Printf("retention_days: %d\n", v.RetentionDays)
+	case RulesConfig:
+		fmt.Printf("file: %s\n", v.File)
+	case ICAPConfig:
+		fmt.Printf("enabled: %v\n", v.Enabled)
+		fmt.Printf("bind: %s\n", v.Bind)
+		fmt.Printf("port: %d\n", v.Port)
+		fmt.Printf("preview: %d\n", v.Preview)
+		fmt.Printf("sanitize: %v\n", v.Sanitize)
+	case ExtAuthzConfig:
+		fmt.Printf("enabled: %v\n", v.Enabled)
+		fmt.Printf("bind: %s\n", v.Bind)
+		fmt.Printf("port: %d\n", v.Port)
+		fmt.Printf("path_prefix: %s\n", v.PathPrefix)
+	case CanaryConfig:
+		fmt.Printf("file: %s\n", v.File)
+	case HostsConfig:
+		fmt.Printf("file: %s\n", v.File)
+		fmt.Printf("on_first_seen: %s\n", v.OnFirstSeen)
+	case NotificationsConfig:
+		fmt.Printf("enabled: %v\n", v.Enabled)
+		fmt.Printf("batch_window: %s\n", v.BatchWindow)
+		fmt.Printf("max_batch: %d\n", v.MaxBatch)
+		fmt.Printf("rate_limit: %d\n", v.RateLimit)
+		fmt.Printf("retries: %d\n", v.Retries)
+		fmt.Printf("targets: %d (see 'stronghold notify list')\n", len(v.Targets))
+	case HoldConfig:
+		fmt.Printf("dir: %s\n", v.Dir)
+		fmt.Printf("timeout: %s\n", v.Timeout)
+		fmt.Printf("on_timeout: %s\n", v.OnTimeout)
+		fmt.Printf("api_token: %s\n", tokenStatus(v.APIToken))
+	case ShadowConfig:
+		fmt.Printf("enabled: %v\n", v.Enabled)
+		fmt.Printf("file: %s\n", v.File)
+	case ArchiveConfig:
+		fmt.Printf("enabled: %v\n", v.Enabled)
+		fmt.Printf("max_size: %d\n", v.MaxSize)
+		fmt.Printf("max_depth: %d\n", v.MaxDepth)
+		fmt.Printf("max_members: %d\n", v.MaxMembers)
+	case BatchConfig:
+		fmt.Printf("enabled: %v\n", v.Enabled)
+		fmt.Printf("window_ms: %d\n", v.WindowMs)
+		fmt.Printf("max_items: %d\n", v.MaxItems)
+		fmt.Printf("max_item_size: %d\n", v.MaxItemSize)
+	case SessionConfig:
+		fmt.Printf("enabled: %v\n", v.Enabled)
+		fmt.Printf("deposit: %.2f\n", v.Deposit)
 	case ScanningConfig:
 		fmt.Printf("mode: %s\n", v.Mode)
 		fmt.Printf("block_threshold: %.2f\n", v.BlockThreshold)
@@ -52,10 +130,44 @@ func ConfigGet(key string) error {
 		fmt.Printf("  enabled: %v\n", v.Content.Enabled)
 		fmt.Printf("  action_on_warn: %s\n", v.Content.ActionOnWarn)
 		fmt.Printf("  action_on_block: %s\n", v.Content.ActionOnBlock)
+		fmt.Printf("  shadow: %v\n", v.Content.Shadow)
 		fmt.Println("output:")
 		fmt.Printf("  enabled: %v\n", v.Output.Enabled)
 		fmt.Printf("  action_on_warn: %s\n", v.Output.ActionOnWarn)
 		fmt.Printf("  action_on_block: %s\n", v.Output.ActionOnBlock)
+		fmt.Printf("  shadow: %v\n", v.Output.Shadow)
+		fmt.Println("documents:")
+		fmt.Printf("  enabled: %v\n", v.Documents.Enabled)
+		fmt.Printf("  max_size: %d\n", v.Documents.MaxSize)
+		fmt.Println("archives:")
+		fmt.Printf("  enabled: %v\n", v.Archives.Enabled)
+		fmt.Printf("  max_size: %d\n", v.Archives.MaxSize)
+		fmt.Printf("  max_depth: %d\n", v.Archives.MaxDepth)
+		fmt.Printf("  max_members: %d\n", v.Archives.MaxMembers)
+		fmt.Println("batch:")
+		fmt.Printf("  enabled: %v\n", v.Batch.Enabled)
+		fmt.Printf("  window_ms: %d\n", v.Batch.WindowMs)
+		fmt.Printf("  max_items: %d\n", v.Batch.MaxItems)
+		fmt.Printf("  max_item_size: %d\n", v.Batch.MaxItemSize)
+		fmt.Println("session:")
+		fmt.Printf("  enabled: %v\n", v.Session.Enabled)
+		fmt.Printf("  deposit: %.2f\n", v.Session.Deposit)
+		fmt.Println("breaker:")
+		fmt.Printf("  enabled: %v\n", v.Breaker.Enabled)
+		fmt.Printf("  failure_threshold: %d\n", v.Breaker.FailureThreshold)
+		fmt.Printf("  cooldown: %s\n", v.Breaker.Cooldown)
+		fmt.Printf("  max_cooldown: %s\n", v.Breaker.MaxCooldown)
+		fmt.Println("llm:")
+		fmt.Printf("  enabled: %v\n", v.LLM.Enabled)
+		fmt.Printf("  providers: %s\n", strings.Join(v.LLM.Providers, ","))
+		fmt.Println("json:")
+		fmt.Printf("  sanitize: %v\n", v.JSON.Sanitize)
+		fmt.Println("pii:")
+		fmt.Printf("  enabled: %v\n", v.PII.Enabled)
+		for _, category := range pii.Categories {
+			action, _ := getPIIValue(&v.PII, []string{category})
+			fmt.Printf("  %s: %s\n", category, action)
+		}
 	default:
 		fmt.Printf("%v\n", v)
 	}
@@ -107,6 +219,71 @@ func getConfigValue(config *CLIConfig, key string) (interface{}, error) {
 			return config.Logging, nil
 		}
 		return getLoggingValue(&config.Logging, parts[1:])
+	case "quarantine":
+		if len(parts) == 1 {
+			return config.Quarantine, nil
+		}
+		return getQuarantineValue(&config.Quarantine, parts[1:])
+	case "capture":
+		if len(parts) == 1 {
+			return config.Capture, nil
+		}
+		return getCaptureValue(&config.Capture, parts[1:])
+	case "budget":
+		if len(parts) == 1 {
+			return config.Budget, nil
+		}
+		return getBudgetValue(&config.Budget, parts[1:])
+	case "upstream":
+		if len(parts) == 1 {
+			return config.Upstream, nil
+		}
+		return getUpstreamValue(&config.Upstream, parts[1:])
+	case "stats":
+		if len(parts) == 1 {
+			return config.Stats, nil
+		}
+		return getStatsValue(&config.Stats, parts[1:])
+	case "rules":
+		if len(parts) == 1 {
+			return config.Rules, nil
+		}
+		return getRulesValue(&config.Rules, parts[1:])
+	case "icap":
+		if len(parts) == 1 {
+			return config.ICAP, nil
+		}
+		return getICAPValue(&config.ICAP, parts[1:])
+	case "ext_authz":
+		if len(parts) == 1 {
+			return config.ExtAuthz, nil
+		}
+		return getExtAuthzValue(&config.ExtAuthz, parts[1:])
+	case "canary":
+		if len(parts) == 1 {
+			return config.Canary, nil
+		}
+		return getCanaryValue(&config.Canary, parts[1:])
+	case "hosts":
+		if len(parts) == 1 {
+			return config.Hosts, nil
+		}
+		return getHostsValue(&config.Hosts, parts[1:])
+	case "notifications":
+		if len(parts) == 1 {
+			return config.Notifications, nil
+		}
+		return getNotificationsValue(&config.Notifications, parts[1:])
+	case "hold":
+		if len(parts) == 1 {
+			return config.Hold, nil
+		}
+		return getHoldValue(&config.Hold, parts[1:])
+	case "shadow":
+		if len(parts) == 1 {
+			return config.Shadow, nil
+		}
+		return getShadowValue(&config.Shadow, parts[1:])
 	default:
 		return nil, fmt.Errorf("unknown config key: %s", key)
 	}
@@ -134,11 +311,77 @@ func getScanningValue(scanning *ScanningConfig, parts []string) (interface{}, er
 			return scanning.Output, nil
 		}
 		return getScanTypeValue(&scanning.Output, parts[1:])
+	case "documents":
+		if len(parts) == 1 {
+			return scanning.Documents, nil
+		}
+		return getDocumentValue(&scanning.Documents, parts[1:])
+	case "archives":
+		if len(parts) == 1 {
+			return scanning.Archives, nil
+		}
+		return getArchiveValue(&scanning.Archives, parts[1:])
+	case "batch":
+		if len(parts) == 1 {
+			return scanning.Batch, nil
+		}
+		return getBatchValue(&scanning.Batch, parts[1:])
+	case "session":
+		if len(parts) == 1 {
+			return scanning.Session, nil
+		}
+		return getSessionValue(&scanning.Session, parts[1:])
+	case "breaker":
+		if len(parts) == 1 {
+			return scanning.Breaker, nil
+		}
+		return getBreakerValue(&scanning.Breaker, parts[1:])
+	case "llm":
+		if len(parts) == 1 {
+			return scanning.LLM, nil
+		}
+		return getLLMValue(&scanning.LLM, parts[1:])
+	case "json":
+		if len(parts) == 1 {
+			return scanning.JSON, nil
+		}
+		return getJSONValue(&scanning.JSON, parts[1:])
+	case "pii":
+		if len(parts) == 1 {
+			return scanning.PII, nil
+		}
+		return getPIIValue(&scanning.PII, parts[1:])
 	default:
 		return nil, fmt.Errorf("unknown scanning key: %s", parts[0])
 	}
 }
 
+func getDocumentValue(documents *DocumentConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return documents.Enabled, nil
+	case "max_size":
+		return documents.MaxSize, nil
+	default:
+		return nil, fmt.Errorf("unknown documents key: %s", parts[0])
+	}
+}
+
+func getArchiveValue(archives *ArchiveConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return archives.Enabled, nil
+	case "max_size":
+		return archives.MaxSize, nil
+	case "max_depth":
+		return archives.MaxDepth, nil
+	case "max_members":
+		return archives.MaxMembers, nil
+	default:
+		return nil, fmt.Errorf("unknown archives key: %s", parts[0])
+	}
+}
+
 func getScanTypeValue(scanType *ScanTypeConfig, parts []string) (interface{}, error) {
 	if len(parts) == 0 {
 		return *scanType, nil
@@ -151,6 +394,8 @@ func getScanTypeValue(scanType *ScanTypeConfig, parts []string) (interface{}, er
 		return scanType.ActionOnWarn, nil
 	case "action_on_block":
 		return scanType.ActionOnBlock, nil
+	case "shadow":
+		return scanType.Shadow, nil
 	default:
 		return nil, fmt.Errorf("unknown scan type key: %s", parts[0])
 	}
@@ -226,6 +471,71 @@ func setConfigValue(config *CLIConfig, key, value string) error {
 			return fmt.Errorf("cannot set entire logging section, specify a sub-key")
 		}
 		return setLoggingValue(&config.Logging, parts[1:], value)
+	case "quarantine":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire quarantine section, specify a sub-key")
+		}
+		return setQuarantineValue(&config.Quarantine, parts[1:], value)
+	case "capture":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire capture section, specify a sub-key")
+		}
+		return setCaptureValue(&config.Capture, parts[1:], value)
+	case "budget":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire budget section, specify a sub-key")
+		}
+		return setBudgetValue(&config.Budget, parts[1:], value)
+	case "upstream":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire upstream section, specify a sub-key")
+		}
+		return setUpstreamValue(&config.Upstream, parts[1:], value)
+	case "stats":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire stats section, specify a sub-key")
+		}
+		return setStatsValue(&config.Stats, parts[1:], value)
+	case "rules":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire rules section, specify a sub-key")
+		}
+		return setRulesValue(&config.Rules, parts[1:], value)
+	case "icap":
+		if len(parts) == 1 {
+			return fmt.Errorf("cannot set entire icap section, specify a sub-key")
+		}
+		return setICAPValue(&config.ICAP, parts[1:], value)
+	case "ext_authz":
+		if len(parts) == 1 {
+			return fmt.Errorf("cannot set entire ext_authz section, specify a sub-key")
+		}
+		return setExtAuthzValue(&config.ExtAuthz, parts[1:], value)
+	case "canary":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire canary section, specify a sub-key")
+		}
+		return setCanaryValue(&config.Canary, parts[1:], value)
+	case "hosts":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire hosts section, specify a sub-key")
+		}
+		return setHostsValue(&config.Hosts, parts[1:], value)
+	case "notifications":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire notifications section, specify a sub-key")
+		}
+		return setNotificationsValue(&config.Notifications, parts[1:], value)
+	case "hold":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire hold section, specify a sub-key")
+		}
+		return setHoldValue(&config.Hold, parts[1:], value)
+	case "shadow":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire shadow section, specify a sub-key")
+		}
+		return setShadowValue(&config.Shadow, parts[1:], value)
 	default:
 		return fmt.Errorf("unknown config key: %s", key)
 	}
@@ -259,14 +569,54 @@ func setScanningValue(scanning *ScanningConfig, parts []string, value string) er
 		scanning.FailOpen = b
 	case "content":
 		if len(parts) < 2 {
-			return fmt.Errorf("cannot set entire content section, specify a sub-key (enabled, action_on_warn, action_on_block)")
+			return fmt.Errorf("cannot set entire content section, specify a sub-key (enabled, action_on_warn, action_on_block, shadow)")
 		}
 		return setScanTypeValue(&scanning.Content, parts[1:], value)
 	case "output":
 		if len(parts) < 2 {
-			return fmt.Errorf("cannot set entire output section, specify a sub-key (enabled, action_on_warn, action_on_block)")
+			return fmt.Errorf("cannot set entire output section, specify a sub-key (enabled, action_on_warn, action_on_block, shadow)")
 		}
 		return setScanTypeValue(&scanning.Output, parts[1:], value)
+	case "documents":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire documents section, specify a sub-key (enabled, max_size)")
+		}
+		return setDocumentValue(&scanning.Documents, parts[1:], value)
+	case "archives":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire archives section, specify a sub-key (enabled, max_size, max_depth, max_members)")
+		}
+		return setArchiveValue(&scanning.Archives, parts[1:], value)
+	case "batch":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire batch section, specify a sub-key (enabled, window_ms, max_items, max_item_size)")
+		}
+		return setBatchValue(&scanning.Batch, parts[1:], value)
+	case "session":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire session section, specify a sub-key (enabled, deposit)")
+		}
+		return setSessionValue(&scanning.Session, parts[1:], value)
+	case "breaker":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire breaker section, specify a sub-key (enabled, failure_threshold, cooldown, max_cooldown)")
+		}
+		return setBreakerValue(&scanning.Breaker, parts[1:], value)
+	case "llm":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire llm section, specify a sub-key (enabled, providers)")
+		}
+		return setLLMValue(&scanning.LLM, parts[1:], value)
+	case "json":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire json section, specify a sub-key (sanitize)")
+		}
+		return setJSONValue(&scanning.JSON, parts[1:], value)
+	case "pii":
+		if len(parts) < 2 {
+			return fmt.Errorf("cannot set entire pii section, specify a sub-key (enabled or a category)")
+		}
+		return setPIIValue(&scanning.PII, parts[1:], value)
 	default:
 		return fmt.Errorf("unknown scanning key: %s", parts[0])
 	}
@@ -274,6 +624,60 @@ func setScanningValue(scanning *ScanningConfig, parts []string, value string) er
 	return nil
 }
 
+func setDocumentValue(documents *DocumentConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		documents.Enabled = b
+	case "max_size":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid max_size: %s (must be a positive number of bytes)", value)
+		}
+		documents.MaxSize = n
+	default:
+		return fmt.Errorf("unknown documents key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func setArchiveValue(archives *ArchiveConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		archives.Enabled = b
+	case "max_size":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid max_size: %s (must be a positive number of bytes)", value)
+		}
+		archives.MaxSize = n
+	case "max_depth":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid max_depth: %s (must be 0 or more)", value)
+		}
+		archives.MaxDepth = n
+	case "max_members":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid max_members: %s (must be a positive number)", value)
+		}
+		archives.MaxMembers = n
+	default:
+		return fmt.Errorf("unknown archives key: %s", parts[0])
+	}
+
+	return nil
+}
+
 func setScanTypeValue(scanType *ScanTypeConfig, parts []string, value string) error {
 	if len(parts) == 0 {
 		return fmt.Errorf("missing scan type sub-key")
@@ -287,8 +691,8 @@ func setScanTypeValue(scanType *ScanTypeConfig, parts []string, value string) er
 		}
 		scanType.Enabled = b
 	case "action_on_warn":
-		if value != "allow" && value != "warn" && value != "block" {
-			return fmt.Errorf("invalid action_on_warn: %s (must be allow, warn, or block)", value)
+		if value != "allow" && value != "warn" && value != "block" && value != "hold" {
+			return fmt.Errorf("invalid action_on_warn: %s (must be allow, warn, block, or hold)", value)
 		}
 		scanType.ActionOnWarn = value
 	case "action_on_block":
@@ -296,6 +700,12 @@ func setScanTypeValue(scanType *ScanTypeConfig, parts []string, value string) er
 			return fmt.Errorf("invalid action_on_block: %s (must be allow, warn, or block)", value)
 		}
 		scanType.ActionOnBlock = value
+	case "shadow":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid shadow: %s (must be true or false)", value)
+		}
+		scanType.Shadow = b
 	default:
 		return fmt.Errorf("unknown scan type key: %s", parts[0])
 	}
@@ -361,3 +771,755 @@ func setLoggingValue(logging *LoggingConfig, parts []string, value string) error
 
 	return nil
 }
+
+func getQuarantineValue(quarantine *QuarantineConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return quarantine.Enabled, nil
+	case "dir":
+		return quarantine.Dir, nil
+	case "retention_days":
+		return quarantine.RetentionDays, nil
+	case "max_entries":
+		return quarantine.MaxEntries, nil
+	default:
+		return nil, fmt.Errorf("unknown quarantine key: %s", parts[0])
+	}
+}
+
+func setQuarantineValue(quarantine *QuarantineConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		quarantine.Enabled = b
+	case "dir":
+		quarantine.Dir = value
+	case "retention_days":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid retention_days: %s (must be a positive number of days)", value)
+		}
+		quarantine.RetentionDays = n
+	case "max_entries":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid max_entries: %s (must be a positive number)", value)
+		}
+		quarantine.MaxEntries = n
+	default:
+		return fmt.Errorf("unknown quarantine key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getCaptureValue(capture *CaptureConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "mode":
+		return capture.Mode, nil
+	case "dir":
+		return capture.Dir, nil
+	case "max_entries":
+		return capture.MaxEntries, nil
+	case "max_body_size":
+		return capture.MaxBodySize, nil
+	default:
+		return nil, fmt.Errorf("unknown capture key: %s", parts[0])
+	}
+}
+
+func setCaptureValue(capture *CaptureConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "mode":
+		if value != "off" && value != "flagged" && value != "all" {
+			return fmt.Errorf("invalid mode: %s (must be off, flagged, or all)", value)
+		}
+		capture.Mode = value
+	case "dir":
+		capture.Dir = value
+	case "max_entries":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid max_entries: %s (must be a positive number)", value)
+		}
+		capture.MaxEntries = n
+	case "max_body_size":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid max_body_size: %s (must be a number of bytes)", value)
+		}
+		capture.MaxBodySize = n
+	default:
+		return fmt.Errorf("unknown capture key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getBudgetValue(budget *BudgetConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "daily_limit":
+		return budget.DailyLimit, nil
+	case "monthly_limit":
+		return budget.MonthlyLimit, nil
+	case "per_host_daily_limit":
+		return budget.PerHostDailyLimit, nil
+	case "on_exceeded":
+		return budget.OnExceeded, nil
+	case "ledger":
+		return budget.Ledger, nil
+	default:
+		return nil, fmt.Errorf("unknown budget key: %s", parts[0])
+	}
+}
+
+func setBudgetValue(budget *BudgetConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "daily_limit", "monthly_limit", "per_host_daily_limit":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 {
+			return fmt.Errorf("invalid %s: %s (must be a USDC amount, 0 for no limit)", parts[0], value)
+		}
+		switch parts[0] {
+		case "daily_limit":
+			budget.DailyLimit = f
+		case "monthly_limit":
+			budget.MonthlyLimit = f
+		default:
+			budget.PerHostDailyLimit = f
+		}
+	case "on_exceeded":
+		if value != "local" && value != "fail_open" && value != "fail_closed" {
+			return fmt.Errorf("invalid on_exceeded: %s (must be local, fail_open, or fail_closed)", value)
+		}
+		budget.OnExceeded = value
+	case "ledger":
+		budget.Ledger = value
+	default:
+		return fmt.Errorf("unknown budget key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getBatchValue(batch *BatchConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return batch.Enabled, nil
+	case "window_ms":
+		return batch.WindowMs, nil
+	case "max_items":
+		return batch.MaxItems, nil
+	case "max_item_size":
+		return batch.MaxItemSize, nil
+	default:
+		return nil, fmt.Errorf("unknown batch key: %s", parts[0])
+	}
+}
+
+func setBatchValue(batch *BatchConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		batch.Enabled = b
+	case "window_ms":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 1000 {
+			return fmt.Errorf("invalid window_ms: %s (must be between 1 and 1000)", value)
+		}
+		batch.WindowMs = n
+	case "max_items":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 2 || n > 32 {
+			return fmt.Errorf("invalid max_items: %s (must be between 2 and 32)", value)
+		}
+		batch.MaxItems = n
+	case "max_item_size":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 500*1024 {
+			return fmt.Errorf("invalid max_item_size: %s (must be a positive number of bytes, at most 512000)", value)
+		}
+		batch.MaxItemSize = n
+	default:
+		return fmt.Errorf("unknown batch key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getSessionValue(session *SessionConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return session.Enabled, nil
+	case "deposit":
+		return session.Deposit, nil
+	default:
+		return nil, fmt.Errorf("unknown session key: %s", parts[0])
+	}
+}
+
+func setSessionValue(session *SessionConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		session.Enabled = b
+	case "deposit":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0.01 || f > 10 {
+			return fmt.Errorf("invalid deposit: %s (must be between 0.01 and 10 USDC)", value)
+		}
+		session.Deposit = f
+	default:
+		return fmt.Errorf("unknown session key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getBreakerValue(breaker *BreakerConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return breaker.Enabled, nil
+	case "failure_threshold":
+		return breaker.FailureThreshold, nil
+	case "cooldown":
+		return breaker.Cooldown.String(), nil
+	case "max_cooldown":
+		return breaker.MaxCooldown.String(), nil
+	default:
+		return nil, fmt.Errorf("unknown breaker key: %s", parts[0])
+	}
+}
+
+func setBreakerValue(breaker *BreakerConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		breaker.Enabled = b
+	case "failure_threshold":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 100 {
+			return fmt.Errorf("invalid failure_threshold: %s (must be between 1 and 100)", value)
+		}
+		breaker.FailureThreshold = n
+	case "cooldown":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid cooldown: %s (must be a positive duration such as 10s)", value)
+		}
+		breaker.Cooldown = d
+	case "max_cooldown":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid max_cooldown: %s (must be a positive duration such as 5m)", value)
+		}
+		breaker.MaxCooldown = d
+	default:
+		return fmt.Errorf("unknown breaker key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getUpstreamValue(upstream *UpstreamConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "max_idle_per_host":
+		return upstream.MaxIdlePerHost, nil
+	case "max_conns_per_host":
+		return upstream.MaxConnsPerHost, nil
+	case "idle_timeout":
+		return upstream.IdleTimeout.String(), nil
+	case "http2":
+		return upstream.HTTP2, nil
+	default:
+		return nil, fmt.Errorf("unknown upstream key: %s", parts[0])
+	}
+}
+
+func setUpstreamValue(upstream *UpstreamConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "max_idle_per_host":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 1000 {
+			return fmt.Errorf("invalid max_idle_per_host: %s (must be between 1 and 1000)", value)
+		}
+		upstream.MaxIdlePerHost = n
+	case "max_conns_per_host":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid max_conns_per_host: %s (must be a non-negative integer, 0 for no limit)", value)
+		}
+		upstream.MaxConnsPerHost = n
+	case "idle_timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid idle_timeout: %s (must be a positive duration such as 90s)", value)
+		}
+		upstream.IdleTimeout = d
+	case "http2":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid http2: %s (must be true or false)", value)
+		}
+		upstream.HTTP2 = b
+	default:
+		return fmt.Errorf("unknown upstream key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getStatsValue(stats *StatsConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "file":
+		return stats.File, nil
+	case "retention_days":
+		return stats.RetentionDays, nil
+	default:
+		return nil, fmt.Errorf("unknown stats key: %s", parts[0])
+	}
+}
+
+func setStatsValue(stats *StatsConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "file":
+		stats.File = value
+	case "retention_days":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 3650 {
+			return fmt.Errorf("invalid retention_days: %s (must be between 1 and 3650)", value)
+		}
+		stats.RetentionDays = n
+	default:
+		return fmt.Errorf("unknown stats key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getRulesValue(rules *RulesConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "file":
+		return rules.File, nil
+	default:
+		return nil, fmt.Errorf("unknown rules key: %s", parts[0])
+	}
+}
+
+func setRulesValue(rules *RulesConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "file":
+		rules.File = value
+	default:
+		return fmt.Errorf("unknown rules key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getICAPValue(icap *ICAPConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return icap.Enabled, nil
+	case "bind":
+		return icap.Bind, nil
+	case "port":
+		return icap.Port, nil
+	case "preview":
+		return icap.Preview, nil
+	case "sanitize":
+		return icap.Sanitize, nil
+	default:
+		return nil, fmt.Errorf("unknown icap key: %s", parts[0])
+	}
+}
+
+func setICAPValue(icap *ICAPConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		icap.Enabled = b
+	case "bind":
+		icap.Bind = value
+	case "port":
+		p, err := strconv.Atoi(value)
+		if err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port: %s (must be between 1 and 65535)", value)
+		}
+		icap.Port = p
+	case "preview":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 65536 {
+			return fmt.Errorf("invalid preview: %s (must be between 0 and 65536 bytes)", value)
+		}
+		icap.Preview = n
+	case "sanitize":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid sanitize: %s (must be true or false)", value)
+		}
+		icap.Sanitize = b
+	default:
+		return fmt.Errorf("unknown icap key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getExtAuthzValue(extAuthz *ExtAuthzConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return extAuthz.Enabled, nil
+	case "bind":
+		return extAuthz.Bind, nil
+	case "port":
+		return extAuthz.Port, nil
+	case "path_prefix":
+		return extAuthz.PathPrefix, nil
+	default:
+		return nil, fmt.Errorf("unknown ext_authz key: %s", parts[0])
+	}
+}
+
+func setExtAuthzValue(extAuthz *ExtAuthzConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		extAuthz.Enabled = b
+	case "bind":
+		extAuthz.Bind = value
+	case "port":
+		p, err := strconv.Atoi(value)
+		if err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port: %s (must be between 1 and 65535)", value)
+		}
+		extAuthz.Port = p
+	case "path_prefix":
+		if value != "" && !strings.HasPrefix(value, "/") {
+			return fmt.Errorf("invalid path_prefix: %s (must start with /)", value)
+		}
+		extAuthz.PathPrefix = value
+	default:
+		return fmt.Errorf("unknown ext_authz key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getLLMValue(llm *LLMConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return llm.Enabled, nil
+	case "providers":
+		return strings.Join(llm.Providers, ","), nil
+	default:
+		return nil, fmt.Errorf("unknown llm key: %s", parts[0])
+	}
+}
+
+func setLLMValue(llm *LLMConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		llm.Enabled = b
+	case "providers":
+		var providers []string
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if !slices.Contains(LLMProviders, name) {
+				return fmt.Errorf("invalid providers: %s (must be a comma-separated list of %s)", value, strings.Join(LLMProviders, ", "))
+			}
+			if !slices.Contains(providers, name) {
+				providers = append(providers, name)
+			}
+		}
+		llm.Providers = providers
+	default:
+		return fmt.Errorf("unknown llm key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getJSONValue(jsonCfg *JSONConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "sanitize":
+		return jsonCfg.Sanitize, nil
+	default:
+		return nil, fmt.Errorf("unknown json key: %s", parts[0])
+	}
+}
+
+func setJSONValue(jsonCfg *JSONConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "sanitize":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid sanitize: %s (must be true or false)", value)
+		}
+		jsonCfg.Sanitize = b
+	default:
+		return fmt.Errorf("unknown json key: %s", parts[0])
+	}
+
+	return nil
+}
+
+// piiActions returns the action field of each PII category
+func piiActions(piiCfg *PIIConfig) map[string]*string {
+	return map[string]*string{
+		pii.Email:      &piiCfg.Email,
+		pii.Phone:      &piiCfg.Phone,
+		pii.NationalID: &piiCfg.NationalID,
+		pii.Card:       &piiCfg.Card,
+		pii.IBAN:       &piiCfg.IBAN,
+		pii.Address:    &piiCfg.Address,
+	}
+}
+
+func getPIIValue(piiCfg *PIIConfig, parts []string) (interface{}, error) {
+	if parts[0] == "enabled" {
+		return piiCfg.Enabled, nil
+	}
+	action, ok := piiActions(piiCfg)[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown pii key: %s", parts[0])
+	}
+	if *action == "" {
+		// Unset categories follow the default policy
+		return pii.DefaultPolicy().Action(parts[0]), nil
+	}
+	return *action, nil
+}
+
+func setPIIValue(piiCfg *PIIConfig, parts []string, value string) error {
+	if parts[0] == "enabled" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		piiCfg.Enabled = b
+		return nil
+	}
+	action, ok := piiActions(piiCfg)[parts[0]]
+	if !ok {
+		return fmt.Errorf("unknown pii key: %s", parts[0])
+	}
+	if err := (pii.Policy{parts[0]: value}).Validate(); err != nil {
+		return err
+	}
+	*action = value
+	return nil
+}
+
+func getCanaryValue(canary *CanaryConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "file":
+		return canary.File, nil
+	default:
+		return nil, fmt.Errorf("unknown canary key: %s", parts[0])
+	}
+}
+
+func setCanaryValue(canary *CanaryConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "file":
+		canary.File = value
+	default:
+		return fmt.Errorf("unknown canary key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getHostsValue(hosts *HostsConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "file":
+		return hosts.File, nil
+	case "on_first_seen":
+		return hosts.OnFirstSeen, nil
+	default:
+		return nil, fmt.Errorf("unknown hosts key: %s", parts[0])
+	}
+}
+
+func setHostsValue(hosts *HostsConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "file":
+		hosts.File = value
+	case "on_first_seen":
+		if value != "allow" && value != "flag" && value != "hold" {
+			return fmt.Errorf("invalid on_first_seen: %s (must be allow, flag, or hold)", value)
+		}
+		hosts.OnFirstSeen = value
+	case "webhook":
+		return fmt.Errorf("hosts.webhook is replaced by notification targets: use 'stronghold notify add --name %s --url <url> --events new_host'", HostsWebhookTarget)
+	default:
+		return fmt.Errorf("unknown hosts key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getNotificationsValue(notifications *NotificationsConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return notifications.Enabled, nil
+	case "batch_window":
+		return notifications.BatchWindow.String(), nil
+	case "max_batch":
+		return notifications.MaxBatch, nil
+	case "rate_limit":
+		return notifications.RateLimit, nil
+	case "retries":
+		return notifications.Retries, nil
+	case "targets":
+		names := make([]string, len(notifications.Targets))
+		for i, t := range notifications.Targets {
+			names[i] = t.Name
+		}
+		return strings.Join(names, ","), nil
+	default:
+		return nil, fmt.Errorf("unknown notifications key: %s", parts[0])
+	}
+}
+
+func setNotificationsValue(notifications *NotificationsConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		notifications.Enabled = b
+	case "batch_window":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > 10*time.Minute {
+			return fmt.Errorf("invalid batch_window: %s (must be a duration up to 10m, e.g. 10s)", value)
+		}
+		notifications.BatchWindow = d
+	case "max_batch":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 100 {
+			return fmt.Errorf("invalid max_batch: %s (must be between 1 and 100)", value)
+		}
+		notifications.MaxBatch = n
+	case "rate_limit":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 600 {
+			return fmt.Errorf("invalid rate_limit: %s (must be between 1 and 600 deliveries per minute)", value)
+		}
+		notifications.RateLimit = n
+	case "retries":
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > 10 {
+			return fmt.Errorf("invalid retries: %s (must be between 1 and 10)", value)
+		}
+		notifications.Retries = n
+	case "targets":
+		return fmt.Errorf("targets are managed with 'stronghold notify add' and 'stronghold notify remove'")
+	default:
+		return fmt.Errorf("unknown notifications key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getHoldValue(hold *HoldConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "dir":
+		return hold.Dir, nil
+	case "timeout":
+		return hold.Timeout.String(), nil
+	case "on_timeout":
+		return hold.OnTimeout, nil
+	case "api_token":
+		return tokenStatus(hold.APIToken), nil
+	default:
+		return nil, fmt.Errorf("unknown hold key: %s", parts[0])
+	}
+}
+
+func setHoldValue(hold *HoldConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "dir":
+		hold.Dir = value
+	case "timeout":
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Second || d > time.Hour {
+			return fmt.Errorf("invalid timeout: %s (must be a duration between 1s and 1h, e.g. 2m)", value)
+		}
+		hold.Timeout = d
+	case "on_timeout":
+		if value != "allow" && value != "warn" && value != "block" {
+			return fmt.Errorf("invalid on_timeout: %s (must be allow, warn, or block)", value)
+		}
+		hold.OnTimeout = value
+	case "api_token":
+		if value != "" && len(value) < 16 {
+			return fmt.Errorf("api_token must be at least 16 characters, or empty to disable the admin API")
+		}
+		hold.APIToken = value
+	default:
+		return fmt.Errorf("unknown hold key: %s", parts[0])
+	}
+
+	return nil
+}
+
+func getShadowValue(shadow *ShadowConfig, parts []string) (interface{}, error) {
+	switch parts[0] {
+	case "enabled":
+		return shadow.Enabled, nil
+	case "file":
+		return shadow.File, nil
+	default:
+		return nil, fmt.Errorf("unknown shadow key: %s", parts[0])
+	}
+}
+
+func setShadowValue(shadow *ShadowConfig, parts []string, value string) error {
+	switch parts[0] {
+	case "enabled":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid enabled: %s (must be true or false)", value)
+		}
+		shadow.Enabled = b
+	case "file":
+		shadow.File = value
+	default:
+		return fmt.Errorf("unknown shadow key: %s", parts[0])
+	}
+
+	return nil
+}
+
+// tokenStatus shows whether a secret is set without revealing it
+func tokenStatus(token string) string {
+	if token == "" {
+		return "not set"
+	}
+	return "set"
+}
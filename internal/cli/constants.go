@@ -26,6 +26,64 @@ const (
 	DefaultBlockchain     = "base"
 	DefaultSolanaNetwork  = "solana"
 
+	// Scanning
+	DefaultDocumentMaxSize   = 10 * 1024 * 1024 // 10 MB
+	DefaultArchiveMaxSize    = 50 * 1024 * 1024 // 50 MB
+	DefaultArchiveMaxDepth   = 2
+	DefaultArchiveMaxMembers = 1000
+	DefaultBatchWindowMs     = 25
+	DefaultBatchMaxItems     = 16
+	DefaultBatchMaxItemSize  = 32 * 1024 // 32 KB
+	DefaultSessionDeposit    = 0.10      // USDC
+
+	// Scanning API circuit breaker
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerCooldown         = 10 * time.Second
+	DefaultBreakerMaxCooldown      = 5 * time.Minute
+
+	// Quarantine
+	DefaultQuarantineRetentionDays = 30
+	DefaultQuarantineMaxEntries    = 1000
+
+	// Capture
+	DefaultCaptureMode        = "off"
+	DefaultCaptureMaxEntries  = 500
+	DefaultCaptureMaxBodySize = 256 * 1024 // 256 KB
+
+	// Budget (USDC)
+	DefaultBudgetDailyLimit        = 5.0
+	DefaultBudgetMonthlyLimit      = 50.0
+	DefaultBudgetPerHostDailyLimit = 1.0
+	DefaultBudgetOnExceeded        = "local"
+
+	// Upstream connection pool
+	DefaultUpstreamMaxIdlePerHost  = 8
+	DefaultUpstreamMaxConnsPerHost = 64
+	DefaultUpstreamIdleTimeout     = 90 * time.Second
+
+	// Traffic statistics
+	DefaultStatsRetentionDays = 90
+
+	// ICAP listener
+	DefaultICAPBind    = "127.0.0.1"
+	DefaultICAPPort    = 1344
+	DefaultICAPPreview = 4096
+
+	// Envoy ext_authz listener
+	DefaultExtAuthzBind = "127.0.0.1"
+	DefaultExtAuthzPort = 9191
+
+	// Notifications
+	DefaultNotifyBatchWindow = 10 * time.Second
+	DefaultNotifyMaxBatch    = 20
+	DefaultNotifyRateLimit   = 10 // Deliveries per minute per target
+	DefaultNotifyRetries     = 3
+	HostsWebhookTarget       = "hosts-webhook" // Target a hosts.webhook from an older config is moved to
+
+	// Holding WARN content for a human decision
+	DefaultHoldTimeout   = 2 * time.Minute
+	DefaultHoldOnTimeout = "block"
+
 	// Retries
 	MaxAccountNumberRetries = 10
 
@@ -44,3 +102,6 @@ const (
 	PostCheckDelay   = 300 * time.Millisecond
 	InstallStepDelay = 200 * time.Millisecond
 )
+
+// LLMProviders lists the LLM API provider profiles the proxy can apply
+var LLMProviders = []string{"openai", "anthropic"}
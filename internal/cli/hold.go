@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"stronghold/internal/proxy"
+)
+
+// holdPreviewLines is how much of a held body 'stronghold pending' shows
+const holdPreviewLines = 6
+
+// openHolds opens the store of content held for a decision
+func openHolds() (*proxy.HoldStore, *CLIConfig, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	store, err := proxy.OpenHolds(proxy.HoldConfig{
+		Dir:       config.Hold.Dir,
+		Timeout:   config.Hold.Timeout,
+		OnTimeout: config.Hold.OnTimeout,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, config, nil
+}
+
+// HoldList shows the content waiting for a decision, oldest first, with its
+// URL, threats and the start of its body
+func HoldList() error {
+	store, config, err := openHolds()
+	if err != nil {
+		return err
+	}
+
+	items, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Println("Nothing is waiting for a decision.")
+		if config.Scanning.Content.ActionOnWarn != "hold" && config.Scanning.Output.ActionOnWarn != "hold" {
+			fmt.Println()
+			fmt.Println("  No content is held: set scanning.content.action_on_warn or")
+			fmt.Println("  scanning.output.action_on_warn to hold to decide on warned content.")
+		}
+		return nil
+	}
+
+	for i, item := range items {
+		if i > 0 {
+			fmt.Println()
+		}
+		left := time.Until(item.ExpiresAt).Round(time.Second)
+		fmt.Println(warningStyle.Render(fmt.Sprintf("● %s  %s %s", item.ID, item.Method, item.URL)))
+		fmt.Printf("  Held:      %s %s ago, %s left before it is %s\n", item.Direction, time.Since(item.CreatedAt).Round(time.Second), left, timeoutVerb(item.OnTimeout))
+		fmt.Printf("  Reason:    %s\n", item.Reason)
+		for _, t := range item.Threats {
+			threat := t.Category
+			if t.Severity != "" {
+				threat += " (" + t.Severity + ")"
+			}
+			if t.Description != "" {
+				threat += ": " + t.Description
+			}
+			fmt.Printf("  Threat:    %s\n", threat)
+		}
+		fmt.Printf("  Body:      %s, %d bytes\n", item.ContentType, item.Size)
+		for _, line := range previewLines(item.Preview) {
+			fmt.Printf("  │ %s\n", line)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("  Decide with 'stronghold approve <id>' or 'stronghold deny <id>'.")
+	return nil
+}
+
+// HoldDecide approves or denies held content. id may be a unique prefix.
+func HoldDecide(id string, approve bool) error {
+	store, _, err := openHolds()
+	if err != nil {
+		return err
+	}
+
+	item, err := store.Decide(id, approve, "cli")
+	if errors.Is(err, proxy.ErrHoldNotFound) {
+		return fmt.Errorf("nothing with id %s is waiting for a decision (it may have been decided or timed out)", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	held := "The response from " + item.URL
+	if item.Direction == "request" {
+		held = "The request to " + item.URL
+	}
+	if approve {
+		fmt.Println(successStyle.Render(fmt.Sprintf("✓ Approved %s", item.ID)))
+		fmt.Printf("  %s is forwarded.\n", held)
+	} else {
+		fmt.Println(successStyle.Render(fmt.Sprintf("✓ Denied %s", item.ID)))
+		fmt.Printf("  %s is blocked.\n", held)
+	}
+	return nil
+}
+
+// timeoutVerb describes what happens to held content nobody decides on
+func timeoutVerb(action string) string {
+	switch action {
+	case "allow":
+		return "allowed"
+	case "warn":
+		return "forwarded with a warning"
+	default:
+		return "blocked"
+	}
+}
+
+// previewLines cuts a body preview into a few non-empty, bounded lines.
+// Control characters are replaced, as held content is untrusted and must
+// not drive the terminal.
+func previewLines(preview string) []string {
+	var lines []string
+	for _, line := range strings.Split(preview, "\n") {
+		line = strings.Map(func(r rune) rune {
+			switch {
+			case r == '\t':
+				return ' '
+			case unicode.IsPrint(r):
+				return r
+			}
+			return '�'
+		}, strings.TrimSpace(line))
+		if line == "" {
+			continue
+		}
+		if len(lines) == holdPreviewLines {
+			lines = append(lines, "…")
+			break
+		}
+		lines = append(lines, truncateString(line, 100))
+	}
+	return lines
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"stronghold/internal/proxy"
+)
+
+// openHosts opens the record of destination hosts the proxy keeps
+func openHosts() (*proxy.HostStore, *CLIConfig, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	store, err := proxy.OpenHosts(proxy.HostsConfig{File: config.Hosts.File})
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, config, nil
+}
+
+// HostsList lists destination hosts, most recently first seen first, with
+// their block and warn ratios. With pending set, only hosts held for
+// approval are listed.
+func HostsList(pending bool, limit int) error {
+	store, config, err := openHosts()
+	if err != nil {
+		return err
+	}
+
+	hosts, err := store.List()
+	if err != nil {
+		return err
+	}
+	held := 0
+	var shown []proxy.HostEntry
+	for _, h := range hosts {
+		if h.Pending {
+			held++
+		}
+		if pending && !h.Pending {
+			continue
+		}
+		shown = append(shown, h)
+	}
+	if len(shown) == 0 {
+		if pending {
+			fmt.Println("No hosts are held for approval.")
+		} else {
+			fmt.Println("No destination hosts recorded yet.")
+		}
+		return nil
+	}
+	if limit > 0 && len(shown) > limit {
+		shown = shown[:limit]
+	}
+
+	fmt.Printf("%-40s  %-16s  %-16s  %8s  %7s  %7s  %s\n", "HOST", "FIRST SEEN", "LAST SEEN", "REQUESTS", "BLOCKED", "WARNED", "STATUS")
+	for _, h := range shown {
+		status := "-"
+		switch {
+		case h.Pending:
+			status = "held"
+		case h.ApprovedAt != nil:
+			status = "approved"
+		}
+		fmt.Printf("%-40s  %-16s  %-16s  %8d  %6.1f%%  %6.1f%%  %s\n",
+			truncateString(h.Host, 40),
+			h.FirstSeen.Local().Format("2006-01-02 15:04"),
+			h.LastSeen.Local().Format("2006-01-02 15:04"),
+			h.Requests,
+			percentage(h.Blocked, h.Requests),
+			percentage(h.Warned, h.Requests),
+			status,
+		)
+	}
+
+	if held > 0 && !pending {
+		fmt.Println()
+		fmt.Println(warningStyle.Render(fmt.Sprintf("⚠ %d hosts are held for approval. Approve one with 'stronghold hosts approve <host>'.", held)))
+	}
+	if config.Hosts.OnFirstSeen == "allow" {
+		fmt.Println()
+		fmt.Println("  New hosts are recorded but not flagged. Set hosts.on_first_seen to flag or hold")
+		fmt.Println("  to be alerted on first contact.")
+	}
+	return nil
+}
+
+// HostsApprove lets requests to a held host through. Hosts not seen yet can
+// be approved ahead of first contact.
+func HostsApprove(host string) error {
+	store, _, err := openHosts()
+	if err != nil {
+		return err
+	}
+
+	entry, err := store.Approve(host)
+	if errors.Is(err, proxy.ErrHostNotFound) {
+		return fmt.Errorf("no host given")
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(successStyle.Render(fmt.Sprintf("✓ Approved %s", entry.Host)))
+	return nil
+}
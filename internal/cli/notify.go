@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"stronghold/internal/proxy"
+)
+
+// proxyNotifyTarget converts a configured target to the proxy's type
+func proxyNotifyTarget(t NotifyTarget) proxy.NotifyTarget {
+	return proxy.NotifyTarget{
+		Name:   t.Name,
+		URL:    t.URL,
+		Format: t.Format,
+		Secret: t.Secret,
+		Events: t.Events,
+	}
+}
+
+// NotifyList lists the notification targets
+func NotifyList() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targets := config.Notifications.Targets
+	if len(targets) == 0 {
+		fmt.Println("No notification targets. Add one with 'stronghold notify add'.")
+		return nil
+	}
+
+	fmt.Printf("%-16s  %-6s  %-6s  %-40s  %s\n", "NAME", "FORMAT", "SIGNED", "URL", "EVENTS")
+	for _, t := range targets {
+		signed := "no"
+		if t.Secret != "" {
+			signed = "yes"
+		}
+		events := "all"
+		if len(t.Events) > 0 {
+			events = strings.Join(t.Events, ",")
+		}
+		fmt.Printf("%-16s  %-6s  %-6s  %-40s  %s\n",
+			truncateString(t.Name, 16),
+			t.Format,
+			signed,
+			truncateString(t.URL, 40),
+			events,
+		)
+	}
+
+	if !config.Notifications.Enabled {
+		fmt.Println()
+		fmt.Println(warningStyle.Render("⚠ Notifications are disabled. Enable them with 'stronghold config set notifications.enabled true'."))
+	}
+	return nil
+}
+
+// NotifyAdd adds a notification target, replacing any with the same name
+func NotifyAdd(target NotifyTarget) error {
+	if err := proxyNotifyTarget(target).Validate(); err != nil {
+		return err
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	replaced := false
+	for i, t := range config.Notifications.Targets {
+		if t.Name == target.Name {
+			config.Notifications.Targets[i] = target
+			replaced = true
+		}
+	}
+	if !replaced {
+		config.Notifications.Targets = append(config.Notifications.Targets, target)
+	}
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	verb := "Added"
+	if replaced {
+		verb = "Updated"
+	}
+	fmt.Println(successStyle.Render(fmt.Sprintf("✓ %s notification target %s", verb, target.Name)))
+	if !config.Notifications.Enabled {
+		fmt.Println("  Enable notifications with 'stronghold config set notifications.enabled true'.")
+	}
+	fmt.Println("  Send a test notification with 'stronghold notify test'. Restart the proxy to apply.")
+	return nil
+}
+
+// NotifyRemove removes the notification target called name
+func NotifyRemove(name string) error {
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targets := config.Notifications.Targets[:0]
+	for _, t := range config.Notifications.Targets {
+		if t.Name != name {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == len(config.Notifications.Targets) {
+		return fmt.Errorf("no notification target named %s", name)
+	}
+	config.Notifications.Targets = targets
+	if err := config.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Println(successStyle.Render(fmt.Sprintf("✓ Removed notification target %s", name)))
+	return nil
+}
+
+// NotifyTest sends a test notification to each target, or only to the one
+// called name, and reports how each delivery went
+func NotifyTest(name string) error {
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var targets []proxy.NotifyTarget
+	for _, t := range config.Notifications.Targets {
+		if name == "" || t.Name == name {
+			targets = append(targets, proxyNotifyTarget(t))
+		}
+	}
+	if len(targets) == 0 {
+		if name != "" {
+			return fmt.Errorf("no notification target named %s", name)
+		}
+		return fmt.Errorf("no notification targets. Add one with 'stronghold notify add'")
+	}
+
+	notifier, err := proxy.NewNotifier(proxy.NotificationsConfig{Targets: targets}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	results := notifier.Test(ctx)
+
+	failed := 0
+	for _, t := range targets {
+		if err := results[t.Name]; err != nil {
+			failed++
+			fmt.Println(errorStyle.Render(fmt.Sprintf("✗ %s: %v", t.Name, err)))
+			continue
+		}
+		fmt.Println(successStyle.Render(fmt.Sprintf("✓ %s: delivered", t.Name)))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d test notifications failed", failed, len(targets))
+	}
+	return nil
+}
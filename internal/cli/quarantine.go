@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"stronghold/internal/proxy"
+)
+
+// openQuarantine opens the quarantine store the proxy writes to
+func openQuarantine() (*proxy.QuarantineStore, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if _, err := os.Stat(config.Quarantine.Dir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no quarantine found at %s", config.Quarantine.Dir)
+	}
+
+	return proxy.OpenQuarantine(proxy.QuarantineConfig{
+		Enabled:       config.Quarantine.Enabled,
+		Dir:           config.Quarantine.Dir,
+		RetentionDays: config.Quarantine.RetentionDays,
+		MaxEntries:    config.Quarantine.MaxEntries,
+	})
+}
+
+// QuarantineList lists quarantined responses, newest first
+func QuarantineList() error {
+	store, err := openQuarantine()
+	if err != nil {
+		return err
+	}
+
+	entries, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("Quarantine is empty.")
+		return nil
+	}
+
+	fmt.Printf("%-12s  %-19s  %-8s  %9s  %s\n", "ID", "BLOCKED AT", "DECISION", "SIZE", "URL")
+	for _, e := range entries {
+		decision := ""
+		if e.ScanResult != nil {
+			decision = string(e.ScanResult.Decision)
+		}
+		fmt.Printf("%-12s  %-19s  %-8s  %9s  %s\n",
+			e.ID,
+			e.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			decision,
+			formatBytes(int64(e.Size)),
+			truncateString(e.URL, 80),
+		)
+	}
+	fmt.Println()
+	fmt.Println(infoStyle.Render(fmt.Sprintf("%d entries. Use 'stronghold quarantine show <id>' for details.", len(entries))))
+	return nil
+}
+
+// QuarantineShow prints the details of a quarantined response. The body is
+// only printed when printBody is set, or written to outputPath, so that the
+// blocked content is never shown by accident.
+func QuarantineShow(id string, printBody bool, outputPath string) error {
+	store, err := openQuarantine()
+	if err != nil {
+		return err
+	}
+
+	entry, body, err := store.Get(id)
+	if err != nil {
+		return quarantineError(id, err)
+	}
+
+	fmt.Printf("ID:           %s\n", entry.ID)
+	fmt.Printf("Blocked at:   %s\n", entry.CreatedAt.Local().Format("2006-01-02 15:04:05 MST"))
+	fmt.Printf("URL:          %s\n", entry.URL)
+	fmt.Printf("Method:       %s\n", entry.Method)
+	fmt.Printf("Status:       %d\n", entry.StatusCode)
+	fmt.Printf("Content-Type: %s\n", entry.ContentType)
+	fmt.Printf("Size:         %s\n", formatBytes(int64(entry.Size)))
+	fmt.Printf("SHA-256:      %s\n", entry.SHA256)
+	fmt.Printf("Transport:    %s\n", entry.Transport)
+	if entry.RequestID != "" {
+		fmt.Printf("Request ID:   %s\n", entry.RequestID)
+	}
+
+	if result := entry.ScanResult; result != nil {
+		fmt.Println()
+		fmt.Println("Scan result:")
+		fmt.Printf("  Decision:   %s\n", result.Decision)
+		fmt.Printf("  Reason:     %s\n", result.Reason)
+		names := make([]string, 0, len(result.Scores))
+		for name := range result.Scores {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  Score:      %s=%.2f\n", name, result.Scores[name])
+		}
+		for _, threat := range result.ThreatsFound {
+			location := ""
+			if threat.Location != "" {
+				location = " at " + threat.Location
+			}
+			fmt.Printf("  Threat:     [%s] %s%s - %s\n", threat.Severity, threat.Category, location, threat.Description)
+		}
+	}
+
+	if outputPath != "" {
+		if err := os.WriteFile(outputPath, body, 0600); err != nil {
+			return fmt.Errorf("failed to write body: %w", err)
+		}
+		fmt.Println()
+		fmt.Println(successStyle.Render("✓ Body written to " + outputPath))
+	}
+
+	if printBody {
+		fmt.Println()
+		fmt.Println(warningStyle.Render("Body (blocked content - do not pass to an LLM):"))
+		os.Stdout.Write(body)
+		if len(body) > 0 && body[len(body)-1] != '\n' {
+			fmt.Println()
+		}
+	}
+
+	return nil
+}
+
+// QuarantineRelease whitelists a quarantined response so the same content
+// passes the proxy on its next fetch
+func QuarantineRelease(id string) error {
+	store, err := openQuarantine()
+	if err != nil {
+		return err
+	}
+
+	entry, err := store.Release(id)
+	if err != nil {
+		return quarantineError(id, err)
+	}
+
+	fmt.Println(successStyle.Render("✓ Released " + entry.ID))
+	fmt.Printf("  Content with SHA-256 %s from %s will no longer be blocked.\n", entry.SHA256, entry.URL)
+	return nil
+}
+
+// QuarantineDelete removes quarantined responses
+func QuarantineDelete(ids []string, all bool) error {
+	store, err := openQuarantine()
+	if err != nil {
+		return err
+	}
+
+	if all {
+		entries, err := store.List()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := store.Delete(e.ID); err != nil {
+				return err
+			}
+		}
+		fmt.Println(successStyle.Render(fmt.Sprintf("✓ Deleted %d entries", len(entries))))
+		return nil
+	}
+
+	if len(ids) == 0 {
+		return fmt.Errorf("specify at least one quarantine id, or --all")
+	}
+	for _, id := range ids {
+		if err := store.Delete(id); err != nil {
+			return quarantineError(id, err)
+		}
+		fmt.Println(successStyle.Render("✓ Deleted " + id))
+	}
+	return nil
+}
+
+func quarantineError(id string, err error) error {
+	if errors.Is(err, proxy.ErrQuarantineNotFound) {
+		return fmt.Errorf("no quarantine entry matches %q", id)
+	}
+	return err
+}
+
+// truncateString shortens s to max runes, adding an ellipsis
+func truncateString(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return strings.TrimSpace(string(r[:max-1])) + "…"
+}
+
+// formatBytes renders a byte count for display
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"stronghold/internal/proxy"
+)
+
+// loadRules loads the local rules file the proxy evaluates
+func loadRules() (*proxy.RuleSet, string, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load config: %w", err)
+	}
+	rules, err := proxy.LoadRules(config.Rules.File)
+	if err != nil {
+		return nil, config.Rules.File, err
+	}
+	return rules, config.Rules.File, nil
+}
+
+// RulesCheck validates the local rules file and lists its rules
+func RulesCheck() error {
+	rules, path, err := loadRules()
+	if err != nil {
+		return err
+	}
+
+	if rules.Len() == 0 {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			fmt.Printf("No rules file at %s.\n", path)
+		} else {
+			fmt.Printf("%s has no rules.\n", path)
+		}
+		return nil
+	}
+
+	fmt.Printf("%-24s  %-8s  %-9s  %-8s  %-6s  %s\n", "ID", "TYPE", "DIRECTION", "SEVERITY", "ACTION", "CATEGORY")
+	for _, r := range rules.Rules() {
+		fmt.Printf("%-24s  %-8s  %-9s  %-8s  %-6s  %s\n",
+			truncateString(r.ID, 24), r.Type, r.Direction, r.Severity, r.Action, r.Category)
+	}
+	fmt.Println()
+	fmt.Println(successStyle.Render(fmt.Sprintf("✓ %d rules in %s are valid", rules.Len(), path)))
+	fmt.Println("  The proxy loads rules at startup; run 'stronghold disable' and 'stronghold enable' to apply changes.")
+	return nil
+}
+
+// RulesTest evaluates the local rules against the content of inputPath, or
+// stdin for "-", as the proxy would for traffic in direction
+func RulesTest(inputPath, direction string) error {
+	if direction != proxy.RuleInbound && direction != proxy.RuleOutbound {
+		return fmt.Errorf("invalid direction: %s (must be inbound or outbound)", direction)
+	}
+	rules, _, err := loadRules()
+	if err != nil {
+		return err
+	}
+
+	var content []byte
+	if inputPath == "-" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(inputPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	matches := rules.Match(content, direction)
+	if len(matches) == 0 {
+		fmt.Printf("No %s rules matched.\n", direction)
+		return nil
+	}
+	for _, m := range matches {
+		fmt.Printf("%-24s  %-6s  offset %-8d  %s\n", truncateString(m.Rule.ID, 24), m.Rule.Action, m.Offset, m.Rule.Description)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"stronghold/internal/proxy"
+)
+
+// ShadowReport summarises what shadow mode would have done over the last
+// days days: would-block rates by host and the categories behind them
+func ShadowReport(days, limit int) error {
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	fmt.Printf("Shadow mode: %s\n", shadowScope(config))
+	records, err := proxy.OpenShadowLog(config.Shadow.File).Records(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Printf("No scans were evaluated in shadow mode in the last %d days.\n", days)
+		if shadowScope(config) == "off" {
+			fmt.Println()
+			fmt.Println("  Enable it with 'stronghold config set shadow.enabled true', or shadow one policy")
+			fmt.Println("  with scanning.content.shadow or scanning.output.shadow, then restart the proxy.")
+		}
+		return nil
+	}
+
+	summary := proxy.SummarizeShadow(records)
+	total := summary.Total
+	fmt.Printf("Last %d days: %d scans, %d would be blocked (%.1f%%), %d warned, sanitized or held (%.1f%%)\n",
+		days, total.Scans,
+		total.Blocked(), percentage(total.Blocked(), total.Scans),
+		total.Flagged(), percentage(total.Flagged(), total.Scans),
+	)
+
+	hosts := summary.Hosts
+	if limit > 0 && len(hosts) > limit {
+		hosts = hosts[:limit]
+	}
+	fmt.Println()
+	fmt.Printf("%-40s  %7s  %7s  %7s  %7s  %s\n", "HOST", "SCANS", "BLOCK", "RATE", "OTHER", "TOP CATEGORY")
+	for _, h := range hosts {
+		category := h.Category
+		if category == "" {
+			category = "-"
+		}
+		fmt.Printf("%-40s  %7d  %7d  %6.1f%%  %7d  %s\n",
+			truncateString(h.Name, 40),
+			h.Scans,
+			h.Blocked(),
+			percentage(h.Blocked(), h.Scans),
+			h.Flagged(),
+			category,
+		)
+	}
+	if len(hosts) < len(summary.Hosts) {
+		fmt.Printf("  ... and %d more hosts\n", len(summary.Hosts)-len(hosts))
+	}
+
+	if len(summary.Categories) > 0 {
+		fmt.Println()
+		fmt.Printf("%-32s  %7s  %7s\n", "CATEGORY", "BLOCK", "SHARE")
+		for _, c := range summary.Categories {
+			fmt.Printf("%-32s  %7d  %6.1f%%\n", truncateString(c.Name, 32), c.Blocked(), percentage(c.Blocked(), total.Blocked()))
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("  BLOCK counts scans policy would have blocked; OTHER those it would have")
+	fmt.Println("  warned on, sanitized or held. Nothing was enforced.")
+	return nil
+}
+
+// shadowScope describes which policies are shadowed
+func shadowScope(config *CLIConfig) string {
+	if config.Shadow.Enabled {
+		return "on for all policies"
+	}
+	var policies []string
+	if config.Scanning.Content.Shadow {
+		policies = append(policies, "content")
+	}
+	if config.Scanning.Output.Shadow {
+		policies = append(policies, "output")
+	}
+	if len(policies) == 0 {
+		return "off"
+	}
+	return "on for " + strings.Join(policies, " and ") + " scans"
+}
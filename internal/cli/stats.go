@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"stronghold/internal/proxy"
+)
+
+// maxHistoryDays is the longest window 'status --history' accepts
+const maxHistoryDays = 3650
+
+// maxSparkWidth is the most characters a sparkline takes; longer series are
+// summed into buckets
+const maxSparkWidth = 60
+
+// sparkTicks draw a trend, lowest to highest
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// openStats opens the traffic statistics the proxy writes
+func openStats(config *CLIConfig) (*proxy.StatsStore, error) {
+	return proxy.OpenStats(proxy.StatsConfig{
+		File:          config.Stats.File,
+		RetentionDays: config.Stats.RetentionDays,
+	})
+}
+
+// ParseHistoryWindow parses a --history value such as 30d, 4w or 7 into a
+// number of days
+func ParseHistoryWindow(value string) (int, error) {
+	number := strings.ToLower(strings.TrimSpace(value))
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(number, "d"):
+		number = strings.TrimSuffix(number, "d")
+	case strings.HasSuffix(number, "w"):
+		number = strings.TrimSuffix(number, "w")
+		multiplier = 7
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid history window %q: use a number of days such as 30d or weeks such as 4w", value)
+	}
+	days := n * multiplier
+	if days > maxHistoryDays {
+		return 0, fmt.Errorf("history window must be at most %d days", maxHistoryDays)
+	}
+	return days, nil
+}
+
+// printHistory renders traffic trends over the last days days. Windows
+// longer than a month are shown by week.
+func printHistory(history proxy.StatsHistory, days int) {
+	fmt.Printf("History (last %d days):\n", days)
+
+	requests := make([]int64, len(history.Days))
+	blocked := make([]int64, len(history.Days))
+	for i, d := range history.Days {
+		requests[i] = d.Requests
+		blocked[i] = d.Blocked
+	}
+	fmt.Printf("  Requests:   %s\n", sparkline(requests))
+	fmt.Printf("  Blocked:    %s\n", sparkline(blocked))
+	fmt.Println()
+
+	type row struct {
+		label  string
+		counts proxy.TrafficCounts
+	}
+	var rows []row
+	for _, m := range history.Months {
+		rows = append(rows, row{label: m.Month + " (month)", counts: m.TrafficCounts})
+	}
+	step := 1
+	if days > 31 {
+		step = 7
+	}
+	for i := 0; i < len(history.Days); i += step {
+		r := row{label: history.Days[i].Date}
+		if step > 1 {
+			r.label = "week of " + history.Days[i].Date
+		}
+		for j := i; j < i+step && j < len(history.Days); j++ {
+			addCounts(&r.counts, history.Days[j].TrafficCounts)
+		}
+		rows = append(rows, r)
+	}
+
+	fmt.Printf("  %-22s %9s %8s %8s %8s %12s\n", "", "Requests", "Blocked", "Warned", "Skipped", "Cost")
+	for _, r := range rows {
+		fmt.Printf("  %-22s %9d %8d %8d %8d %12s\n", r.label, r.counts.Requests, r.counts.Blocked, r.counts.Warned, r.counts.Skipped, "$"+r.counts.Spend.String())
+	}
+	t := history.Total
+	fmt.Printf("  %-22s %9d %8d %8d %8d %12s\n", "Total", t.Requests, t.Blocked, t.Warned, t.Skipped, "$"+t.Spend.String())
+
+	if len(history.Hosts) > 0 {
+		fmt.Println()
+		fmt.Println("  Top hosts:")
+		for i, h := range history.Hosts {
+			if i == 5 {
+				fmt.Printf("    ... and %d more\n", len(history.Hosts)-i)
+				break
+			}
+			fmt.Printf("    %-40s %9d requests, %d blocked, %d warned\n", truncateString(h.Host, 40), h.Requests, h.Blocked, h.Warned)
+		}
+	}
+	fmt.Println()
+}
+
+// addCounts adds o to c
+func addCounts(c *proxy.TrafficCounts, o proxy.TrafficCounts) {
+	c.Requests += o.Requests
+	c.Blocked += o.Blocked
+	c.Warned += o.Warned
+	c.Skipped += o.Skipped
+	c.Spend += o.Spend
+}
+
+// sparkline draws values as a row of block characters scaled to the largest
+func sparkline(values []int64) string {
+	if len(values) > maxSparkWidth {
+		per := (len(values) + maxSparkWidth - 1) / maxSparkWidth
+		buckets := make([]int64, 0, maxSparkWidth)
+		for i := 0; i < len(values); i += per {
+			var sum int64
+			for j := i; j < i+per && j < len(values); j++ {
+				sum += values[j]
+			}
+			buckets = append(buckets, sum)
+		}
+		values = buckets
+	}
+
+	var max int64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range values {
+		if max == 0 {
+			b.WriteRune(sparkTicks[0])
+			continue
+		}
+		b.WriteRune(sparkTicks[int(v*int64(len(sparkTicks)-1)/max)])
+	}
+	return b.String()
+}
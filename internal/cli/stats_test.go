@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseHistoryWindow(t *testing.T) {
+	tests := []struct {
+		value   string
+		days    int
+		wantErr bool
+	}{
+		{"30d", 30, false},
+		{"7", 7, false},
+		{"4w", 28, false},
+		{" 14D ", 14, false},
+		{"0d", 0, true},
+		{"-3d", 0, true},
+		{"month", 0, true},
+		{"4000d", 0, true},
+	}
+	for _, tt := range tests {
+		days, err := ParseHistoryWindow(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseHistoryWindow(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if days != tt.days {
+			t.Errorf("ParseHistoryWindow(%q) = %d, want %d", tt.value, days, tt.days)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline([]int64{0, 4, 8}); got != "▁▄█" {
+		t.Errorf("expected ▁▄█, got %q", got)
+	}
+	if got := sparkline([]int64{0, 0}); got != "▁▁" {
+		t.Errorf("expected a flat line for no traffic, got %q", got)
+	}
+	if got := sparkline(make([]int64, 365)); utf8.RuneCountInString(got) > maxSparkWidth {
+		t.Errorf("expected long series to be bucketed to %d columns, got %d", maxSparkWidth, utf8.RuneCountInString(got))
+	}
+}
@@ -2,17 +2,55 @@ package cli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"stronghold/internal/proxy"
 	"stronghold/internal/wallet"
 )
 
-// Status displays the current status of Stronghold
-func Status() error {
+// proxyHealthTimeout bounds the query for the running proxy's health
+const proxyHealthTimeout = time.Second
+
+// proxyBreakerState asks the running proxy for the state of its circuit
+// breaker in front of the scanning API. It returns nil if the breaker is
+// disabled.
+func proxyBreakerState(config *CLIConfig) (*proxy.BreakerState, error) {
+	client := &http.Client{
+		Timeout:   proxyHealthTimeout,
+		Transport: &http.Transport{Proxy: nil}, // Never route through the proxy itself
+	}
+	resp, err := client.Get(config.GetProxyURL() + "/health")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		Breaker *proxy.BreakerState `json:"breaker"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+		return nil, fmt.Errorf("invalid proxy health response: %w", err)
+	}
+	return health.Breaker, nil
+}
+
+// failModeName describes what the proxy does with content it cannot scan
+func failModeName(config *CLIConfig) string {
+	if config.Scanning.FailOpen {
+		return "content passes unscanned"
+	}
+	return "content is blocked"
+}
+
+// Status displays the current status of Stronghold. When historyDays is
+// positive, traffic over that many days is shown as well.
+func Status(historyDays int) error {
 	config, err := LoadConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
@@ -32,9 +70,6 @@ func Status() error {
 		return fmt.Errorf("failed to check proxy status: %w", err)
 	}
 
-	// Reset daily stats if needed
-	config.ResetDailyStats()
-
 	// Print status header
 	fmt.Println()
 	fmt.Println("╔══════════════════════════════════════════╗")
@@ -59,6 +94,18 @@ func Status() error {
 			fmt.Printf("  Mode:       %s\n", warningStyle.Render("Not intercepting traffic"))
 		}
 		fmt.Printf("  Protection: %s\n", successStyle.Render("Enabled"))
+		if breaker, err := proxyBreakerState(config); err == nil && breaker != nil {
+			switch breaker.State {
+			case proxy.BreakerClosed:
+				fmt.Printf("  Scan API:   %s\n", successStyle.Render("Reachable"))
+			case proxy.BreakerOpen:
+				fmt.Printf("  Scan API:   %s\n", errorStyle.Render(fmt.Sprintf(
+					"Unavailable after %d failures, retrying at %s (%s)",
+					breaker.ConsecutiveFailures, breaker.RetryAt.Local().Format("15:04:05"), failModeName(config))))
+			default:
+				fmt.Printf("  Scan API:   %s\n", warningStyle.Render("Checking for recovery"))
+			}
+		}
 	} else {
 		fmt.Printf("  Status:     %s\n", errorStyle.Render("Stopped"))
 		fmt.Printf("  Protection: %s\n", warningStyle.Render("Disabled"))
@@ -140,17 +187,24 @@ func Status() error {
 	fmt.Println()
 
 	// Usage stats
-	fmt.Println("Usage (last 24h):")
-	fmt.Printf("  Requests:   %d\n", config.Stats.RequestsToday)
-	fmt.Printf("  Blocked:    %d (%.2f%%)\n",
-		config.Stats.BlockedToday,
-		percentage(config.Stats.BlockedToday, config.Stats.RequestsToday))
-	fmt.Printf("  Warned:     %d (%.2f%%)\n",
-		config.Stats.WarnedToday,
-		percentage(config.Stats.WarnedToday, config.Stats.RequestsToday))
-	fmt.Printf("  Cost:       $%.2f\n", config.Stats.CostToday)
+	stats, statsErr := openStats(config)
+	fmt.Println("Usage (today):")
+	if statsErr != nil {
+		fmt.Printf("  %s\n", warningStyle.Render(fmt.Sprintf("Could not read stats: %v", statsErr)))
+	} else {
+		today := stats.History(1).Total
+		fmt.Printf("  Requests:   %d\n", today.Requests)
+		fmt.Printf("  Blocked:    %d (%.2f%%)\n", today.Blocked, percentage(today.Blocked, today.Requests))
+		fmt.Printf("  Warned:     %d (%.2f%%)\n", today.Warned, percentage(today.Warned, today.Requests))
+		fmt.Printf("  Skipped:    %d (%.2f%%)\n", today.Skipped, percentage(today.Skipped, today.Requests))
+		fmt.Printf("  Cost:       $%s\n", today.Spend)
+	}
 	fmt.Println()
 
+	if historyDays > 0 && statsErr == nil {
+		printHistory(stats.History(historyDays), historyDays)
+	}
+
 	// Configuration
 	fmt.Println("Configuration:")
 	fmt.Printf("  Config:     %s\n", ConfigPath())
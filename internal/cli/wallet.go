@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
+	"stronghold/internal/proxy"
+	"stronghold/internal/usdc"
 	"stronghold/internal/wallet"
 )
 
@@ -115,6 +117,82 @@ func WalletBalance() error {
 	return nil
 }
 
+// WalletSpend reports the proxy's x402 spend against the configured budget.
+func WalletSpend() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	ledger, err := proxy.OpenSpendLedger(proxy.BudgetConfig{
+		DailyLimit:        config.Budget.DailyLimit,
+		MonthlyLimit:      config.Budget.MonthlyLimit,
+		PerHostDailyLimit: config.Budget.PerHostDailyLimit,
+		OnExceeded:        config.Budget.OnExceeded,
+		Ledger:            config.Budget.Ledger,
+	})
+	if err != nil {
+		return err
+	}
+	summary := ledger.Summary()
+
+	fmt.Println(accountTitleStyle.Render("💸 Scan Spend"))
+	fmt.Println()
+	fmt.Printf("Today:      %s (%d payments)\n", spendAgainst(summary.Today, summary.DailyLimit), summary.TodayPayments)
+	fmt.Printf("This month: %s\n", spendAgainst(summary.Month, summary.MonthlyLimit))
+
+	if len(summary.Hosts) > 0 {
+		fmt.Println()
+		if summary.PerHostLimit > 0 {
+			fmt.Printf("Today by host (cap $%s each):\n", summary.PerHostLimit)
+		} else {
+			fmt.Println("Today by host:")
+		}
+		for i, h := range summary.Hosts {
+			if i == 10 {
+				fmt.Println(accountInfoStyle.Render(fmt.Sprintf("  ... and %d more", len(summary.Hosts)-i)))
+				break
+			}
+			line := fmt.Sprintf("  %-40s $%s", truncateString(h.Host, 40), h.Amount)
+			if summary.PerHostLimit > 0 && h.Amount >= summary.PerHostLimit {
+				line = accountWarningStyle.Render(line + "  (cap reached)")
+			}
+			fmt.Println(line)
+		}
+	}
+
+	dailyHit := summary.DailyLimit > 0 && summary.Today >= summary.DailyLimit
+	monthlyHit := summary.MonthlyLimit > 0 && summary.Month >= summary.MonthlyLimit
+	if dailyHit || monthlyHit {
+		fmt.Println()
+		fmt.Println(accountWarningStyle.Render("⚠ Spending cap reached. " + budgetFallbackDescription(config.Budget.OnExceeded)))
+	}
+
+	fmt.Println()
+	fmt.Println(accountInfoStyle.Render("Change caps with 'stronghold config set budget.daily_limit <usdc>'"))
+	return nil
+}
+
+// spendAgainst formats spend with its cap, if any
+func spendAgainst(spent, limit usdc.MicroUSDC) string {
+	if limit <= 0 {
+		return fmt.Sprintf("$%s (no cap)", spent)
+	}
+	pct := float64(spent) / float64(limit) * 100
+	return fmt.Sprintf("$%s of $%s (%.0f%%)", spent, limit, pct)
+}
+
+func budgetFallbackDescription(onExceeded string) string {
+	switch onExceeded {
+	case proxy.BudgetFailOpen:
+		return "Content passes the proxy unscanned."
+	case proxy.BudgetFailClosed:
+		return "Content that needs a paid scan is blocked."
+	default:
+		return "The proxy is scanning locally with built-in patterns."
+	}
+}
+
 // WalletList displays configured wallets by chain.
 func WalletList() error {
 	config, err := LoadConfig()
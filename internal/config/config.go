@@ -79,11 +79,12 @@ type DashboardConfig struct {
 
 // X402Config holds x402 payment configuration
 type X402Config struct {
-	EVMWalletAddress    string   // EVM wallet address (Base)
-	SolanaWalletAddress string   // Solana wallet address
-	FacilitatorURL      string   // x402 facilitator URL
-	Networks            []string // Supported payment networks (e.g. ["base", "solana"])
-	SolanaFeePayer      string   // Facilitator's Solana pubkey for paying tx fees
+	EVMWalletAddress    string        // EVM wallet address (Base)
+	SolanaWalletAddress string        // Solana wallet address
+	FacilitatorURL      string        // x402 facilitator URL
+	Networks            []string      // Supported payment networks (e.g. ["base", "solana"])
+	SolanaFeePayer      string        // Facilitator's Solana pubkey for paying tx fees
+	SessionTTL          time.Duration // How long a prepaid session stays usable
 }
 
 // WalletForNetwork returns the wallet address for the given network.
@@ -131,8 +132,11 @@ type StrongholdConfig struct {
 
 // PricingConfig holds endpoint pricing in microUSDC
 type PricingConfig struct {
-	ScanContent usdc.MicroUSDC
-	ScanOutput  usdc.MicroUSDC
+	ScanContent   usdc.MicroUSDC
+	ScanOutput    usdc.MicroUSDC
+	ScanBatchItem usdc.MicroUSDC // Per item in a /v1/scan/batch request
+	SessionMin    usdc.MicroUSDC // Smallest deposit that opens a prepaid session
+	SessionMax    usdc.MicroUSDC // Largest deposit that opens a prepaid session
 }
 
 // RateLimitConfig holds rate limiting configuration
@@ -203,6 +207,7 @@ func Load() *Config {
 			FacilitatorURL:      getEnv("X402_FACILITATOR_URL", "https://x402.org/facilitator"),
 			Networks:            loadX402Networks(),
 			SolanaFeePayer:      getEnv("X402_SOLANA_FEE_PAYER", ""),
+			SessionTTL:          getDuration("X402_SESSION_TTL", 24*time.Hour),
 		},
 		Stripe: StripeConfig{
 			SecretKey:      getEnv("STRIPE_SECRET_KEY", ""),
@@ -220,8 +225,11 @@ func Load() *Config {
 			LLMAPIKey:       getEnv("STRONGHOLD_LLM_API_KEY", ""),
 		},
 		Pricing: PricingConfig{
-			ScanContent: getMicroUSDC("PRICE_SCAN_CONTENT", 0.001),
-			ScanOutput:  getMicroUSDC("PRICE_SCAN_OUTPUT", 0.001),
+			ScanContent:   getMicroUSDC("PRICE_SCAN_CONTENT", 0.001),
+			ScanOutput:    getMicroUSDC("PRICE_SCAN_OUTPUT", 0.001),
+			ScanBatchItem: getMicroUSDC("PRICE_SCAN_BATCH_ITEM", 0.001),
+			SessionMin:    getMicroUSDC("PRICE_SESSION_MIN_DEPOSIT", 0.01),
+			SessionMax:    getMicroUSDC("PRICE_SESSION_MAX_DEPOSIT", 10),
 		},
 		RateLimit: RateLimitConfig{
 			Enabled:       getBool("RATE_LIMIT_ENABLED", true),
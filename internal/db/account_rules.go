@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// AccountRule is a custom detection rule owned by an account
+type AccountRule struct {
+	ID            uuid.UUID `json:"id"`
+	AccountID     uuid.UUID `json:"-"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Type          string    `json:"type"`              // "regex", "keyword" or "phrase"
+	Pattern       string    `json:"pattern,omitempty"` // For regex rules
+	Keywords      []string  `json:"keywords,omitempty"`
+	CaseSensitive bool      `json:"case_sensitive"`
+	Severity      string    `json:"severity"`
+	Action        string    `json:"action"` // "warn" or "block"
+	Enabled       bool      `json:"enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ErrAccountRuleLimitReached is returned when the account has reached the maximum number of rules.
+var ErrAccountRuleLimitReached = errors.New("account rule limit reached")
+
+// ErrAccountRuleNotFound is returned when the rule does not exist or belongs to another account.
+var ErrAccountRuleNotFound = errors.New("account rule not found")
+
+const accountRuleColumns = `id, account_id, name, description, rule_type, pattern, keywords,
+	case_sensitive, severity, action, enabled, created_at, updated_at`
+
+func scanAccountRule(row pgx.Row) (*AccountRule, error) {
+	var r AccountRule
+	err := row.Scan(
+		&r.ID, &r.AccountID, &r.Name, &r.Description, &r.Type, &r.Pattern, &r.Keywords,
+		&r.CaseSensitive, &r.Severity, &r.Action, &r.Enabled, &r.CreatedAt, &r.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateAccountRule stores a new rule, enforcing a maximum number of rules
+// per account. The cap is checked under a row lock on the account so
+// concurrent requests cannot exceed it.
+func (db *DB) CreateAccountRule(ctx context.Context, rule *AccountRule, maxRules int) error {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var lockedID uuid.UUID
+	if err := tx.QueryRow(ctx, `SELECT id FROM accounts WHERE id = $1 FOR UPDATE`, rule.AccountID).Scan(&lockedID); err != nil {
+		return fmt.Errorf("failed to lock account: %w", err)
+	}
+
+	var count int
+	if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM account_rules WHERE account_id = $1`, rule.AccountID).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count account rules: %w", err)
+	}
+	if count >= maxRules {
+		return ErrAccountRuleLimitReached
+	}
+
+	if rule.Keywords == nil {
+		rule.Keywords = []string{}
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO account_rules (
+			account_id, name, description, rule_type, pattern, keywords,
+			case_sensitive, severity, action, enabled
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at
+	`, rule.AccountID, rule.Name, rule.Description, rule.Type, rule.Pattern, rule.Keywords,
+		rule.CaseSensitive, rule.Severity, rule.Action, rule.Enabled,
+	).Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create account rule: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// GetAccountRule retrieves a rule, verifying ownership
+func (db *DB) GetAccountRule(ctx context.Context, ruleID, accountID uuid.UUID) (*AccountRule, error) {
+	rule, err := scanAccountRule(db.pool.QueryRow(ctx, `
+		SELECT `+accountRuleColumns+`
+		FROM account_rules
+		WHERE id = $1 AND account_id = $2
+	`, ruleID, accountID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAccountRuleNotFound
+		}
+		return nil, fmt.Errorf("failed to get account rule: %w", err)
+	}
+	return rule, nil
+}
+
+// ListAccountRules lists an account's rules, oldest first. With enabledOnly,
+// disabled rules are left out.
+func (db *DB) ListAccountRules(ctx context.Context, accountID uuid.UUID, enabledOnly bool) ([]AccountRule, error) {
+	rows, err := db.pool.Query(ctx, `
+		SELECT `+accountRuleColumns+`
+		FROM account_rules
+		WHERE account_id = $1 AND (enabled OR NOT $2)
+		ORDER BY created_at, id
+	`, accountID, enabledOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list account rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []AccountRule
+	for rows.Next() {
+		rule, err := scanAccountRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account rule: %w", err)
+		}
+		rules = append(rules, *rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating account rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// UpdateAccountRule replaces a rule's definition, verifying ownership
+func (db *DB) UpdateAccountRule(ctx context.Context, rule *AccountRule) error {
+	if rule.Keywords == nil {
+		rule.Keywords = []string{}
+	}
+	err := db.pool.QueryRow(ctx, `
+		UPDATE account_rules SET
+			name = $3, description = $4, rule_type = $5, pattern = $6, keywords = $7,
+			case_sensitive = $8, severity = $9, action = $10, enabled = $11, updated_at = NOW()
+		WHERE id = $1 AND account_id = $2
+		RETURNING created_at, updated_at
+	`, rule.ID, rule.AccountID, rule.Name, rule.Description, rule.Type, rule.Pattern, rule.Keywords,
+		rule.CaseSensitive, rule.Severity, rule.Action, rule.Enabled,
+	).Scan(&rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAccountRuleNotFound
+		}
+		return fmt.Errorf("failed to update account rule: %w", err)
+	}
+	return nil
+}
+
+// DeleteAccountRule removes a rule, verifying ownership
+func (db *DB) DeleteAccountRule(ctx context.Context, ruleID, accountID uuid.UUID) error {
+	result, err := db.pool.Exec(ctx, `
+		DELETE FROM account_rules WHERE id = $1 AND account_id = $2
+	`, ruleID, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to delete account rule: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAccountRuleNotFound
+	}
+	return nil
+}
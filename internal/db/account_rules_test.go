@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"stronghold/internal/db/testutil"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAccountRule(accountID uuid.UUID, name string, enabled bool) *AccountRule {
+	return &AccountRule{
+		AccountID: accountID,
+		Name:      name,
+		Type:      "keyword",
+		Keywords:  []string{"falcon"},
+		Severity:  "high",
+		Action:    "block",
+		Enabled:   enabled,
+	}
+}
+
+func TestAccountRules_CRUD(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close(t)
+
+	db := &DB{pool: testDB.Pool}
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, nil, nil)
+	require.NoError(t, err)
+
+	rule := newTestAccountRule(account.ID, "Codename", true)
+	require.NoError(t, db.CreateAccountRule(ctx, rule, 10))
+	assert.NotEqual(t, uuid.Nil, rule.ID)
+
+	got, err := db.GetAccountRule(ctx, rule.ID, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Codename", got.Name)
+	assert.Equal(t, []string{"falcon"}, got.Keywords)
+
+	// Another account cannot see or change the rule
+	other, err := db.CreateAccount(ctx, nil, nil)
+	require.NoError(t, err)
+	_, err = db.GetAccountRule(ctx, rule.ID, other.ID)
+	assert.ErrorIs(t, err, ErrAccountRuleNotFound)
+	assert.ErrorIs(t, db.DeleteAccountRule(ctx, rule.ID, other.ID), ErrAccountRuleNotFound)
+
+	rule.Type = "regex"
+	rule.Pattern = `(?i)falcon-\d+`
+	rule.Keywords = nil
+	rule.Enabled = false
+	require.NoError(t, db.UpdateAccountRule(ctx, rule))
+
+	enabled, err := db.ListAccountRules(ctx, account.ID, true)
+	require.NoError(t, err)
+	assert.Empty(t, enabled, "disabled rules should be left out")
+
+	all, err := db.ListAccountRules(ctx, account.ID, false)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "regex", all[0].Type)
+	assert.Equal(t, `(?i)falcon-\d+`, all[0].Pattern)
+
+	require.NoError(t, db.DeleteAccountRule(ctx, rule.ID, account.ID))
+	_, err = db.GetAccountRule(ctx, rule.ID, account.ID)
+	assert.ErrorIs(t, err, ErrAccountRuleNotFound)
+}
+
+func TestCreateAccountRule_EnforcesLimit(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close(t)
+
+	db := &DB{pool: testDB.Pool}
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, db.CreateAccountRule(ctx, newTestAccountRule(account.ID, "one", true), 2))
+	require.NoError(t, db.CreateAccountRule(ctx, newTestAccountRule(account.ID, "two", false), 2))
+
+	err = db.CreateAccountRule(ctx, newTestAccountRule(account.ID, "three", true), 2)
+	assert.ErrorIs(t, err, ErrAccountRuleLimitReached, "disabled rules count toward the limit")
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
@@ -788,3 +789,53 @@ func (db *DB) SetJailbreakDetectionEnabled(ctx context.Context, accountID uuid.U
 
 	return nil
 }
+
+// GetPIIPolicy reads the pii_policy setting, a map of PII category to action, from the account's metadata JSONB.
+// Returns nil if the key is absent, so the default policy applies.
+func (db *DB) GetPIIPolicy(ctx context.Context, accountID uuid.UUID) (map[string]string, error) {
+	var metadata map[string]any
+	err := db.QueryRow(ctx, `
+		SELECT metadata FROM accounts WHERE id = $1
+	`, accountID).Scan(&metadata)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("account not found")
+		}
+		return nil, fmt.Errorf("failed to get account metadata: %w", err)
+	}
+
+	stored, ok := metadata["pii_policy"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+
+	policy := make(map[string]string, len(stored))
+	for category, action := range stored {
+		if s, ok := action.(string); ok {
+			policy[category] = s
+		}
+	}
+	return policy, nil
+}
+
+// SetPIIPolicy replaces the pii_policy key in the account's metadata JSONB.
+func (db *DB) SetPIIPolicy(ctx context.Context, accountID uuid.UUID, policy map[string]string) error {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to encode PII policy: %w", err)
+	}
+
+	_, err = db.pool.Exec(ctx, `
+		UPDATE accounts
+		SET metadata = jsonb_set(COALESCE(metadata, '{}'::jsonb), '{pii_policy}', $1::jsonb),
+		    updated_at = $2
+		WHERE id = $3
+	`, string(data), time.Now().UTC(), accountID)
+
+	if err != nil {
+		return fmt.Errorf("failed to update PII policy: %w", err)
+	}
+
+	return nil
+}
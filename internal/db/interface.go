@@ -111,6 +111,13 @@ type Database interface {
 	MarkSettling(ctx context.Context, id uuid.UUID) error
 	LinkUsageLog(ctx context.Context, usageLogID, paymentTxID uuid.UUID) error
 
+	// Prepaid session operations
+	CreatePrepaidSession(ctx context.Context, session *PrepaidSession) error
+	GetPrepaidSession(ctx context.Context, tokenHash string) (*PrepaidSession, error)
+	DebitPrepaidSession(ctx context.Context, tokenHash string, amount usdc.MicroUSDC) (usdc.MicroUSDC, error)
+	CreditPrepaidSession(ctx context.Context, tokenHash string, amount usdc.MicroUSDC) (usdc.MicroUSDC, error)
+	CleanupExpiredPrepaidSessions(ctx context.Context) (int64, error)
+
 	// Webhook event idempotency
 	ClaimWebhookEvent(ctx context.Context, eventID, eventType string) (bool, error)
 	UnclaimWebhookEvent(ctx context.Context, eventID string) error
@@ -118,6 +125,15 @@ type Database interface {
 	// Account settings
 	GetJailbreakDetectionEnabled(ctx context.Context, accountID uuid.UUID, defaultValue bool) (bool, error)
 	SetJailbreakDetectionEnabled(ctx context.Context, accountID uuid.UUID, enabled bool) error
+	GetPIIPolicy(ctx context.Context, accountID uuid.UUID) (map[string]string, error)
+	SetPIIPolicy(ctx context.Context, accountID uuid.UUID, policy map[string]string) error
+
+	// Custom detection rules
+	CreateAccountRule(ctx context.Context, rule *AccountRule, maxRules int) error
+	GetAccountRule(ctx context.Context, ruleID, accountID uuid.UUID) (*AccountRule, error)
+	ListAccountRules(ctx context.Context, accountID uuid.UUID, enabledOnly bool) ([]AccountRule, error)
+	UpdateAccountRule(ctx context.Context, rule *AccountRule) error
+	DeleteAccountRule(ctx context.Context, ruleID, accountID uuid.UUID) error
 }
 
 // Ensure DB implements Database interface
@@ -0,0 +1,25 @@
+-- Prepaid x402 sessions. A client opens a session with one x402 payment and
+-- receives a bearer token; later requests are debited from the session
+-- balance instead of carrying their own payment.
+-- Token format: ps_<64 hex chars>, stored as SHA-256 hash
+
+CREATE TABLE IF NOT EXISTS prepaid_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    token_hash VARCHAR(64) NOT NULL,
+    payment_id UUID NOT NULL REFERENCES payment_transactions(id),
+    payer_address VARCHAR(64) NOT NULL,
+    network VARCHAR(32) NOT NULL,
+    deposit_usdc BIGINT NOT NULL,
+    balance_usdc BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ NOT NULL,
+    CONSTRAINT prepaid_sessions_token_hash_length CHECK (LENGTH(token_hash) = 64),
+    CONSTRAINT prepaid_sessions_balance_range CHECK (balance_usdc >= 0 AND balance_usdc <= deposit_usdc)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_prepaid_sessions_token_hash ON prepaid_sessions(token_hash);
+CREATE INDEX IF NOT EXISTS idx_prepaid_sessions_expires ON prepaid_sessions(expires_at);
+
+COMMENT ON COLUMN prepaid_sessions.deposit_usdc IS 'Amount paid to open the session in microUSDC';
+COMMENT ON COLUMN prepaid_sessions.balance_usdc IS 'Remaining balance in microUSDC';
@@ -0,0 +1,27 @@
+-- Custom detection rules per account. Rules are evaluated by the scan
+-- endpoints alongside the built-in detection layers and reported in
+-- threats_found with the category "custom".
+
+CREATE TABLE IF NOT EXISTS account_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    rule_type VARCHAR(16) NOT NULL,
+    pattern TEXT NOT NULL DEFAULT '',
+    keywords TEXT[] NOT NULL DEFAULT '{}',
+    case_sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+    severity VARCHAR(16) NOT NULL DEFAULT 'medium',
+    action VARCHAR(16) NOT NULL DEFAULT 'warn',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT account_rules_type_check CHECK (rule_type IN ('regex', 'keyword', 'phrase')),
+    CONSTRAINT account_rules_severity_check CHECK (severity IN ('low', 'medium', 'high', 'critical')),
+    CONSTRAINT account_rules_action_check CHECK (action IN ('warn', 'block'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_rules_account_id ON account_rules(account_id);
+
+COMMENT ON COLUMN account_rules.pattern IS 'Regular expression for regex rules';
+COMMENT ON COLUMN account_rules.keywords IS 'Words for keyword rules, phrases for phrase rules';
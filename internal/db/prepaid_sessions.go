@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"stronghold/internal/usdc"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// PrepaidSession is a balance opened with one x402 payment and debited by
+// later requests that present the session token
+type PrepaidSession struct {
+	ID           uuid.UUID      `json:"id"`
+	TokenHash    string         `json:"-"` // Never expose in JSON
+	PaymentID    uuid.UUID      `json:"payment_id"`
+	PayerAddress string         `json:"payer_address"`
+	Network      string         `json:"network"`
+	DepositUSDC  usdc.MicroUSDC `json:"deposit_usdc"`
+	BalanceUSDC  usdc.MicroUSDC `json:"balance_usdc"`
+	CreatedAt    time.Time      `json:"created_at"`
+	LastUsedAt   *time.Time     `json:"last_used_at,omitempty"`
+	ExpiresAt    time.Time      `json:"expires_at"`
+}
+
+// ErrPrepaidSessionNotFound is returned when a session token is unknown, the
+// session has expired, or the payment that opened it has not settled yet.
+var ErrPrepaidSessionNotFound = errors.New("prepaid session not found or not active")
+
+// ErrPrepaidSessionExhausted is returned when the session balance cannot cover a debit.
+var ErrPrepaidSessionExhausted = errors.New("prepaid session balance too low")
+
+// CreatePrepaidSession records a new session. The balance starts at the deposit.
+func (db *DB) CreatePrepaidSession(ctx context.Context, session *PrepaidSession) error {
+	session.BalanceUSDC = session.DepositUSDC
+
+	err := db.pool.QueryRow(ctx, `
+		INSERT INTO prepaid_sessions (
+			token_hash, payment_id, payer_address, network,
+			deposit_usdc, balance_usdc, expires_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`, session.TokenHash, session.PaymentID, session.PayerAddress, session.Network,
+		session.DepositUSDC, session.BalanceUSDC, session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create prepaid session: %w", err)
+	}
+
+	return nil
+}
+
+// GetPrepaidSession retrieves a session by its token hash, whether or not it is active
+func (db *DB) GetPrepaidSession(ctx context.Context, tokenHash string) (*PrepaidSession, error) {
+	var s PrepaidSession
+	err := db.pool.QueryRow(ctx, `
+		SELECT id, token_hash, payment_id, payer_address, network,
+			   deposit_usdc, balance_usdc, created_at, last_used_at, expires_at
+		FROM prepaid_sessions
+		WHERE token_hash = $1
+	`, tokenHash).Scan(
+		&s.ID, &s.TokenHash, &s.PaymentID, &s.PayerAddress, &s.Network,
+		&s.DepositUSDC, &s.BalanceUSDC, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrPrepaidSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get prepaid session: %w", err)
+	}
+
+	return &s, nil
+}
+
+// DebitPrepaidSession atomically takes amount from an active session and
+// returns the remaining balance. A session is active once the payment that
+// opened it has settled and until it expires. When the balance is too low,
+// ErrPrepaidSessionExhausted is returned along with the current balance.
+func (db *DB) DebitPrepaidSession(ctx context.Context, tokenHash string, amount usdc.MicroUSDC) (usdc.MicroUSDC, error) {
+	var balance usdc.MicroUSDC
+	err := db.pool.QueryRow(ctx, `
+		UPDATE prepaid_sessions s
+		SET balance_usdc = s.balance_usdc - $2, last_used_at = NOW()
+		FROM payment_transactions p
+		WHERE s.token_hash = $1
+		  AND p.id = s.payment_id
+		  AND p.status = 'completed'
+		  AND s.expires_at > NOW()
+		  AND s.balance_usdc >= $2
+		RETURNING s.balance_usdc
+	`, tokenHash, amount).Scan(&balance)
+	if err == nil {
+		return balance, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("failed to debit prepaid session: %w", err)
+	}
+
+	// Nothing was debited; tell an exhausted session from an unusable one
+	var active bool
+	err = db.pool.QueryRow(ctx, `
+		SELECT s.balance_usdc, (p.status = 'completed' AND s.expires_at > NOW())
+		FROM prepaid_sessions s
+		JOIN payment_transactions p ON p.id = s.payment_id
+		WHERE s.token_hash = $1
+	`, tokenHash).Scan(&balance, &active)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrPrepaidSessionNotFound
+		}
+		return 0, fmt.Errorf("failed to get prepaid session: %w", err)
+	}
+	if !active {
+		return 0, ErrPrepaidSessionNotFound
+	}
+	return balance, ErrPrepaidSessionExhausted
+}
+
+// CreditPrepaidSession returns amount to a session, for a debited request
+// that failed, and returns the new balance. The balance never exceeds the deposit.
+func (db *DB) CreditPrepaidSession(ctx context.Context, tokenHash string, amount usdc.MicroUSDC) (usdc.MicroUSDC, error) {
+	var balance usdc.MicroUSDC
+	err := db.pool.QueryRow(ctx, `
+		UPDATE prepaid_sessions
+		SET balance_usdc = LEAST(balance_usdc + $2, deposit_usdc)
+		WHERE token_hash = $1
+		RETURNING balance_usdc
+	`, tokenHash, amount).Scan(&balance)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrPrepaidSessionNotFound
+		}
+		return 0, fmt.Errorf("failed to credit prepaid session: %w", err)
+	}
+
+	return balance, nil
+}
+
+// CleanupExpiredPrepaidSessions removes sessions that expired more than a
+// day ago and returns how many were removed
+func (db *DB) CleanupExpiredPrepaidSessions(ctx context.Context) (int64, error) {
+	result, err := db.pool.Exec(ctx, `
+		DELETE FROM prepaid_sessions WHERE expires_at < NOW() - INTERVAL '1 day'
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to cleanup prepaid sessions: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"stronghold/internal/usdc"
+
+	"github.com/google/uuid"
+)
+
+// TestPrepaidSessionDebitFlow tests that a session is only usable once its
+// payment settles and that debits never overdraw it
+func TestPrepaidSessionDebitFlow(t *testing.T) {
+	// Skip if no database connection available
+	pool := getTestPool(t)
+	if pool == nil {
+		t.Skip("No database connection available")
+	}
+	db := &DB{pool: pool}
+	ctx := context.Background()
+
+	tx := &PaymentTransaction{
+		PaymentNonce:    "test-nonce-" + uuid.New().String(),
+		PaymentHeader:   "x402;test-header",
+		PayerAddress:    "0x1234567890123456789012345678901234567890",
+		ReceiverAddress: "0x0987654321098765432109876543210987654321",
+		Endpoint:        "/v1/sessions",
+		AmountUSDC:      usdc.MicroUSDC(3000),
+		Network:         "base-sepolia",
+		ExpiresAt:       time.Now().Add(5 * time.Minute),
+	}
+	if err := db.CreatePaymentTransaction(ctx, tx); err != nil {
+		t.Fatalf("Failed to create payment transaction: %v", err)
+	}
+	defer func() {
+		_, _ = db.pool.Exec(ctx, "DELETE FROM prepaid_sessions WHERE payment_id = $1", tx.ID)
+		_, _ = db.pool.Exec(ctx, "DELETE FROM payment_transactions WHERE id = $1", tx.ID)
+	}()
+
+	tokenHash := "test-" + uuid.New().String()
+	for len(tokenHash) < 64 {
+		tokenHash += "0"
+	}
+	session := &PrepaidSession{
+		TokenHash:    tokenHash,
+		PaymentID:    tx.ID,
+		PayerAddress: tx.PayerAddress,
+		Network:      tx.Network,
+		DepositUSDC:  tx.AmountUSDC,
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+	if err := db.CreatePrepaidSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create prepaid session: %v", err)
+	}
+	if session.BalanceUSDC != 3000 {
+		t.Errorf("Expected balance to start at the deposit, got %d", session.BalanceUSDC)
+	}
+
+	// Test: Unsettled payment cannot be spent
+	if _, err := db.DebitPrepaidSession(ctx, tokenHash, 1000); !errors.Is(err, ErrPrepaidSessionNotFound) {
+		t.Errorf("Expected ErrPrepaidSessionNotFound before settlement, got %v", err)
+	}
+
+	// Settle the payment
+	for _, step := range [][2]PaymentStatus{
+		{PaymentStatusReserved, PaymentStatusExecuting},
+		{PaymentStatusExecuting, PaymentStatusSettling},
+	} {
+		if err := db.TransitionStatus(ctx, tx.ID, step[0], step[1]); err != nil {
+			t.Fatalf("Failed to transition to %s: %v", step[1], err)
+		}
+	}
+	if err := db.CompleteSettlement(ctx, tx.ID, "payment-id-123"); err != nil {
+		t.Fatalf("Failed to complete settlement: %v", err)
+	}
+
+	// Test: Debits reduce the balance
+	balance, err := db.DebitPrepaidSession(ctx, tokenHash, 2000)
+	if err != nil {
+		t.Fatalf("Failed to debit session: %v", err)
+	}
+	if balance != 1000 {
+		t.Errorf("Expected balance 1000, got %d", balance)
+	}
+
+	// Test: Overdraw is refused and reports the balance
+	balance, err = db.DebitPrepaidSession(ctx, tokenHash, 2000)
+	if !errors.Is(err, ErrPrepaidSessionExhausted) {
+		t.Errorf("Expected ErrPrepaidSessionExhausted, got %v", err)
+	}
+	if balance != 1000 {
+		t.Errorf("Expected exhausted balance 1000, got %d", balance)
+	}
+
+	// Test: Credits never exceed the deposit
+	balance, err = db.CreditPrepaidSession(ctx, tokenHash, 5000)
+	if err != nil {
+		t.Fatalf("Failed to credit session: %v", err)
+	}
+	if balance != 3000 {
+		t.Errorf("Expected balance capped at 3000, got %d", balance)
+	}
+
+	// Test: Unknown token
+	if _, err := db.DebitPrepaidSession(ctx, "unknown", 1); !errors.Is(err, ErrPrepaidSessionNotFound) {
+		t.Errorf("Expected ErrPrepaidSessionNotFound for unknown token, got %v", err)
+	}
+}
@@ -145,3 +145,31 @@ func TestGetJailbreakDetectionEnabled_IndependentPerAccount(t *testing.T) {
 	require.NoError(t, err)
 	assert.False(t, enabled2)
 }
+
+func TestPIIPolicy_SetAndGet(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close(t)
+
+	db := &DB{pool: testDB.Pool}
+	ctx := context.Background()
+
+	account, err := db.CreateAccount(ctx, nil, nil)
+	require.NoError(t, err)
+
+	policy, err := db.GetPIIPolicy(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Nil(t, policy, "should return nil when not set")
+
+	err = db.SetJailbreakDetectionEnabled(ctx, account.ID, false)
+	require.NoError(t, err)
+	err = db.SetPIIPolicy(ctx, account.ID, map[string]string{"email": "allow", "card": "redact"})
+	require.NoError(t, err)
+
+	policy, err = db.GetPIIPolicy(ctx, account.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"email": "allow", "card": "redact"}, policy)
+
+	enabled, err := db.GetJailbreakDetectionEnabled(ctx, account.ID, true)
+	require.NoError(t, err)
+	assert.False(t, enabled, "setting the PII policy should keep other settings")
+}
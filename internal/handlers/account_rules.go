@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+
+	"stronghold/internal/db"
+	"stronghold/internal/stronghold"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+)
+
+// maxAccountRules is the number of custom rules an account may define
+const maxAccountRules = 100
+
+// AccountRulesHandler handles custom detection rule endpoints
+type AccountRulesHandler struct {
+	db *db.DB
+}
+
+// NewAccountRulesHandler creates a new account rules handler
+func NewAccountRulesHandler(database *db.DB) *AccountRulesHandler {
+	return &AccountRulesHandler{db: database}
+}
+
+// RegisterRoutes registers account rule routes
+func (h *AccountRulesHandler) RegisterRoutes(app *fiber.App, authHandler *AuthHandler) {
+	group := app.Group("/v1/account/rules")
+	group.Get("/", authHandler.AuthMiddleware(), authHandler.RequireTrustedDevice(), h.ListRules)
+	group.Post("/", authHandler.AuthMiddleware(), authHandler.RequireTrustedDevice(), h.CreateRule)
+	group.Get("/:id", authHandler.AuthMiddleware(), authHandler.RequireTrustedDevice(), h.GetRule)
+	group.Put("/:id", authHandler.AuthMiddleware(), authHandler.RequireTrustedDevice(), h.UpdateRule)
+	group.Delete("/:id", authHandler.AuthMiddleware(), authHandler.RequireTrustedDevice(), h.DeleteRule)
+}
+
+// AccountRuleRequest represents a request to create or replace a rule
+type AccountRuleRequest struct {
+	Name          string   `json:"name"`
+	Description   string   `json:"description"`
+	Type          string   `json:"type"`
+	Pattern       string   `json:"pattern"`
+	Keywords      []string `json:"keywords"`
+	CaseSensitive bool     `json:"case_sensitive"`
+	Severity      string   `json:"severity"`
+	Action        string   `json:"action"`
+	Enabled       *bool    `json:"enabled"` // Defaults to true
+}
+
+// ListAccountRulesResponse represents the list of an account's rules
+type ListAccountRulesResponse struct {
+	Rules    []db.AccountRule `json:"rules"`
+	MaxRules int              `json:"max_rules"`
+}
+
+// ListRules returns all of the account's rules
+func (h *AccountRulesHandler) ListRules(c fiber.Ctx) error {
+	accountID, err := ruleAccountID(c)
+	if err != nil {
+		return err
+	}
+
+	rules, err := h.db.ListAccountRules(c.Context(), accountID, false)
+	if err != nil {
+		slog.Error("failed to list account rules", "account_id", accountID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to list rules",
+		})
+	}
+	if rules == nil {
+		rules = []db.AccountRule{}
+	}
+
+	return c.JSON(ListAccountRulesResponse{
+		Rules:    rules,
+		MaxRules: maxAccountRules,
+	})
+}
+
+// CreateRule validates and stores a new rule
+func (h *AccountRulesHandler) CreateRule(c fiber.Ctx) error {
+	accountID, err := ruleAccountID(c)
+	if err != nil {
+		return err
+	}
+
+	rule, err := bindAccountRule(c)
+	if err != nil {
+		return err
+	}
+	rule.AccountID = accountID
+
+	if err := h.db.CreateAccountRule(c.Context(), rule, maxAccountRules); err != nil {
+		if errors.Is(err, db.ErrAccountRuleLimitReached) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Maximum number of rules reached",
+			})
+		}
+		slog.Error("failed to create account rule", "account_id", accountID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create rule",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// GetRule returns a single rule
+func (h *AccountRulesHandler) GetRule(c fiber.Ctx) error {
+	accountID, err := ruleAccountID(c)
+	if err != nil {
+		return err
+	}
+	ruleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid rule ID",
+		})
+	}
+
+	rule, err := h.db.GetAccountRule(c.Context(), ruleID, accountID)
+	if err != nil {
+		return ruleLookupError(c, err)
+	}
+	return c.JSON(rule)
+}
+
+// UpdateRule validates and replaces a rule
+func (h *AccountRulesHandler) UpdateRule(c fiber.Ctx) error {
+	accountID, err := ruleAccountID(c)
+	if err != nil {
+		return err
+	}
+	ruleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid rule ID",
+		})
+	}
+
+	rule, err := bindAccountRule(c)
+	if err != nil {
+		return err
+	}
+	rule.ID = ruleID
+	rule.AccountID = accountID
+
+	if err := h.db.UpdateAccountRule(c.Context(), rule); err != nil {
+		return ruleLookupError(c, err)
+	}
+	return c.JSON(rule)
+}
+
+// DeleteRule removes a rule
+func (h *AccountRulesHandler) DeleteRule(c fiber.Ctx) error {
+	accountID, err := ruleAccountID(c)
+	if err != nil {
+		return err
+	}
+	ruleID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid rule ID",
+		})
+	}
+
+	if err := h.db.DeleteAccountRule(c.Context(), ruleID, accountID); err != nil {
+		return ruleLookupError(c, err)
+	}
+	return c.JSON(fiber.Map{
+		"message": "Rule deleted",
+	})
+}
+
+// ruleAccountID extracts the account ID from the request context. Returns
+// fiber.NewError so callers never continue with uuid.Nil.
+func ruleAccountID(c fiber.Ctx) (uuid.UUID, error) {
+	accountIDStr, _ := c.Locals("account_id").(string)
+	if accountIDStr == "" {
+		return uuid.UUID{}, fiber.NewError(fiber.StatusUnauthorized, "Not authenticated")
+	}
+	accountID, err := uuid.Parse(accountIDStr)
+	if err != nil {
+		return uuid.UUID{}, fiber.NewError(fiber.StatusInternalServerError, "Invalid account ID")
+	}
+	return accountID, nil
+}
+
+// bindAccountRule parses and validates a rule from the request body. Rules
+// are compiled here so that invalid or overly complex patterns are rejected
+// when saved rather than when scanning.
+func bindAccountRule(c fiber.Ctx) (*db.AccountRule, error) {
+	var req AccountRuleRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	compiled, err := stronghold.CompileCustomRule(stronghold.CustomRule{
+		Name:          req.Name,
+		Description:   req.Description,
+		Type:          req.Type,
+		Pattern:       req.Pattern,
+		Keywords:      req.Keywords,
+		CaseSensitive: req.CaseSensitive,
+		Severity:      req.Severity,
+		Action:        req.Action,
+	})
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid rule: "+err.Error())
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	return &db.AccountRule{
+		Name:          compiled.Name,
+		Description:   compiled.Description,
+		Type:          compiled.Type,
+		Pattern:       compiled.Pattern,
+		Keywords:      compiled.Keywords,
+		CaseSensitive: compiled.CaseSensitive,
+		Severity:      compiled.Severity,
+		Action:        compiled.Action,
+		Enabled:       enabled,
+	}, nil
+}
+
+// ruleLookupError writes the response for a failed lookup of a single rule
+func ruleLookupError(c fiber.Ctx, err error) error {
+	if errors.Is(err, db.ErrAccountRuleNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Rule not found",
+		})
+	}
+	slog.Error("failed to access account rule", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to access rule",
+	})
+}
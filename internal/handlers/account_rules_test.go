@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"stronghold/internal/db"
+	"stronghold/internal/db/testutil"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAccountRulesTest(t *testing.T) (*fiber.App, *testutil.TestDB, *db.DB) {
+	testDB := testutil.NewTestDB(t)
+
+	cfg := &db.Config{
+		Host:     testDB.Host,
+		Port:     testDB.Port,
+		User:     testDB.User,
+		Password: testDB.Password,
+		Name:     testDB.Database,
+		SSLMode:  "disable",
+	}
+
+	database, err := db.New(cfg)
+	require.NoError(t, err)
+
+	authConfig := &AuthConfig{
+		JWTSecret:       "test-secret-key-for-testing",
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: 90 * 24 * time.Hour,
+		DashboardURL:    "http://localhost:3000",
+		AllowedOrigins:  []string{"http://localhost:3000"},
+		Cookie: CookieConfig{
+			Domain:   "",
+			Secure:   false,
+			SameSite: "Lax",
+		},
+	}
+
+	authHandler := NewAuthHandler(database, authConfig, nil)
+	rulesHandler := NewAccountRulesHandler(database)
+
+	app := fiber.New()
+	authHandler.RegisterRoutes(app)
+	rulesHandler.RegisterRoutes(app, authHandler)
+
+	return app, testDB, database
+}
+
+func sendRuleRequest(t *testing.T, app *fiber.App, method, path, accessToken string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+
+	var reqBody *bytes.Buffer
+	if body != nil {
+		bodyJSON, _ := json.Marshal(body)
+		reqBody = bytes.NewBuffer(bodyJSON)
+	} else {
+		reqBody = &bytes.Buffer{}
+	}
+	req := httptest.NewRequest(method, path, reqBody)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cookie", AccessTokenCookie+"="+accessToken)
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var decoded map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&decoded)
+	return resp.StatusCode, decoded
+}
+
+func TestAccountRules_CreateListUpdateDelete(t *testing.T) {
+	app, testDB, database := setupAccountRulesTest(t)
+	defer testDB.Close(t)
+	defer database.Close()
+
+	_, accessToken := createAuthenticatedAccountForSettings(t, app)
+
+	status, created := sendRuleRequest(t, app, "POST", "/v1/account/rules/", accessToken, map[string]interface{}{
+		"name":     "Codename",
+		"type":     "keyword",
+		"keywords": []string{"falcon"},
+		"action":   "block",
+	})
+	require.Equal(t, 201, status)
+	assert.Equal(t, "medium", created["severity"])
+	assert.Equal(t, true, created["enabled"])
+	id, _ := created["id"].(string)
+	require.NotEmpty(t, id)
+
+	status, list := sendRuleRequest(t, app, "GET", "/v1/account/rules/", accessToken, nil)
+	require.Equal(t, 200, status)
+	assert.Len(t, list["rules"], 1)
+
+	status, updated := sendRuleRequest(t, app, "PUT", "/v1/account/rules/"+id, accessToken, map[string]interface{}{
+		"name":    "Ticket",
+		"type":    "regex",
+		"pattern": `OPS-\d+`,
+		"enabled": false,
+	})
+	require.Equal(t, 200, status)
+	assert.Equal(t, "regex", updated["type"])
+	assert.Equal(t, false, updated["enabled"])
+
+	status, _ = sendRuleRequest(t, app, "DELETE", "/v1/account/rules/"+id, accessToken, nil)
+	assert.Equal(t, 200, status)
+	status, _ = sendRuleRequest(t, app, "GET", "/v1/account/rules/"+id, accessToken, nil)
+	assert.Equal(t, 404, status)
+}
+
+func TestAccountRules_RejectsInvalidRules(t *testing.T) {
+	app, testDB, database := setupAccountRulesTest(t)
+	defer testDB.Close(t)
+	defer database.Close()
+
+	_, accessToken := createAuthenticatedAccountForSettings(t, app)
+
+	invalid := []map[string]interface{}{
+		{"name": "Bad regex", "type": "regex", "pattern": "("},
+		{"name": "No keywords", "type": "keyword"},
+		{"name": "Unknown type", "type": "glob", "pattern": "*"},
+		{"name": "Too complex", "type": "regex", "pattern": `\w{1000}\w{1000}\w{1000}\w{1000}\w{1000}\w{1000}`},
+	}
+	for _, body := range invalid {
+		status, _ := sendRuleRequest(t, app, "POST", "/v1/account/rules/", accessToken, body)
+		assert.Equal(t, 400, status, "expected %v to be rejected", body["name"])
+	}
+
+	status, list := sendRuleRequest(t, app, "GET", "/v1/account/rules/", accessToken, nil)
+	require.Equal(t, 200, status)
+	assert.Empty(t, list["rules"])
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"stronghold/internal/config"
+	"stronghold/internal/db"
+	"stronghold/internal/middleware"
+	"stronghold/internal/usdc"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// PrepaidSessionHandler opens prepaid x402 sessions and reports their balance.
+// A session is opened with one x402 payment; later scans that present the
+// session token are debited from its balance instead of paying one by one.
+type PrepaidSessionHandler struct {
+	x402    *middleware.X402Middleware
+	db      *db.DB
+	pricing *config.PricingConfig
+	ttl     time.Duration
+}
+
+// NewPrepaidSessionHandler creates a new prepaid session handler
+func NewPrepaidSessionHandler(x402 *middleware.X402Middleware, database *db.DB, pricing *config.PricingConfig, ttl time.Duration) *PrepaidSessionHandler {
+	return &PrepaidSessionHandler{
+		x402:    x402,
+		db:      database,
+		pricing: pricing,
+		ttl:     ttl,
+	}
+}
+
+// OpenSessionRequest represents a request to open a prepaid session
+type OpenSessionRequest struct {
+	DepositMicroUSDC usdc.MicroUSDC `json:"deposit_micro_usdc"`
+}
+
+// PrepaidSessionResponse describes a prepaid session. The token is only
+// returned when the session is opened.
+type PrepaidSessionResponse struct {
+	Token            string         `json:"token,omitempty"`
+	DepositMicroUSDC usdc.MicroUSDC `json:"deposit_micro_usdc"`
+	BalanceMicroUSDC usdc.MicroUSDC `json:"balance_micro_usdc"`
+	ExpiresAt        time.Time      `json:"expires_at"`
+	RequestID        string         `json:"request_id,omitempty"`
+}
+
+// RegisterRoutes registers prepaid session routes
+func (h *PrepaidSessionHandler) RegisterRoutes(app *fiber.App) {
+	if h.db == nil {
+		panic("prepaid session handler requires database")
+	}
+	if h.x402 == nil {
+		panic("prepaid session handler requires x402 middleware")
+	}
+	if h.pricing == nil {
+		panic("prepaid session handler requires pricing config")
+	}
+
+	app.Post("/v1/sessions", h.x402.AtomicPaymentFunc(h.depositPrice), h.OpenSession)
+	app.Get("/v1/sessions/current", h.GetSession)
+}
+
+// OpenSession opens a prepaid session funded by the x402 payment on the request
+// @Summary Open a prepaid x402 session
+// @Description Pays a deposit with one x402 payment and returns a session token. Scans that send the token in X-Session-Token are debited from the deposit.
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Param request body OpenSessionRequest true "Session deposit"
+// @Success 201 {object} PrepaidSessionResponse
+// @Failure 400 {object} map[string]string
+// @Failure 402 {object} map[string]interface{}
+// @Router /v1/sessions [post]
+func (h *PrepaidSessionHandler) OpenSession(c fiber.Ctx) error {
+	requestID := middleware.GetRequestID(c)
+
+	// Sessions are funded by a settled x402 payment, never by another session
+	tx := middleware.GetPaymentTransaction(c)
+	if tx == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":      "Sessions must be opened with an x402 payment",
+			"request_id": requestID,
+		})
+	}
+
+	// Generate token: ps_ + 64 random hex chars
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Failed to generate session token",
+			"request_id": requestID,
+		})
+	}
+	token := "ps_" + hex.EncodeToString(randomBytes)
+
+	session := &db.PrepaidSession{
+		TokenHash:    middleware.HashSessionToken(token),
+		PaymentID:    tx.ID,
+		PayerAddress: tx.PayerAddress,
+		Network:      tx.Network,
+		DepositUSDC:  tx.AmountUSDC,
+		ExpiresAt:    time.Now().Add(h.ttl),
+	}
+	if err := h.db.CreatePrepaidSession(c.Context(), session); err != nil {
+		slog.Error("failed to create prepaid session", "request_id", requestID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":      "Failed to open session",
+			"request_id": requestID,
+		})
+	}
+
+	response := PrepaidSessionResponse{
+		Token:            token,
+		DepositMicroUSDC: session.DepositUSDC,
+		BalanceMicroUSDC: session.BalanceUSDC,
+		ExpiresAt:        session.ExpiresAt,
+		RequestID:        requestID,
+	}
+
+	// Record the response for idempotent replay, so a client retrying with
+	// the same payment after a settlement failure still gets its token
+	if err := h.db.RecordExecution(c.Context(), tx.ID, map[string]interface{}{
+		"token":              response.Token,
+		"deposit_micro_usdc": response.DepositMicroUSDC,
+		"balance_micro_usdc": response.BalanceMicroUSDC,
+		"expires_at":         response.ExpiresAt,
+		"request_id":         response.RequestID,
+	}); err != nil {
+		slog.Error("failed to record execution result",
+			"payment_id", tx.ID,
+			"request_id", requestID,
+			"error", err,
+		)
+	}
+
+	slog.Info("prepaid session opened",
+		"session_id", session.ID,
+		"payment_id", tx.ID,
+		"deposit", session.DepositUSDC.String(),
+	)
+
+	c.Set(middleware.SessionBalanceHeader, strconv.FormatInt(int64(session.BalanceUSDC), 10))
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// GetSession returns the balance of the session in X-Session-Token
+// @Summary Get prepaid session balance
+// @Description Returns the deposit, remaining balance and expiry of the session whose token is sent in X-Session-Token
+// @Tags sessions
+// @Produce json
+// @Param X-Session-Token header string true "Session token"
+// @Success 200 {object} PrepaidSessionResponse
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /v1/sessions/current [get]
+func (h *PrepaidSessionHandler) GetSession(c fiber.Ctx) error {
+	token := c.Get(middleware.SessionTokenHeader)
+	if token == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Session token is required",
+		})
+	}
+
+	session, err := h.db.GetPrepaidSession(c.Context(), middleware.HashSessionToken(token))
+	if err != nil {
+		if errors.Is(err, db.ErrPrepaidSessionNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Session not found",
+			})
+		}
+		slog.Error("failed to get prepaid session", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get session",
+		})
+	}
+
+	c.Set(middleware.SessionBalanceHeader, strconv.FormatInt(int64(session.BalanceUSDC), 10))
+	return c.JSON(PrepaidSessionResponse{
+		DepositMicroUSDC: session.DepositUSDC,
+		BalanceMicroUSDC: session.BalanceUSDC,
+		ExpiresAt:        session.ExpiresAt,
+	})
+}
+
+// depositPrice prices a session at the requested deposit, within the
+// configured bounds
+func (h *PrepaidSessionHandler) depositPrice(c fiber.Ctx) (usdc.MicroUSDC, error) {
+	var req OpenSessionRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return 0, errors.New("Invalid request body")
+	}
+	if req.DepositMicroUSDC < h.pricing.SessionMin || req.DepositMicroUSDC > h.pricing.SessionMax {
+		return 0, fmt.Errorf("Deposit must be between %s and %s USDC", h.pricing.SessionMin, h.pricing.SessionMax)
+	}
+	return req.DepositMicroUSDC, nil
+}
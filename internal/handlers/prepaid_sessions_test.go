@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"stronghold/internal/config"
+	"stronghold/internal/db"
+	"stronghold/internal/middleware"
+	"stronghold/internal/usdc"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepaidSession_DepositPriceBounds(t *testing.T) {
+	handler := &PrepaidSessionHandler{pricing: &config.PricingConfig{
+		SessionMin: usdc.MicroUSDC(10000),
+		SessionMax: usdc.MicroUSDC(10000000),
+	}}
+
+	app := fiber.New()
+	app.Post("/price", func(c fiber.Ctx) error {
+		price, err := handler.depositPrice(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"price": price})
+	})
+
+	tests := []struct {
+		deposit        string
+		expectedStatus int
+	}{
+		{"100000", 200},
+		{"10000", 200},
+		{"9999", 400},
+		{"10000001", 400},
+	}
+	for _, tt := range tests {
+		bodyJSON, _ := json.Marshal(map[string]string{"deposit_micro_usdc": tt.deposit})
+		req := httptest.NewRequest("POST", "/price", bytes.NewBuffer(bodyJSON))
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, tt.expectedStatus, resp.StatusCode, "deposit %s", tt.deposit)
+	}
+}
+
+func TestPrepaidSession_OpenRequiresPayment(t *testing.T) {
+	// Dev mode lets the request through without a payment transaction
+	x402cfg := &config.X402Config{
+		EVMWalletAddress: "",
+		FacilitatorURL:   "https://x402.org/facilitator",
+		Networks:         []string{"base-sepolia"},
+	}
+	pricing := &config.PricingConfig{SessionMin: usdc.MicroUSDC(10000), SessionMax: usdc.MicroUSDC(10000000)}
+	x402 := middleware.NewX402Middleware(x402cfg, pricing)
+	handler := NewPrepaidSessionHandler(x402, &db.DB{}, pricing, 0)
+
+	app := fiber.New()
+	app.Use(middleware.RequestID())
+	handler.RegisterRoutes(app)
+
+	bodyJSON, _ := json.Marshal(map[string]string{"deposit_micro_usdc": "100000"})
+	req := httptest.NewRequest("POST", "/v1/sessions", bytes.NewBuffer(bodyJSON))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 400, resp.StatusCode)
+}
+
+func TestPrepaidSession_GetRequiresToken(t *testing.T) {
+	handler := NewPrepaidSessionHandler(nil, &db.DB{}, &config.PricingConfig{}, 0)
+
+	app := fiber.New()
+	app.Get("/v1/sessions/current", handler.GetSession)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/sessions/current", nil))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 401, resp.StatusCode)
+}
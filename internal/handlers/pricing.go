@@ -59,6 +59,8 @@ func (h *PricingHandler) GetPricing(c fiber.Ctx) error {
 			description = "Content scanning for prompt injection detection"
 		case "/v1/scan/output":
 			description = "Output scanning for credential leak detection"
+		case "/v1/scan/batch":
+			description = "Batch content scanning, priced per item"
 		}
 
 		routePrices = append(routePrices, RoutePrice{
@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 
 	"stronghold/internal/config"
 	"stronghold/internal/db"
 	"stronghold/internal/middleware"
+	"stronghold/internal/pii"
 	"stronghold/internal/stronghold"
 	"stronghold/internal/usdc"
 
@@ -45,13 +49,33 @@ func NewScanHandlerWithPaymentRouter(scanner *stronghold.Scanner, x402 *middlewa
 
 // ScanContentRequest represents a request to scan external content for prompt injection
 type ScanContentRequest struct {
-	Text        string `json:"text"`
-	SourceURL   string `json:"source_url,omitempty"`   // Where content came from (e.g., https://github.com/...)
-	SourceType  string `json:"source_type,omitempty"`  // "web_page", "file", "api_response", "code_repo"
-	ContentType string `json:"content_type,omitempty"` // "html", "markdown", "json", "text", "code"
-	FilePath    string `json:"file_path,omitempty"`    // For file reads, e.g., "README.md"
+	Text        string            `json:"text"`
+	SourceURL   string            `json:"source_url,omitempty"`   // Where content came from (e.g., https://github.com/...)
+	SourceType  string            `json:"source_type,omitempty"`  // "web_page", "file", "api_response", "code_repo"
+	ContentType string            `json:"content_type,omitempty"` // "html", "markdown", "json", "text", "code"
+	FilePath    string            `json:"file_path,omitempty"`    // For file reads, e.g., "README.md"
+	MCPTools    map[string]string `json:"mcp_tools,omitempty"`    // Tool names by JSON-RPC call ID, for MCP tool results
 }
 
+// ScanBatchRequest represents a request to scan several pieces of content
+// under a single payment
+type ScanBatchRequest struct {
+	Items []ScanContentRequest `json:"items"`
+}
+
+// ScanBatchResponse holds one scan result per item, in request order
+type ScanBatchResponse struct {
+	Results   []*stronghold.ScanResult `json:"results"`
+	RequestID string                   `json:"request_id"`
+}
+
+// Batch limits
+const (
+	maxScanTextSize  = 500 * 1024      // Per item, same as /v1/scan/content
+	maxBatchItems    = 32              // Items per batch
+	maxBatchTextSize = 2 * 1024 * 1024 // Text across all items
+)
+
 // ScanOutputRequest represents a request to scan LLM/agent output for credential leaks
 type ScanOutputRequest struct {
 	Text string `json:"text"`
@@ -79,9 +103,11 @@ func (h *ScanHandler) RegisterRoutes(app *fiber.App) {
 	if h.paymentRouter != nil {
 		group.Post("/content", h.paymentRouter.Route(h.pricing.ScanContent), h.ScanContent)
 		group.Post("/output", h.paymentRouter.Route(h.pricing.ScanOutput), h.ScanOutput)
+		group.Post("/batch", h.paymentRouter.RouteFunc(h.batchPrice), h.ScanBatch)
 	} else {
 		group.Post("/content", h.x402.AtomicPayment(h.pricing.ScanContent), h.ScanContent)
 		group.Post("/output", h.x402.AtomicPayment(h.pricing.ScanOutput), h.ScanOutput)
+		group.Post("/batch", h.x402.AtomicPaymentFunc(h.batchPrice), h.ScanBatch)
 	}
 }
 
@@ -115,14 +141,14 @@ func (h *ScanHandler) ScanContent(c fiber.Ctx) error {
 	}
 
 	// Reject oversized payloads (500KB limit)
-	if len(req.Text) > 500*1024 {
+	if len(req.Text) > maxScanTextSize {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":      "Text too large, maximum size is 500KB",
 			"request_id": requestID,
 		})
 	}
 
-	result, err := h.scanner.ScanContent(c.Context(), req.Text, req.SourceURL, req.SourceType, req.ContentType)
+	result, err := h.scanContentItem(c.Context(), &req)
 	if err != nil {
 		slog.Error("scan content failed", "request_id", requestID, "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -131,20 +157,14 @@ func (h *ScanHandler) ScanContent(c fiber.Ctx) error {
 		})
 	}
 
-	// Add source metadata to result
-	if result.Metadata == nil {
-		result.Metadata = make(map[string]interface{})
-	}
-	result.Metadata["source_url"] = req.SourceURL
-	result.Metadata["source_type"] = req.SourceType
-	result.Metadata["content_type"] = req.ContentType
-	result.Metadata["file_path"] = req.FilePath
-
 	result.RequestID = requestID
 
 	// Filter jailbreak threats based on auth method and settings
 	h.filterJailbreakThreats(c, result)
 
+	// Apply the account's custom detection rules
+	stronghold.ApplyCustomRules(result, req.Text, h.accountRules(c))
+
 	// Record execution result in payment transaction for idempotent replay
 	h.recordExecutionResult(c, result)
 
@@ -154,9 +174,142 @@ func (h *ScanHandler) ScanContent(c fiber.Ctx) error {
 	return c.JSON(result)
 }
 
+// ScanBatch handles content scanning for several items under one payment
+// @Summary Scan a batch of external content for prompt injection
+// @Description Scans up to 32 items of external content in one request. Payment is priced per item and settled once for the whole batch.
+// @Tags scan
+// @Accept json
+// @Produce json
+// @Param request body ScanBatchRequest true "Batch scan request"
+// @Success 200 {object} ScanBatchResponse
+// @Failure 400 {object} map[string]string
+// @Failure 402 {object} map[string]interface{}
+// @Router /v1/scan/batch [post]
+func (h *ScanHandler) ScanBatch(c fiber.Ctx) error {
+	requestID := middleware.GetRequestID(c)
+
+	var req ScanBatchRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":      "Invalid request body",
+			"request_id": requestID,
+		})
+	}
+
+	if err := validateBatch(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":      err.Error(),
+			"request_id": requestID,
+		})
+	}
+
+	response := ScanBatchResponse{
+		Results:   make([]*stronghold.ScanResult, len(req.Items)),
+		RequestID: requestID,
+	}
+	rules := h.accountRules(c)
+	for i := range req.Items {
+		result, err := h.scanContentItem(c.Context(), &req.Items[i])
+		if err != nil {
+			slog.Error("batch scan failed", "request_id", requestID, "item", i, "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":      "Scan failed",
+				"request_id": requestID,
+			})
+		}
+		result.RequestID = requestID
+		h.filterJailbreakThreats(c, result)
+		stronghold.ApplyCustomRules(result, req.Items[i].Text, rules)
+		response.Results[i] = result
+	}
+
+	// Record execution result in payment transaction for idempotent replay
+	h.recordExecution(c, requestID, map[string]interface{}{
+		"request_id": requestID,
+		"results":    response.Results,
+	})
+
+	// Log usage for B2B requests, one entry per item
+	for _, result := range response.Results {
+		h.logB2BUsage(c, result, "/v1/scan/batch", h.pricing.ScanBatchItem)
+	}
+
+	return c.JSON(response)
+}
+
+// batchPrice prices a batch request per item. Invalid batches are rejected
+// before any payment is taken.
+func (h *ScanHandler) batchPrice(c fiber.Ctx) (usdc.MicroUSDC, error) {
+	var req ScanBatchRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return 0, errors.New("Invalid request body")
+	}
+	if err := validateBatch(&req); err != nil {
+		return 0, err
+	}
+	return h.pricing.ScanBatchItem * usdc.MicroUSDC(len(req.Items)), nil
+}
+
+// validateBatch checks a batch against the item and size limits
+func validateBatch(req *ScanBatchRequest) error {
+	if len(req.Items) == 0 {
+		return errors.New("Items are required")
+	}
+	if len(req.Items) > maxBatchItems {
+		return fmt.Errorf("Too many items, maximum is %d", maxBatchItems)
+	}
+
+	total := 0
+	for i, item := range req.Items {
+		if item.Text == "" {
+			return fmt.Errorf("Text is required (item %d)", i)
+		}
+		if len(item.Text) > maxScanTextSize {
+			return fmt.Errorf("Text too large, maximum size is 500KB (item %d)", i)
+		}
+		total += len(item.Text)
+	}
+	if total > maxBatchTextSize {
+		return errors.New("Batch too large, maximum total size is 2MB")
+	}
+	return nil
+}
+
+// scanContentItem scans one piece of content and adds its source metadata
+func (h *ScanHandler) scanContentItem(ctx context.Context, req *ScanContentRequest) (*stronghold.ScanResult, error) {
+	// HTML is segmented so hidden text is scored apart from visible text,
+	// MCP tool results are scored item by item, and other JSON field by
+	// field
+	var result *stronghold.ScanResult
+	var err error
+	switch {
+	case stronghold.IsHTMLContentType(req.ContentType):
+		result, err = h.scanner.ScanHTML(ctx, req.Text, req.SourceURL, req.SourceType, req.ContentType)
+	case stronghold.IsMCPContentType(req.ContentType) || len(req.MCPTools) > 0:
+		// Falls back to ScanJSON for JSON that is not an MCP message
+		result, err = h.scanner.ScanMCP(ctx, req.Text, req.SourceURL, req.SourceType, req.ContentType, req.MCPTools)
+	default:
+		result, err = h.scanner.ScanContent(ctx, req.Text, req.SourceURL, req.SourceType, req.ContentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Add source metadata to result
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	result.Metadata["source_url"] = req.SourceURL
+	result.Metadata["source_type"] = req.SourceType
+	result.Metadata["content_type"] = req.ContentType
+	result.Metadata["file_path"] = req.FilePath
+
+	return result, nil
+}
+
 // ScanOutput handles output scanning
-// @Summary Scan LLM output for credential leaks
-// @Description Scans LLM output text for credential leaks and sensitive data exposure
+// @Summary Scan LLM output for credential leaks and personal data
+// @Description Scans LLM output text for credential leaks and personal data. Personal data is only checked for accounts with a PII policy, which decides what is blocked and what is redacted in sanitized_text.
 // @Tags scan
 // @Accept json
 // @Produce json
@@ -191,7 +344,7 @@ func (h *ScanHandler) ScanOutput(c fiber.Ctx) error {
 		})
 	}
 
-	result, err := h.scanner.ScanOutput(c.Context(), req.Text)
+	result, err := h.scanner.ScanOutput(c.Context(), req.Text, h.piiPolicy(c))
 	if err != nil {
 		slog.Error("scan output failed", "request_id", requestID, "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -202,6 +355,9 @@ func (h *ScanHandler) ScanOutput(c fiber.Ctx) error {
 
 	result.RequestID = requestID
 
+	// Apply the account's custom detection rules
+	stronghold.ApplyCustomRules(result, req.Text, h.accountRules(c))
+
 	// Record execution result in payment transaction for idempotent replay
 	h.recordExecutionResult(c, result)
 
@@ -263,6 +419,73 @@ func (h *ScanHandler) filterJailbreakThreats(c fiber.Ctx, result *stronghold.Sca
 	}
 }
 
+// accountRules loads the enabled custom rules of a B2B (API key) account.
+// Rules are validated when saved; one that no longer compiles is skipped.
+// If the rules cannot be loaded the scan goes ahead without them.
+func (h *ScanHandler) accountRules(c fiber.Ctx) []*stronghold.CompiledCustomRule {
+	authMethod, _ := c.Locals("auth_method").(string)
+	if authMethod != "api_key" {
+		return nil
+	}
+	accountIDStr, _ := c.Locals("account_id").(string)
+	accountID, err := uuid.Parse(accountIDStr)
+	if err != nil {
+		return nil
+	}
+
+	stored, err := h.db.ListAccountRules(c.Context(), accountID, true)
+	if err != nil {
+		slog.Warn("failed to load account rules, scanning without them",
+			"account_id", accountIDStr, "error", err)
+		return nil
+	}
+
+	rules := make([]*stronghold.CompiledCustomRule, 0, len(stored))
+	for _, r := range stored {
+		compiled, err := stronghold.CompileCustomRule(stronghold.CustomRule{
+			ID:            r.ID.String(),
+			Name:          r.Name,
+			Description:   r.Description,
+			Type:          r.Type,
+			Pattern:       r.Pattern,
+			Keywords:      r.Keywords,
+			CaseSensitive: r.CaseSensitive,
+			Severity:      r.Severity,
+			Action:        r.Action,
+		})
+		if err != nil {
+			slog.Warn("skipping invalid account rule",
+				"account_id", accountIDStr, "rule_id", r.ID, "error", err)
+			continue
+		}
+		rules = append(rules, compiled)
+	}
+	return rules
+}
+
+// piiPolicy loads the PII policy of a B2B (API key) account. PII detection
+// is opt-in: other callers, accounts without a stored policy and accounts
+// whose policy cannot be loaded get nil, and output scans skip it.
+func (h *ScanHandler) piiPolicy(c fiber.Ctx) pii.Policy {
+	authMethod, _ := c.Locals("auth_method").(string)
+	if authMethod != "api_key" {
+		return nil
+	}
+	accountIDStr, _ := c.Locals("account_id").(string)
+	accountID, err := uuid.Parse(accountIDStr)
+	if err != nil {
+		return nil
+	}
+
+	policy, err := h.db.GetPIIPolicy(c.Context(), accountID)
+	if err != nil {
+		slog.Warn("failed to load PII policy, skipping PII detection",
+			"account_id", accountIDStr, "error", err)
+		return nil
+	}
+	return policy
+}
+
 // logB2BUsage creates a usage log entry for B2B (API key) requests.
 // x402 payment requests already have their own logging via the payment transaction.
 func (h *ScanHandler) logB2BUsage(c fiber.Ctx, result *stronghold.ScanResult, endpoint string, cost usdc.MicroUSDC) {
@@ -315,15 +538,6 @@ func (h *ScanHandler) logB2BUsage(c fiber.Ctx, result *stronghold.ScanResult, en
 
 // recordExecutionResult stores the scan result in the payment transaction for idempotent replay
 func (h *ScanHandler) recordExecutionResult(c fiber.Ctx, result *stronghold.ScanResult) {
-	if h.db == nil {
-		return
-	}
-
-	tx := middleware.GetPaymentTransaction(c)
-	if tx == nil {
-		return
-	}
-
 	// Convert result to map for storage
 	resultMap := map[string]interface{}{
 		"request_id":         result.RequestID,
@@ -337,12 +551,26 @@ func (h *ScanHandler) recordExecutionResult(c fiber.Ctx, result *stronghold.Scan
 		"recommended_action": result.RecommendedAction,
 	}
 
+	h.recordExecution(c, result.RequestID, resultMap)
+}
+
+// recordExecution stores a response body in the payment transaction for idempotent replay
+func (h *ScanHandler) recordExecution(c fiber.Ctx, requestID string, resultMap map[string]interface{}) {
+	if h.db == nil {
+		return
+	}
+
+	tx := middleware.GetPaymentTransaction(c)
+	if tx == nil {
+		return
+	}
+
 	if err := h.db.RecordExecution(c.Context(), tx.ID, resultMap); err != nil {
 		// Log but don't fail - the result was already computed
 		// The middleware will still attempt settlement
 		slog.Error("failed to record execution result",
 			"payment_id", tx.ID,
-			"request_id", result.RequestID,
+			"request_id", requestID,
 			"error", err,
 		)
 	}
@@ -403,6 +403,77 @@ func TestScanHandler_RegisterRoutes_PanicsWithoutScanner(t *testing.T) {
 	})
 }
 
+func TestScanBatch_Validation(t *testing.T) {
+	handler := &ScanHandler{pricing: &config.PricingConfig{ScanBatchItem: usdc.MicroUSDC(1000)}}
+
+	app := fiber.New()
+	app.Use(middleware.RequestID())
+	app.Post("/v1/scan/batch", handler.ScanBatch)
+
+	tooMany := make([]map[string]string, maxBatchItems+1)
+	for i := range tooMany {
+		tooMany[i] = map[string]string{"text": "hello"}
+	}
+
+	testCases := []struct {
+		name    string
+		body    interface{}
+		wantErr string
+	}{
+		{"no items", map[string]interface{}{"items": []interface{}{}}, "Items are required"},
+		{"empty text", map[string]interface{}{"items": []map[string]string{{"text": "a"}, {"text": ""}}}, "Text is required (item 1)"},
+		{"too many items", map[string]interface{}{"items": tooMany}, "Too many items, maximum is 32"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			bodyJSON, _ := json.Marshal(tc.body)
+			req := httptest.NewRequest("POST", "/v1/scan/batch", bytes.NewBuffer(bodyJSON))
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, 400, resp.StatusCode)
+
+			var body map[string]interface{}
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, tc.wantErr, body["error"])
+			assert.Contains(t, body, "request_id")
+		})
+	}
+}
+
+func TestScanBatch_PricedPerItem(t *testing.T) {
+	handler := &ScanHandler{pricing: &config.PricingConfig{ScanBatchItem: usdc.MicroUSDC(800)}}
+
+	app := fiber.New()
+	app.Post("/price", func(c fiber.Ctx) error {
+		price, err := handler.batchPrice(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"price": price})
+	})
+
+	bodyJSON, _ := json.Marshal(map[string]interface{}{
+		"items": []map[string]string{{"text": "a"}, {"text": "b"}, {"text": "c"}},
+	})
+	req := httptest.NewRequest("POST", "/price", bytes.NewBuffer(bodyJSON))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var body map[string]usdc.MicroUSDC
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, usdc.MicroUSDC(2400), body["price"])
+}
+
 // --- Jailbreak filtering tests ---
 
 // makeScanResult builds a ScanResult with the given threats and decision.
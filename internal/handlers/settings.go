@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"stronghold/internal/db"
+	"stronghold/internal/pii"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
@@ -57,15 +58,24 @@ func (h *SettingsHandler) GetSettings(c fiber.Ctx) error {
 		})
 	}
 
+	policy, err := h.db.GetPIIPolicy(c.Context(), accountID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get settings",
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"jailbreak_detection_enabled": enabled,
+		"pii_policy":                  effectivePIIPolicy(policy),
 		"has_api_keys":                hasKeys,
 	})
 }
 
 // UpdateSettingsRequest represents a request to update account settings
 type UpdateSettingsRequest struct {
-	JailbreakDetectionEnabled *bool `json:"jailbreak_detection_enabled"`
+	JailbreakDetectionEnabled *bool             `json:"jailbreak_detection_enabled"`
+	PIIPolicy                 map[string]string `json:"pii_policy"` // Actions by PII category, turning PII detection on; categories left out keep their default
 }
 
 // UpdateSettings updates the account settings
@@ -91,6 +101,14 @@ func (h *SettingsHandler) UpdateSettings(c fiber.Ctx) error {
 		})
 	}
 
+	if req.PIIPolicy != nil {
+		if err := pii.Policy(req.PIIPolicy).Validate(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
 	if req.JailbreakDetectionEnabled != nil {
 		if err := h.db.SetJailbreakDetectionEnabled(c.Context(), accountID, *req.JailbreakDetectionEnabled); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -99,6 +117,14 @@ func (h *SettingsHandler) UpdateSettings(c fiber.Ctx) error {
 		}
 	}
 
+	if req.PIIPolicy != nil {
+		if err := h.db.SetPIIPolicy(c.Context(), accountID, req.PIIPolicy); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update settings",
+			})
+		}
+	}
+
 	// Return updated settings
 	hasKeys, err := h.db.HasActiveAPIKeys(c.Context(), accountID)
 	if err != nil {
@@ -112,9 +138,30 @@ func (h *SettingsHandler) UpdateSettings(c fiber.Ctx) error {
 			"error": "Failed to read updated settings",
 		})
 	}
+	policy, err := h.db.GetPIIPolicy(c.Context(), accountID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to read updated settings",
+		})
+	}
 
 	return c.JSON(fiber.Map{
 		"jailbreak_detection_enabled": enabled,
+		"pii_policy":                  effectivePIIPolicy(policy),
 		"has_api_keys":                hasKeys,
 	})
 }
+
+// effectivePIIPolicy returns the action for every PII category: the
+// account's own, or the default. It returns nil while the account has not
+// opted in to PII detection by storing a policy.
+func effectivePIIPolicy(stored map[string]string) pii.Policy {
+	if stored == nil {
+		return nil
+	}
+	policy := pii.DefaultPolicy()
+	for category, action := range stored {
+		policy[category] = action
+	}
+	return policy
+}
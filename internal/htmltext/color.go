@@ -0,0 +1,180 @@
+package htmltext
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// rgb is a parsed CSS color
+type rgb struct {
+	r, g, b     float64
+	transparent bool
+}
+
+// colorWhite is the assumed page background when none is declared
+var colorWhite = rgb{r: 255, g: 255, b: 255}
+
+// namedColors covers the CSS color keywords commonly used to hide text
+var namedColors = map[string]rgb{
+	"white":       {r: 255, g: 255, b: 255},
+	"snow":        {r: 255, g: 250, b: 250},
+	"ivory":       {r: 255, g: 255, b: 240},
+	"whitesmoke":  {r: 245, g: 245, b: 245},
+	"black":       {},
+	"gray":        {r: 128, g: 128, b: 128},
+	"grey":        {r: 128, g: 128, b: 128},
+	"silver":      {r: 192, g: 192, b: 192},
+	"lightgray":   {r: 211, g: 211, b: 211},
+	"lightgrey":   {r: 211, g: 211, b: 211},
+	"red":         {r: 255},
+	"green":       {g: 128},
+	"blue":        {b: 255},
+	"navy":        {b: 128},
+	"yellow":      {r: 255, g: 255},
+	"transparent": {transparent: true},
+}
+
+// parseColor parses hex, rgb()/rgba() and named CSS colors
+func parseColor(v string) (rgb, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == "" {
+		return rgb{}, false
+	}
+	if c, ok := namedColors[v]; ok {
+		return c, true
+	}
+	if strings.HasPrefix(v, "#") {
+		hex := v[1:]
+		switch len(hex) {
+		case 3, 4:
+			var expanded strings.Builder
+			for _, ch := range hex {
+				expanded.WriteRune(ch)
+				expanded.WriteRune(ch)
+			}
+			hex = expanded.String()
+		case 6, 8:
+		default:
+			return rgb{}, false
+		}
+		n, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			return rgb{}, false
+		}
+		if len(hex) == 8 {
+			alpha := n & 0xff
+			n >>= 8
+			if alpha == 0 {
+				return rgb{transparent: true}, true
+			}
+		}
+		return rgb{r: float64(n >> 16 & 0xff), g: float64(n >> 8 & 0xff), b: float64(n & 0xff)}, true
+	}
+	if strings.HasPrefix(v, "rgb") {
+		open := strings.IndexByte(v, '(')
+		end := strings.IndexByte(v, ')')
+		if open < 0 || end < open {
+			return rgb{}, false
+		}
+		fields := strings.FieldsFunc(v[open+1:end], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '/'
+		})
+		if len(fields) < 3 {
+			return rgb{}, false
+		}
+		var vals [4]float64
+		vals[3] = 1
+		for i := 0; i < len(fields) && i < 4; i++ {
+			f := fields[i]
+			pct := strings.HasSuffix(f, "%")
+			n, err := strconv.ParseFloat(strings.TrimSuffix(f, "%"), 64)
+			if err != nil {
+				return rgb{}, false
+			}
+			if pct {
+				if i == 3 {
+					n /= 100
+				} else {
+					n = n * 255 / 100
+				}
+			}
+			vals[i] = n
+		}
+		if vals[3] == 0 {
+			return rgb{transparent: true}, true
+		}
+		return rgb{r: vals[0], g: vals[1], b: vals[2]}, true
+	}
+	return rgb{}, false
+}
+
+// backgroundOf returns the background color an element declares
+func backgroundOf(n *html.Node, style map[string]string) (rgb, bool) {
+	if v, ok := style["background-color"]; ok {
+		if c, ok := parseColor(v); ok && !c.transparent {
+			return c, true
+		}
+	}
+	if v, ok := style["background"]; ok {
+		// Only a bare color is understood; shorthand with images is ignored
+		if c, ok := parseColor(v); ok && !c.transparent {
+			return c, true
+		}
+	}
+	if c, ok := parseColor(attr(n, "bgcolor")); ok && !c.transparent {
+		return c, true
+	}
+	return rgb{}, false
+}
+
+// foregroundOf returns the text color an element declares
+func foregroundOf(n *html.Node, style map[string]string) (rgb, bool) {
+	if v, ok := style["color"]; ok {
+		return parseColor(v)
+	}
+	if n.DataAtom == atom.Font {
+		return parseColor(attr(n, "color"))
+	}
+	return rgb{}, false
+}
+
+// lowContrast reports whether text in fg is effectively invisible on bg,
+// using the WCAG contrast ratio. Ratios below 1.2 are indistinguishable
+// to most readers.
+func lowContrast(fg, bg rgb) bool {
+	if fg.transparent {
+		return true
+	}
+	return contrastRatio(fg, bg) < 1.2
+}
+
+func contrastRatio(a, b rgb) float64 {
+	la, lb := luminance(a), luminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+func luminance(c rgb) float64 {
+	channel := func(v float64) float64 {
+		v /= 255
+		if v <= 0.03928 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c.r) + 0.7152*channel(c.g) + 0.0722*channel(c.b)
+}
+
+func (c rgb) String() string {
+	if c.transparent {
+		return "transparent"
+	}
+	return fmt.Sprintf("rgb(%.0f,%.0f,%.0f)", c.r, c.g, c.b)
+}
@@ -0,0 +1,668 @@
+// Package htmltext extracts visible text and known prompt-injection hiding
+// spots (comments, hidden elements, alt/title attributes, meta tags and
+// low-contrast text) from HTML documents.
+package htmltext
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Kind identifies where in a document a text segment was found
+type Kind string
+
+const (
+	KindVisible     Kind = "visible"      // Rendered body text
+	KindComment     Kind = "comment"      // <!-- HTML comments -->
+	KindHidden      Kind = "hidden"       // display:none, zero-size, off-screen, hidden attribute, <noscript>, <template>
+	KindAriaHidden  Kind = "aria_hidden"  // aria-hidden="true" subtrees
+	KindAttribute   Kind = "attribute"    // alt, title and aria-label attributes
+	KindMeta        Kind = "meta"         // <title> and <meta content>
+	KindLowContrast Kind = "low_contrast" // Text colored (nearly) the same as its background
+)
+
+// HiddenKinds lists every kind except visible text, in reporting order
+var HiddenKinds = []Kind{KindComment, KindHidden, KindAriaHidden, KindLowContrast, KindAttribute, KindMeta}
+
+// Segment is a piece of text found in a document
+type Segment struct {
+	Kind   Kind   `json:"kind"`
+	Path   string `json:"path"`             // DOM path of the element holding the text, e.g. html>body>div#main>p[2]; deep paths keep only their last steps
+	Text   string `json:"text"`             // Whitespace-normalized text
+	Reason string `json:"reason,omitempty"` // Why the segment is considered hidden, e.g. "display:none"
+}
+
+// Document holds the segments extracted from an HTML document
+type Document struct {
+	Segments []Segment
+}
+
+// Text returns the text of all segments of a kind joined by newlines
+func (d *Document) Text(kind Kind) string {
+	var parts []string
+	for _, seg := range d.Segments {
+		if seg.Kind == kind {
+			parts = append(parts, seg.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ByKind returns the segments of a kind in document order
+func (d *Document) ByKind(kind Kind) []Segment {
+	var out []Segment
+	for _, seg := range d.Segments {
+		if seg.Kind == kind {
+			out = append(out, seg)
+		}
+	}
+	return out
+}
+
+// Counts returns the number of segments found for each kind
+func (d *Document) Counts() map[Kind]int {
+	counts := make(map[Kind]int)
+	for _, seg := range d.Segments {
+		counts[seg.Kind]++
+	}
+	return counts
+}
+
+// nonRendered elements never contribute visible text
+var nonRendered = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Svg: true,
+	atom.Math: true, atom.Iframe: true, atom.Object: true, atom.Canvas: true,
+}
+
+// blockElements end a run of text so adjacent blocks do not merge
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Li: true, atom.Tr: true, atom.Td: true,
+	atom.Th: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true,
+	atom.H5: true, atom.H6: true, atom.Section: true, atom.Article: true,
+	atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Nav: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Br: true, atom.Table: true,
+	atom.Ul: true, atom.Ol: true, atom.Form: true, atom.Main: true,
+	atom.Body: true, atom.Details: true, atom.Summary: true,
+}
+
+// Extract parses an HTML document and returns its text segments
+func Extract(r io.Reader) (*Document, error) {
+	root, err := html.ParseWithOptions(r, html.ParseOptionEnableScripting(false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	w := &walker{
+		doc:        &Document{},
+		hiddenSels: collectHiddenSelectors(root),
+	}
+	w.walk(root, walkState{background: colorWhite})
+	w.flush()
+	return w.doc, nil
+}
+
+// walkState is inherited from parent to child while walking the tree
+type walkState struct {
+	path       *domPath
+	blockPath  *domPath // path of the nearest block ancestor, used to group visible text
+	kind       Kind     // non-visible kind inherited from an ancestor, if any
+	kindPath   *domPath // path of the ancestor that set kind
+	reason     string
+	background rgb
+	color      *rgb
+}
+
+type walker struct {
+	doc        *Document
+	hiddenSels map[string]string
+	run        strings.Builder // pending text of the current run
+	runKind    Kind
+	runPath    *domPath
+	runReason  string
+}
+
+// emit appends text to the current run, flushing when the run changes
+func (w *walker) emit(kind Kind, path *domPath, reason, text string) {
+	if kind != w.runKind || path != w.runPath {
+		w.flush()
+		w.runKind, w.runPath, w.runReason = kind, path, reason
+	}
+	w.run.WriteString(text)
+}
+
+// flush closes the current run and records it as a segment
+func (w *walker) flush() {
+	w.addSegment(w.runKind, w.runPath, w.runReason, w.run.String())
+	w.run.Reset()
+}
+
+func (w *walker) addSegment(kind Kind, path *domPath, reason, text string) {
+	text = normalizeSpace(text)
+	if text == "" {
+		return
+	}
+	w.doc.Segments = append(w.doc.Segments, Segment{Kind: kind, Path: path.String(), Text: text, Reason: reason})
+}
+
+func (w *walker) walk(n *html.Node, st walkState) {
+	switch n.Type {
+	case html.CommentNode:
+		w.flush()
+		w.addSegment(KindComment, st.path, "", n.Data)
+		return
+	case html.TextNode:
+		kind, path := KindVisible, st.blockPath
+		if st.kind != "" {
+			kind, path = st.kind, st.kindPath
+		}
+		w.emit(kind, path, st.reason, n.Data)
+		return
+	case html.DocumentNode:
+		w.walkChildren(n, st)
+		return
+	case html.ElementNode:
+		// handled below; st.path already names this element
+	default:
+		return
+	}
+
+	w.collectAttributes(n, st)
+
+	switch n.DataAtom {
+	case atom.Title:
+		w.flush()
+		w.addSegment(KindMeta, st.path, "", textContent(n))
+		return
+	case atom.Meta:
+		if content := attr(n, "content"); content != "" && isTextMeta(n) {
+			w.flush()
+			w.addSegment(KindMeta, st.path, metaName(n), content)
+		}
+		return
+	case atom.Input:
+		if strings.EqualFold(attr(n, "type"), "hidden") && attr(n, "value") != "" {
+			w.flush()
+			w.addSegment(KindHidden, st.path, "input type=hidden", attr(n, "value"))
+		}
+		return
+	}
+
+	if nonRendered[n.DataAtom] {
+		return
+	}
+
+	// Determine whether this element hides its subtree
+	if st.kind == "" || st.kind == KindLowContrast {
+		if reason, hidden := w.hiddenReason(n); hidden {
+			st.kind, st.kindPath, st.reason = KindHidden, st.path, reason
+		} else if strings.EqualFold(attr(n, "aria-hidden"), "true") && st.kind == "" {
+			st.kind, st.kindPath, st.reason = KindAriaHidden, st.path, "aria-hidden"
+		}
+	}
+
+	// Track colors for low-contrast detection
+	style := parseStyle(attr(n, "style"))
+	if bg, ok := backgroundOf(n, style); ok {
+		st.background = bg
+	}
+	if fg, ok := foregroundOf(n, style); ok {
+		st.color = &fg
+	}
+	if st.kind == "" && st.color != nil && lowContrast(*st.color, st.background) {
+		st.kind, st.kindPath, st.reason = KindLowContrast, st.path, "text color matches background"
+	}
+
+	if blockElements[n.DataAtom] || st.blockPath == nil {
+		st.blockPath = st.path
+		w.flush()
+	}
+	w.walkChildren(n, st)
+	if blockElements[n.DataAtom] {
+		w.flush()
+	}
+}
+
+// walkChildren walks the children of n, extending the path for each child
+// element. Same-tag siblings are counted once per parent so wide documents
+// stay linear.
+func (w *walker) walkChildren(n *html.Node, st walkState) {
+	total := make(map[string]int)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			total[c.Data]++
+		}
+	}
+	seen := make(map[string]int, len(total))
+	parent := st.path
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			seen[c.Data]++
+			st.path = parent.child(c, seen[c.Data], total[c.Data])
+		} else {
+			st.path = parent
+		}
+		w.walk(c, st)
+	}
+}
+
+// collectAttributes records text-bearing attributes of an element
+func (w *walker) collectAttributes(n *html.Node, st walkState) {
+	for _, key := range []string{"alt", "title", "aria-label"} {
+		if v := attr(n, key); v != "" {
+			w.flush()
+			w.addSegment(KindAttribute, st.path, key, v)
+		}
+	}
+}
+
+// hiddenReason reports whether an element is hidden from sighted readers
+func (w *walker) hiddenReason(n *html.Node) (string, bool) {
+	if hasAttr(n, "hidden") {
+		return "hidden attribute", true
+	}
+	switch n.DataAtom {
+	case atom.Noscript:
+		return "noscript", true
+	case atom.Template:
+		return "template", true
+	}
+
+	if reason, ok := styleHides(parseStyle(attr(n, "style"))); ok {
+		return reason, true
+	}
+
+	if id := attr(n, "id"); id != "" {
+		if reason, ok := w.hiddenSels["#"+strings.ToLower(id)]; ok {
+			return reason, true
+		}
+	}
+	for _, class := range strings.Fields(attr(n, "class")) {
+		class = strings.ToLower(class)
+		if reason, ok := w.hiddenSels["."+class]; ok {
+			return reason, true
+		}
+		if hiddenClassNames[class] {
+			return "class " + class, true
+		}
+	}
+	return "", false
+}
+
+// hiddenClassNames are utility classes that popular CSS frameworks use to hide content
+var hiddenClassNames = map[string]bool{
+	"sr-only": true, "visually-hidden": true, "screen-reader-text": true,
+	"d-none": true, "hidden": true, "invisible": true, "hide": true,
+}
+
+// styleHides reports whether inline style declarations hide an element
+func styleHides(style map[string]string) (string, bool) {
+	if len(style) == 0 {
+		return "", false
+	}
+	if style["display"] == "none" {
+		return "display:none", true
+	}
+	if v := style["visibility"]; v == "hidden" || v == "collapse" {
+		return "visibility:" + v, true
+	}
+	if isZero(style["opacity"]) {
+		return "opacity:0", true
+	}
+	if isZero(style["font-size"]) {
+		return "font-size:0", true
+	}
+	if isZero(style["width"]) || isZero(style["height"]) || isZero(style["max-height"]) || isZero(style["max-width"]) {
+		return "zero-size", true
+	}
+	if strings.HasPrefix(style["clip"], "rect(0") || strings.Contains(style["clip-path"], "inset(50%") ||
+		strings.Contains(style["clip-path"], "inset(100%") {
+		return "clipped", true
+	}
+	if pos := style["position"]; pos == "absolute" || pos == "fixed" {
+		for _, side := range []string{"left", "top", "right"} {
+			if isFarOffscreen(style[side]) {
+				return "off-screen", true
+			}
+		}
+	}
+	if isFarOffscreen(style["text-indent"]) {
+		return "off-screen", true
+	}
+	if c, ok := parseColor(style["color"]); ok && c.transparent {
+		return "transparent text", true
+	}
+	return "", false
+}
+
+// collectHiddenSelectors scans <style> blocks for simple class and id
+// selectors whose rules hide content, e.g. ".x{display:none}"
+func collectHiddenSelectors(root *html.Node) map[string]string {
+	sels := make(map[string]string)
+	var visit func(n *html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Style {
+			parseHidingRules(textContent(n), sels)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(root)
+	return sels
+}
+
+// parseHidingRules is a deliberately small CSS reader: it only understands
+// flat "selector-list { declarations }" rules and ignores at-rules nesting.
+func parseHidingRules(css string, sels map[string]string) {
+	css = stripCSSComments(css)
+	for {
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			return
+		}
+		close := strings.IndexByte(css[open:], '}')
+		if close < 0 {
+			return
+		}
+		selectors := css[:open]
+		body := css[open+1 : open+close]
+		css = css[open+close+1:]
+
+		// Skip into @media blocks by treating their inner rules as top-level
+		if at := strings.LastIndexByte(selectors, '@'); at >= 0 {
+			if inner := strings.IndexByte(body, '{'); inner >= 0 {
+				css = body[:inner] + "{" + body[inner+1:] + "}" + css
+			}
+			continue
+		}
+
+		reason, hides := styleHides(parseStyle(body))
+		if !hides {
+			continue
+		}
+		for _, sel := range strings.Split(selectors, ",") {
+			sel = strings.TrimSpace(sel)
+			fields := strings.Fields(sel)
+			if len(fields) == 0 {
+				continue
+			}
+			last := strings.ToLower(fields[len(fields)-1])
+			if (strings.HasPrefix(last, ".") || strings.HasPrefix(last, "#")) &&
+				!strings.ContainsAny(last[1:], ".#:[>+~") {
+				sels[last] = reason
+			}
+		}
+	}
+}
+
+func stripCSSComments(css string) string {
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			return css
+		}
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			return css[:start]
+		}
+		css = css[:start] + css[start+2+end+2:]
+	}
+}
+
+// parseStyle parses inline CSS declarations into a lowercase property map
+func parseStyle(style string) map[string]string {
+	if style == "" {
+		return nil
+	}
+	out := make(map[string]string)
+	for _, decl := range strings.Split(style, ";") {
+		name, value, ok := strings.Cut(decl, ":")
+		if !ok {
+			continue
+		}
+		value = strings.ToLower(strings.TrimSpace(value))
+		value = strings.TrimSpace(strings.TrimSuffix(value, "!important"))
+		out[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return out
+}
+
+// isZero reports whether a CSS length or number is zero
+func isZero(v string) bool {
+	if v == "" {
+		return false
+	}
+	v = strings.TrimRight(v, "pxemrtvhw%")
+	v = strings.TrimLeft(v, "+-")
+	v = strings.TrimLeft(v, "0")
+	return v == "" || v == "." || strings.Trim(v, ".0") == ""
+}
+
+// isFarOffscreen reports whether a CSS offset moves content well outside the viewport
+func isFarOffscreen(v string) bool {
+	if !strings.HasPrefix(v, "-") {
+		return false
+	}
+	num := strings.TrimRight(v, "abcdefghijklmnopqrstuvwxyz%")
+	unit := v[len(num):]
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return false
+	}
+	switch unit {
+	case "em", "rem":
+		n *= 16
+	case "%", "vw", "vh":
+		n *= 10
+	}
+	return n <= -999
+}
+
+// DOM paths
+
+// maxPathDepth caps how many trailing steps a rendered path keeps, so deeply
+// nested documents do not produce quadratic output
+const maxPathDepth = 32
+
+// domPath is a step in a DOM path, linked to its parent. Paths are built
+// while walking and only rendered when a segment is recorded.
+type domPath struct {
+	parent   *domPath
+	step     string
+	depth    int
+	rendered string
+}
+
+// child extends a path with an element as tag, tag#id or tag[idx], where idx
+// is the 1-based position among total same-tag siblings
+func (p *domPath) child(n *html.Node, idx, total int) *domPath {
+	step := n.Data
+	if id := attr(n, "id"); id != "" {
+		step += "#" + id
+	} else if n.DataAtom != atom.Html && n.DataAtom != atom.Body && n.DataAtom != atom.Head && total > 1 {
+		step += "[" + strconv.Itoa(idx) + "]"
+	}
+	depth := 1
+	if p != nil {
+		depth = p.depth + 1
+	}
+	return &domPath{parent: p, step: step, depth: depth}
+}
+
+// String renders the path, e.g. html>body>div#main>p[2]. Paths deeper than
+// maxPathDepth start with "…" followed by their last maxPathDepth steps.
+func (p *domPath) String() string {
+	if p == nil {
+		return ""
+	}
+	if p.rendered != "" {
+		return p.rendered
+	}
+	n := min(p.depth, maxPathDepth)
+	steps := make([]string, n)
+	q := p
+	for i := n - 1; i >= 0; i-- {
+		steps[i] = q.step
+		q = q.parent
+	}
+	if q != nil {
+		steps[0] = "…>" + steps[0]
+	}
+	p.rendered = strings.Join(steps, ">")
+	return p.rendered
+}
+
+// Helpers
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			visit(c)
+		}
+	}
+	visit(n)
+	return sb.String()
+}
+
+// isTextMeta reports whether a <meta> tag carries human-readable text
+func isTextMeta(n *html.Node) bool {
+	if attr(n, "http-equiv") != "" || attr(n, "charset") != "" {
+		return false
+	}
+	name := strings.ToLower(metaName(n))
+	switch {
+	case name == "viewport", name == "robots", name == "theme-color", name == "generator",
+		strings.HasPrefix(name, "msapplication"), strings.HasSuffix(name, ":url"),
+		strings.HasSuffix(name, ":image"), strings.HasSuffix(name, ":type"):
+		return false
+	}
+	return true
+}
+
+func metaName(n *html.Node) string {
+	if name := attr(n, "name"); name != "" {
+		return name
+	}
+	return attr(n, "property")
+}
+
+// normalizeSpace collapses runs of whitespace while keeping line breaks
+func normalizeSpace(s string) string {
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// Strip re-renders an HTML document without scripts, styles, embedded media
+// and presentational attributes. Structure, comments, hidden elements and
+// the attributes needed to locate hiding spots are kept, so the result can
+// still be segmented by Extract while being much smaller than the original.
+func Strip(r io.Reader) ([]byte, error) {
+	root, err := html.ParseWithOptions(r, html.ParseOptionEnableScripting(false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	hiddenSels := collectHiddenSelectors(root)
+
+	var strip func(n *html.Node)
+	strip = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode {
+				switch c.DataAtom {
+				case atom.Script, atom.Style, atom.Svg, atom.Math, atom.Canvas, atom.Link,
+					atom.Iframe, atom.Object, atom.Embed, atom.Video, atom.Audio, atom.Picture, atom.Source:
+					n.RemoveChild(c)
+					c = next
+					continue
+				}
+				c.Attr = keepAttrs(c, hiddenSels)
+			}
+			strip(c)
+			c = next
+		}
+	}
+	strip(root)
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, root); err != nil {
+		return nil, fmt.Errorf("failed to render HTML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// keptAttrs are the attributes Extract relies on
+var keptAttrs = map[string]bool{
+	"id": true, "class": true, "style": true, "hidden": true, "aria-hidden": true,
+	"aria-label": true, "alt": true, "title": true, "name": true, "property": true,
+	"content": true, "type": true, "value": true, "color": true, "bgcolor": true,
+	"http-equiv": true, "charset": true,
+}
+
+// keepAttrs filters an element's attributes down to keptAttrs. Classes and
+// ids hidden by a stripped <style> block are converted to an inline style so
+// the hiding information survives the removal of the stylesheet.
+func keepAttrs(n *html.Node, hiddenSels map[string]string) []html.Attribute {
+	var out []html.Attribute
+	hiddenBySheet := false
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if !keptAttrs[key] {
+			continue
+		}
+		switch key {
+		case "id":
+			if _, ok := hiddenSels["#"+strings.ToLower(a.Val)]; ok {
+				hiddenBySheet = true
+			}
+		case "class":
+			for _, class := range strings.Fields(a.Val) {
+				if _, ok := hiddenSels["."+strings.ToLower(class)]; ok {
+					hiddenBySheet = true
+				}
+			}
+		}
+		out = append(out, a)
+	}
+	if hiddenBySheet {
+		out = append(out, html.Attribute{Key: "hidden"})
+	}
+	return out
+}
@@ -0,0 +1,195 @@
+// Package jsontext walks JSON documents for their string values, so each
+// field can be scanned on its own and located by its JSON path, and blanks
+// chosen fields while leaving the rest of the document intact.
+package jsontext
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Leaf is a string value in a JSON document
+type Leaf struct {
+	Path string `json:"path"` // Location in the document, e.g. data.items[2].body
+	Text string `json:"text"`
+}
+
+// Leaves returns the non-empty string values of a JSON object or array, in
+// document order. ok is false when body is not a JSON object or array.
+// Object keys are not returned.
+func Leaves(body []byte) ([]Leaf, bool) {
+	var leaves []Leaf
+	err := walk(body, nil, func(path, text string) string {
+		if text != "" {
+			leaves = append(leaves, Leaf{Path: path, Text: text})
+		}
+		return text
+	})
+	if err != nil {
+		return nil, false
+	}
+	return leaves, true
+}
+
+// Blank returns body with the string values at paths replaced by empty
+// strings. Whitespace is not preserved; everything else is.
+func Blank(body []byte, paths map[string]bool) ([]byte, error) {
+	var out bytes.Buffer
+	err := walk(body, &out, func(path, text string) string {
+		if paths[path] {
+			return ""
+		}
+		return text
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// errNotContainer means a document is not a JSON object or array
+var errNotContainer = errors.New("not a JSON object or array")
+
+// walk calls visit with each string value of body and its path. When out
+// is not nil, body is written to it compacted, with each string replaced
+// by what visit returned.
+func walk(body []byte, out *bytes.Buffer, visit func(path, text string) string) error {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || (body[0] != '{' && body[0] != '[') {
+		return errNotContainer
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	w := &walker{dec: dec, out: out, visit: visit}
+	if err := w.value(""); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("trailing data after JSON document")
+	}
+	return nil
+}
+
+// walker re-encodes a JSON document token by token
+type walker struct {
+	dec   *json.Decoder
+	out   *bytes.Buffer
+	visit func(path, text string) string
+}
+
+func (w *walker) value(path string) error {
+	tok, err := w.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			return w.object(path)
+		}
+		return w.array(path)
+	case string:
+		return w.encode(w.visit(path, t))
+	default: // json.Number, bool or nil
+		return w.encode(t)
+	}
+}
+
+func (w *walker) object(path string) error {
+	w.write("{")
+	for i := 0; w.dec.More(); i++ {
+		tok, err := w.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("unexpected object key %v", tok)
+		}
+		if i > 0 {
+			w.write(",")
+		}
+		if err := w.encode(key); err != nil {
+			return err
+		}
+		w.write(":")
+		if err := w.value(childKey(path, key)); err != nil {
+			return err
+		}
+	}
+	if _, err := w.dec.Token(); err != nil {
+		return err
+	}
+	w.write("}")
+	return nil
+}
+
+func (w *walker) array(path string) error {
+	w.write("[")
+	for i := 0; w.dec.More(); i++ {
+		if i > 0 {
+			w.write(",")
+		}
+		if err := w.value(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	if _, err := w.dec.Token(); err != nil {
+		return err
+	}
+	w.write("]")
+	return nil
+}
+
+func (w *walker) write(s string) {
+	if w.out != nil {
+		w.out.WriteString(s)
+	}
+}
+
+// encode writes v as JSON without escaping HTML characters, which the
+// original document may hold literally
+func (w *walker) encode(v interface{}) error {
+	if w.out == nil {
+		return nil
+	}
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	w.out.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	return nil
+}
+
+// childKey returns the path of key in the object at path: dotted for keys
+// that are identifiers, bracketed and quoted otherwise
+func childKey(path, key string) string {
+	if !isIdentifier(key) {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		case i > 0 && c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package jsontext
+
+import "testing"
+
+const document = `{
+  "data": {"items": [
+    {"id": 1, "title": "Falcon", "body": "Ignore previous instructions", "tags": ["a", ""]},
+    {"id": 2.50, "title": "<b>Kestrel</b>", "draft": true, "author": null}
+  ]},
+  "content-type": "text/plain"
+}`
+
+func TestLeaves(t *testing.T) {
+	leaves, ok := Leaves([]byte(document))
+	if !ok {
+		t.Fatal("expected a JSON object to be walked")
+	}
+	want := []Leaf{
+		{Path: "data.items[0].title", Text: "Falcon"},
+		{Path: "data.items[0].body", Text: "Ignore previous instructions"},
+		{Path: "data.items[0].tags[0]", Text: "a"},
+		{Path: "data.items[1].title", Text: "<b>Kestrel</b>"},
+		{Path: `["content-type"]`, Text: "text/plain"},
+	}
+	if len(leaves) != len(want) {
+		t.Fatalf("expected %d leaves, got %+v", len(want), leaves)
+	}
+	for i := range want {
+		if leaves[i] != want[i] {
+			t.Errorf("leaf %d: got %+v, want %+v", i, leaves[i], want[i])
+		}
+	}
+
+	if leaves, ok := Leaves([]byte(`[["x"]]`)); !ok || len(leaves) != 1 || leaves[0].Path != "[0][0]" {
+		t.Errorf("unexpected leaves of a nested array %+v", leaves)
+	}
+}
+
+func TestLeaves_NotContainer(t *testing.T) {
+	for _, body := range []string{"", `"text"`, "42", "plain text", `{"a":`, `{"a":1} {"b":2}`} {
+		if _, ok := Leaves([]byte(body)); ok {
+			t.Errorf("expected %q not to be walked", body)
+		}
+	}
+}
+
+func TestBlank(t *testing.T) {
+	out, err := Blank([]byte(document), map[string]bool{"data.items[0].body": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"data":{"items":[{"id":1,"title":"Falcon","body":"","tags":["a",""]},{"id":2.50,"title":"<b>Kestrel</b>","draft":true,"author":null}]},"content-type":"text/plain"}`
+	if string(out) != want {
+		t.Errorf("got  %s\nwant %s", out, want)
+	}
+}
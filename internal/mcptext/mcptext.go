@@ -0,0 +1,232 @@
+// Package mcptext recognizes Model Context Protocol (MCP) JSON-RPC messages
+// and extracts the text of tool results and resource contents, so each
+// content item can be scanned on its own and located by the call it
+// answers. Messages are accepted as plain JSON, JSON-RPC batches or the
+// Server-Sent Events streams of the Streamable HTTP and SSE transports.
+package mcptext
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Kind identifies where in a result a content item was found
+type Kind string
+
+const (
+	KindText     Kind = "text"     // Text items of a tool result's content
+	KindResource Kind = "resource" // Embedded resources and resources/read contents
+)
+
+// Item is a piece of text found in an MCP response
+type Item struct {
+	Kind   Kind   `json:"kind"`
+	CallID string `json:"call_id"`       // JSON-RPC id of the response holding the item
+	Path   string `json:"path"`          // Location in the response, e.g. result.content[2].resource.text
+	URI    string `json:"uri,omitempty"` // Resource URI
+	Text   string `json:"text"`
+}
+
+// Message holds the JSON-RPC responses found in an MCP message
+type Message struct {
+	IDs    []json.RawMessage // Ids of the responses, as sent, in order
+	Items  []Item
+	Stream bool // The message arrived as a Server-Sent Events stream
+}
+
+// Counts returns the number of items of each kind
+func (m *Message) Counts() map[Kind]int {
+	counts := make(map[Kind]int)
+	for _, item := range m.Items {
+		counts[item.Kind]++
+	}
+	return counts
+}
+
+// rpcMessage is the part of a JSON-RPC 2.0 message mcptext looks at
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// rpcResult covers tools/call and resources/read results
+type rpcResult struct {
+	Content []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		Resource *struct {
+			URI  string `json:"uri"`
+			Text string `json:"text"`
+		} `json:"resource"`
+	} `json:"content"`
+	Contents []struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"contents"`
+}
+
+// Parse extracts the content items of an MCP message. ok is false when
+// body holds no JSON-RPC 2.0 messages. Responses without text content,
+// such as errors or initialize results, are listed without items.
+func Parse(body []byte) (*Message, bool) {
+	messages, stream := decode(body)
+	if len(messages) == 0 {
+		return nil, false
+	}
+
+	msg := &Message{Stream: stream}
+	for _, m := range messages {
+		if len(m.ID) == 0 || len(m.Result) == 0 {
+			continue
+		}
+		msg.IDs = append(msg.IDs, m.ID)
+
+		var result rpcResult
+		if err := json.Unmarshal(m.Result, &result); err != nil {
+			continue
+		}
+		id := IDString(m.ID)
+		for i, c := range result.Content {
+			switch {
+			case c.Type == "text" && c.Text != "":
+				msg.Items = append(msg.Items, Item{
+					Kind:   KindText,
+					CallID: id,
+					Path:   fmt.Sprintf("result.content[%d].text", i),
+					Text:   c.Text,
+				})
+			case c.Type == "resource" && c.Resource != nil && c.Resource.Text != "":
+				msg.Items = append(msg.Items, Item{
+					Kind:   KindResource,
+					CallID: id,
+					Path:   fmt.Sprintf("result.content[%d].resource.text", i),
+					URI:    c.Resource.URI,
+					Text:   c.Resource.Text,
+				})
+			}
+		}
+		for i, c := range result.Contents {
+			if c.Text == "" {
+				continue
+			}
+			msg.Items = append(msg.Items, Item{
+				Kind:   KindResource,
+				CallID: id,
+				Path:   fmt.Sprintf("result.contents[%d].text", i),
+				URI:    c.URI,
+				Text:   c.Text,
+			})
+		}
+	}
+	return msg, true
+}
+
+// ToolCalls returns the tool named by each tools/call request in body, by
+// JSON-RPC id. ok is false when body holds no JSON-RPC 2.0 messages.
+func ToolCalls(body []byte) (map[string]string, bool) {
+	messages, _ := decode(body)
+	if len(messages) == 0 {
+		return nil, false
+	}
+
+	tools := make(map[string]string)
+	for _, m := range messages {
+		if m.Method != "tools/call" || len(m.ID) == 0 {
+			continue
+		}
+		var params struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(m.Params, &params); err == nil && params.Name != "" {
+			tools[IDString(m.ID)] = params.Name
+		}
+	}
+	return tools, true
+}
+
+// IDString returns a JSON-RPC id as text: strings without their quotes,
+// numbers as written
+func IDString(id json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(id, &s); err == nil {
+		return s
+	}
+	return string(bytes.TrimSpace(id))
+}
+
+// decode returns the JSON-RPC 2.0 messages in body, which is a message, a
+// batch, or an event stream whose data fields hold either
+func decode(body []byte) ([]rpcMessage, bool) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, false
+	}
+	if trimmed[0] == '{' || trimmed[0] == '[' {
+		return decodeJSON(trimmed), false
+	}
+
+	var messages []rpcMessage
+	for _, data := range eventData(body) {
+		messages = append(messages, decodeJSON([]byte(data))...)
+	}
+	return messages, true
+}
+
+// decodeJSON decodes a message or batch, keeping JSON-RPC 2.0 messages
+func decodeJSON(data []byte) []rpcMessage {
+	data = bytes.TrimSpace(data)
+	var batch []rpcMessage
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil
+		}
+	} else {
+		var m rpcMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil
+		}
+		batch = []rpcMessage{m}
+	}
+
+	messages := batch[:0]
+	for _, m := range batch {
+		if m.JSONRPC == "2.0" {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+// eventData returns the data of each event in a Server-Sent Events stream.
+// Multi-line data is joined with newlines.
+func eventData(body []byte) []string {
+	var events []string
+	var data []string
+	flush := func() {
+		if len(data) > 0 {
+			events = append(events, strings.Join(data, "\n"))
+			data = nil
+		}
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	sc.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" {
+			flush()
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+	flush()
+	return events
+}
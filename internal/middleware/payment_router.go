@@ -38,8 +38,13 @@ func NewPaymentRouter(x402 *X402Middleware, apiKey *APIKeyMiddleware, meter *bil
 // Route returns middleware that handles payment for the given price.
 // It accepts either x402 crypto payment OR B2B API key authentication.
 func (pr *PaymentRouter) Route(price usdc.MicroUSDC) fiber.Handler {
+	return pr.RouteFunc(FixedPrice(price))
+}
+
+// RouteFunc is Route for endpoints whose price depends on the request
+func (pr *PaymentRouter) RouteFunc(priceFn PriceFunc) fiber.Handler {
 	// Pre-build the x402 handler for this price
-	x402Handler := pr.x402.AtomicPayment(price)
+	x402Handler := pr.x402.AtomicPaymentFunc(priceFn)
 
 	return func(c fiber.Ctx) error {
 		// Path 1: x402 crypto payment (X-PAYMENT header present)
@@ -53,6 +58,12 @@ func (pr *PaymentRouter) Route(price usdc.MicroUSDC) fiber.Handler {
 			// Parse scheme case-insensitively (RFC 7235)
 			parts := strings.SplitN(authHeader, " ", 2)
 			if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") && strings.HasPrefix(parts[1], "sk_live_") {
+				price, err := priceFn(c)
+				if err != nil {
+					return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+						"error": err.Error(),
+					})
+				}
 				return pr.handleAPIKeyPayment(c, price)
 			}
 		}
@@ -2,11 +2,15 @@ package middleware
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/big"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +23,19 @@ import (
 	"github.com/gofiber/fiber/v3"
 )
 
+// Prepaid session headers. A request presenting a session token is debited
+// from the session instead of carrying its own X-Payment.
+const (
+	SessionTokenHeader   = "X-Session-Token"
+	SessionBalanceHeader = "X-Session-Balance" // Remaining balance in microUSDC
+)
+
+// HashSessionToken returns the SHA-256 hex digest stored for a session token
+func HashSessionToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
 // X402Middleware creates x402 payment verification middleware
 type X402Middleware struct {
 	config     *config.X402Config
@@ -70,11 +87,12 @@ type PriceRoute struct {
 	Price  usdc.MicroUSDC
 }
 
-// GetRoutes returns all priced routes
+// GetRoutes returns all priced routes. The batch route's price is per item.
 func (m *X402Middleware) GetRoutes() []PriceRoute {
 	return []PriceRoute{
 		{Path: "/v1/scan/content", Method: "POST", Price: m.pricing.ScanContent},
 		{Path: "/v1/scan/output", Method: "POST", Price: m.pricing.ScanOutput},
+		{Path: "/v1/scan/batch", Method: "POST", Price: m.pricing.ScanBatchItem},
 	}
 }
 
@@ -91,15 +109,40 @@ func (m *X402Middleware) GetNetworks() []string {
 	return m.config.Networks
 }
 
+// PriceFunc computes the price of a request, for endpoints priced by what
+// the request contains. An error rejects the request with a 400.
+type PriceFunc func(c fiber.Ctx) (usdc.MicroUSDC, error)
+
+// FixedPrice returns a PriceFunc that always charges price
+func FixedPrice(price usdc.MicroUSDC) PriceFunc {
+	return func(fiber.Ctx) (usdc.MicroUSDC, error) {
+		return price, nil
+	}
+}
+
 // AtomicPayment returns middleware that implements the reserve-commit pattern for atomic payments.
 // It ensures that either both service execution and payment settlement succeed, or neither does.
 // If settlement fails, a 503 is returned and the service result is not delivered.
 func (m *X402Middleware) AtomicPayment(price usdc.MicroUSDC) fiber.Handler {
+	return m.AtomicPaymentFunc(FixedPrice(price))
+}
+
+// AtomicPaymentFunc is AtomicPayment for endpoints whose price depends on
+// the request, such as batch scans priced per item
+func (m *X402Middleware) AtomicPaymentFunc(priceFn PriceFunc) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		// Skip if no payment networks configured (allow all in dev mode)
 		if !m.config.HasPayments() {
 			return c.Next()
 		}
+
+		price, err := priceFn(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
 		// Atomic payments require a database-backed nonce reservation.
 		if m.db == nil {
 			slog.Error("atomic payment middleware misconfigured: missing database", "path", c.Path())
@@ -108,9 +151,12 @@ func (m *X402Middleware) AtomicPayment(price usdc.MicroUSDC) fiber.Handler {
 			})
 		}
 
-		// Check for payment header
+		// Check for payment header, falling back to a prepaid session
 		paymentHeader := c.Get("X-Payment")
 		if paymentHeader == "" {
+			if token := c.Get(SessionTokenHeader); token != "" {
+				return m.sessionPayment(c, token, price)
+			}
 			return m.requirePaymentResponse(c, price)
 		}
 
@@ -245,6 +291,54 @@ func (m *X402Middleware) AtomicPayment(price usdc.MicroUSDC) fiber.Handler {
 	}
 }
 
+// sessionPayment debits price from a prepaid session and runs the handler.
+// The debit is credited back if the handler fails. An exhausted or unknown
+// session gets a 402 so the client can pay directly or open a new session.
+func (m *X402Middleware) sessionPayment(c fiber.Ctx, token string, price usdc.MicroUSDC) error {
+	tokenHash := HashSessionToken(token)
+
+	balance, err := m.db.DebitPrepaidSession(c.Context(), tokenHash, price)
+	if err != nil {
+		if errors.Is(err, db.ErrPrepaidSessionExhausted) {
+			c.Set(SessionBalanceHeader, strconv.FormatInt(int64(balance), 10))
+			return m.requirePaymentResponse(c, price)
+		}
+		if errors.Is(err, db.ErrPrepaidSessionNotFound) {
+			return m.requirePaymentResponse(c, price)
+		}
+		slog.Error("failed to debit prepaid session", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Payment processing error",
+		})
+	}
+
+	// Execute the handler
+	if err := c.Next(); err != nil {
+		m.creditSession(c, tokenHash, price)
+		return err
+	}
+
+	// Don't charge for error responses
+	if c.Response().StatusCode() >= 400 {
+		if credited, ok := m.creditSession(c, tokenHash, price); ok {
+			balance = credited
+		}
+	}
+
+	c.Set(SessionBalanceHeader, strconv.FormatInt(int64(balance), 10))
+	return nil
+}
+
+// creditSession returns a debit to a prepaid session
+func (m *X402Middleware) creditSession(c fiber.Ctx, tokenHash string, amount usdc.MicroUSDC) (usdc.MicroUSDC, bool) {
+	balance, err := m.db.CreditPrepaidSession(c.Context(), tokenHash, amount)
+	if err != nil {
+		slog.Error("failed to credit prepaid session after failed request", "error", err)
+		return 0, false
+	}
+	return balance, true
+}
+
 // GetPaymentTransaction retrieves the payment transaction from the request context
 func GetPaymentTransaction(c fiber.Ctx) *db.PaymentTransaction {
 	if tx, ok := c.Locals("payment_tx").(*db.PaymentTransaction); ok {
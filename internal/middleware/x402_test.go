@@ -186,14 +186,15 @@ func TestGetRoutes(t *testing.T) {
 		Networks:         []string{"base-sepolia"},
 	}
 	pricing := &config.PricingConfig{
-		ScanContent: usdc.MicroUSDC(1000),
-		ScanOutput:  usdc.MicroUSDC(1000),
+		ScanContent:   usdc.MicroUSDC(1000),
+		ScanOutput:    usdc.MicroUSDC(1000),
+		ScanBatchItem: usdc.MicroUSDC(800),
 	}
 
 	m := NewX402Middleware(cfg, pricing)
 	routes := m.GetRoutes()
 
-	assert.Len(t, routes, 2)
+	assert.Len(t, routes, 3)
 
 	// Verify route pricing
 	routeMap := make(map[string]usdc.MicroUSDC)
@@ -203,6 +204,7 @@ func TestGetRoutes(t *testing.T) {
 
 	assert.Equal(t, usdc.MicroUSDC(1000), routeMap["/v1/scan/content"])
 	assert.Equal(t, usdc.MicroUSDC(1000), routeMap["/v1/scan/output"])
+	assert.Equal(t, usdc.MicroUSDC(800), routeMap["/v1/scan/batch"])
 }
 
 func TestMicroUSDCToBigInt(t *testing.T) {
@@ -0,0 +1,322 @@
+// Package pii finds personal data in text: email addresses, phone
+// numbers, national ID numbers, payment card numbers, IBANs and street
+// addresses. Detection is local and deterministic, so text can be checked
+// before it is sent anywhere. Card numbers must pass the Luhn check and
+// IBANs the ISO 7064 mod-97 check, which keeps random digit runs such as
+// order numbers from matching.
+package pii
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Categories of personal data
+const (
+	Email      = "email"
+	Phone      = "phone"
+	NationalID = "national_id" // US Social Security and UK National Insurance numbers
+	Card       = "card"
+	IBAN       = "iban"
+	Address    = "address" // Street addresses
+)
+
+// Categories lists every category, in the order overlapping matches are
+// resolved: an earlier category wins over a later one
+var Categories = []string{IBAN, Card, NationalID, Email, Phone, Address}
+
+// Policy actions
+const (
+	ActionAllow  = "allow"  // Not reported
+	ActionRedact = "redact" // Reported and replaced in sanitized text
+	ActionBlock  = "block"  // Reported and the content blocked
+)
+
+// labels describe categories in threats and logs
+var labels = map[string]string{
+	Email:      "Email address",
+	Phone:      "Phone number",
+	NationalID: "National ID number",
+	Card:       "Payment card number",
+	IBAN:       "IBAN",
+	Address:    "Street address",
+}
+
+// Label returns a human-readable name for category
+func Label(category string) string {
+	if label, ok := labels[category]; ok {
+		return label
+	}
+	return category
+}
+
+// Policy maps categories to the action taken when they are found.
+// Categories it does not mention follow DefaultPolicy.
+type Policy map[string]string
+
+// DefaultPolicy blocks numbers that identify a person or an account on
+// their own, and redacts contact details
+func DefaultPolicy() Policy {
+	return Policy{
+		Card:       ActionBlock,
+		IBAN:       ActionBlock,
+		NationalID: ActionBlock,
+		Email:      ActionRedact,
+		Phone:      ActionRedact,
+		Address:    ActionRedact,
+	}
+}
+
+// Action returns the action for category
+func (p Policy) Action(category string) string {
+	if action, ok := p[category]; ok {
+		return action
+	}
+	return DefaultPolicy()[category]
+}
+
+// Validate checks that the policy names known categories and actions
+func (p Policy) Validate() error {
+	for category, action := range p {
+		if _, ok := labels[category]; !ok {
+			return fmt.Errorf("unknown PII category %q (must be one of %s)", category, strings.Join(Categories, ", "))
+		}
+		switch action {
+		case ActionAllow, ActionRedact, ActionBlock:
+		default:
+			return fmt.Errorf("invalid action %q for %s (must be allow, redact or block)", action, category)
+		}
+	}
+	return nil
+}
+
+// Finding is personal data found in text
+type Finding struct {
+	Category string
+	Action   string // Action of the policy the text was checked against
+	Start    int    // Byte offsets of the match
+	End      int
+}
+
+var (
+	emailPattern = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)
+
+	// International numbers with a leading +, and North American numbers
+	// written with separators. Bare digit runs are left alone: they are
+	// more often IDs than phone numbers.
+	phonePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\+[1-9]\d{0,2}(?:[ .-]?\(?\d{1,4}\)?){2,6}`),
+		regexp.MustCompile(`(?:\(\d{3}\)\s?|\b\d{3}[ .-])\d{3}[ .-]\d{4}\b`),
+	}
+
+	ssnPattern  = regexp.MustCompile(`\b(\d{3})-(\d{2})-(\d{4})\b`)
+	ninoPattern = regexp.MustCompile(`\b[A-CEGHJ-PR-TW-Z][A-CEGHJ-NPR-TW-Z] ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`)
+
+	cardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	ibanPattern = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`)
+
+	addressPattern = regexp.MustCompile(`\b\d{1,6}[A-Za-z]?\s+(?:[A-Z][A-Za-z'-]*\.?\s+){1,4}` +
+		`(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|Lane|Ln|Drive|Dr|Court|Ct|Way|Place|Pl|Terrace|Circle|Parkway|Pkwy|Highway|Hwy|Square|Sq)\b\.?` +
+		`(?:,?\s+(?:Apt|Apartment|Suite|Ste|Unit|#)\.?\s*[A-Za-z0-9-]+)?` +
+		`(?:,\s*[A-Z][A-Za-z.]*(?:\s+[A-Z][A-Za-z.]*)*,?\s+[A-Z]{2}\s+\d{5}(?:-\d{4})?)?`)
+)
+
+// Find returns the personal data in text that policy does not allow, in
+// order of appearance. Overlapping matches are reported once.
+func Find(text string, policy Policy) []Finding {
+	var findings []Finding
+	for _, category := range Categories {
+		action := policy.Action(category)
+		if action == ActionAllow {
+			continue
+		}
+		for _, loc := range match(category, text) {
+			findings = append(findings, Finding{Category: category, Action: action, Start: loc[0], End: loc[1]})
+		}
+	}
+
+	// Categories were matched in priority order, so keep the first of
+	// overlapping findings
+	var kept []Finding
+	for _, f := range findings {
+		overlaps := false
+		for _, k := range kept {
+			if f.Start < k.End && k.Start < f.End {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			kept = append(kept, f)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Start < kept[j].Start })
+	return kept
+}
+
+// match returns the locations of category in text
+func match(category, text string) [][]int {
+	switch category {
+	case Email:
+		return emailPattern.FindAllStringIndex(text, -1)
+	case Phone:
+		var locs [][]int
+		for _, re := range phonePatterns {
+			for _, loc := range re.FindAllStringIndex(text, -1) {
+				if n := countDigits(text[loc[0]:loc[1]]); n >= 8 && n <= 15 {
+					locs = append(locs, loc)
+				}
+			}
+		}
+		return locs
+	case NationalID:
+		var locs [][]int
+		for _, m := range ssnPattern.FindAllStringSubmatchIndex(text, -1) {
+			area, group, serial := text[m[2]:m[3]], text[m[4]:m[5]], text[m[6]:m[7]]
+			if area == "000" || area == "666" || area[0] == '9' || group == "00" || serial == "0000" {
+				continue
+			}
+			locs = append(locs, m[:2])
+		}
+		return append(locs, ninoPattern.FindAllStringIndex(text, -1)...)
+	case Card:
+		return filter(cardPattern.FindAllStringIndex(text, -1), text, func(s string) bool {
+			digits := stripSeparators(s)
+			return strings.IndexByte("23456", digits[0]) >= 0 && luhn(digits)
+		})
+	case IBAN:
+		return filter(ibanPattern.FindAllStringIndex(text, -1), text, func(s string) bool {
+			iban := stripSeparators(s)
+			return len(iban) >= 15 && len(iban) <= 34 && ibanChecksum(iban)
+		})
+	case Address:
+		return addressPattern.FindAllStringIndex(text, -1)
+	}
+	return nil
+}
+
+// filter keeps the locations whose text passes valid
+func filter(locs [][]int, text string, valid func(string) bool) [][]int {
+	var kept [][]int
+	for _, loc := range locs {
+		if valid(text[loc[0]:loc[1]]) {
+			kept = append(kept, loc)
+		}
+	}
+	return kept
+}
+
+// Redact replaces each finding in text with a placeholder naming its
+// category, such as [REDACTED_EMAIL]. Findings must be in order and not
+// overlap, as returned by Find.
+func Redact(text string, findings []Finding) string {
+	if len(findings) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, f := range findings {
+		b.WriteString(text[last:f.Start])
+		b.WriteString("[REDACTED_" + strings.ToUpper(f.Category) + "]")
+		last = f.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Threat locates one finding in a scan verdict without repeating the data
+type Threat struct {
+	Category    string // Category of personal data
+	Location    string // e.g. "offset 12"
+	Severity    string // "high" for findings the policy blocks, "medium" otherwise
+	Description string // e.g. "Email address (redacted by policy)"
+}
+
+// Report describes findings for a scan verdict
+type Report struct {
+	Block      bool     // The policy blocks at least one finding
+	Categories []string // Categories found, in order of first appearance
+	Threats    []Threat // One per finding
+	Reason     string   // e.g. "Personal data found: email address, iban"
+}
+
+// Describe reports findings for a scan verdict
+func Describe(findings []Finding) Report {
+	var report Report
+	var labels []string
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		severity, verb := "medium", "redacted"
+		if f.Action == ActionBlock {
+			report.Block = true
+			severity, verb = "high", "blocked"
+		}
+		report.Threats = append(report.Threats, Threat{
+			Category:    f.Category,
+			Location:    fmt.Sprintf("offset %d", f.Start),
+			Severity:    severity,
+			Description: fmt.Sprintf("%s (%s by policy)", Label(f.Category), verb),
+		})
+		if !seen[f.Category] {
+			seen[f.Category] = true
+			report.Categories = append(report.Categories, f.Category)
+			labels = append(labels, strings.ToLower(Label(f.Category)))
+		}
+	}
+	report.Reason = "Personal data found: " + strings.Join(labels, ", ")
+	return report
+}
+
+func countDigits(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			n++
+		}
+	}
+	return n
+}
+
+func stripSeparators(s string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(s)
+}
+
+// luhn reports whether a string of digits passes the Luhn check
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// ibanChecksum reports whether an IBAN passes the ISO 7064 mod-97 check:
+// with the country code and check digits moved to the end and letters
+// counted from A=10, the number leaves a remainder of 1
+func ibanChecksum(iban string) bool {
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for i := 0; i < len(rearranged); i++ {
+		c := rearranged[i]
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
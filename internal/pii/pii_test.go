@@ -0,0 +1,85 @@
+package pii
+
+import "testing"
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		text     string
+		category string
+		match    string
+	}{
+		{"write to jane.doe+ops@mail.example.co.uk today", Email, "jane.doe+ops@mail.example.co.uk"},
+		{"call +44 20 7946 0958 now", Phone, "+44 20 7946 0958"},
+		{"or (555) 123-4567", Phone, "(555) 123-4567"},
+		{"SSN 123-45-6789.", NationalID, "123-45-6789"},
+		{"NI number AB 12 34 56 C", NationalID, "AB 12 34 56 C"},
+		{"card 4111 1111 1111 1111 exp 12/29", Card, "4111 1111 1111 1111"},
+		{"pay GB82 WEST 1234 5698 7654 32 by Friday", IBAN, "GB82 WEST 1234 5698 7654 32"},
+		{"IBAN DE89370400440532013000", IBAN, "DE89370400440532013000"},
+		{"ship to 221B Baker Street, London", Address, "221B Baker Street"},
+		{"at 1600 Pennsylvania Ave, Washington, DC 20500.", Address, "1600 Pennsylvania Ave, Washington, DC 20500"},
+	}
+	for _, tt := range tests {
+		findings := Find(tt.text, DefaultPolicy())
+		if len(findings) != 1 {
+			t.Errorf("%q: expected one finding, got %+v", tt.text, findings)
+			continue
+		}
+		f := findings[0]
+		if f.Category != tt.category || tt.text[f.Start:f.End] != tt.match {
+			t.Errorf("%q: got %s %q, want %s %q", tt.text, f.Category, tt.text[f.Start:f.End], tt.category, tt.match)
+		}
+	}
+}
+
+func TestFind_RejectsLookalikes(t *testing.T) {
+	for _, text := range []string{
+		"order 4111 1111 1111 1112",     // fails the Luhn check
+		"GB82 WEST 1234 5698 7654 33",   // fails the mod-97 check
+		"SSN 000-12-3456",               // invalid area number
+		"build 20260118123045 finished", // bare digit run
+		"version 1.2.3-4567",
+		"see user@localhost",
+	} {
+		if findings := Find(text, DefaultPolicy()); len(findings) != 0 {
+			t.Errorf("%q: expected no findings, got %+v", text, findings)
+		}
+	}
+}
+
+func TestFind_Policy(t *testing.T) {
+	text := "mail jane@example.com, card 5555 5555 5555 4444"
+	findings := Find(text, Policy{Email: ActionAllow})
+	if len(findings) != 1 || findings[0].Category != Card || findings[0].Action != ActionBlock {
+		t.Fatalf("expected only the card, blocked by default, got %+v", findings)
+	}
+	if got := Redact(text, Find(text, Policy{Card: ActionRedact})); got != "mail [REDACTED_EMAIL], card [REDACTED_CARD]" {
+		t.Errorf("unexpected redaction %q", got)
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	if err := (Policy{Email: ActionAllow, Card: ActionRedact}).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (Policy{"passport": ActionBlock}).Validate(); err == nil {
+		t.Error("expected an unknown category to be rejected")
+	}
+	if err := (Policy{Email: "warn"}).Validate(); err == nil {
+		t.Error("expected an unknown action to be rejected")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	text := "mail jane@example.com, card 4111 1111 1111 1111, cc bob@example.com"
+	report := Describe(Find(text, DefaultPolicy()))
+	if !report.Block {
+		t.Error("expected the card to be blocked")
+	}
+	if len(report.Threats) != 3 || report.Threats[1].Severity != "high" || report.Threats[0].Location != "offset 5" {
+		t.Errorf("unexpected threats %+v", report.Threats)
+	}
+	if report.Reason != "Personal data found: email address, payment card number" {
+		t.Errorf("unexpected reason %q", report.Reason)
+	}
+}
@@ -0,0 +1,546 @@
+package proxy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxInflatedArchive caps the total bytes decompressed from one archive,
+// including nested archives, to guard against zip bombs.
+const maxInflatedArchive = 256 * 1024 * 1024
+
+// archiveMembersKey is the ScanResult metadata key listing offending member paths
+const archiveMembersKey = "offending_members"
+
+// ArchiveConfig controls scanning of zip, tar and tar.gz downloads
+type ArchiveConfig struct {
+	Enabled    bool  `yaml:"enabled"`     // Open archives and scan their text-like members
+	MaxSize    int64 `yaml:"max_size"`    // Largest archive body (bytes) we buffer for inspection
+	MaxDepth   int   `yaml:"max_depth"`   // How many levels of nested archives are opened
+	MaxMembers int   `yaml:"max_members"` // Most entries inspected per archive, nested ones included
+}
+
+// applyDefaultArchiveConfig sets default values for ArchiveConfig if not already set
+func applyDefaultArchiveConfig(cfg *ArchiveConfig) {
+	// If MaxSize is zero, this is an old config without the archives section
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = 50 * 1024 * 1024
+		cfg.MaxDepth = 2
+		cfg.MaxMembers = 1000
+	}
+}
+
+// archiveKind identifies a supported archive format
+type archiveKind string
+
+const (
+	arcZip  archiveKind = "zip"
+	arcTar  archiveKind = "tar"
+	arcGzip archiveKind = "gzip"
+)
+
+// archiveTypes maps MIME types to the archive format used for inspection
+var archiveTypes = map[string]archiveKind{
+	"application/zip":              arcZip,
+	"application/x-zip":            arcZip,
+	"application/x-zip-compressed": arcZip,
+	"application/x-tar":            arcTar,
+	"application/gzip":             arcGzip,
+	"application/x-gzip":           arcGzip,
+	"application/x-gtar":           arcGzip,
+	"application/x-tgz":            arcGzip,
+	"application/x-compressed-tar": arcGzip,
+}
+
+// IsArchiveContentType determines if a content type is an archive we can open
+func IsArchiveContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	_, ok := archiveTypes[mediaType]
+	return ok
+}
+
+// ArchiveMember is a text-like file found inside an archive
+type ArchiveMember struct {
+	Path string // Member path; nested archives are separated by "!/", e.g. "deps/lib.zip!/README.md"
+	Text []byte
+}
+
+// ArchiveContents holds the members extracted from an archive
+type ArchiveContents struct {
+	Members   []ArchiveMember
+	Truncated bool // Some entries were not inspected because a limit was reached
+}
+
+// ExtractArchiveMembers opens a zip, tar or tar.gz archive and returns its
+// text-like members, honoring the size, depth and member-count limits in cfg
+func ExtractArchiveMembers(contentType string, body []byte, cfg ArchiveConfig) (*ArchiveContents, error) {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	kind, ok := archiveTypes[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported archive type: %s", contentType)
+	}
+
+	r := &archiveReader{cfg: cfg, contents: &ArchiveContents{}}
+	if err := r.open(kind, "", "", body, 0); err != nil {
+		return nil, err
+	}
+	return r.contents, nil
+}
+
+// archiveReader walks an archive and its nested archives
+type archiveReader struct {
+	cfg      ArchiveConfig
+	contents *ArchiveContents
+	entries  int
+	inflated int64
+}
+
+// open reads one archive level. prefix is prepended to member paths and
+// name is the archive's own member name, used for single-file gzip streams.
+func (r *archiveReader) open(kind archiveKind, prefix, name string, body []byte, depth int) error {
+	switch kind {
+	case arcZip:
+		return r.openZip(prefix, body, depth)
+	case arcTar:
+		return r.openTar(prefix, bytes.NewReader(body), depth)
+	case arcGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("invalid gzip stream: %w", err)
+		}
+		defer gz.Close()
+		data, err := r.read(gz, r.remaining())
+		if err != nil {
+			return fmt.Errorf("failed to decompress gzip stream: %w", err)
+		}
+		if isTarData(data) {
+			return r.openTar(prefix, bytes.NewReader(data), depth)
+		}
+		// A plain .gz file holds a single member
+		member := gz.Name
+		if member == "" {
+			member = strings.TrimSuffix(path.Base(name), ".gz")
+		}
+		if member == "" || member == "." {
+			member = "content"
+		}
+		r.entries++
+		r.addMember(prefix+member, data)
+		return nil
+	}
+	return fmt.Errorf("unsupported archive kind: %s", kind)
+}
+
+func (r *archiveReader) openZip(prefix string, body []byte, depth int) error {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if !r.admit() {
+			return nil
+		}
+		if !r.wanted(f.Name, depth) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			r.contents.Truncated = true
+			continue
+		}
+		data, err := r.read(rc, r.memberLimit(f.Name))
+		rc.Close()
+		if err != nil {
+			r.contents.Truncated = true
+			continue
+		}
+		if err := r.visit(prefix+f.Name, data, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *archiveReader) openTar(prefix string, src io.Reader, depth int) error {
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if r.entries == 0 {
+				return fmt.Errorf("invalid tar archive: %w", err)
+			}
+			r.contents.Truncated = true
+			return nil
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if !r.admit() {
+			return nil
+		}
+		if !r.wanted(hdr.Name, depth) {
+			continue
+		}
+		data, err := r.read(tr, r.memberLimit(hdr.Name))
+		if err != nil {
+			r.contents.Truncated = true
+			return nil
+		}
+		if err := r.visit(prefix+hdr.Name, data, depth); err != nil {
+			return err
+		}
+	}
+}
+
+// admit counts an entry against MaxMembers
+func (r *archiveReader) admit() bool {
+	r.entries++
+	if r.cfg.MaxMembers > 0 && r.entries > r.cfg.MaxMembers {
+		r.contents.Truncated = true
+		return false
+	}
+	return true
+}
+
+// wanted reports whether an entry is worth reading: text-like members, and
+// nested archives while depth allows
+func (r *archiveReader) wanted(name string, depth int) bool {
+	if nestedArchiveKind(name) != "" {
+		if depth+1 > r.cfg.MaxDepth {
+			r.contents.Truncated = true
+			return false
+		}
+		return true
+	}
+	return isTextMemberName(name)
+}
+
+// memberLimit returns how many bytes to read from an entry
+func (r *archiveReader) memberLimit(name string) int64 {
+	if nestedArchiveKind(name) != "" {
+		limit := r.cfg.MaxSize
+		if limit <= 0 || limit > r.remaining() {
+			limit = r.remaining()
+		}
+		return limit
+	}
+	return maxScanBodySize
+}
+
+// visit records a text member or descends into a nested archive
+func (r *archiveReader) visit(name string, data []byte, depth int) error {
+	if kind := nestedArchiveKind(name); kind != "" {
+		if err := r.open(kind, name+"!/", name, data, depth+1); err != nil {
+			// A corrupt nested archive cannot be inspected, but the rest can
+			r.contents.Truncated = true
+		}
+		return nil
+	}
+	r.addMember(name, data)
+	return nil
+}
+
+// addMember keeps a member if its content is text
+func (r *archiveReader) addMember(name string, data []byte) {
+	if !looksLikeText(data) {
+		return
+	}
+	r.contents.Members = append(r.contents.Members, ArchiveMember{Path: name, Text: data})
+}
+
+// read reads up to limit bytes (plus one to detect overflow) and charges
+// them against the inflation budget
+func (r *archiveReader) read(src io.Reader, limit int64) ([]byte, error) {
+	if limit > r.remaining() {
+		limit = r.remaining()
+	}
+	if limit <= 0 {
+		r.contents.Truncated = true
+		return nil, errors.New("archive decompression budget exhausted")
+	}
+	data, err := io.ReadAll(io.LimitReader(src, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	r.inflated += int64(len(data))
+	if int64(len(data)) > limit {
+		r.contents.Truncated = true
+		data = data[:limit]
+	}
+	return data, nil
+}
+
+func (r *archiveReader) remaining() int64 {
+	return maxInflatedArchive - r.inflated
+}
+
+// isTarData reports whether a decompressed stream is a tar archive
+func isTarData(data []byte) bool {
+	return len(data) >= 262 && string(data[257:262]) == "ustar"
+}
+
+// nestedArchiveKind returns the archive format implied by a member name
+func nestedArchiveKind(name string) archiveKind {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return arcZip
+	case strings.HasSuffix(lower, ".tar"):
+		return arcTar
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return arcGzip
+	}
+	return ""
+}
+
+// textMemberExts are file extensions treated as text-like archive members
+var textMemberExts = map[string]bool{
+	".md": true, ".markdown": true, ".mdx": true, ".txt": true, ".rst": true, ".adoc": true,
+	".json": true, ".jsonl": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true,
+	".cfg": true, ".conf": true, ".env": true, ".xml": true, ".html": true, ".htm": true,
+	".csv": true, ".tsv": true, ".ipynb": true, ".prompt": true,
+	".py": true, ".js": true, ".mjs": true, ".cjs": true, ".ts": true, ".tsx": true,
+	".jsx": true, ".go": true, ".rs": true, ".java": true, ".kt": true, ".rb": true,
+	".php": true, ".sh": true, ".bash": true, ".zsh": true, ".ps1": true, ".c": true,
+	".h": true, ".cc": true, ".cpp": true, ".hpp": true, ".cs": true, ".swift": true,
+	".lua": true, ".pl": true, ".r": true, ".sql": true, ".scala": true, ".vue": true,
+	".svelte": true, ".css": true,
+}
+
+// textMemberNames are extensionless file names treated as text
+var textMemberNames = map[string]bool{
+	"readme": true, "license": true, "copying": true, "notice": true, "authors": true,
+	"changelog": true, "makefile": true, "dockerfile": true, "gemfile": true,
+	"procfile": true, "rakefile": true,
+}
+
+// isTextMemberName reports whether a member name looks like a text file
+func isTextMemberName(name string) bool {
+	base := strings.ToLower(path.Base(name))
+	if strings.HasPrefix(base, "readme") || textMemberNames[base] {
+		return true
+	}
+	return textMemberExts[path.Ext(base)]
+}
+
+// looksLikeText reports whether data is text rather than binary
+func looksLikeText(data []byte) bool {
+	sample := data
+	if len(sample) > 8192 {
+		sample = sample[:8192]
+	}
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return false
+	}
+	// Allow a multi-byte rune cut off at the end of the sample
+	for i := 0; i < utf8.UTFMax && len(sample) < len(data) && !utf8.Valid(sample); i++ {
+		sample = sample[:len(sample)-1]
+	}
+	return utf8.Valid(sample)
+}
+
+// archiveChunkHeader separates members combined into one scan request
+func archiveChunkHeader(path string) string {
+	return fmt.Sprintf("\n===== %s =====\n", path)
+}
+
+// scanArchive scans the text members of an archive. Members are grouped
+// into as few scan requests as possible; when a group is flagged, its
+// members are rescanned one by one to find the offending paths. The whole
+// archive is blocked if any member is malicious. Each scan goes through
+// check, so local rules for direction apply to archive members too.
+func (p *pipeline) scanArchive(body []byte, sourceURL, contentType, direction string) *ScanResult {
+	cfg := &p.config.Scanning
+	contents, err := ExtractArchiveMembers(contentType, body, cfg.Archives)
+	if err != nil {
+		p.logger.Error("archive extraction error", "url", sourceURL, "error", err)
+		if cfg.FailOpen {
+			return nil
+		}
+		return &ScanResult{
+			Decision:          DecisionBlock,
+			Reason:            "Archive could not be opened - blocking for safety",
+			RecommendedAction: "Retry the request",
+		}
+	}
+
+	if len(contents.Members) == 0 {
+		if contents.Truncated && !cfg.FailOpen {
+			return archiveLimitResult()
+		}
+		return nil
+	}
+
+	// failed reports whether the remote scan errored, in which case check
+	// has already let the content through or blocked it per fail_open
+	scan := func(text []byte) (result *ScanResult, failed bool) {
+		result = p.check(text, sourceURL, direction, func(ctx context.Context) (*ScanResult, error) {
+			r, err := p.scanner.ScanContent(ctx, text, sourceURL, "text/plain")
+			failed = err != nil
+			return r, err
+		})
+		return result, failed
+	}
+
+	var worst *ScanResult
+	var offending []string
+	var threats []Threat
+
+	flag := func(member string, result *ScanResult) {
+		offending = append(offending, member)
+		for _, threat := range result.ThreatsFound {
+			threat.Location = member
+			threats = append(threats, threat)
+		}
+	}
+
+	for _, chunk := range chunkArchiveMembers(contents.Members) {
+		var text bytes.Buffer
+		for _, m := range chunk {
+			text.WriteString(archiveChunkHeader(m.Path))
+			text.Write(m.Text)
+		}
+
+		result, failed := scan(text.Bytes())
+		if failed {
+			return result
+		}
+		if worst == nil || decisionRank(result.Decision) > decisionRank(worst.Decision) {
+			worst = result
+		}
+		if result.Decision == DecisionAllow {
+			continue
+		}
+
+		if len(chunk) == 1 {
+			flag(chunk[0].Path, result)
+			continue
+		}
+
+		// Narrow the verdict down to individual members
+		found := false
+		for _, m := range chunk {
+			memberResult, failed := scan(m.Text)
+			if failed || memberResult == nil || memberResult.Decision == DecisionAllow {
+				continue
+			}
+			found = true
+			flag(m.Path, memberResult)
+		}
+		if !found {
+			// Only the combination was flagged; report the whole group
+			for _, m := range chunk {
+				flag(m.Path, result)
+			}
+		}
+	}
+
+	if worst.Decision == DecisionAllow {
+		if contents.Truncated && !cfg.FailOpen {
+			return archiveLimitResult()
+		}
+		worst.Metadata = archiveMetadata(worst.Metadata, contents, nil)
+		return worst
+	}
+
+	verdict := "Malicious"
+	if worst.Decision == DecisionWarn {
+		verdict = "Suspicious"
+	}
+	return &ScanResult{
+		Decision:          worst.Decision,
+		Scores:            worst.Scores,
+		Reason:            fmt.Sprintf("%s content in archive members: %s", verdict, strings.Join(offending, ", ")),
+		ThreatsFound:      threats,
+		RecommendedAction: worst.RecommendedAction,
+		Metadata:          archiveMetadata(worst.Metadata, contents, offending),
+	}
+}
+
+// chunkArchiveMembers groups members so each group fits in one scan request
+func chunkArchiveMembers(members []ArchiveMember) [][]ArchiveMember {
+	var chunks [][]ArchiveMember
+	var current []ArchiveMember
+	size := 0
+	for _, m := range members {
+		n := len(m.Text) + len(archiveChunkHeader(m.Path))
+		if len(current) > 0 && size+n > maxExtractedText {
+			chunks = append(chunks, current)
+			current, size = nil, 0
+		}
+		current = append(current, m)
+		size += n
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// archiveLimitResult blocks an archive that could not be fully inspected
+func archiveLimitResult() *ScanResult {
+	return &ScanResult{
+		Decision:          DecisionBlock,
+		Reason:            "Archive exceeds inspection limits - blocking for safety",
+		RecommendedAction: "Raise scanning.archives limits or download the archive another way",
+	}
+}
+
+// archiveMetadata adds archive details to a result's metadata
+func archiveMetadata(metadata map[string]interface{}, contents *ArchiveContents, offending []string) map[string]interface{} {
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["members_scanned"] = len(contents.Members)
+	metadata["truncated"] = contents.Truncated
+	if len(offending) > 0 {
+		metadata[archiveMembersKey] = offending
+	}
+	return metadata
+}
+
+// offendingMembers returns the archive member paths that caused a verdict
+func offendingMembers(result *ScanResult) []string {
+	if result == nil || result.Metadata == nil {
+		return nil
+	}
+	switch v := result.Metadata[archiveMembersKey].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		members := make([]string, 0, len(v))
+		for _, m := range v {
+			if s, ok := m.(string); ok {
+				members = append(members, s)
+			}
+		}
+		return members
+	}
+	return nil
+}
+
+// decisionRank orders decisions from least to most severe
+func decisionRank(d Decision) int {
+	switch d {
+	case DecisionBlock:
+		return 2
+	case DecisionWarn:
+		return 1
+	}
+	return 0
+}
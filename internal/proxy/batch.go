@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"stronghold/internal/usdc"
+	"stronghold/internal/wallet"
+)
+
+// BatchConfig controls coalescing of concurrent small content scans into a
+// single /v1/scan/batch call, paid for with one x402 payment
+type BatchConfig struct {
+	Enabled     bool `yaml:"enabled"`       // Coalesce scans into batches
+	WindowMs    int  `yaml:"window_ms"`     // How long the first scan waits for others to join
+	MaxItems    int  `yaml:"max_items"`     // A full batch is sent without waiting
+	MaxItemSize int  `yaml:"max_item_size"` // Larger content is scanned on its own (bytes)
+}
+
+// applyDefaultBatchConfig sets default values for BatchConfig if not already set
+func applyDefaultBatchConfig(cfg *BatchConfig) {
+	// If MaxItems is zero, this is an old config without the batch section
+	if cfg.MaxItems == 0 {
+		cfg.WindowMs = 25
+		cfg.MaxItems = 16
+		cfg.MaxItemSize = 32 * 1024
+	}
+}
+
+// batchItem is one scan waiting in a batch
+type batchItem struct {
+	req    ScanRequest
+	host   string
+	result *ScanResult
+	err    error
+	done   chan struct{}
+}
+
+// scanBatcher collects content scans that arrive within a short window and
+// sends them as one batch request
+type scanBatcher struct {
+	client      *ScannerClient
+	window      time.Duration
+	maxItems    int
+	maxItemSize int
+	unsupported atomic.Bool // The API has no batch endpoint
+
+	mu      sync.Mutex
+	pending []*batchItem
+	timer   *time.Timer
+}
+
+func newScanBatcher(client *ScannerClient, cfg BatchConfig) *scanBatcher {
+	return &scanBatcher{
+		client:      client,
+		window:      time.Duration(cfg.WindowMs) * time.Millisecond,
+		maxItems:    cfg.MaxItems,
+		maxItemSize: cfg.MaxItemSize,
+	}
+}
+
+// accepts reports whether content of size bytes should join a batch
+func (b *scanBatcher) accepts(size int) bool {
+	return b != nil && size <= b.maxItemSize && !b.unsupported.Load()
+}
+
+// submit adds a scan to the current batch and waits for its result
+func (b *scanBatcher) submit(ctx context.Context, req ScanRequest, host string) (*ScanResult, error) {
+	item := &batchItem{req: req, host: host, done: make(chan struct{})}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, item)
+	if len(b.pending) >= b.maxItems {
+		items := b.takeLocked()
+		b.mu.Unlock()
+		go b.send(items)
+	} else {
+		if b.timer == nil {
+			b.timer = time.AfterFunc(b.window, b.flush)
+		}
+		b.mu.Unlock()
+	}
+
+	select {
+	case <-item.done:
+		return item.result, item.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// flush sends whatever is pending when the window closes
+func (b *scanBatcher) flush() {
+	b.mu.Lock()
+	items := b.takeLocked()
+	b.mu.Unlock()
+	if len(items) > 0 {
+		b.send(items)
+	}
+}
+
+// takeLocked removes and returns the pending items. Callers must hold b.mu.
+func (b *scanBatcher) takeLocked() []*batchItem {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	items := b.pending
+	b.pending = nil
+	return items
+}
+
+// send scans items and delivers each result. A lone item goes to
+// /v1/scan/content as usual.
+func (b *scanBatcher) send(items []*batchItem) {
+	// Items wait on their own contexts, so the batch is bounded by the
+	// HTTP client timeout instead
+	ctx := context.Background()
+	defer func() {
+		for _, item := range items {
+			close(item.done)
+		}
+	}()
+
+	if len(items) > 1 && !b.unsupported.Load() {
+		err := b.client.scanBatch(ctx, items)
+		if !errors.Is(err, errBatchUnsupported) {
+			return
+		}
+		b.unsupported.Store(true)
+	}
+
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		go func(item *batchItem) {
+			defer wg.Done()
+			item.result, item.err = b.client.scanWithPayment(ctx, "/v1/scan/content", item.host, item.req)
+		}(item)
+	}
+	wg.Wait()
+}
+
+// errBatchUnsupported means the API predates /v1/scan/batch
+var errBatchUnsupported = errors.New("batch scanning not supported by the API")
+
+// scanBatchRequest is the body of a /v1/scan/batch call
+type scanBatchRequest struct {
+	Items []ScanRequest `json:"items"`
+}
+
+// scanBatchResponse holds one result per item, in request order
+type scanBatchResponse struct {
+	Results   []*ScanResult `json:"results"`
+	RequestID string        `json:"request_id"`
+}
+
+// scanBatch scans items with a single request and payment, setting each
+// item's result or error. Items whose payment would exceed the budget get a
+// *BudgetExceededError and are left out of the batch.
+func (c *ScannerClient) scanBatch(ctx context.Context, items []*batchItem) error {
+	// Try the request first (might already have credit, a prepaid session or be in dev mode)
+	token, items, charged := c.chargeHosts(c.session.current(), items)
+	if len(items) == 0 {
+		return nil
+	}
+	statusCode, paymentReq, err := c.postBatch(ctx, items, sessionHeaders(token))
+	if statusCode != http.StatusOK {
+		c.refundHosts(items, charged)
+	}
+	if statusCode == http.StatusNotFound || statusCode == http.StatusMethodNotAllowed {
+		return errBatchUnsupported
+	}
+	if err != nil || statusCode != http.StatusPaymentRequired {
+		failBatch(items, err)
+		return err
+	}
+	c.session.drop(token)
+	if paymentReq != nil {
+		if total, err := paymentAmount(paymentReq); err == nil {
+			c.session.setPrice("/v1/scan/batch", total/usdc.MicroUSDC(len(items)))
+		}
+	}
+
+	// Open a new session rather than paying for this batch alone
+	if token, ok := c.session.open(ctx); ok {
+		token, items, charged := c.chargeHosts(token, items)
+		if len(items) == 0 {
+			return nil
+		}
+		if token != "" {
+			statusCode, _, err = c.postBatch(ctx, items, sessionHeaders(token))
+			if statusCode != http.StatusOK {
+				c.refundHosts(items, charged)
+			}
+			if err != nil || statusCode != http.StatusPaymentRequired {
+				failBatch(items, err)
+				return err
+			}
+			c.session.drop(token)
+		}
+	}
+
+	if paymentReq == nil {
+		err = fmt.Errorf("payment required but no requirements received")
+		failBatch(items, err)
+		return err
+	}
+
+	selectedWallet, err := c.walletFor(paymentReq)
+	if err != nil {
+		failBatch(items, err)
+		return err
+	}
+
+	// The batch is priced per item. Reserve each item against the budget
+	// before signing, and drop the ones that do not fit.
+	total, ok := new(big.Int).SetString(paymentReq.Amount, 10)
+	if !ok {
+		err = fmt.Errorf("invalid payment amount: %s", paymentReq.Amount)
+		failBatch(items, err)
+		return err
+	}
+	perItem := new(big.Int).Div(total, big.NewInt(int64(len(items))))
+	amount := usdc.FromBigInt(perItem, paymentReq.Network)
+
+	paid := items[:0:0]
+	for _, item := range items {
+		if c.budget != nil {
+			var exceeded *BudgetExceededError
+			if err := c.budget.Reserve(item.host, amount); errors.As(err, &exceeded) {
+				item.err = err
+				continue
+			}
+		}
+		paid = append(paid, item)
+	}
+	if len(paid) == 0 {
+		return nil
+	}
+	if len(paid) < len(items) {
+		paymentReq.Amount = new(big.Int).Mul(perItem, big.NewInt(int64(len(paid)))).String()
+	}
+
+	refund := func() {
+		for _, item := range paid {
+			c.refund(item.host, amount)
+		}
+	}
+
+	paymentHeader, err := selectedWallet.CreateX402Payment(paymentReq)
+	if err != nil {
+		refund()
+		err = fmt.Errorf("failed to create payment: %w", err)
+		failBatch(paid, err)
+		return err
+	}
+
+	// Retry with payment
+	statusCode, _, err = c.postBatch(ctx, paid, paymentHeaders(paymentHeader))
+	if err != nil {
+		failBatch(paid, err)
+		return err
+	}
+	if statusCode == http.StatusPaymentRequired {
+		refund()
+		err = fmt.Errorf("payment was rejected - insufficient funds or invalid payment. Check your balance with 'stronghold wallet balance'")
+		failBatch(paid, err)
+		return err
+	}
+	return nil
+}
+
+// postBatch sends items to /v1/scan/batch and sets their results on success
+func (c *ScannerClient) postBatch(ctx context.Context, items []*batchItem, headers map[string]string) (int, *wallet.PaymentRequirements, error) {
+	req := scanBatchRequest{Items: make([]ScanRequest, len(items))}
+	for i, item := range items {
+		req.Items[i] = item.req
+	}
+
+	var resp scanBatchResponse
+	statusCode, paymentReq, err := c.post(ctx, "/v1/scan/batch", req, headers, &resp)
+	if err != nil || statusCode != http.StatusOK {
+		return statusCode, paymentReq, err
+	}
+	if len(resp.Results) != len(items) {
+		return statusCode, nil, fmt.Errorf("batch scan returned %d results for %d items", len(resp.Results), len(items))
+	}
+	for i, item := range items {
+		item.result = resp.Results[i]
+	}
+	return statusCode, nil, nil
+}
+
+// chargeHosts charges each item of a batch debited from the session with
+// token to its host, like chargeHost. Items over their host's cap get a
+// *BudgetExceededError and are left out of the returned items.
+func (c *ScannerClient) chargeHosts(token string, items []*batchItem) (string, []*batchItem, usdc.MicroUSDC) {
+	if token == "" || c.budget == nil {
+		return token, items, 0
+	}
+	price, ok := c.session.price("/v1/scan/batch")
+	if !ok {
+		return "", items, 0
+	}
+	charged := items[:0:0]
+	for _, item := range items {
+		if _, _, err := c.chargeHost(token, "/v1/scan/batch", item.host); err != nil {
+			item.err = err
+			continue
+		}
+		charged = append(charged, item)
+	}
+	return token, charged, price
+}
+
+// refundHosts reverses chargeHosts for a batch the session did not pay for
+func (c *ScannerClient) refundHosts(items []*batchItem, amount usdc.MicroUSDC) {
+	for _, item := range items {
+		c.refundHost(item.host, amount)
+	}
+}
+
+// failBatch sets err on every item
+func failBatch(items []*batchItem, err error) {
+	for _, item := range items {
+		item.err = err
+	}
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"stronghold/internal/wallet"
+)
+
+// newBatchScanServer returns an API that prices batches at $0.001 per item
+// and counts calls per endpoint
+func newBatchScanServer(t *testing.T, batchCalls, contentCalls *int32, paidItems *int32) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/scan/batch":
+			atomic.AddInt32(batchCalls, 1)
+			var req scanBatchRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if r.Header.Get("X-Payment") == "" {
+				w.WriteHeader(http.StatusPaymentRequired)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"payment_requirements": map[string]interface{}{
+						"scheme":    "x402",
+						"network":   "base-sepolia",
+						"recipient": "0x1234567890123456789012345678901234567890",
+						"amount":    fmt.Sprint(1000 * len(req.Items)),
+						"currency":  "USDC",
+					},
+				})
+				return
+			}
+			atomic.AddInt32(paidItems, int32(len(req.Items)))
+			resp := scanBatchResponse{}
+			for _, item := range req.Items {
+				resp.Results = append(resp.Results, &ScanResult{Decision: DecisionAllow, Reason: "batched " + item.Text})
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/v1/scan/content":
+			atomic.AddInt32(contentCalls, 1)
+			var req ScanRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			json.NewEncoder(w).Encode(ScanResult{Decision: DecisionAllow, Reason: "single " + req.Text})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// scanConcurrently scans each text from its own goroutine
+func scanConcurrently(t *testing.T, client *ScannerClient, texts []string, sourceURL func(int) string) []*ScanResult {
+	t.Helper()
+	results := make([]*ScanResult, len(texts))
+	var wg sync.WaitGroup
+	for i, text := range texts {
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			result, err := client.ScanContent(context.Background(), []byte(text), sourceURL(i), "text/plain")
+			if err != nil {
+				t.Errorf("scan %d failed: %v", i, err)
+				return
+			}
+			results[i] = result
+		}(i, text)
+	}
+	wg.Wait()
+	return results
+}
+
+func TestScannerClient_BatchCoalescing(t *testing.T) {
+	testWallet, err := wallet.NewTestWallet()
+	if err != nil {
+		t.Fatalf("failed to create test wallet: %v", err)
+	}
+
+	var batchCalls, contentCalls, paidItems int32
+	server := newBatchScanServer(t, &batchCalls, &contentCalls, &paidItems)
+	defer server.Close()
+
+	client := NewScannerClient(server.URL, "")
+	client.SetWallet(testWallet)
+	client.SetBatching(BatchConfig{Enabled: true, WindowMs: 1000, MaxItems: 4, MaxItemSize: 1024})
+
+	texts := []string{"one", "two", "three", "four"}
+	results := scanConcurrently(t, client, texts, func(int) string { return "http://example.com" })
+
+	for i, result := range results {
+		if result == nil || result.Reason != "batched "+texts[i] {
+			t.Errorf("item %d: expected its own batched result, got %+v", i, result)
+		}
+	}
+	if batchCalls != 2 || contentCalls != 0 {
+		t.Errorf("expected one probe and one paid batch call, got %d batch and %d content calls", batchCalls, contentCalls)
+	}
+	if paidItems != 4 {
+		t.Errorf("expected 4 paid items, got %d", paidItems)
+	}
+
+	// Content larger than max_item_size is scanned on its own
+	result, err := client.ScanContent(context.Background(), []byte(strings.Repeat("x", 2048)), "http://example.com", "text/plain")
+	if err != nil || !strings.HasPrefix(result.Reason, "single") {
+		t.Errorf("expected large content to skip batching, got %+v, %v", result, err)
+	}
+}
+
+func TestScannerClient_BatchBudget(t *testing.T) {
+	testWallet, err := wallet.NewTestWallet()
+	if err != nil {
+		t.Fatalf("failed to create test wallet: %v", err)
+	}
+
+	var batchCalls, contentCalls, paidItems int32
+	server := newBatchScanServer(t, &batchCalls, &contentCalls, &paidItems)
+	defer server.Close()
+
+	client := NewScannerClient(server.URL, "")
+	client.SetWallet(testWallet)
+	client.SetBudget(newTestLedger(t, BudgetConfig{PerHostDailyLimit: 0.002, OnExceeded: BudgetFailClosed}), 0.55)
+	client.SetBatching(BatchConfig{Enabled: true, WindowMs: 1000, MaxItems: 3, MaxItemSize: 1024})
+
+	// Two items from a.example fit its per-host cap, the third does not
+	results := scanConcurrently(t, client, []string{"one", "two", "three"}, func(int) string { return "http://a.example" })
+
+	var blocked int
+	for _, result := range results {
+		if result != nil && result.Metadata["budget_exceeded"] == "host" {
+			blocked++
+		}
+	}
+	if blocked != 1 {
+		t.Errorf("expected one item to hit the host cap, got %d", blocked)
+	}
+	if paidItems != 2 {
+		t.Errorf("expected the batch to be paid for 2 items, got %d", paidItems)
+	}
+}
+
+func TestScannerClient_BatchUnsupported(t *testing.T) {
+	var contentCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/scan/content" {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&contentCalls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ScanResult{Decision: DecisionAllow, Reason: "single"})
+	}))
+	defer server.Close()
+
+	client := NewScannerClient(server.URL, "")
+	client.SetBatching(BatchConfig{Enabled: true, WindowMs: 1000, MaxItems: 2, MaxItemSize: 1024})
+
+	results := scanConcurrently(t, client, []string{"one", "two"}, func(int) string { return "http://example.com" })
+	for i, result := range results {
+		if result == nil || result.Reason != "single" {
+			t.Errorf("item %d: expected fallback to /v1/scan/content, got %+v", i, result)
+		}
+	}
+	if contentCalls != 2 {
+		t.Errorf("expected 2 content calls, got %d", contentCalls)
+	}
+	if client.batcher.accepts(10) {
+		t.Error("expected batching to be disabled after the API rejected it")
+	}
+}
@@ -0,0 +1,198 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // Scans go to the API
+	BreakerOpen     = "open"      // Scans fail immediately
+	BreakerHalfOpen = "half-open" // One probe scan is let through
+)
+
+// ErrBreakerOpen is returned instead of calling the API while the breaker
+// is open
+var ErrBreakerOpen = errors.New("scanning API unavailable: circuit breaker is open")
+
+// BreakerConfig controls the circuit breaker in front of the scanning API
+type BreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`           // Stop calling the API after repeated failures
+	FailureThreshold int           `yaml:"failure_threshold"` // Consecutive failures or timeouts that open the breaker
+	Cooldown         time.Duration `yaml:"cooldown"`          // Wait before the first probe after opening
+	MaxCooldown      time.Duration `yaml:"max_cooldown"`      // The cooldown doubles after each failed probe up to this
+}
+
+// applyDefaultBreakerConfig sets default values for BreakerConfig if not already set
+func applyDefaultBreakerConfig(cfg *BreakerConfig) {
+	// If FailureThreshold is zero, this is an old config without the breaker section
+	if cfg.FailureThreshold == 0 {
+		cfg.Enabled = true
+		cfg.FailureThreshold = 5
+		cfg.Cooldown = 10 * time.Second
+		cfg.MaxCooldown = 5 * time.Minute
+	}
+}
+
+// BreakerState describes the circuit breaker for health reports
+type BreakerState struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	RetryAt             time.Time `json:"retry_at,omitzero"` // When the next probe is let through while open
+}
+
+// circuitBreaker stops calls to the scanning API after consecutive
+// failures, so requests fail fast instead of each waiting for a timeout.
+// After a cooldown a single probe is let through; its outcome closes the
+// breaker or opens it again with a doubled cooldown.
+type circuitBreaker struct {
+	threshold int
+	baseCool  time.Duration
+	maxCool   time.Duration
+	onChange  func(BreakerState) // Called without b.mu held when the state changes; may be nil
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	cooldown time.Duration
+	openedAt time.Time
+	probing  bool // A half-open probe is in flight
+}
+
+func newCircuitBreaker(cfg BreakerConfig, onChange func(BreakerState)) *circuitBreaker {
+	maxCool := cfg.MaxCooldown
+	if maxCool < cfg.Cooldown {
+		maxCool = cfg.Cooldown
+	}
+	return &circuitBreaker{
+		threshold: cfg.FailureThreshold,
+		baseCool:  cfg.Cooldown,
+		maxCool:   maxCool,
+		onChange:  onChange,
+		now:       time.Now,
+		state:     BreakerClosed,
+		cooldown:  cfg.Cooldown,
+	}
+}
+
+// allow reports whether a call may go to the API, returning ErrBreakerOpen
+// if not. probe is true for the single call let through to test recovery.
+// Every call that is allowed must be followed by done.
+func (b *circuitBreaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	var change *BreakerState
+	defer func() { b.notify(change) }()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Before(b.openedAt.Add(b.cooldown)) {
+			return false, ErrBreakerOpen
+		}
+		change = b.setStateLocked(BreakerHalfOpen)
+		b.probing = true
+		return true, nil
+	case BreakerHalfOpen:
+		if b.probing {
+			return false, ErrBreakerOpen
+		}
+		b.probing = true
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// done records the outcome of a call allow let through
+func (b *circuitBreaker) done(probe, failed bool) {
+	if b == nil {
+		return
+	}
+	var change *BreakerState
+	defer func() { b.notify(change) }()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+		if failed {
+			// Back off further while the API stays down
+			b.failures++
+			b.cooldown *= 2
+			if b.cooldown > b.maxCool {
+				b.cooldown = b.maxCool
+			}
+			b.openedAt = b.now()
+			change = b.setStateLocked(BreakerOpen)
+			return
+		}
+		b.failures = 0
+		b.cooldown = b.baseCool
+		change = b.setStateLocked(BreakerClosed)
+		return
+	}
+
+	// Calls started before the breaker opened do not change its state
+	if b.state != BreakerClosed {
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = b.now()
+		change = b.setStateLocked(BreakerOpen)
+	}
+}
+
+// setStateLocked moves to state and returns the new state, or nil if it
+// did not change. Callers must hold b.mu and pass the result to notify once
+// they have released it.
+func (b *circuitBreaker) setStateLocked(state string) *BreakerState {
+	if b.state == state {
+		return nil
+	}
+	b.state = state
+	s := b.snapshotLocked()
+	return &s
+}
+
+// notify reports a state change returned by setStateLocked
+func (b *circuitBreaker) notify(change *BreakerState) {
+	if change != nil && b.onChange != nil {
+		b.onChange(*change)
+	}
+}
+
+// snapshot returns the breaker state
+func (b *circuitBreaker) snapshot() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.snapshotLocked()
+}
+
+func (b *circuitBreaker) snapshotLocked() BreakerState {
+	s := BreakerState{State: b.state, ConsecutiveFailures: b.failures}
+	if b.state == BreakerOpen {
+		s.RetryAt = b.openedAt.Add(b.cooldown)
+	}
+	return s
+}
+
+// breakerFailure reports whether a call outcome counts against the API.
+// Requests abandoned by the proxy's own client are not the API's fault.
+func breakerFailure(ctx context.Context, statusCode int, err error) bool {
+	if err != nil {
+		return !errors.Is(ctx.Err(), context.Canceled)
+	}
+	return statusCode >= 500
+}
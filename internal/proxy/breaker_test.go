@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestBreaker(threshold int) (*circuitBreaker, *time.Time) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(BreakerConfig{
+		Enabled:          true,
+		FailureThreshold: threshold,
+		Cooldown:         10 * time.Second,
+		MaxCooldown:      30 * time.Second,
+	}, nil)
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func TestCircuitBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(3)
+
+	for i := 0; i < 2; i++ {
+		probe, err := b.allow()
+		if err != nil || probe {
+			t.Fatalf("expected calls to pass while closed, got probe=%v err=%v", probe, err)
+		}
+		b.done(false, true)
+	}
+	// A success resets the count
+	b.done(false, false)
+	for i := 0; i < 3; i++ {
+		b.done(false, true)
+	}
+
+	if got := b.snapshot(); got.State != BreakerOpen || got.ConsecutiveFailures != 3 {
+		t.Fatalf("expected open after 3 consecutive failures, got %+v", got)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("expected ErrBreakerOpen while open, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_ProbesAndBacksOff(t *testing.T) {
+	b, now := newTestBreaker(1)
+	b.done(false, true)
+
+	if retry := b.snapshot().RetryAt; !retry.Equal(now.Add(10 * time.Second)) {
+		t.Errorf("expected a retry after the cooldown, got %v", retry)
+	}
+
+	// After the cooldown only one probe is let through
+	*now = now.Add(10 * time.Second)
+	probe, err := b.allow()
+	if err != nil || !probe {
+		t.Fatalf("expected a probe after the cooldown, got probe=%v err=%v", probe, err)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("expected other calls to fail fast during the probe, got %v", err)
+	}
+
+	// A failed probe doubles the cooldown, up to the maximum
+	b.done(true, true)
+	if got := b.snapshot(); got.State != BreakerOpen || !got.RetryAt.Equal(now.Add(20*time.Second)) {
+		t.Errorf("expected a doubled cooldown, got %+v", got)
+	}
+	*now = now.Add(20 * time.Second)
+	probe, _ = b.allow()
+	b.done(probe, true)
+	if got := b.snapshot(); !got.RetryAt.Equal(now.Add(30 * time.Second)) {
+		t.Errorf("expected the cooldown capped at 30s, got %+v", got)
+	}
+
+	// A successful probe closes the breaker and resets the cooldown
+	*now = now.Add(30 * time.Second)
+	probe, _ = b.allow()
+	b.done(probe, false)
+	if got := b.snapshot(); got.State != BreakerClosed || got.ConsecutiveFailures != 0 {
+		t.Fatalf("expected closed after a successful probe, got %+v", got)
+	}
+	b.done(false, true)
+	if got := b.snapshot(); !got.RetryAt.Equal(now.Add(10 * time.Second)) {
+		t.Errorf("expected the cooldown reset after recovery, got %+v", got)
+	}
+}
+
+func TestCircuitBreaker_NotifiesWithoutLock(t *testing.T) {
+	b, _ := newTestBreaker(1)
+	var states []BreakerState
+	b.onChange = func(state BreakerState) {
+		// Reading the breaker from the callback must not deadlock
+		states = append(states, b.snapshot())
+	}
+
+	b.done(false, true)
+	if len(states) != 1 || states[0].State != BreakerOpen {
+		t.Fatalf("expected one change to open, got %+v", states)
+	}
+}
+
+func TestBreakerState_OmitsRetryAtWhenClosed(t *testing.T) {
+	b, _ := newTestBreaker(1)
+	data, err := json.Marshal(b.snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"state":"closed","consecutive_failures":0}` {
+		t.Errorf("unexpected closed state: %s", data)
+	}
+}
+
+func TestBreakerFailure_IgnoresCanceledRequests(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if breakerFailure(canceled, 0, context.Canceled) {
+		t.Error("expected a request abandoned by the client not to count")
+	}
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	if !breakerFailure(expired, 0, context.DeadlineExceeded) {
+		t.Error("expected a timeout to count")
+	}
+	if !breakerFailure(context.Background(), http.StatusBadGateway, nil) {
+		t.Error("expected a 5xx response to count")
+	}
+	if breakerFailure(context.Background(), http.StatusPaymentRequired, nil) {
+		t.Error("expected a 402 response not to count")
+	}
+}
+
+func TestHandleHTTP_BreakerShortCircuitsToFailMode(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("content"))
+	}))
+	defer upstream.Close()
+
+	var calls int32
+	scanner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer scanner.Close()
+
+	config := newTestConfig(scanner.URL)
+	config.Scanning.FailOpen = false
+	config.Scanning.Breaker = BreakerConfig{Enabled: true, FailureThreshold: 2, Cooldown: time.Minute, MaxCooldown: time.Minute}
+	s := newTestServer(t, config)
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest("GET", upstream.URL+"/page", nil))
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("request %d: expected fail-closed 403, got %d", i, rec.Code)
+		}
+		if i == 2 && rec.Header().Get("X-Stronghold-Breaker") != BreakerOpen {
+			t.Errorf("expected X-Stronghold-Breaker=open, got %q", rec.Header().Get("X-Stronghold-Breaker"))
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("expected the open breaker to skip the API, got %d calls", got)
+	}
+
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+	var health struct {
+		Status  string        `json:"status"`
+		Breaker *BreakerState `json:"breaker"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+		t.Fatalf("invalid health response: %v", err)
+	}
+	if health.Status != "degraded" || health.Breaker == nil || health.Breaker.State != BreakerOpen {
+		t.Errorf("expected /health to report the open breaker, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,309 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"stronghold/internal/usdc"
+)
+
+// Behaviors when a spending cap is reached
+const (
+	BudgetLocalScan  = "local"       // Scan with the built-in pattern scanner
+	BudgetFailOpen   = "fail_open"   // Pass content unscanned
+	BudgetFailClosed = "fail_closed" // Block content
+)
+
+// BudgetConfig caps what the proxy spends on x402 scan payments. Limits are
+// in USDC; zero means no limit.
+type BudgetConfig struct {
+	DailyLimit        float64 `yaml:"daily_limit"`          // Spend per calendar day
+	MonthlyLimit      float64 `yaml:"monthly_limit"`        // Spend per calendar month
+	PerHostDailyLimit float64 `yaml:"per_host_daily_limit"` // Spend per scanned host per day
+	OnExceeded        string  `yaml:"on_exceeded"`          // local, fail_open or fail_closed
+	Ledger            string  `yaml:"ledger"`               // Where spend is recorded
+}
+
+// applyDefaultBudgetConfig sets default values for BudgetConfig if not already set
+func applyDefaultBudgetConfig(cfg *BudgetConfig) {
+	// If OnExceeded is empty, this is an old config without the budget section
+	if cfg.OnExceeded == "" {
+		cfg.DailyLimit = 5
+		cfg.MonthlyLimit = 50
+		cfg.PerHostDailyLimit = 1
+		cfg.OnExceeded = BudgetLocalScan
+	}
+}
+
+// IsValidBudgetBehavior reports whether b is a known on_exceeded behavior
+func IsValidBudgetBehavior(b string) bool {
+	return b == BudgetLocalScan || b == BudgetFailOpen || b == BudgetFailClosed
+}
+
+// BudgetExceededError is returned when a payment would exceed a spending cap
+type BudgetExceededError struct {
+	Limit string // "daily", "monthly" or "host"
+	Host  string
+	Spent usdc.MicroUSDC
+	Cap   usdc.MicroUSDC
+}
+
+func (e *BudgetExceededError) Error() string {
+	if e.Limit == "host" {
+		return fmt.Sprintf("daily spending cap for %s reached ($%s of $%s)", e.Host, e.Spent, e.Cap)
+	}
+	return fmt.Sprintf("%s spending cap reached ($%s of $%s)", e.Limit, e.Spent, e.Cap)
+}
+
+// ledgerRetention is how long per-day spend is kept in the ledger
+const ledgerRetention = 400 * 24 * time.Hour
+
+// DaySpend is the spend recorded for one calendar day
+type DaySpend struct {
+	Total    usdc.MicroUSDC            `json:"total"`
+	Payments int                       `json:"payments"`
+	Hosts    map[string]usdc.MicroUSDC `json:"hosts"`
+}
+
+// SpendLedger records x402 payments per day and host and enforces the
+// budget. The proxy writes the ledger; the CLI reads it for reports.
+type SpendLedger struct {
+	path         string
+	daily        usdc.MicroUSDC
+	monthly      usdc.MicroUSDC
+	perHostDaily usdc.MicroUSDC
+	onExceeded   string
+
+	mu   sync.Mutex
+	days map[string]*DaySpend
+	now  func() time.Time
+}
+
+// OpenSpendLedger loads the ledger at cfg.Ledger, starting an empty one if
+// the file does not exist yet
+func OpenSpendLedger(cfg BudgetConfig) (*SpendLedger, error) {
+	if cfg.Ledger == "" {
+		return nil, errors.New("spend ledger path is not configured")
+	}
+
+	l := &SpendLedger{
+		path:         cfg.Ledger,
+		daily:        usdc.FromFloat(cfg.DailyLimit),
+		monthly:      usdc.FromFloat(cfg.MonthlyLimit),
+		perHostDaily: usdc.FromFloat(cfg.PerHostDailyLimit),
+		onExceeded:   cfg.OnExceeded,
+		days:         make(map[string]*DaySpend),
+		now:          time.Now,
+	}
+
+	data, err := os.ReadFile(cfg.Ledger)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spend ledger: %w", err)
+	}
+	if err := json.Unmarshal(data, &l.days); err != nil {
+		return nil, fmt.Errorf("failed to parse spend ledger: %w", err)
+	}
+	return l, nil
+}
+
+// OnExceeded returns the configured behavior for when a cap is reached
+func (l *SpendLedger) OnExceeded() string {
+	return l.onExceeded
+}
+
+// Reserve records a payment of amount for host if it fits within every
+// cap, and returns a *BudgetExceededError otherwise. Reserving before the
+// payment is signed keeps concurrent scans from overshooting a cap.
+func (l *SpendLedger) Reserve(host string, amount usdc.MicroUSDC) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	day := l.dayLocked(now)
+	month := l.monthTotalLocked(now)
+
+	if l.daily > 0 && day.Total+amount > l.daily {
+		return &BudgetExceededError{Limit: "daily", Spent: day.Total, Cap: l.daily}
+	}
+	if l.monthly > 0 && month+amount > l.monthly {
+		return &BudgetExceededError{Limit: "monthly", Spent: month, Cap: l.monthly}
+	}
+	if l.perHostDaily > 0 && host != "" && day.Hosts[host]+amount > l.perHostDaily {
+		return &BudgetExceededError{Limit: "host", Host: host, Spent: day.Hosts[host], Cap: l.perHostDaily}
+	}
+
+	day.Total += amount
+	day.Payments++
+	if host != "" {
+		day.Hosts[host] += amount
+	}
+	return l.saveLocked(now)
+}
+
+// Refund reverses a reservation for a payment that was not made
+func (l *SpendLedger) Refund(host string, amount usdc.MicroUSDC) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	day := l.dayLocked(now)
+	day.Total -= amount
+	day.Payments--
+	if host != "" {
+		day.Hosts[host] -= amount
+		if day.Hosts[host] <= 0 {
+			delete(day.Hosts, host)
+		}
+	}
+	return l.saveLocked(now)
+}
+
+// ReserveHost attributes a scan debited from a prepaid session to host if
+// it fits within the per-host cap. The session deposit already counted
+// against the daily and monthly caps, so the totals are left alone.
+func (l *SpendLedger) ReserveHost(host string, amount usdc.MicroUSDC) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	day := l.dayLocked(now)
+	if l.perHostDaily > 0 && day.Hosts[host]+amount > l.perHostDaily {
+		return &BudgetExceededError{Limit: "host", Host: host, Spent: day.Hosts[host], Cap: l.perHostDaily}
+	}
+	day.Hosts[host] += amount
+	return l.saveLocked(now)
+}
+
+// RefundHost reverses ReserveHost for a scan the session did not pay for
+func (l *SpendLedger) RefundHost(host string, amount usdc.MicroUSDC) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	day := l.dayLocked(now)
+	day.Hosts[host] -= amount
+	if day.Hosts[host] <= 0 {
+		delete(day.Hosts, host)
+	}
+	return l.saveLocked(now)
+}
+
+// HostSpend is the spend attributed to one host
+type HostSpend struct {
+	Host   string
+	Amount usdc.MicroUSDC
+}
+
+// SpendSummary reports spend against the configured caps
+type SpendSummary struct {
+	Today         usdc.MicroUSDC
+	TodayPayments int
+	Month         usdc.MicroUSDC
+	DailyLimit    usdc.MicroUSDC
+	MonthlyLimit  usdc.MicroUSDC
+	PerHostLimit  usdc.MicroUSDC
+	Hosts         []HostSpend // Today's spend by host, highest first
+}
+
+// Summary returns today's and this month's spend
+func (l *SpendLedger) Summary() SpendSummary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	summary := SpendSummary{
+		Month:        l.monthTotalLocked(now),
+		DailyLimit:   l.daily,
+		MonthlyLimit: l.monthly,
+		PerHostLimit: l.perHostDaily,
+	}
+	if day, ok := l.days[dayKey(now)]; ok {
+		summary.Today = day.Total
+		summary.TodayPayments = day.Payments
+		for host, amount := range day.Hosts {
+			summary.Hosts = append(summary.Hosts, HostSpend{Host: host, Amount: amount})
+		}
+	}
+	sort.Slice(summary.Hosts, func(i, j int) bool {
+		if summary.Hosts[i].Amount != summary.Hosts[j].Amount {
+			return summary.Hosts[i].Amount > summary.Hosts[j].Amount
+		}
+		return summary.Hosts[i].Host < summary.Hosts[j].Host
+	})
+	return summary
+}
+
+func (l *SpendLedger) dayLocked(now time.Time) *DaySpend {
+	key := dayKey(now)
+	day, ok := l.days[key]
+	if !ok {
+		day = &DaySpend{}
+		l.days[key] = day
+	}
+	if day.Hosts == nil {
+		day.Hosts = make(map[string]usdc.MicroUSDC)
+	}
+	return day
+}
+
+func (l *SpendLedger) monthTotalLocked(now time.Time) usdc.MicroUSDC {
+	prefix := now.Format("2006-01-")
+	var total usdc.MicroUSDC
+	for key, day := range l.days {
+		if strings.HasPrefix(key, prefix) {
+			total += day.Total
+		}
+	}
+	return total
+}
+
+// saveLocked drops days past the retention period and writes the ledger
+// atomically. Callers must hold l.mu.
+func (l *SpendLedger) saveLocked(now time.Time) error {
+	cutoff := dayKey(now.Add(-ledgerRetention))
+	for key := range l.days {
+		if key < cutoff {
+			delete(l.days, key)
+		}
+	}
+
+	data, err := json.MarshalIndent(l.days, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode spend ledger: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0700); err != nil {
+		return fmt.Errorf("failed to create ledger directory: %w", err)
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write spend ledger: %w", err)
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return fmt.Errorf("failed to write spend ledger: %w", err)
+	}
+	return nil
+}
+
+func dayKey(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// spendHost returns the host a scan of sourceURL is attributed to
+func spendHost(sourceURL string) string {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,461 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CanaryConfig points at the registry of canary credentials
+type CanaryConfig struct {
+	File string `yaml:"file"` // JSON registry written by 'stronghold canary'; no canaries if it does not exist
+}
+
+// Canary kinds
+const (
+	CanaryAWS   = "aws"   // AWS-style access key ID and secret access key
+	CanaryToken = "token" // API token
+	CanaryURL   = "url"   // Unguessable link
+)
+
+// CanaryKinds lists the kinds of canary that can be created
+var CanaryKinds = []string{CanaryAWS, CanaryToken, CanaryURL}
+
+const (
+	defaultCanaryTokenPrefix = "sk-"
+	defaultCanaryURLBase     = "https://files.example.com/s/"
+	canaryHitsFile           = "canary-hits.jsonl"
+	canaryAlphanumeric       = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	canaryAWSKeyAlphabet     = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+)
+
+// ErrCanaryNotFound is returned when no canary matches an ID
+var ErrCanaryNotFound = errors.New("canary not found")
+
+// Canary is a fake credential planted in an agent environment. It has no
+// legitimate use, so any outbound request carrying one of its tokens is
+// exfiltration.
+type Canary struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Label     string     `json:"label,omitempty"`
+	Value     string     `json:"value"`            // What to plant: the key ID, token or URL
+	Secret    string     `json:"secret,omitempty"` // Secret access key of AWS canaries
+	Tokens    []string   `json:"tokens"`           // Strings whose presence in a request identifies the canary
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the canary is still matched
+func (c *Canary) Active() bool {
+	return c.RevokedAt == nil
+}
+
+// CanaryHit records an outbound request that carried a canary
+type CanaryHit struct {
+	CanaryID  string    `json:"canary_id"`
+	At        time.Time `json:"at"`
+	URL       string    `json:"url"`
+	Method    string    `json:"method"`
+	Location  string    `json:"location"` // "url", "header <name>" or "body"
+	RequestID string    `json:"request_id,omitempty"`
+	Transport string    `json:"transport"`
+}
+
+// canaryFile is the content of the registry
+type canaryFile struct {
+	Canaries []Canary `json:"canaries"`
+}
+
+// CanaryStore is the registry of canaries. The CLI creates and revokes
+// canaries; the proxy rereads the registry whenever it changes, so new
+// canaries are matched without a restart, and appends hits to a log next
+// to it.
+type CanaryStore struct {
+	path     string
+	hitsPath string
+
+	mu       sync.Mutex
+	canaries []Canary
+	mtime    time.Time
+	size     int64
+	loaded   bool
+}
+
+// OpenCanaries opens the registry at cfg.File. The file is created when
+// the first canary is.
+func OpenCanaries(cfg CanaryConfig) (*CanaryStore, error) {
+	if cfg.File == "" {
+		return nil, errors.New("canary registry is not configured")
+	}
+	return &CanaryStore{
+		path:     cfg.File,
+		hitsPath: filepath.Join(filepath.Dir(cfg.File), canaryHitsFile),
+	}, nil
+}
+
+// List returns every canary, revoked ones included, oldest first
+func (s *CanaryStore) List() ([]Canary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	canaries, err := s.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	return append([]Canary(nil), canaries...), nil
+}
+
+// Create generates a canary of kind and registers it. For tokens, option
+// is the prefix (default "sk-"); for URLs, the base URL the random path is
+// appended to.
+func (s *CanaryStore) Create(kind, label, option string) (*Canary, error) {
+	canary, err := newCanary(kind, label, option)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	canaries, err := s.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.saveLocked(append(canaries, *canary)); err != nil {
+		return nil, err
+	}
+	return canary, nil
+}
+
+// Revoke stops matching the canary whose ID starts with prefix
+func (s *CanaryStore) Revoke(prefix string) (*Canary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	canaries, err := s.loadLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	index := -1
+	for i, c := range canaries {
+		if c.ID == prefix {
+			index = i
+			break
+		}
+		if prefix != "" && strings.HasPrefix(c.ID, prefix) {
+			if index >= 0 {
+				return nil, fmt.Errorf("canary ID %q is ambiguous", prefix)
+			}
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, ErrCanaryNotFound
+	}
+
+	updated := append([]Canary(nil), canaries...)
+	canary := updated[index]
+	if canary.Active() {
+		now := time.Now().UTC()
+		canary.RevokedAt = &now
+		updated[index] = canary
+		if err := s.saveLocked(updated); err != nil {
+			return nil, err
+		}
+	}
+	return &canary, nil
+}
+
+// active returns the canaries still matched
+func (s *CanaryStore) active() []Canary {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	canaries, err := s.loadLocked()
+	if err != nil {
+		return nil
+	}
+	var active []Canary
+	for _, c := range canaries {
+		if c.Active() {
+			active = append(active, c)
+		}
+	}
+	return active
+}
+
+// RecordHit appends hit to the hit log
+func (s *CanaryStore) RecordHit(hit CanaryHit) error {
+	data, err := json.Marshal(hit)
+	if err != nil {
+		return fmt.Errorf("failed to encode canary hit: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.hitsPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open canary hits: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write canary hit: %w", err)
+	}
+	return nil
+}
+
+// Hits returns the recorded hits, oldest first
+func (s *CanaryStore) Hits() ([]CanaryHit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(s.hitsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open canary hits: %w", err)
+	}
+	defer f.Close()
+
+	var hits []CanaryHit
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var hit CanaryHit
+		if err := json.Unmarshal(scanner.Bytes(), &hit); err != nil {
+			continue // A torn write loses one hit, not the log
+		}
+		hits = append(hits, hit)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read canary hits: %w", err)
+	}
+	return hits, nil
+}
+
+// loadLocked returns the registry, rereading the file only when it changed
+func (s *CanaryStore) loadLocked() ([]Canary, error) {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.canaries, s.mtime, s.size, s.loaded = nil, time.Time{}, 0, true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat canaries: %w", err)
+	}
+	if s.loaded && info.ModTime().Equal(s.mtime) && info.Size() == s.size {
+		return s.canaries, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read canaries: %w", err)
+	}
+	var file canaryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse canaries: %w", err)
+	}
+	s.canaries, s.mtime, s.size, s.loaded = file.Canaries, info.ModTime(), info.Size(), true
+	return s.canaries, nil
+}
+
+// saveLocked replaces the registry file, so the proxy never reads a
+// partial one
+func (s *CanaryStore) saveLocked(canaries []Canary) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create canary directory: %w", err)
+	}
+	data, err := json.MarshalIndent(canaryFile{Canaries: canaries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode canaries: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write canaries: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write canaries: %w", err)
+	}
+	s.loaded = false
+	return nil
+}
+
+// newCanary generates a canary of kind
+func newCanary(kind, label, option string) (*Canary, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate canary ID: %w", err)
+	}
+	canary := &Canary{
+		ID:        hex.EncodeToString(id),
+		Kind:      kind,
+		Label:     label,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	switch kind {
+	case CanaryAWS:
+		keyID, err := randomString(canaryAWSKeyAlphabet, 16)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := randomString(canaryAlphanumeric, 40)
+		if err != nil {
+			return nil, err
+		}
+		canary.Value = "AKIA" + keyID
+		canary.Secret = secret
+		canary.Tokens = []string{canary.Value, secret}
+	case CanaryToken:
+		if option == "" {
+			option = defaultCanaryTokenPrefix
+		}
+		token, err := randomString(canaryAlphanumeric, 40)
+		if err != nil {
+			return nil, err
+		}
+		canary.Value = option + token
+		canary.Tokens = []string{canary.Value}
+	case CanaryURL:
+		if option == "" {
+			option = defaultCanaryURLBase
+		}
+		if !strings.HasPrefix(option, "http://") && !strings.HasPrefix(option, "https://") {
+			return nil, fmt.Errorf("invalid base URL %q (must start with http:// or https://)", option)
+		}
+		path, err := randomString(canaryAlphanumeric, 24)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasSuffix(option, "/") {
+			option += "/"
+		}
+		canary.Value = option + path
+		// The random path identifies the link however it is written
+		canary.Tokens = []string{path}
+	default:
+		return nil, fmt.Errorf("invalid kind %q (must be %s)", kind, strings.Join(CanaryKinds, ", "))
+	}
+	return canary, nil
+}
+
+// randomString returns n characters drawn uniformly from alphabet
+func randomString(alphabet string, n int) (string, error) {
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, n)
+	for i := range b {
+		k, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate canary: %w", err)
+		}
+		b[i] = alphabet[k.Int64()]
+	}
+	return string(b), nil
+}
+
+// matchCanary returns the first of canaries with a token in text
+func matchCanary(canaries []Canary, text []byte) *Canary {
+	for i := range canaries {
+		for _, token := range canaries[i].Tokens {
+			if token != "" && bytes.Contains(text, []byte(token)) {
+				return &canaries[i]
+			}
+		}
+	}
+	return nil
+}
+
+// findCanary looks for a canary in the URL, headers and buffered body of a
+// request, and returns it with where it was found. Basic credentials are
+// decoded, since a key pair sent that way is base64-encoded.
+func findCanary(canaries []Canary, x *interception) (*Canary, string) {
+	if c := matchCanary(canaries, []byte(x.url)); c != nil {
+		return c, "url"
+	}
+	for name, values := range x.req.Header {
+		for _, v := range values {
+			if c := matchCanary(canaries, []byte(v)); c != nil {
+				return c, "header " + name
+			}
+			if encoded, ok := strings.CutPrefix(v, "Basic "); ok {
+				if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded)); err == nil {
+					if c := matchCanary(canaries, decoded); c != nil {
+						return c, "header " + name
+					}
+				}
+			}
+		}
+	}
+	if c := matchCanary(canaries, x.scanBody); c != nil {
+		return c, "body"
+	}
+	return nil, ""
+}
+
+// canaryStage blocks a request carrying a canary. Canaries are matched
+// exactly, without the scanner, and a hit is blocked whatever the scanning
+// configuration says: a planted credential has no legitimate use.
+func canaryStage(p *pipeline, x *interception) error {
+	if len(x.canaries) == 0 {
+		return nil
+	}
+	canary, location := findCanary(x.canaries, x)
+	if canary == nil {
+		return nil
+	}
+
+	p.logger.Error("canary credential sent", "canary", canary.ID, "kind", canary.Kind, "label", canary.Label,
+		"url", x.url, "location", location, "request_id", x.requestID)
+	if err := p.canaries.RecordHit(CanaryHit{
+		CanaryID:  canary.ID,
+		At:        time.Now().UTC(),
+		URL:       x.url,
+		Method:    x.req.Method,
+		Location:  location,
+		RequestID: x.requestID,
+		Transport: x.transport,
+	}); err != nil {
+		p.logger.Error("failed to record canary hit", "canary", canary.ID, "error", err)
+	}
+
+	x.result = canaryResult(canary, location, x.url)
+	x.scanType = "canary"
+	return nil
+}
+
+// canaryResult is the verdict on a request carrying canary
+func canaryResult(canary *Canary, location, sourceURL string) *ScanResult {
+	name := canary.ID
+	if canary.Label != "" {
+		name = fmt.Sprintf("%s (%s)", canary.ID, canary.Label)
+	}
+	return &ScanResult{
+		Decision:          DecisionBlock,
+		Scores:            map[string]float64{"canary": 1.0, "combined": 1.0},
+		Reason:            fmt.Sprintf("Canary credential %s sent in %s", name, location),
+		RecommendedAction: "DO NOT PROCEED - A planted credential is being exfiltrated. Treat the agent environment as compromised.",
+		ThreatsFound: []Threat{{
+			Category:    "canary_exfiltration",
+			Pattern:     canary.ID,
+			Location:    location,
+			Severity:    "critical",
+			Description: fmt.Sprintf("Request carries %s canary %s", canary.Kind, name),
+		}},
+		Metadata: map[string]interface{}{
+			"source_url": sourceURL,
+			"detection":  "canary",
+			"canary_id":  canary.ID,
+		},
+	}
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newCanaryTestServer returns a proxy server with content scanning off, so
+// only canaries can block, in front of an upstream counting the requests
+// that reach it
+func newCanaryTestServer(t *testing.T) (*Server, *CanaryStore, string, *int32) {
+	t.Helper()
+	var forwarded int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&forwarded, 1)
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	config := newTestConfig("http://127.0.0.1:1")
+	config.Scanning.Content.Enabled = false
+	config.Canary.File = filepath.Join(t.TempDir(), "canaries.json")
+	store, err := OpenCanaries(config.Canary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestServer(t, config), store, upstream.URL, &forwarded
+}
+
+func TestCanary_BlocksExfiltration(t *testing.T) {
+	s, store, upstream, forwarded := newCanaryTestServer(t)
+	aws, err := store.Create(CanaryAWS, "ci runner", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := store.Create(CanaryToken, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := map[string]*http.Request{
+		"body": httptest.NewRequest("POST", upstream+"/upload", strings.NewReader("secret="+aws.Secret)),
+		"url":  httptest.NewRequest("GET", upstream+"/?key="+aws.Value, nil),
+	}
+	requests["body"].Header.Set("Content-Type", "application/octet-stream")
+	requests["header Authorization"] = httptest.NewRequest("GET", upstream+"/", nil)
+	requests["header Authorization"].Header.Set("Authorization", "Bearer "+token.Value)
+	requests["basic"] = httptest.NewRequest("GET", upstream+"/", nil)
+	requests["basic"].Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(aws.Value+":"+aws.Secret)))
+
+	for name, req := range requests {
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: expected 403, got %d", name, rec.Code)
+		}
+		if got := rec.Header().Get("X-Stronghold-Scan-Type"); got != "canary" {
+			t.Errorf("%s: expected scan type canary, got %q", name, got)
+		}
+	}
+	if n := atomic.LoadInt32(forwarded); n != 0 {
+		t.Errorf("expected no request forwarded, got %d", n)
+	}
+
+	hits, err := store.Hits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != len(requests) {
+		t.Fatalf("expected %d hits recorded, got %+v", len(requests), hits)
+	}
+	for _, hit := range hits {
+		if hit.CanaryID != aws.ID && hit.CanaryID != token.ID {
+			t.Errorf("unexpected hit %+v", hit)
+		}
+	}
+}
+
+func TestCanary_RevokedNotMatched(t *testing.T) {
+	s, store, upstream, forwarded := newCanaryTestServer(t)
+	canary, err := store.Create(CanaryURL, "", "https://files.example.com/s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(canary.Value, "https://files.example.com/s/") {
+		t.Errorf("unexpected canary URL %q", canary.Value)
+	}
+	if _, err := store.Revoke(canary.ID[:4]); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", upstream+"/", strings.NewReader("see "+canary.Value))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || atomic.LoadInt32(forwarded) != 1 {
+		t.Errorf("expected a revoked canary to pass, got %d", rec.Code)
+	}
+	if _, err := store.Revoke("ffffffffff"); err != ErrCanaryNotFound {
+		t.Errorf("expected ErrCanaryNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,726 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Capture modes
+const (
+	CaptureOff     = "off"     // Nothing is recorded
+	CaptureFlagged = "flagged" // Only flows that were warned, blocked or failed
+	CaptureAll     = "all"     // Every flow
+)
+
+// CaptureConfig controls recording of proxied flows for HAR export
+type CaptureConfig struct {
+	Mode        string `yaml:"mode"`          // off, flagged or all
+	Dir         string `yaml:"dir"`           // Where captured flows are stored
+	MaxEntries  int    `yaml:"max_entries"`   // Oldest flows are dropped beyond this count
+	MaxBodySize int    `yaml:"max_body_size"` // Bodies are truncated to this many bytes
+}
+
+// applyDefaultCaptureConfig sets default values for CaptureConfig if not already set
+func applyDefaultCaptureConfig(cfg *CaptureConfig) {
+	// If MaxEntries is zero, this is an old config without the capture section
+	if cfg.MaxEntries == 0 {
+		cfg.Mode = CaptureOff
+		cfg.MaxEntries = 500
+		cfg.MaxBodySize = 256 * 1024
+	}
+	if !IsValidCaptureMode(cfg.Mode) {
+		cfg.Mode = CaptureOff
+	}
+}
+
+// IsValidCaptureMode reports whether mode is a known capture mode
+func IsValidCaptureMode(mode string) bool {
+	return mode == CaptureOff || mode == CaptureFlagged || mode == CaptureAll
+}
+
+const (
+	captureStateFile = "capture.state"
+	captureEntryExt  = ".json"
+	redactedValue    = "[redacted]"
+)
+
+// sensitiveHeaders are never written to capture files
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// CaptureState is the on-demand capture mode written by the CLI. It
+// overrides capture.mode from the config file while present.
+type CaptureState struct {
+	Mode      string    `json:"mode"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// CaptureStore keeps recent flows on disk as HAR entries. The proxy writes
+// entries and the CLI starts, stops and exports captures, so state is
+// shared through files in the capture directory.
+type CaptureStore struct {
+	dir         string
+	mode        string
+	maxEntries  int
+	maxBodySize int
+
+	seq   atomic.Uint64
+	count atomic.Int64
+
+	mu         sync.Mutex
+	state      *CaptureState
+	stateMtime time.Time
+	stateSize  int64
+}
+
+// OpenCapture opens (creating if needed) the capture store in cfg.Dir
+func OpenCapture(cfg CaptureConfig) (*CaptureStore, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("capture directory is not configured")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %w", err)
+	}
+
+	c := &CaptureStore{
+		dir:         cfg.Dir,
+		mode:        cfg.Mode,
+		maxEntries:  cfg.MaxEntries,
+		maxBodySize: cfg.MaxBodySize,
+	}
+	names, err := c.entryNames()
+	if err != nil {
+		return nil, err
+	}
+	c.count.Store(int64(len(names)))
+	return c, nil
+}
+
+// Mode returns the effective capture mode: the on-demand state if a
+// capture was started, otherwise the configured mode
+func (c *CaptureStore) Mode() string {
+	if state := c.State(); state != nil {
+		return state.Mode
+	}
+	return c.mode
+}
+
+// State returns the on-demand capture state, or nil if none was started
+func (c *CaptureStore) State() *CaptureState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := filepath.Join(c.dir, captureStateFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		c.state = nil
+		c.stateMtime = time.Time{}
+		c.stateSize = 0
+		return nil
+	}
+	if info.ModTime().Equal(c.stateMtime) && info.Size() == c.stateSize {
+		return c.state
+	}
+
+	c.stateMtime = info.ModTime()
+	c.stateSize = info.Size()
+	c.state = nil
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state CaptureState
+	if err := json.Unmarshal(data, &state); err != nil || !IsValidCaptureMode(state.Mode) {
+		return nil
+	}
+	c.state = &state
+	return c.state
+}
+
+// Start begins an on-demand capture in the given mode
+func (c *CaptureStore) Start(mode string) error {
+	if !IsValidCaptureMode(mode) || mode == CaptureOff {
+		return fmt.Errorf("invalid capture mode: %s", mode)
+	}
+	data, err := json.Marshal(CaptureState{Mode: mode, StartedAt: time.Now().UTC()})
+	if err != nil {
+		return fmt.Errorf("failed to encode capture state: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(c.dir, captureStateFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write capture state: %w", err)
+	}
+	return nil
+}
+
+// Stop ends an on-demand capture, returning to the configured mode
+func (c *CaptureStore) Stop() error {
+	err := os.Remove(filepath.Join(c.dir, captureStateFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove capture state: %w", err)
+	}
+	return nil
+}
+
+// ConfiguredMode returns capture.mode from the config file
+func (c *CaptureStore) ConfiguredMode() string {
+	return c.mode
+}
+
+// Record stores a flow and drops the oldest flows beyond the maximum count
+func (c *CaptureStore) Record(entry HAREntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode capture entry: %w", err)
+	}
+	name := fmt.Sprintf("%020d-%06d%s", entry.StartedDateTime.UnixNano(), c.seq.Add(1)%1000000, captureEntryExt)
+	if err := os.WriteFile(filepath.Join(c.dir, name), data, 0600); err != nil {
+		return fmt.Errorf("failed to write capture entry: %w", err)
+	}
+
+	if c.count.Add(1) > int64(c.maxEntries) && c.maxEntries > 0 {
+		return c.prune()
+	}
+	return nil
+}
+
+// Entries returns the captured flows, oldest first
+func (c *CaptureStore) Entries() ([]HAREntry, error) {
+	names, err := c.entryNames()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]HAREntry, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(c.dir, name))
+		if err != nil {
+			continue
+		}
+		var entry HAREntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Clear removes all captured flows. It returns the number removed.
+func (c *CaptureStore) Clear() (int, error) {
+	names, err := c.entryNames()
+	if err != nil {
+		return 0, err
+	}
+	for i, name := range names {
+		if err := os.Remove(filepath.Join(c.dir, name)); err != nil && !os.IsNotExist(err) {
+			return i, fmt.Errorf("failed to remove capture entry: %w", err)
+		}
+	}
+	c.count.Store(0)
+	return len(names), nil
+}
+
+// ExportHAR writes the captured flows as a HAR 1.2 document
+func (c *CaptureStore) ExportHAR(w io.Writer, creatorVersion string) (int, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return 0, err
+	}
+	har := HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "Stronghold", Version: creatorVersion},
+		Entries: entries,
+	}}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(har); err != nil {
+		return 0, fmt.Errorf("failed to write HAR: %w", err)
+	}
+	return len(entries), nil
+}
+
+// prune drops the oldest flows beyond the maximum count
+func (c *CaptureStore) prune() error {
+	names, err := c.entryNames()
+	if err != nil {
+		return err
+	}
+	excess := len(names) - c.maxEntries
+	for i := 0; i < excess; i++ {
+		if err := os.Remove(filepath.Join(c.dir, names[i])); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove capture entry: %w", err)
+		}
+	}
+	if excess > 0 {
+		c.count.Store(int64(c.maxEntries))
+	}
+	return nil
+}
+
+// entryNames returns the capture entry file names, oldest first
+func (c *CaptureStore) entryNames() ([]string, error) {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read capture directory: %w", err)
+	}
+	var names []string
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), captureEntryExt) {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// HAR is a HAR 1.2 document (http://www.softwareishard.com/blog/har-12-spec/)
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of a HAR document
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator names the application that produced the HAR
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is one request/response pair
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+	Stronghold      *HARVerdict `json:"_stronghold,omitempty"`
+}
+
+// HARRequest is the request half of an entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse is the response half of an entry, as sent to the client
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a header, cookie or query parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is a captured request body
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARContent is a captured response body
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are in milliseconds; -1 means the phase was not measured
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HARVerdict is the Stronghold scan verdict, stored as a custom field
+type HARVerdict struct {
+	Transport    string             `json:"transport"`
+	Decision     string             `json:"decision,omitempty"`
+	Action       string             `json:"action,omitempty"`
+	Reason       string             `json:"reason,omitempty"`
+	ScanType     string             `json:"scan_type,omitempty"`
+	Scores       map[string]float64 `json:"scores,omitempty"`
+	RequestID    string             `json:"request_id,omitempty"`
+	QuarantineID string             `json:"quarantine_id,omitempty"`
+	Error        string             `json:"error,omitempty"`
+}
+
+// captureFlow accumulates one flow while it is proxied. A nil flow records
+// nothing, so call sites need no capture checks.
+type captureFlow struct {
+	store     *CaptureStore
+	mode      string
+	transport string
+	started   time.Time
+	responded time.Time
+
+	req      *http.Request
+	url      string
+	reqBody  *cappedBuffer
+	respBody *cappedBuffer
+
+	status        int
+	respHeader    http.Header
+	respProto     string
+	result        *ScanResult
+	action        string
+	err           error
+	headerWritten bool
+}
+
+// begin starts recording a flow, or returns nil if capture is off
+func (c *CaptureStore) begin(req *http.Request, url, transport string) *captureFlow {
+	if c == nil {
+		return nil
+	}
+	mode := c.Mode()
+	if mode == CaptureOff {
+		return nil
+	}
+	return &captureFlow{
+		store:     c,
+		mode:      mode,
+		transport: transport,
+		started:   time.Now(),
+		req:       req,
+		url:       url,
+		reqBody:   &cappedBuffer{max: c.maxBodySize},
+		respBody:  &cappedBuffer{max: c.maxBodySize},
+	}
+}
+
+// teeRequestBody records the request body as it is forwarded upstream
+func (f *captureFlow) teeRequestBody(body io.ReadCloser) io.ReadCloser {
+	if f == nil || body == nil || body == http.NoBody {
+		return body
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(body, f.reqBody), body}
+}
+
+// responseStarted marks the end of the wait for upstream response headers
+func (f *captureFlow) responseStarted() {
+	if f != nil && f.responded.IsZero() {
+		f.responded = time.Now()
+	}
+}
+
+// setVerdict records the scan result and the action taken
+func (f *captureFlow) setVerdict(result *ScanResult, action string) {
+	if f != nil {
+		f.result = result
+		f.action = action
+	}
+}
+
+// fail records an error that ended the flow
+func (f *captureFlow) fail(err error) {
+	if f != nil && err != nil {
+		f.err = err
+	}
+}
+
+// wrapWriter records the response sent to the client through w
+func (f *captureFlow) wrapWriter(w http.ResponseWriter) http.ResponseWriter {
+	if f == nil {
+		return w
+	}
+	return &captureWriter{ResponseWriter: w, flow: f}
+}
+
+// captureResponse records resp as it is written to the client
+func (f *captureFlow) captureResponse(resp *http.Response) {
+	if f == nil {
+		return
+	}
+	f.responseStarted()
+	f.status = resp.StatusCode
+	f.respHeader = resp.Header.Clone()
+	f.respProto = resp.Proto
+	if resp.Body != nil && resp.Body != http.NoBody {
+		body := resp.Body
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(body, f.respBody), body}
+	}
+}
+
+// flagged reports whether the flow was warned, blocked or failed
+func (f *captureFlow) flagged() bool {
+	if f.err != nil {
+		return true
+	}
+	if f.result != nil && f.result.Decision != DecisionAllow {
+		return true
+	}
+	decision := f.respHeader.Get("X-Stronghold-Decision")
+	return decision != "" && decision != string(DecisionAllow)
+}
+
+// finish writes the flow to the capture store if the mode calls for it
+func (f *captureFlow) finish(logger *slog.Logger) {
+	if f == nil {
+		return
+	}
+	if f.mode == CaptureFlagged && !f.flagged() {
+		return
+	}
+	if err := f.store.Record(f.entry(time.Now())); err != nil {
+		logger.Warn("failed to record captured flow", "url", f.url, "error", err)
+	}
+}
+
+// entry builds the HAR entry for the flow
+func (f *captureFlow) entry(end time.Time) HAREntry {
+	responded := f.responded
+	if responded.IsZero() {
+		responded = end
+	}
+
+	reqHeaders := harHeaders(f.req.Header)
+	if f.req.Host != "" && f.req.Header.Get("Host") == "" {
+		reqHeaders = append([]HARNameValue{{Name: "Host", Value: f.req.Host}}, reqHeaders...)
+	}
+
+	entry := HAREntry{
+		StartedDateTime: f.started.UTC(),
+		Time:            millis(end.Sub(f.started)),
+		Request: HARRequest{
+			Method:      f.req.Method,
+			URL:         f.url,
+			HTTPVersion: f.req.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     reqHeaders,
+			QueryString: harQueryString(f.req),
+			HeadersSize: -1,
+			BodySize:    f.reqBody.total,
+		},
+		Response: HARResponse{
+			Status:      f.status,
+			StatusText:  http.StatusText(f.status),
+			HTTPVersion: f.respProto,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(f.respHeader),
+			RedirectURL: f.respHeader.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    f.respBody.total,
+		},
+		Timings: HARTimings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			SSL:     -1,
+			Wait:    millis(responded.Sub(f.started)),
+			Receive: millis(end.Sub(responded)),
+		},
+		Stronghold: f.verdict(),
+	}
+	if entry.Response.HTTPVersion == "" {
+		entry.Response.HTTPVersion = "HTTP/1.1"
+	}
+
+	if f.reqBody.total > 0 {
+		text, _, truncated := f.reqBody.content()
+		entry.Request.PostData = &HARPostData{
+			MimeType: f.req.Header.Get("Content-Type"),
+			Text:     text,
+			Comment:  truncated,
+		}
+	}
+
+	entry.Response.Content = HARContent{
+		Size:     f.respBody.total,
+		MimeType: f.respHeader.Get("Content-Type"),
+	}
+	if f.respBody.total > 0 {
+		entry.Response.Content.Text, entry.Response.Content.Encoding, entry.Response.Content.Comment = f.respBody.content()
+	}
+
+	if f.err != nil {
+		entry.Comment = f.err.Error()
+	}
+	return entry
+}
+
+// verdict builds the Stronghold custom field, falling back to the response
+// headers when no scan result was recorded directly
+func (f *captureFlow) verdict() *HARVerdict {
+	v := &HARVerdict{
+		Transport:    f.transport,
+		Decision:     f.respHeader.Get("X-Stronghold-Decision"),
+		Action:       f.respHeader.Get("X-Stronghold-Action"),
+		Reason:       f.respHeader.Get("X-Stronghold-Reason"),
+		ScanType:     f.respHeader.Get("X-Stronghold-Scan-Type"),
+		RequestID:    f.respHeader.Get("X-Stronghold-Request-ID"),
+		QuarantineID: f.respHeader.Get("X-Stronghold-Quarantine-ID"),
+	}
+	if f.result != nil {
+		v.Decision = string(f.result.Decision)
+		v.Reason = f.result.Reason
+		v.Scores = f.result.Scores
+	}
+	if f.action != "" {
+		v.Action = f.action
+	}
+	if f.err != nil {
+		v.Error = f.err.Error()
+	}
+	return v
+}
+
+// captureWriter records what a handler writes to the client
+type captureWriter struct {
+	http.ResponseWriter
+	flow *captureFlow
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if !w.flow.headerWritten {
+		w.flow.headerWritten = true
+		w.flow.responseStarted()
+		w.flow.status = status
+		w.flow.respHeader = w.ResponseWriter.Header().Clone()
+		w.flow.respProto = "HTTP/1.1"
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if !w.flow.headerWritten {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.flow.respBody.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// cappedBuffer keeps the first max bytes written and counts the rest
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	max   int
+	total int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.total += len(p)
+	if room := b.max - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// content returns the captured bytes as HAR text, base64 encoding binary
+// data, and a comment if the body was truncated
+func (b *cappedBuffer) content() (text, encoding, comment string) {
+	data := b.buf.Bytes()
+	if b.total > len(data) {
+		comment = "truncated to " + strconv.Itoa(len(data)) + " of " + strconv.Itoa(b.total) + " bytes"
+	}
+	if utf8.Valid(data) {
+		return string(data), "", comment
+	}
+	return base64.StdEncoding.EncodeToString(data), "base64", comment
+}
+
+// harHeaders converts headers to HAR form, redacting credentials
+func harHeaders(h http.Header) []HARNameValue {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := []HARNameValue{}
+	for _, name := range names {
+		for _, value := range h[name] {
+			if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+				value = redactedValue
+			}
+			headers = append(headers, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+func harQueryString(req *http.Request) []HARNameValue {
+	params := []HARNameValue{}
+	if req.URL == nil {
+		return params
+	}
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range query[key] {
+			params = append(params, HARNameValue{Name: key, Value: value})
+		}
+	}
+	return params
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,671 @@
+package proxy
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxExtractedText caps the text sent to the scanner for a single document.
+// The API rejects payloads over 500KB, so anything beyond that is dropped.
+const maxExtractedText = 500 * 1024
+
+// maxDecompressedDocument caps how many bytes we are willing to inflate from
+// a single document (zip members or PDF streams) to guard against zip bombs.
+const maxDecompressedDocument = 32 * 1024 * 1024
+
+// DocumentConfig controls text extraction for office documents and PDFs
+type DocumentConfig struct {
+	Enabled bool  `yaml:"enabled"`  // Extract and scan PDF/DOCX/XLSX/PPTX/ODT/RTF
+	MaxSize int64 `yaml:"max_size"` // Largest document body (bytes) we buffer for extraction
+}
+
+// applyDefaultDocumentConfig sets default values for DocumentConfig if not already set
+func applyDefaultDocumentConfig(cfg *DocumentConfig) {
+	// If MaxSize is zero, this is an old config without the documents section
+	if cfg.MaxSize == 0 {
+		cfg.Enabled = true
+		cfg.MaxSize = 10 * 1024 * 1024
+	}
+}
+
+// documentKind identifies a supported document format
+type documentKind string
+
+const (
+	docPDF  documentKind = "pdf"
+	docDOCX documentKind = "docx"
+	docXLSX documentKind = "xlsx"
+	docPPTX documentKind = "pptx"
+	docODT  documentKind = "odt"
+	docRTF  documentKind = "rtf"
+)
+
+// documentTypes maps MIME types to the document format used for extraction
+var documentTypes = map[string]documentKind{
+	"application/pdf":   docPDF,
+	"application/x-pdf": docPDF,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   docDOCX,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         docXLSX,
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": docPPTX,
+	"application/vnd.oasis.opendocument.text":                                   docODT,
+	"application/rtf":   docRTF,
+	"application/x-rtf": docRTF,
+	"text/rtf":          docRTF,
+}
+
+// documentKindFor returns the document format for a content type, if supported
+func documentKindFor(contentType string) (documentKind, bool) {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	kind, ok := documentTypes[mediaType]
+	return kind, ok
+}
+
+// IsDocumentContentType determines if a content type is a document we can extract text from
+func IsDocumentContentType(contentType string) bool {
+	_, ok := documentKindFor(contentType)
+	return ok
+}
+
+// ExtractDocumentText extracts human-readable text from a PDF, DOCX, XLSX,
+// PPTX, ODT or RTF body. The result is capped at maxExtractedText bytes.
+func ExtractDocumentText(contentType string, body []byte) ([]byte, error) {
+	kind, ok := documentKindFor(contentType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported document type: %s", contentType)
+	}
+
+	var text string
+	var err error
+	switch kind {
+	case docPDF:
+		text, err = extractPDFText(body)
+	case docDOCX:
+		text, err = extractZipXMLText(body, isDOCXTextPart)
+	case docXLSX:
+		text, err = extractZipXMLText(body, isXLSXTextPart)
+	case docPPTX:
+		text, err = extractZipXMLText(body, isPPTXTextPart)
+	case docODT:
+		text, err = extractZipXMLText(body, isODTTextPart)
+	case docRTF:
+		text, err = extractRTFText(body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %s text: %w", kind, err)
+	}
+
+	return truncateText([]byte(strings.TrimSpace(text)), maxExtractedText), nil
+}
+
+// truncateText cuts b to at most limit bytes without splitting a UTF-8 sequence
+func truncateText(b []byte, limit int) []byte {
+	if len(b) <= limit {
+		return b
+	}
+	b = b[:limit]
+	for len(b) > 0 && !utf8.Valid(b) {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// Office Open XML and OpenDocument formats are zip containers of XML parts.
+
+func isDOCXTextPart(name string) bool {
+	switch {
+	case name == "word/document.xml", name == "word/comments.xml",
+		name == "word/footnotes.xml", name == "word/endnotes.xml",
+		name == "docProps/core.xml":
+		return true
+	case strings.HasPrefix(name, "word/header"), strings.HasPrefix(name, "word/footer"):
+		return strings.HasSuffix(name, ".xml")
+	}
+	return false
+}
+
+func isXLSXTextPart(name string) bool {
+	switch {
+	case name == "xl/sharedStrings.xml", name == "docProps/core.xml":
+		return true
+	case strings.HasPrefix(name, "xl/worksheets/sheet"), strings.HasPrefix(name, "xl/comments"):
+		return strings.HasSuffix(name, ".xml")
+	}
+	return false
+}
+
+func isPPTXTextPart(name string) bool {
+	switch {
+	case name == "docProps/core.xml":
+		return true
+	case strings.HasPrefix(name, "ppt/slides/slide"), strings.HasPrefix(name, "ppt/notesSlides/notesSlide"),
+		strings.HasPrefix(name, "ppt/comments/"):
+		return strings.HasSuffix(name, ".xml")
+	}
+	return false
+}
+
+func isODTTextPart(name string) bool {
+	return name == "content.xml" || name == "meta.xml" || name == "styles.xml"
+}
+
+// extractZipXMLText reads the XML parts selected by wantPart from a zip
+// container and concatenates their character data in a stable order.
+func extractZipXMLText(body []byte, wantPart func(string) bool) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return "", fmt.Errorf("invalid zip container: %w", err)
+	}
+
+	var parts []*zip.File
+	for _, f := range zr.File {
+		if wantPart(f.Name) {
+			parts = append(parts, f)
+		}
+	}
+	if len(parts) == 0 {
+		return "", errors.New("no text parts found")
+	}
+	sort.Slice(parts, func(i, j int) bool { return naturalLess(parts[i].Name, parts[j].Name) })
+
+	var out strings.Builder
+	budget := int64(maxDecompressedDocument)
+	for _, f := range parts {
+		if budget <= 0 {
+			break
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("failed to open %s: %w", f.Name, err)
+		}
+		lr := &io.LimitedReader{R: rc, N: budget}
+		err = xmlCharData(lr, &out)
+		rc.Close()
+		budget = lr.N
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", f.Name, err)
+		}
+		out.WriteString("\n")
+	}
+
+	return out.String(), nil
+}
+
+// xmlBreakElements are element local names after which a newline is emitted
+// so paragraphs, rows and cells do not run together.
+var xmlBreakElements = map[string]bool{
+	"p": true, "h": true, "br": true, "tab": true, "tr": true, "row": true,
+	"si": true, "c": true, "title": true, "subject": true, "description": true,
+	"keywords": true, "creator": true, "text": true,
+}
+
+// xmlCharData writes all character data in an XML stream to out
+func xmlCharData(r io.Reader, out *strings.Builder) error {
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			out.Write(t)
+		case xml.EndElement:
+			if xmlBreakElements[t.Name.Local] {
+				out.WriteString("\n")
+			}
+		}
+	}
+}
+
+// naturalLess orders names so that slide2.xml sorts before slide10.xml
+func naturalLess(a, b string) bool {
+	da, na := splitTrailingNumber(a)
+	db, nb := splitTrailingNumber(b)
+	if da == db && na >= 0 && nb >= 0 {
+		return na < nb
+	}
+	return a < b
+}
+
+func splitTrailingNumber(name string) (string, int) {
+	base := strings.TrimSuffix(name, path.Ext(name))
+	i := len(base)
+	for i > 0 && base[i-1] >= '0' && base[i-1] <= '9' {
+		i--
+	}
+	if i == len(base) {
+		return base, -1
+	}
+	n, err := strconv.Atoi(base[i:])
+	if err != nil {
+		return base, -1
+	}
+	return base[:i], n
+}
+
+// PDF extraction. This is a best-effort reader for text-based PDFs: it walks
+// every stream, inflates FlateDecode data and pulls strings out of the text
+// showing operators (Tj, TJ, ' and "). Document info strings such as /Title
+// and annotation /Contents are included because they are common injection
+// carriers that viewers do not render prominently.
+
+var (
+	pdfStreamRe   = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+	pdfInfoKeysRe = regexp.MustCompile(`/(Title|Subject|Keywords|Author|Contents|TU)\s*\(`)
+)
+
+// extractPDFText extracts text from a PDF body
+func extractPDFText(body []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(body, "\x00\t\r\n "), []byte("%PDF")) {
+		return "", errors.New("missing %PDF header")
+	}
+
+	var out strings.Builder
+	budget := maxDecompressedDocument
+
+	for _, loc := range pdfStreamRe.FindAllSubmatchIndex(body, -1) {
+		dict := body[loc[2]:loc[3]]
+		start := loc[1]
+		end := bytes.Index(body[start:], []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+		raw := bytes.TrimRight(body[start:start+end], "\r\n")
+
+		// Skip images, fonts and other streams that never carry page text
+		if bytes.Contains(dict, []byte("/Image")) || bytes.Contains(dict, []byte("/FontFile")) ||
+			bytes.Contains(dict, []byte("/Length1")) || bytes.Contains(dict, []byte("/XRef")) {
+			continue
+		}
+
+		data := raw
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			zr, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				continue
+			}
+			data, err = io.ReadAll(io.LimitReader(zr, int64(budget)))
+			zr.Close()
+			if err != nil && len(data) == 0 {
+				continue
+			}
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			// Other filters (DCT, LZW, ASCII85...) are not supported
+			continue
+		}
+		budget -= len(data)
+
+		if bytes.Contains(dict, []byte("/ObjStm")) {
+			pdfInfoStrings(data, &out)
+		} else {
+			pdfContentText(data, &out)
+		}
+		if budget <= 0 || out.Len() > maxExtractedText {
+			break
+		}
+	}
+
+	pdfInfoStrings(body, &out)
+
+	return out.String(), nil
+}
+
+// pdfInfoStrings extracts literal strings stored under metadata and
+// annotation keys in uncompressed object data
+func pdfInfoStrings(data []byte, out *strings.Builder) {
+	for _, loc := range pdfInfoKeysRe.FindAllIndex(data, -1) {
+		s, _ := pdfLiteralString(data, loc[1]-1)
+		if s != "" {
+			out.WriteString(s)
+			out.WriteString("\n")
+		}
+	}
+}
+
+// pdfContentText extracts shown text from a page content stream
+func pdfContentText(data []byte, out *strings.Builder) {
+	var pending []string
+	flush := func(sep string) {
+		for _, s := range pending {
+			out.WriteString(s)
+		}
+		if len(pending) > 0 {
+			out.WriteString(sep)
+		}
+		pending = pending[:0]
+	}
+
+	inArray := false
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '(':
+			s, next := pdfLiteralString(data, i)
+			pending = append(pending, s)
+			i = next
+		case c == '<' && i+1 < len(data) && data[i+1] != '<':
+			s, next := pdfHexString(data, i)
+			pending = append(pending, s)
+			i = next
+		case c == '[':
+			inArray = true
+			i++
+		case c == ']':
+			inArray = false
+			i++
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '/':
+			// Names are operands of non-text operators; skip them whole
+			i++
+			for i < len(data) && !isPDFDelimiterOrSpace(data[i]) && data[i] != '(' && data[i] != '<' {
+				i++
+			}
+		case isPDFDelimiterOrSpace(c):
+			i++
+		default:
+			j := i
+			for j < len(data) && !isPDFDelimiterOrSpace(data[j]) && data[j] != '(' && data[j] != '<' {
+				j++
+			}
+			if j == i {
+				j++
+			}
+			tok := string(data[i:j])
+			switch tok {
+			case "Tj", "TJ":
+				flush("")
+			case "'", "\"":
+				flush("\n")
+			case "T*", "ET":
+				flush("")
+				out.WriteString("\n")
+			case "Td", "TD":
+				out.WriteString(" ")
+			default:
+				if inArray {
+					// Large negative kerning inside TJ arrays is a word gap
+					if n, err := strconv.ParseFloat(tok, 64); err == nil && n < -200 {
+						pending = append(pending, " ")
+					}
+				} else if isPDFOperator(data[i:j]) {
+					// Operands of non-text operators are discarded
+					pending = pending[:0]
+				}
+			}
+			i = j
+		}
+	}
+	flush("")
+}
+
+func isPDFDelimiterOrSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '[', ']', '{', '}', '/', '>', ')', '%':
+		return true
+	}
+	return false
+}
+
+func isPDFOperator(tok []byte) bool {
+	if len(tok) == 0 {
+		return false
+	}
+	c := tok[0]
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '*'
+}
+
+// pdfLiteralString parses a (...) string starting at data[start] == '('.
+// It returns the decoded string and the index just past the closing paren.
+func pdfLiteralString(data []byte, start int) (string, int) {
+	var sb strings.Builder
+	depth := 0
+	i := start
+	for i < len(data) {
+		c := data[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				sb.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return decodePDFTextString(sb.String()), i + 1
+			}
+			sb.WriteByte(c)
+		case '\\':
+			i++
+			if i >= len(data) {
+				break
+			}
+			e := data[i]
+			switch e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'b', 'f':
+				// ignored
+			case '\r', '\n':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					k := 0
+					for k < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7' {
+						n = n*8 + int(data[i]-'0')
+						i++
+						k++
+					}
+					i--
+					sb.WriteByte(byte(n))
+				} else {
+					sb.WriteByte(e)
+				}
+			}
+		default:
+			sb.WriteByte(c)
+		}
+		i++
+	}
+	return decodePDFTextString(sb.String()), i
+}
+
+// pdfHexString parses a <...> hex string starting at data[start] == '<'
+func pdfHexString(data []byte, start int) (string, int) {
+	end := bytes.IndexByte(data[start:], '>')
+	if end < 0 {
+		return "", len(data)
+	}
+	var digits []byte
+	for _, c := range data[start+1 : start+end] {
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	decoded := make([]byte, len(digits)/2)
+	for k := range decoded {
+		v, _ := strconv.ParseUint(string(digits[2*k:2*k+2]), 16, 8)
+		decoded[k] = byte(v)
+	}
+	return decodePDFTextString(string(decoded)), start + end + 1
+}
+
+// decodePDFTextString converts UTF-16BE strings (with BOM) to UTF-8 and
+// drops non-printable bytes from single-byte strings
+func decodePDFTextString(s string) string {
+	if strings.HasPrefix(s, "\xfe\xff") {
+		b := []byte(s[2:])
+		var sb strings.Builder
+		for k := 0; k+1 < len(b); k += 2 {
+			sb.WriteRune(rune(b[k])<<8 | rune(b[k+1]))
+		}
+		return sb.String()
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if r == utf8.RuneError || (r < 0x20 && r != '\n' && r != '\t') {
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// RTF extraction. Control words are stripped, \par and \line become
+// newlines, and \'hh / \uN escapes are decoded. Destinations that never hold
+// document text (font tables, pictures, binary data) are skipped, but hidden
+// text (\v) is kept on purpose since it is a classic place to hide injections.
+
+var rtfSkipDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "listtable": true,
+	"listoverridetable": true, "pict": true, "object": true, "themedata": true,
+	"colorschememapping": true, "datastore": true, "latentstyles": true,
+	"rsidtbl": true, "generator": true, "xmlnstbl": true, "filetbl": true,
+}
+
+// extractRTFText extracts text from an RTF body
+func extractRTFText(body []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(body, "\t\r\n "), []byte("{\\rtf")) {
+		return "", errors.New("missing {\\rtf header")
+	}
+
+	var out strings.Builder
+	type group struct{ skip bool }
+	stack := []group{{}}
+	skipping := func() bool { return stack[len(stack)-1].skip }
+
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch c {
+		case '{':
+			stack = append(stack, group{skip: skipping()})
+		case '}':
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case '\\':
+			if i+1 >= len(body) {
+				continue
+			}
+			next := body[i+1]
+			switch {
+			case next == '\'' && i+3 < len(body):
+				v, err := strconv.ParseUint(string(body[i+2:i+4]), 16, 8)
+				if err == nil && !skipping() {
+					out.WriteRune(rune(v))
+				}
+				i += 3
+			case next == '*':
+				// Ignorable destination marker. The control word that follows
+				// decides: known non-text destinations are skipped, others kept.
+				i++
+			case next == '\\' || next == '{' || next == '}':
+				if !skipping() {
+					out.WriteByte(next)
+				}
+				i++
+			case next == '\n' || next == '\r':
+				if !skipping() {
+					out.WriteString("\n")
+				}
+				i++
+			case isASCIILetter(next):
+				j := i + 1
+				for j < len(body) && isASCIILetter(body[j]) {
+					j++
+				}
+				word := string(body[i+1 : j])
+				k := j
+				if k < len(body) && (body[k] == '-' || (body[k] >= '0' && body[k] <= '9')) {
+					k++
+					for k < len(body) && body[k] >= '0' && body[k] <= '9' {
+						k++
+					}
+				}
+				param := string(body[j:k])
+				if k < len(body) && body[k] == ' ' {
+					k++
+				}
+				i = k - 1
+
+				if rtfSkipDestinations[word] {
+					stack[len(stack)-1].skip = true
+					continue
+				}
+				if word == "bin" {
+					// N raw bytes follow; a negative or oversized N must not
+					// move i backwards or past the end
+					n, _ := strconv.Atoi(param)
+					if n < 0 {
+						n = 0
+					}
+					if n > len(body)-1-i {
+						n = len(body) - 1 - i
+					}
+					i += n
+					continue
+				}
+				if skipping() {
+					continue
+				}
+				switch word {
+				case "par", "line", "row", "sect", "page":
+					out.WriteString("\n")
+				case "tab", "cell":
+					out.WriteString("\t")
+				case "u":
+					n, err := strconv.Atoi(param)
+					if err == nil {
+						if n < 0 {
+							n += 65536
+						}
+						out.WriteRune(rune(n))
+						// Skip the single fallback character that follows \uN
+						if i+1 < len(body) && body[i+1] != '\\' && body[i+1] != '{' && body[i+1] != '}' {
+							i++
+						}
+					}
+				}
+			default:
+				i++
+			}
+		case '\r', '\n':
+			// Raw newlines are not significant in RTF
+		default:
+			if !skipping() {
+				out.WriteByte(c)
+			}
+		}
+	}
+
+	return out.String(), nil
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExtAuthzConfig configures the Envoy external authorization listener. An
+// Envoy ext_authz filter using an http_service sends each request, with its
+// buffered body, here before routing it; Stronghold answers allow or deny
+// instead of carrying the traffic itself.
+type ExtAuthzConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Bind       string `yaml:"bind"`
+	Port       int    `yaml:"port"`
+	PathPrefix string `yaml:"path_prefix"` // The http_service path_prefix; removed from check request paths
+}
+
+// applyDefaultExtAuthzConfig sets default values for ExtAuthzConfig if not already set
+func applyDefaultExtAuthzConfig(cfg *ExtAuthzConfig) {
+	// If Port is zero, this is an old config without the ext_authz section
+	if cfg.Port == 0 {
+		cfg.Port = 9191
+	}
+	if cfg.Bind == "" {
+		cfg.Bind = "127.0.0.1"
+	}
+}
+
+// Addr returns the address the ext_authz listener binds to
+func (c ExtAuthzConfig) Addr() string {
+	return net.JoinHostPort(c.Bind, strconv.Itoa(c.Port))
+}
+
+const extAuthzReadTimeout = 2 * time.Minute // Envoy keeps check connections open between requests
+
+// startExtAuthz listens for Envoy check requests and serves them until the
+// server is shut down
+func (s *Server) startExtAuthz(ctx context.Context) error {
+	addr := s.config.ExtAuthz.Addr()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for ext_authz on %s: %w", addr, err)
+	}
+	s.extAuthzServer = &http.Server{
+		Handler:     http.HandlerFunc(s.handleExtAuthz),
+		IdleTimeout: extAuthzReadTimeout,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	s.logger.Info("ext_authz listening", "addr", addr, "path_prefix", s.config.ExtAuthz.PathPrefix)
+
+	go func() {
+		if err := s.extAuthzServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("ext_authz server error", "error", err)
+		}
+	}()
+	return nil
+}
+
+// handleExtAuthz answers one Envoy check request. The check request carries
+// the original method, path and allowed headers, and the body when Envoy is
+// configured with with_request_body. A 200 allows the request, adding the
+// X-Stronghold headers upstream; anything else is sent back to the client.
+func (s *Server) handleExtAuthz(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	s.mu.Lock()
+	s.requestCount++
+	s.mu.Unlock()
+
+	targetURL, err := extAuthzTargetURL(r, s.config.ExtAuthz.PathPrefix)
+	if err != nil {
+		s.logger.Warn("rejecting ext_authz check", "path", r.URL.Path, "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("X-Envoy-Auth-Partial-Body") == "true" {
+		s.logger.Debug("ext_authz check carries a truncated body", "url", targetURL)
+	}
+
+	x := s.pipeline.begin(r, targetURL, "ext_authz", start, nil)
+	reply, err := s.pipeline.handleRequest(x)
+	if err != nil {
+		s.logger.Error("error inspecting request", "error", err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	if reply != nil {
+		s.writeResponse(w, reply, x.requestID)
+		return
+	}
+
+	// Envoy forwards the original body whatever the check answers, so
+	// content that would be sanitized, such as redacted personal data, is
+	// denied instead
+	if x.action == "sanitize" {
+		s.logger.Warn("denying request that ext_authz cannot sanitize", "url", targetURL)
+		x.action = "block"
+		x.reply = s.pipeline.blockResponse(x)
+		annotateStage(s.pipeline, x)
+		recordStage(s.pipeline, x)
+		s.writeResponse(w, x.reply, x.requestID)
+		return
+	}
+
+	// The check is answered rather than forwarded, so an allowed request is
+	// annotated and counted as the reply
+	x.reply = &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: http.NoBody}
+	annotateStage(s.pipeline, x)
+	recordStage(s.pipeline, x)
+	copyResponseHeaders(w.Header(), x.reply.Header)
+	w.WriteHeader(http.StatusOK)
+}
+
+// extAuthzTargetURL rebuilds the URL of the request being checked from the
+// Host header and path Envoy forwards. The scheme comes from
+// X-Forwarded-Proto when Envoy is allowed to send it.
+func extAuthzTargetURL(r *http.Request, prefix string) (string, error) {
+	if r.Host == "" {
+		return "", errors.New("check request has no host")
+	}
+	path := r.URL.RequestURI()
+	if prefix != "" {
+		rest, ok := strings.CutPrefix(path, strings.TrimSuffix(prefix, "/"))
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/") && !strings.HasPrefix(rest, "?")) {
+			return "", fmt.Errorf("check request path does not start with %s", prefix)
+		}
+		if !strings.HasPrefix(rest, "/") {
+			rest = "/" + rest
+		}
+		path = rest
+	}
+
+	scheme := "http"
+	if proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + path, nil
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newExtAuthzTestServer returns the ext_authz handler of a proxy server
+// and the stub scanner that answers its scans with result
+func newExtAuthzTestServer(t *testing.T, result ScanResult, configure func(*Config)) (*httptest.Server, *stubScanner) {
+	t.Helper()
+	scanner := newStubScanner(t, func(ScanRequest) ScanResult { return result })
+
+	config := newTestConfig(scanner.URL)
+	config.ExtAuthz = ExtAuthzConfig{Enabled: true, Bind: "127.0.0.1", Port: 9191, PathPrefix: "/check"}
+	if configure != nil {
+		configure(config)
+	}
+	s := newTestServer(t, config)
+
+	authz := httptest.NewServer(http.HandlerFunc(s.handleExtAuthz))
+	t.Cleanup(authz.Close)
+	return authz, scanner
+}
+
+// envoyCheck sends a check request the way Envoy's http_service does: the
+// original method and host, the path under the configured prefix, and the
+// buffered body
+func envoyCheck(t *testing.T, authz *httptest.Server, method, host, path, contentType, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, authz.URL+"/check"+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = host
+	req.Header.Set("X-Forwarded-Proto", "https")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("check request failed: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestExtAuthz_DeniesBlockedRequest(t *testing.T) {
+	authz, scanner := newExtAuthzTestServer(t, ScanResult{
+		Decision: DecisionBlock,
+		Reason:   "Credential detected",
+	}, nil)
+
+	resp := envoyCheck(t, authz, http.MethodPost, "api.example.com", "/v1/upload?x=1", "text/plain", "key=sk-live-abcdef")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "Credential detected") {
+		t.Errorf("expected the block reason in the body, got %s", body)
+	}
+	if resp.Header.Get("X-Stronghold-Decision") != "BLOCK" || resp.Header.Get("X-Stronghold-Proxy") != "ext_authz" {
+		t.Errorf("expected verdict headers, got %v", resp.Header)
+	}
+	if requests := scanner.Requests(); len(requests) != 1 || requests[0].SourceURL != "https://api.example.com/v1/upload?x=1" {
+		t.Errorf("expected the original URL scanned, got %+v", requests)
+	}
+}
+
+func TestExtAuthz_AllowsWithHeaders(t *testing.T) {
+	authz, scanner := newExtAuthzTestServer(t, ScanResult{
+		Decision: DecisionWarn,
+		Reason:   "Suspicious phrasing",
+	}, nil)
+
+	resp := envoyCheck(t, authz, http.MethodPost, "api.example.com", "/v1/chat", "application/json", `{"prompt":"hello"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for a warned request, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("X-Stronghold-Action") != "warn" || resp.Header.Get("X-Stronghold-Warning") != "Suspicious phrasing" {
+		t.Errorf("expected warning headers for upstream, got %v", resp.Header)
+	}
+
+	// Requests without a body are allowed without a scan
+	resp = envoyCheck(t, authz, http.MethodGet, "api.example.com", "/v1/models", "", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Stronghold-Scan-Type") != "skipped-not-scannable" {
+		t.Errorf("expected an unscanned allow, got %d (%v)", resp.StatusCode, resp.Header)
+	}
+	if got := len(scanner.Requests()); got != 1 {
+		t.Errorf("expected one scan, got %d", got)
+	}
+}
+
+func TestExtAuthz_DeniesRequestThatNeedsRedacting(t *testing.T) {
+	authz, scanner := newExtAuthzTestServer(t, ScanResult{Decision: DecisionAllow}, func(c *Config) {
+		c.Scanning.PII = PIIConfig{Enabled: true}
+	})
+
+	// Envoy would forward the original body, so a redaction becomes a deny
+	resp := envoyCheck(t, authz, http.MethodPost, "api.example.com", "/v1/notes", "application/json", `{"note":"mail jane@example.com"}`)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for a request that needs redacting, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("X-Stronghold-Action") != "block" || resp.Header.Get("X-Stronghold-Sanitized") != "" {
+		t.Errorf("expected block headers, got %v", resp.Header)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "jane@example.com") {
+		t.Errorf("the deny should not repeat the email address: %s", body)
+	}
+	if scanned := scanner.Texts(""); len(scanned) != 1 || strings.Contains(scanned[0], "jane@example.com") {
+		t.Errorf("expected only the redacted body scanned, got %q", scanned)
+	}
+}
+
+func TestExtAuthzTargetURL(t *testing.T) {
+	tests := []struct {
+		prefix, path, proto string
+		want                string
+	}{
+		{"", "/v1/chat", "", "http://api.example.com/v1/chat"},
+		{"/check", "/check/v1/chat?stream=true", "https", "https://api.example.com/v1/chat?stream=true"},
+		{"/check/", "/check", "", "http://api.example.com/"},
+		{"/check", "/checkout", "", ""},
+		{"/check", "/v1/chat", "", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		r.Host = "api.example.com"
+		if tt.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", tt.proto)
+		}
+		got, err := extAuthzTargetURL(r, tt.prefix)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("expected %s under prefix %q to be rejected, got %s", tt.path, tt.prefix, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("extAuthzTargetURL(%s, %q) = %q, %v; want %q", tt.path, tt.prefix, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of a held item
+const (
+	HoldPending  = "pending"
+	HoldApproved = "approved"
+	HoldDenied   = "denied"
+	HoldTimedOut = "timed_out"
+)
+
+const (
+	holdPollInterval = 500 * time.Millisecond // How often a held item is checked for a decision made by the CLI
+	holdPreviewSize  = 1024                   // Body bytes kept for the reviewer
+	holdStaleAfter   = time.Minute            // Items are removed this long after they expire
+	holdItemExt      = ".json"
+	holdLockExt      = ".lock"
+	holdLockWait     = 2 * time.Second  // Longest wait for another process to release an item
+	holdLockStale    = 10 * time.Second // A lock this old was left by a process that died holding it
+)
+
+// HoldConfig controls WARN content held for a human decision when an
+// action_on_warn is "hold"
+type HoldConfig struct {
+	Dir       string        `yaml:"dir"`        // Where held items are kept while they wait
+	Timeout   time.Duration `yaml:"timeout"`    // How long a held item waits for a decision
+	OnTimeout string        `yaml:"on_timeout"` // "allow", "warn" or "block" when no decision arrives
+	APIToken  string        `yaml:"api_token"`  // Bearer token of the admin API; empty disables it
+}
+
+// applyDefaultHoldConfig sets default values for HoldConfig if not already set
+func applyDefaultHoldConfig(cfg *HoldConfig) {
+	// If Timeout is zero, this is an old config without the hold section
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 2 * time.Minute
+	}
+	if cfg.OnTimeout == "" {
+		cfg.OnTimeout = "block"
+	}
+}
+
+// ErrHoldNotFound is returned when no pending item matches an ID
+var ErrHoldNotFound = errors.New("held item not found")
+
+// HoldItem is content waiting for a human decision
+type HoldItem struct {
+	ID          string     `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	URL         string     `json:"url"`
+	Method      string     `json:"method"`
+	Direction   string     `json:"direction"` // "request" or "response"
+	ContentType string     `json:"content_type,omitempty"`
+	Size        int        `json:"size"`
+	Reason      string     `json:"reason"`
+	Threats     []Threat   `json:"threats,omitempty"`
+	Preview     string     `json:"preview"` // Start of the body, for the reviewer
+	RequestID   string     `json:"request_id,omitempty"`
+	Transport   string     `json:"transport"`
+	OnTimeout   string     `json:"on_timeout"` // Action applied if no decision arrives
+	Status      string     `json:"status"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty"`
+	DecidedBy   string     `json:"decided_by,omitempty"` // "cli" or "api"
+}
+
+// HoldStore keeps held items in a directory, one file each, so that the
+// CLI can decide on them while the proxy waits. Items are removed once
+// decided.
+type HoldStore struct {
+	dir       string
+	timeout   time.Duration
+	onTimeout string
+
+	mu      sync.Mutex
+	waiters map[string]chan struct{} // Held items this process waits on
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// OpenHolds opens (creating if needed) the store of held items in cfg.Dir
+func OpenHolds(cfg HoldConfig) (*HoldStore, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("hold directory is not configured")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create hold directory: %w", err)
+	}
+	return &HoldStore{
+		dir:       cfg.Dir,
+		timeout:   cfg.Timeout,
+		onTimeout: cfg.OnTimeout,
+		waiters:   make(map[string]chan struct{}),
+		closed:    make(chan struct{}),
+	}, nil
+}
+
+// List returns the items waiting for a decision, oldest first
+func (h *HoldStore) List() ([]HoldItem, error) {
+	files, err := os.ReadDir(h.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hold directory: %w", err)
+	}
+
+	now := time.Now()
+	var items []HoldItem
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), holdLockExt) {
+			// Left by a process that died holding it
+			if info, err := f.Info(); err == nil && now.Sub(info.ModTime()) > holdLockStale {
+				os.Remove(filepath.Join(h.dir, f.Name()))
+			}
+			continue
+		}
+		if !strings.HasSuffix(f.Name(), holdItemExt) {
+			continue
+		}
+		item, err := h.read(strings.TrimSuffix(f.Name(), holdItemExt))
+		if err != nil {
+			continue
+		}
+		// Items outliving their timeout were left by a proxy that stopped
+		// waiting without removing them
+		if now.After(item.ExpiresAt.Add(holdStaleAfter)) {
+			os.Remove(filepath.Join(h.dir, f.Name()))
+			continue
+		}
+		if item.Status != HoldPending || now.After(item.ExpiresAt) {
+			continue
+		}
+		items = append(items, *item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+	return items, nil
+}
+
+// Get returns a pending item. id may be a unique prefix.
+func (h *HoldStore) Get(id string) (*HoldItem, error) {
+	fullID, err := h.resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	item, err := h.read(fullID)
+	if err != nil {
+		return nil, err
+	}
+	if item.Status != HoldPending {
+		return nil, ErrHoldNotFound
+	}
+	return item, nil
+}
+
+// Decide approves or denies a pending item. id may be a unique prefix.
+// A proxy waiting on the item picks the decision up within a poll
+// interval, or at once when the decision is made in the same process.
+// Items that have expired or stopped waiting are not found.
+func (h *HoldStore) Decide(id string, approve bool, by string) (*HoldItem, error) {
+	fullID, err := h.resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := h.lock(fullID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Checked under the lock, so the waiting proxy cannot give up on the
+	// item in between and leave the decision behind
+	item, err := h.read(fullID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if item.Status != HoldPending || !now.Before(item.ExpiresAt) {
+		return nil, ErrHoldNotFound
+	}
+	item.Status = HoldDenied
+	if approve {
+		item.Status = HoldApproved
+	}
+	item.DecidedAt = &now
+	item.DecidedBy = by
+	if err := h.write(item); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	if wake, ok := h.waiters[item.ID]; ok {
+		delete(h.waiters, item.ID)
+		close(wake)
+	}
+	h.mu.Unlock()
+	return item, nil
+}
+
+// wait records item as pending and waits until it is decided, it times
+// out, or the store is closed. It returns the final status; items that
+// time out or are abandoned on shutdown are timed out.
+func (h *HoldStore) wait(item HoldItem) (string, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate hold id: %w", err)
+	}
+	item.ID = hex.EncodeToString(id)
+	item.CreatedAt = time.Now().UTC()
+	item.ExpiresAt = item.CreatedAt.Add(h.timeout)
+	item.OnTimeout = h.onTimeout
+	item.Status = HoldPending
+	if err := h.write(&item); err != nil {
+		return "", err
+	}
+	defer os.Remove(filepath.Join(h.dir, item.ID+holdItemExt))
+
+	wake := make(chan struct{})
+	h.mu.Lock()
+	h.waiters[item.ID] = wake
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.waiters, item.ID)
+		h.mu.Unlock()
+	}()
+
+	timeout := time.NewTimer(h.timeout)
+	defer timeout.Stop()
+	poll := time.NewTicker(holdPollInterval)
+	defer poll.Stop()
+	for {
+		expired := false
+		select {
+		case <-wake:
+		case <-poll.C:
+		case <-timeout.C:
+			expired = true
+		case <-h.closed:
+			expired = true
+		}
+		// The file is the record of a decision, wherever it was made
+		if current, err := h.read(item.ID); err == nil && current.Status != HoldPending {
+			return current.Status, nil
+		}
+		if expired {
+			return h.expire(item.ID), nil
+		}
+	}
+}
+
+// expire gives up on a held item. A decision made just before is still
+// applied; once the item is removed, later decisions are refused.
+func (h *HoldStore) expire(id string) string {
+	unlock, err := h.lock(id)
+	if err == nil {
+		defer unlock()
+	}
+	status := HoldTimedOut
+	if current, err := h.read(id); err == nil && current.Status != HoldPending {
+		status = current.Status
+	}
+	os.Remove(filepath.Join(h.dir, id+holdItemExt))
+	return status
+}
+
+// lock takes the lock on an item shared with other processes using the
+// directory. The returned func releases it.
+func (h *HoldStore) lock(id string) (func(), error) {
+	path := filepath.Join(h.dir, id+holdLockExt)
+	deadline := time.Now().Add(holdLockWait)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock held item: %w", err)
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > holdLockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("held item %s is locked by another process", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Close releases every item still waiting, as if it had timed out
+func (h *HoldStore) Close() {
+	if h == nil {
+		return
+	}
+	h.once.Do(func() { close(h.closed) })
+}
+
+// resolve expands a unique ID prefix to a full item ID
+func (h *HoldStore) resolve(prefix string) (string, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" || strings.ContainsAny(prefix, `/\.`) {
+		return "", ErrHoldNotFound
+	}
+	files, err := os.ReadDir(h.dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read hold directory: %w", err)
+	}
+
+	var matches []string
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasSuffix(name, holdItemExt) && strings.HasPrefix(name, prefix) {
+			matches = append(matches, strings.TrimSuffix(name, holdItemExt))
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", ErrHoldNotFound
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("hold id %q is ambiguous (%d matches)", prefix, len(matches))
+	}
+}
+
+func (h *HoldStore) read(id string) (*HoldItem, error) {
+	data, err := os.ReadFile(filepath.Join(h.dir, id+holdItemExt))
+	if os.IsNotExist(err) {
+		return nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read held item: %w", err)
+	}
+	var item HoldItem
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("failed to parse held item: %w", err)
+	}
+	return &item, nil
+}
+
+// write replaces an item's file atomically, so a waiting proxy never reads
+// it half written
+func (h *HoldStore) write(item *HoldItem) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode held item: %w", err)
+	}
+	path := filepath.Join(h.dir, item.ID+holdItemExt)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write held item: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write held item: %w", err)
+	}
+	return nil
+}
+
+// holdForDecision parks x until a human approves or denies it and returns
+// the action to apply: allow when approved, block when denied, and
+// hold.on_timeout when no decision arrives in time
+func (p *pipeline) holdForDecision(x *interception) string {
+	onTimeout := p.config.Hold.OnTimeout
+	if p.holds == nil {
+		p.logger.Warn("content cannot be held, applying hold.on_timeout", "url", x.url, "action", onTimeout)
+		return onTimeout
+	}
+
+	item := HoldItem{
+		URL:         x.url,
+		Method:      x.req.Method,
+		Direction:   x.direction(),
+		ContentType: x.contentType,
+		Size:        len(x.body),
+		Reason:      x.result.Reason,
+		Threats:     x.result.ThreatsFound,
+		Preview:     string(truncateText(x.scanBody, holdPreviewSize)),
+		RequestID:   x.requestID,
+		Transport:   x.transport,
+	}
+	p.logger.Warn("content held for approval", "url", x.url, "direction", x.direction(), "reason", x.result.Reason, "timeout", p.config.Hold.Timeout)
+	p.notifier.Notify(Notification{
+		Event:     EventHeld,
+		Summary:   fmt.Sprintf("Held %s %s for approval: %s. Decide with 'stronghold approve' or 'stronghold deny' within %s", x.direction(), spendHost(x.url), x.result.Reason, p.config.Hold.Timeout),
+		Host:      spendHost(x.url),
+		URL:       x.url,
+		Direction: x.direction(),
+		Decision:  string(x.result.Decision),
+		Reason:    x.result.Reason,
+		ScanType:  x.scanType,
+		RequestID: x.requestID,
+		Transport: x.transport,
+	})
+
+	status, err := p.holds.wait(item)
+	if err != nil {
+		p.logger.Error("failed to hold content, applying hold.on_timeout", "url", x.url, "action", onTimeout, "error", err)
+		return onTimeout
+	}
+	x.holdStatus = status
+	switch status {
+	case HoldApproved:
+		p.logger.Info("held content approved", "url", x.url)
+		return "allow"
+	case HoldDenied:
+		p.logger.Info("held content denied", "url", x.url)
+		return "block"
+	default:
+		p.logger.Warn("held content timed out", "url", x.url, "action", onTimeout)
+		return onTimeout
+	}
+}
+
+// holdAPIPrefix is where the admin API for held items is served on the
+// proxy port
+const holdAPIPrefix = "/stronghold/holds"
+
+// handleHoldAPI serves the admin API for held items:
+//
+//	GET  /stronghold/holds              pending items
+//	POST /stronghold/holds/{id}/approve approve an item
+//	POST /stronghold/holds/{id}/deny    deny an item
+//
+// Requests need hold.api_token as a bearer token; without one configured
+// the API is off. Proxied requests for the same path pass through.
+func (s *Server) handleHoldAPI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.IsAbs() {
+		s.handleRequest(w, r)
+		return
+	}
+	token := s.config.Hold.APIToken
+	if token == "" || s.holds == nil {
+		http.NotFound(w, r)
+		return
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="stronghold"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, holdAPIPrefix), "/")
+	if path == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		items, err := s.holds.List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeHoldJSON(w, http.StatusOK, map[string]any{"holds": items})
+		return
+	}
+
+	id, verb, ok := strings.Cut(path, "/")
+	if !ok || (verb != "approve" && verb != "deny") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	item, err := s.holds.Decide(id, verb == "approve", "api")
+	if errors.Is(err, ErrHoldNotFound) {
+		http.Error(w, "No pending item with that id", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeHoldJSON(w, http.StatusOK, item)
+}
+
+func writeHoldJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
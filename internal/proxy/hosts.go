@@ -0,0 +1,401 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What the proxy does on first contact with a host it has never seen
+const (
+	FirstSeenAllow = "allow" // Record the host only
+	FirstSeenFlag  = "flag"  // Log, notify new_host and add X-Stronghold-New-Host
+	FirstSeenHold  = "hold"  // Flag, and block requests until the host is approved
+)
+
+// hostsWebhookTarget names the notification target a hosts.webhook from an
+// older config is moved to
+const hostsWebhookTarget = "hosts-webhook"
+
+// HostsConfig controls the record of destination hosts
+type HostsConfig struct {
+	File        string `yaml:"file"`              // Where destination hosts are recorded
+	OnFirstSeen string `yaml:"on_first_seen"`     // allow, flag or hold
+	Webhook     string `yaml:"webhook,omitempty"` // Deprecated: moved to a notifications target on load
+}
+
+// applyDefaultHostsConfig sets default values for HostsConfig if not already set
+func applyDefaultHostsConfig(cfg *HostsConfig) {
+	// If OnFirstSeen is empty, this is an old config without the hosts section
+	if cfg.OnFirstSeen == "" {
+		cfg.OnFirstSeen = FirstSeenAllow
+	}
+}
+
+// migrateHostsWebhook moves the hosts.webhook of an older config to a
+// notification target subscribed to new_host. Notifications are turned on
+// for it unless other targets are configured and were left off.
+func migrateHostsWebhook(hosts *HostsConfig, notifications *NotificationsConfig) {
+	if hosts.Webhook == "" {
+		return
+	}
+	target := NotifyTarget{
+		Name:   hostsWebhookTarget,
+		URL:    hosts.Webhook,
+		Format: NotifyFormatJSON,
+		Events: []string{EventNewHost},
+	}
+	hosts.Webhook = ""
+	for _, t := range notifications.Targets {
+		if t.Name == target.Name {
+			return
+		}
+	}
+	if len(notifications.Targets) == 0 {
+		notifications.Enabled = true
+	}
+	notifications.Targets = append(notifications.Targets, target)
+}
+
+// ErrHostNotFound is returned when a host has not been recorded
+var ErrHostNotFound = errors.New("host not found")
+
+// HostRecord is what is known about one destination host
+type HostRecord struct {
+	FirstSeen  time.Time  `json:"first_seen"`
+	LastSeen   time.Time  `json:"last_seen"`
+	Requests   int64      `json:"requests"`
+	Blocked    int64      `json:"blocked"`
+	Warned     int64      `json:"warned"`
+	Pending    bool       `json:"pending,omitempty"` // Held for approval
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+}
+
+// HostEntry is a recorded host with its name
+type HostEntry struct {
+	Host string
+	HostRecord
+}
+
+// hostsFile is the content of the hosts file
+type hostsFile struct {
+	Hosts map[string]*HostRecord `json:"hosts"`
+}
+
+// hostsFlushDelay is how long after a host is first seen the hosts file is
+// written, so hosts first seen together are written at once
+const hostsFlushDelay = time.Second
+
+// HostStore records every host the proxy sends traffic to. The proxy
+// counts traffic in memory and writes it periodically, and shortly after a
+// host is first seen; the CLI approves held hosts in the file, and the
+// proxy picks approvals up whenever the file changes.
+type HostStore struct {
+	path string
+
+	mu    sync.Mutex
+	hosts map[string]*HostRecord
+	dirty bool
+	mtime time.Time // Of the file as last read or written
+	size  int64
+	now   func() time.Time
+
+	seen chan struct{} // Signals flushEvery that a host was first seen
+}
+
+// OpenHosts loads the hosts file at cfg.File, starting an empty record if
+// the file does not exist yet
+func OpenHosts(cfg HostsConfig) (*HostStore, error) {
+	if cfg.File == "" {
+		return nil, errors.New("hosts file is not configured")
+	}
+	s := &HostStore{
+		path:  cfg.File,
+		hosts: make(map[string]*HostRecord),
+		now:   time.Now,
+		seen:  make(chan struct{}, 1),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.mergeLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// see records contact with host. It reports whether this is the first
+// contact, and whether the host is held: with hold on, a host stays held
+// from its first contact until it is approved.
+func (s *HostStore) see(host string, hold bool) (first, held bool) {
+	if s == nil || host == "" {
+		return false, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now().UTC()
+	r, ok := s.hosts[host]
+	if !ok {
+		r = &HostRecord{FirstSeen: now, Pending: hold}
+		s.hosts[host] = r
+		first = true
+		select {
+		case s.seen <- struct{}{}:
+		default: // A write is already due
+		}
+	} else if r.Pending && hold {
+		// The host may have been approved since the file was last read
+		s.mergeLocked()
+	}
+	r.LastSeen = now
+	s.dirty = true
+	return first, hold && r.Pending
+}
+
+// record counts one request to host and its outcome
+func (s *HostStore) record(host string, decision Decision) {
+	if s == nil || host == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.hosts[host]
+	if !ok {
+		now := s.now().UTC()
+		r = &HostRecord{FirstSeen: now, LastSeen: now}
+		s.hosts[host] = r
+	}
+	r.Requests++
+	switch decision {
+	case DecisionBlock:
+		r.Blocked++
+	case DecisionWarn:
+		r.Warned++
+	}
+	s.dirty = true
+}
+
+// List returns every recorded host, most recently first seen first
+func (s *HostStore) List() ([]HostEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.mergeLocked(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]HostEntry, 0, len(s.hosts))
+	for host, r := range s.hosts {
+		entries = append(entries, HostEntry{Host: host, HostRecord: *r})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].FirstSeen.Equal(entries[j].FirstSeen) {
+			return entries[i].FirstSeen.After(entries[j].FirstSeen)
+		}
+		return entries[i].Host < entries[j].Host
+	})
+	return entries, nil
+}
+
+// Approve lets requests to host through. A host that was never seen is
+// recorded as approved, so it is not held on first contact.
+func (s *HostStore) Approve(host string) (*HostEntry, error) {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" {
+		return nil, ErrHostNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.mergeLocked(); err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	r, ok := s.hosts[host]
+	if !ok {
+		r = &HostRecord{FirstSeen: now, LastSeen: now}
+		s.hosts[host] = r
+	}
+	if r.ApprovedAt == nil {
+		r.ApprovedAt = &now
+	}
+	r.Pending = false
+	s.dirty = true
+	if err := s.saveLocked(); err != nil {
+		return nil, err
+	}
+	return &HostEntry{Host: host, HostRecord: *r}, nil
+}
+
+// Flush writes the hosts file if anything changed since the last write,
+// keeping approvals made in the file meanwhile
+func (s *HostStore) Flush() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.mergeLocked(); err != nil {
+		return err
+	}
+	if !s.dirty {
+		return nil
+	}
+	return s.saveLocked()
+}
+
+// flushEvery writes the hosts file every interval, and hostsFlushDelay
+// after a host is first seen, until ctx is done. Writes stay off the
+// request path.
+func (s *HostStore) flushEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.seen:
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(hostsFlushDelay):
+			}
+		}
+		if err := s.Flush(); err != nil {
+			onError(err)
+		}
+	}
+}
+
+// mergeLocked rereads the file if it changed since it was last read or
+// written. Approvals and hosts only in the file are taken from it; traffic
+// counted in memory is kept. Callers must hold s.mu.
+func (s *HostStore) mergeLocked() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat hosts: %w", err)
+	}
+	if info.ModTime().Equal(s.mtime) && info.Size() == s.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read hosts: %w", err)
+	}
+	var file hostsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse hosts: %w", err)
+	}
+	for host, stored := range file.Hosts {
+		r, ok := s.hosts[host]
+		if !ok {
+			s.hosts[host] = stored
+			continue
+		}
+		if stored.ApprovedAt != nil && r.ApprovedAt == nil {
+			r.ApprovedAt = stored.ApprovedAt
+			r.Pending = false
+			s.dirty = true
+		}
+	}
+	s.mtime, s.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// saveLocked replaces the hosts file, so readers never see a partial one.
+// Callers must hold s.mu.
+func (s *HostStore) saveLocked() error {
+	data, err := json.MarshalIndent(hostsFile{Hosts: s.hosts}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode hosts: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create hosts directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write hosts: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write hosts: %w", err)
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.mtime, s.size = info.ModTime(), info.Size()
+	}
+	s.dirty = false
+	return nil
+}
+
+// hostStage records the destination host of each interception. With
+// on_first_seen set to flag or hold, first contact with a host is logged,
+// notified as new_host and marked with X-Stronghold-New-Host; with hold,
+// requests to the host are blocked until it is approved. A response whose
+// request was not inspected, as with ICAP RESPMOD, is recorded and flagged
+// but never held.
+func hostStage(p *pipeline, x *interception) error {
+	if p.hosts == nil || x.hostSeen {
+		return nil
+	}
+	x.hostSeen = true
+
+	host := spendHost(x.url)
+	mode := p.config.Hosts.OnFirstSeen
+	first, held := p.hosts.see(host, mode == FirstSeenHold && x.resp == nil)
+	if mode == FirstSeenAllow {
+		return nil
+	}
+
+	if first {
+		x.newHost = true
+		p.logger.Warn("first contact with new host", "host", host, "url", x.url, "action", mode, "request_id", x.requestID)
+		p.notifier.Notify(Notification{
+			Event:     EventNewHost,
+			Summary:   fmt.Sprintf("First contact with %s (on_first_seen is %s)", host, mode),
+			Host:      host,
+			URL:       x.url,
+			Direction: x.direction(),
+			RequestID: x.requestID,
+			Transport: x.transport,
+		})
+	}
+
+	// A request blocked already keeps its verdict
+	if held && (x.result == nil || x.result.Decision != DecisionBlock) {
+		x.result = heldHostResult(host, x.url)
+		x.scanType = "new-host"
+	}
+	return nil
+}
+
+// heldHostResult is the verdict on a request to a host held for approval
+func heldHostResult(host, sourceURL string) *ScanResult {
+	return &ScanResult{
+		Decision:          DecisionBlock,
+		Reason:            fmt.Sprintf("First contact with %s is held for approval", host),
+		RecommendedAction: fmt.Sprintf("Ask an operator to approve the host with 'stronghold hosts approve %s', then retry.", host),
+		ThreatsFound: []Threat{{
+			Category:    "new_host",
+			Pattern:     host,
+			Location:    "url",
+			Severity:    "medium",
+			Description: "Destination host has not been approved",
+		}},
+		Metadata: map[string]interface{}{
+			"source_url": sourceURL,
+			"detection":  "new_host",
+		},
+	}
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newHostsTestServer returns a proxy server recording hosts with mode, and
+// an upstream counting the requests that reach it. configure, if not nil,
+// adjusts the config first.
+func newHostsTestServer(t *testing.T, mode string, configure func(*Config)) (*Server, string, *int) {
+	t.Helper()
+	forwarded := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded++
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	config := newTestConfig("http://127.0.0.1:1")
+	config.Hosts = HostsConfig{
+		File:        filepath.Join(t.TempDir(), "hosts.json"),
+		OnFirstSeen: mode,
+	}
+	if configure != nil {
+		configure(config)
+	}
+	return newTestServer(t, config), upstream.URL, &forwarded
+}
+
+func getThrough(s *Server, target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHosts_FlagsFirstContactOnly(t *testing.T) {
+	hook, received := newNotifyReceiver(t)
+	s, upstream, _ := newHostsTestServer(t, FirstSeenFlag, func(c *Config) {
+		c.Notifications = NotificationsConfig{
+			Enabled:     true,
+			BatchWindow: 50 * time.Millisecond,
+			Targets:     []NotifyTarget{{Name: "hook", URL: hook, Format: NotifyFormatJSON}},
+		}
+	})
+	s.notifier.Start()
+	defer s.notifier.Close(context.Background())
+
+	first := getThrough(s, upstream+"/a")
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", first.Code)
+	}
+	if got := first.Header().Get("X-Stronghold-New-Host"); got != "true" {
+		t.Errorf("expected the first response to be flagged, got %q", got)
+	}
+	second := getThrough(s, upstream+"/b")
+	if got := second.Header().Get("X-Stronghold-New-Host"); got != "" {
+		t.Errorf("expected later responses not to be flagged, got %q", got)
+	}
+
+	// First contact is delivered once
+	var payload struct {
+		Notifications []Notification `json:"notifications"`
+	}
+	if err := json.Unmarshal(waitForNotification(t, received).Body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(upstream)
+	if len(payload.Notifications) != 1 || payload.Notifications[0].Event != EventNewHost || payload.Notifications[0].Host != u.Hostname() {
+		t.Errorf("expected one new_host notification, got %+v", payload.Notifications)
+	}
+	select {
+	case r := <-received:
+		t.Errorf("expected a single delivery, got another: %s", r.Body)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	hosts, err := s.hosts.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].Requests != 2 {
+		t.Errorf("expected one host with 2 requests, got %+v", hosts)
+	}
+}
+
+func TestHosts_HoldsUntilApproved(t *testing.T) {
+	s, upstream, forwarded := newHostsTestServer(t, FirstSeenHold, nil)
+
+	for i := 0; i < 2; i++ {
+		rec := getThrough(s, upstream+"/data")
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("request %d: expected 403, got %d", i, rec.Code)
+		}
+		if got := rec.Header().Get("X-Stronghold-Scan-Type"); got != "new-host" {
+			t.Errorf("expected scan type new-host, got %q", got)
+		}
+	}
+	if *forwarded != 0 {
+		t.Fatalf("held requests reached upstream %d times", *forwarded)
+	}
+
+	// Approve from another store, as the CLI does
+	cli, err := OpenHosts(s.config.Hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(upstream)
+	if _, err := cli.Approve(u.Hostname()); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := getThrough(s, upstream+"/data")
+	if rec.Code != http.StatusOK {
+		body, _ := io.ReadAll(rec.Body)
+		t.Fatalf("expected 200 after approval, got %d: %s", rec.Code, body)
+	}
+	if *forwarded != 1 {
+		t.Errorf("expected the approved request upstream, got %d", *forwarded)
+	}
+
+	// Counts kept by the proxy survive the approval written by the CLI
+	if err := s.hosts.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenHosts(s.config.Hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].Pending || hosts[0].ApprovedAt == nil || hosts[0].Requests != 3 || hosts[0].Blocked != 2 {
+		t.Errorf("unexpected host record %+v", hosts)
+	}
+}
+
+func TestHosts_WritesFirstContactInBackground(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.json")
+	store, err := OpenHosts(HostsConfig{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.flushEvery(ctx, time.Hour, func(err error) { t.Error(err) })
+
+	store.see("a.example", false)
+	store.see("b.example", false)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no write on the request path, got %v", err)
+	}
+
+	deadline := time.Now().Add(5 * hostsFlushDelay)
+	for time.Now().Before(deadline) {
+		if reopened, err := OpenHosts(HostsConfig{File: path}); err == nil {
+			if hosts, _ := reopened.List(); len(hosts) == 2 {
+				return
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("expected both new hosts to be written shortly after first contact")
+}
+
+func TestMigrateHostsWebhook(t *testing.T) {
+	hosts := HostsConfig{OnFirstSeen: FirstSeenFlag, Webhook: "https://hooks.example.com/hosts"}
+	var notifications NotificationsConfig
+	migrateHostsWebhook(&hosts, &notifications)
+
+	if hosts.Webhook != "" {
+		t.Errorf("expected hosts.webhook cleared, got %q", hosts.Webhook)
+	}
+	if !notifications.Enabled || len(notifications.Targets) != 1 {
+		t.Fatalf("expected notifications on with one target, got %+v", notifications)
+	}
+	target := notifications.Targets[0]
+	if target.Name != hostsWebhookTarget || target.URL != "https://hooks.example.com/hosts" || target.Format != NotifyFormatJSON ||
+		len(target.Events) != 1 || target.Events[0] != EventNewHost {
+		t.Errorf("unexpected migrated target %+v", target)
+	}
+	if err := target.Validate(); err != nil {
+		t.Errorf("migrated target is invalid: %v", err)
+	}
+
+	// Targets configured and left off stay off; a second load adds nothing
+	hosts.Webhook = "https://hooks.example.com/hosts"
+	notifications = NotificationsConfig{Targets: []NotifyTarget{{Name: "chat", URL: "https://chat.example.com", Format: NotifyFormatSlack}}}
+	migrateHostsWebhook(&hosts, &notifications)
+	hosts.Webhook = "https://hooks.example.com/hosts"
+	migrateHostsWebhook(&hosts, &notifications)
+	if notifications.Enabled || len(notifications.Targets) != 2 {
+		t.Errorf("expected the target added once with notifications left off, got %+v", notifications)
+	}
+}
@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"bytes"
+	"strings"
+
+	"stronghold/internal/htmltext"
+)
+
+// isHTMLContentType determines if a content type is an HTML page
+func isHTMLContentType(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	return strings.Contains(ct, "text/html") || strings.Contains(ct, "xhtml")
+}
+
+// prepareHTML reduces an HTML page to the markup the scanner needs. Scripts,
+// styles and embedded media are dropped while comments, hidden elements and
+// text-bearing attributes are kept so the API can score them separately.
+// The original body is returned if the page cannot be parsed.
+func prepareHTML(body []byte) []byte {
+	stripped, err := htmltext.Strip(bytes.NewReader(body))
+	if err != nil {
+		return body
+	}
+	return stripped
+}
@@ -0,0 +1,718 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ICAPConfig configures the ICAP (RFC 3507) listener. Proxies that already
+// terminate TLS, such as Squid, send requests and responses to it for
+// scanning instead of routing traffic through Stronghold.
+type ICAPConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Bind     string `yaml:"bind"`
+	Port     int    `yaml:"port"`
+	Preview  int    `yaml:"preview"`  // Body bytes requested up front; 204 is answered without the rest when the content is not scanned
+	Sanitize bool   `yaml:"sanitize"` // Replace warned text responses with the scanner's sanitized text
+}
+
+// applyDefaultICAPConfig sets default values for ICAPConfig if not already set
+func applyDefaultICAPConfig(cfg *ICAPConfig) {
+	// If Port is zero, this is an old config without the icap section
+	if cfg.Port == 0 {
+		cfg.Port = 1344
+		cfg.Preview = 4096
+	}
+	if cfg.Bind == "" {
+		cfg.Bind = "127.0.0.1"
+	}
+}
+
+// Addr returns the address the ICAP listener binds to
+func (c ICAPConfig) Addr() string {
+	return net.JoinHostPort(c.Bind, strconv.Itoa(c.Port))
+}
+
+// ICAP services, named by the path of the service URI
+const (
+	icapServiceReqmod  = "/reqmod"
+	icapServiceRespmod = "/respmod"
+)
+
+const (
+	icapRequestTimeout = 2 * time.Minute // Idle wait plus one request on a connection
+	maxICAPHeaderSize  = 64 * 1024       // Each encapsulated HTTP header section
+	icapOptionsTTL     = 3600            // Seconds clients may cache OPTIONS
+)
+
+// errICAPMalformed marks requests answered with 400 Bad Request
+var errICAPMalformed = errors.New("malformed ICAP request")
+
+// icapRequest is one ICAP request up to the start of its encapsulated body
+type icapRequest struct {
+	method  string
+	service string
+	header  textproto.MIMEHeader
+	reqHdr  []byte // Encapsulated HTTP request header, as received
+	resHdr  []byte // Encapsulated HTTP response header, as received
+	hasBody bool
+	preview int // Preview size announced by the client; -1 without a preview
+}
+
+// allow204 reports whether the client accepts 204 No Content outside a preview
+func (r *icapRequest) allow204() bool {
+	for _, v := range strings.Split(r.header.Get("Allow"), ",") {
+		if strings.TrimSpace(v) == "204" {
+			return true
+		}
+	}
+	return false
+}
+
+// startICAP listens for ICAP clients and serves them until ctx is done
+func (s *Server) startICAP(ctx context.Context) error {
+	addr := s.config.ICAP.Addr()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for ICAP on %s: %w", addr, err)
+	}
+	s.icapListener = listener
+	s.logger.Info("ICAP listening", "addr", addr, "preview", s.config.ICAP.Preview)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+					return
+				}
+				s.logger.Error("ICAP accept error", "error", err)
+				continue
+			}
+
+			select {
+			case s.connSem <- struct{}{}:
+			default:
+				s.logger.Warn("connection limit reached, rejecting ICAP connection")
+				conn.Close()
+				continue
+			}
+
+			s.connWg.Add(1)
+			go func() {
+				defer s.connWg.Done()
+				defer func() { <-s.connSem }()
+				s.serveICAP(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// serveICAP answers ICAP requests on conn until the client closes it or a
+// request cannot be parsed
+func (s *Server) serveICAP(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	bw := bufio.NewWriter(conn)
+
+	for {
+		conn.SetDeadline(time.Now().Add(icapRequestTimeout))
+		keepAlive, err := s.serveICAPRequest(br, bw)
+		if s.holds != nil {
+			// Content held for a decision may have used up the deadline
+			conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+		}
+		if flushErr := bw.Flush(); err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			s.logger.Debug("closing ICAP connection", "error", err)
+			return
+		}
+		if !keepAlive {
+			return
+		}
+	}
+}
+
+// serveICAPRequest reads one request and writes its response. It returns
+// false when the connection should be closed.
+func (s *Server) serveICAPRequest(br *bufio.Reader, bw *bufio.Writer) (bool, error) {
+	start := time.Now()
+
+	ir, err := readICAPRequest(br)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		writeICAPError(bw, s.icapTag, 400, "Bad Request")
+		return false, err
+	}
+
+	s.mu.Lock()
+	s.requestCount++
+	s.mu.Unlock()
+
+	want := ""
+	switch ir.service {
+	case icapServiceReqmod:
+		want = "REQMOD"
+	case icapServiceRespmod:
+		want = "RESPMOD"
+	default:
+		writeICAPError(bw, s.icapTag, 404, "ICAP Service Not Found")
+		return false, fmt.Errorf("unknown ICAP service %q", ir.service)
+	}
+
+	switch ir.method {
+	case "OPTIONS":
+		s.writeICAPOptions(bw, want)
+	case want:
+		if err := s.modifyICAP(ir, br, bw, start); err != nil {
+			if errors.Is(err, errICAPMalformed) {
+				writeICAPError(bw, s.icapTag, 400, "Bad Request")
+			}
+			return false, err
+		}
+	case "REQMOD", "RESPMOD":
+		writeICAPError(bw, s.icapTag, 405, "Method Not Allowed For Service")
+		return false, fmt.Errorf("%s sent to ICAP service %s", ir.method, ir.service)
+	default:
+		writeICAPError(bw, s.icapTag, 501, "Method Not Implemented")
+		return false, fmt.Errorf("unsupported ICAP method %q", ir.method)
+	}
+
+	return !strings.EqualFold(ir.header.Get("Connection"), "close"), nil
+}
+
+// readICAPRequest reads the request line, the ICAP headers and any
+// encapsulated HTTP headers, leaving the reader at the encapsulated body
+func readICAPRequest(br *bufio.Reader) (*icapRequest, error) {
+	line, err := readICAPLine(br)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Fields(line)
+	if len(parts) != 3 || parts[2] != "ICAP/1.0" {
+		return nil, fmt.Errorf("%w: request line %q", errICAPMalformed, line)
+	}
+	uri, err := url.Parse(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: service URI %q", errICAPMalformed, parts[1])
+	}
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: headers: %v", errICAPMalformed, err)
+	}
+
+	ir := &icapRequest{
+		method:  parts[0],
+		service: uri.Path,
+		header:  header,
+		preview: -1,
+	}
+	if ir.method == "OPTIONS" {
+		return ir, nil
+	}
+
+	if v := header.Get("Preview"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%w: preview %q", errICAPMalformed, v)
+		}
+		ir.preview = n
+	}
+
+	sections, err := parseEncapsulated(header.Get("Encapsulated"))
+	if err != nil {
+		return nil, err
+	}
+	for i, sec := range sections[:len(sections)-1] {
+		size := sections[i+1].offset - sec.offset
+		if size > maxICAPHeaderSize {
+			return nil, fmt.Errorf("%w: %s exceeds %d bytes", errICAPMalformed, sec.name, maxICAPHeaderSize)
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", sec.name, err)
+		}
+		switch sec.name {
+		case "req-hdr":
+			ir.reqHdr = buf
+		case "res-hdr":
+			ir.resHdr = buf
+		default:
+			return nil, fmt.Errorf("%w: unexpected %s section", errICAPMalformed, sec.name)
+		}
+	}
+	switch body := sections[len(sections)-1].name; body {
+	case "req-body", "res-body":
+		ir.hasBody = true
+	case "null-body":
+	default:
+		return nil, fmt.Errorf("%w: unexpected %s section", errICAPMalformed, body)
+	}
+	return ir, nil
+}
+
+// icapSection is one entry of the Encapsulated header
+type icapSection struct {
+	name   string
+	offset int
+}
+
+// parseEncapsulated parses an Encapsulated header such as
+// "req-hdr=0, res-hdr=137, res-body=296". Offsets must increase and the
+// last entry must be a body.
+func parseEncapsulated(v string) ([]icapSection, error) {
+	if v == "" {
+		return nil, fmt.Errorf("%w: missing Encapsulated header", errICAPMalformed)
+	}
+	var sections []icapSection
+	for _, field := range strings.Split(v, ",") {
+		name, offset, ok := strings.Cut(strings.TrimSpace(field), "=")
+		n, err := strconv.Atoi(offset)
+		if !ok || err != nil || n < 0 || (len(sections) > 0 && n < sections[len(sections)-1].offset) {
+			return nil, fmt.Errorf("%w: Encapsulated %q", errICAPMalformed, v)
+		}
+		sections = append(sections, icapSection{name: name, offset: n})
+	}
+	if !strings.HasSuffix(sections[len(sections)-1].name, "-body") {
+		return nil, fmt.Errorf("%w: Encapsulated %q does not end with a body", errICAPMalformed, v)
+	}
+	return sections, nil
+}
+
+// readICAPLine reads one CRLF-terminated line, refusing lines longer than
+// the reader's buffer
+func readICAPLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("%w: line too long", errICAPMalformed)
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// icapChunkReader reads a chunked ICAP body. It stops at each zero-length
+// chunk: the end of a preview or of the whole body. The last chunk of a
+// preview carries the ieof extension when the preview is the whole body.
+type icapChunkReader struct {
+	br        *bufio.Reader
+	remaining int64 // Unread bytes of the current chunk
+	done      bool  // The zero-length chunk was read
+	ieof      bool
+	err       error
+}
+
+func (r *icapChunkReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for r.remaining == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if r.err = r.nextChunk(); r.err != nil {
+			return 0, r.err
+		}
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.br.Read(p)
+	r.remaining -= int64(n)
+	if err == nil && r.remaining == 0 {
+		err = r.readCRLF()
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	r.err = err
+	return n, err
+}
+
+// nextChunk reads a chunk size line and, for the last chunk, the trailer
+func (r *icapChunkReader) nextChunk() error {
+	line, err := readICAPLine(r.br)
+	if err != nil {
+		return err
+	}
+	size, ext, _ := strings.Cut(line, ";")
+	n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("%w: chunk size %q", errICAPMalformed, line)
+	}
+	if n > 0 {
+		r.remaining = n
+		return nil
+	}
+	r.done = true
+	r.ieof = strings.TrimSpace(ext) == "ieof"
+	for {
+		line, err := readICAPLine(r.br)
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			return nil
+		}
+	}
+}
+
+func (r *icapChunkReader) readCRLF() error {
+	line, err := readICAPLine(r.br)
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return fmt.Errorf("%w: chunk not followed by CRLF", errICAPMalformed)
+	}
+	return nil
+}
+
+// resume continues reading chunks after a preview that was not the whole
+// body
+func (r *icapChunkReader) resume() {
+	r.done = false
+}
+
+// modifyICAP runs a REQMOD or RESPMOD request through the pipeline
+func (s *Server) modifyICAP(ir *icapRequest, br *bufio.Reader, bw *bufio.Writer, start time.Time) error {
+	req, resp, err := ir.httpMessages()
+	if err != nil {
+		return err
+	}
+	inspected := req.Header
+	if resp != nil {
+		inspected = resp.Header
+	}
+
+	var chunks *icapChunkReader
+	var body io.Reader = http.NoBody
+	if ir.hasBody {
+		chunks = &icapChunkReader{br: br}
+		body = chunks
+	}
+
+	// A preview lets content that is not scanned pass without sending the rest
+	if chunks != nil && ir.preview >= 0 {
+		preview, err := io.ReadAll(io.LimitReader(chunks, int64(ir.preview)+1))
+		if err != nil {
+			return fmt.Errorf("failed to read preview: %w", err)
+		}
+		if len(preview) > ir.preview || !chunks.done {
+			return fmt.Errorf("%w: preview longer than announced", errICAPMalformed)
+		}
+		if chunks.ieof {
+			body = bytes.NewReader(preview)
+		} else {
+			if s.icapSkipsScan(inspected, resp == nil) {
+				writeICAPNoContent(bw, s.icapTag)
+				return nil
+			}
+			bw.WriteString("ICAP/1.0 100 Continue\r\n\r\n")
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+			chunks.resume()
+			body = io.MultiReader(bytes.NewReader(preview), chunks)
+		}
+	}
+
+	targetURL := icapTargetURL(req)
+	x := s.pipeline.begin(req, targetURL, "icap", start, nil)
+
+	if resp == nil {
+		if ir.hasBody {
+			req.Body = io.NopCloser(body)
+		} else {
+			req.Body, req.ContentLength = http.NoBody, 0
+		}
+		reply, err := s.pipeline.handleRequest(x)
+		if err != nil {
+			return fmt.Errorf("failed to inspect request: %w", err)
+		}
+		if reply != nil {
+			if err := drainICAPBody(chunks); err != nil {
+				return err
+			}
+			return writeICAPResponse(bw, s.icapTag, reply)
+		}
+		// Only an allowed request passes unchanged; a sanitized one carries
+		// the redacted body and the header that goes with it
+		if x.action == "allow" && ir.allow204() {
+			if err := drainICAPBody(chunks); err != nil {
+				return err
+			}
+			writeICAPNoContent(bw, s.icapTag)
+			return nil
+		}
+		return writeICAPEcho(bw, s.icapTag, "req", httpRequestHeader(req, ir.hasBody), ir.hasBody, req.Body)
+	}
+
+	if ir.hasBody {
+		resp.Body = io.NopCloser(body)
+	} else {
+		resp.Body, resp.ContentLength = http.NoBody, 0
+	}
+	out, err := s.pipeline.handleResponse(x, resp)
+	if err != nil {
+		return fmt.Errorf("failed to inspect response: %w", err)
+	}
+	if x.reply == nil && s.config.ICAP.Sanitize {
+		sanitizeICAPResponse(x, out)
+	}
+	// Allowed content is passed back unchanged, without the annotations
+	if x.action == "allow" && out.Header.Get("X-Stronghold-Sanitized") == "" && ir.allow204() {
+		if err := drainICAPBody(chunks); err != nil {
+			return err
+		}
+		writeICAPNoContent(bw, s.icapTag)
+		return nil
+	}
+	if x.reply != nil {
+		if err := drainICAPBody(chunks); err != nil {
+			return err
+		}
+	}
+	return writeICAPResponse(bw, s.icapTag, out)
+}
+
+// httpMessages parses the encapsulated HTTP headers. The response is nil
+// for REQMOD. RESPMOD without a request header gets a stand-in request.
+func (ir *icapRequest) httpMessages() (*http.Request, *http.Response, error) {
+	req := &http.Request{Method: http.MethodGet, URL: &url.URL{}, Header: make(http.Header)}
+	if ir.reqHdr != nil {
+		parsed, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(ir.reqHdr)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: encapsulated request: %v", errICAPMalformed, err)
+		}
+		req = parsed
+	}
+
+	switch ir.method {
+	case "REQMOD":
+		if ir.reqHdr == nil {
+			return nil, nil, fmt.Errorf("%w: REQMOD without req-hdr", errICAPMalformed)
+		}
+		return req, nil, nil
+	default:
+		if ir.resHdr == nil {
+			return nil, nil, fmt.Errorf("%w: RESPMOD without res-hdr", errICAPMalformed)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(ir.resHdr)), req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: encapsulated response: %v", errICAPMalformed, err)
+		}
+		return req, resp, nil
+	}
+}
+
+// icapTargetURL returns the URL of an encapsulated request. Proxies send
+// absolute URLs; a relative one is completed from the Host header.
+func icapTargetURL(req *http.Request) string {
+	if req.URL.IsAbs() {
+		return req.URL.String()
+	}
+	if req.Host == "" {
+		return req.URL.String()
+	}
+	return "http://" + req.Host + req.URL.RequestURI()
+}
+
+// icapSkipsScan reports whether content with header would not be scanned,
+// so a preview can be answered before the rest of the body is sent. While
+// canaries are active, request bodies are always read for them, and
+// while new hosts are held every request goes through the pipeline.
+func (s *Server) icapSkipsScan(header http.Header, request bool) bool {
+	if request && len(s.pipeline.canaries.active()) > 0 {
+		return false
+	}
+	if request && s.pipeline.hosts != nil && s.config.Hosts.OnFirstSeen == FirstSeenHold {
+		return false
+	}
+	scanning := &s.config.Scanning
+	return !scanning.Content.Enabled || !shouldScanResponse(scanning, header.Get("Content-Type"))
+}
+
+// sanitizeICAPResponse replaces a warned text body with the scanner's
+// sanitized text. HTML, documents and archives are left alone: their
+// sanitized text is extracted text, not a replacement body.
+func sanitizeICAPResponse(x *interception, out *http.Response) {
+	if x.action != "warn" || x.result == nil || x.result.SanitizedText == "" {
+		return
+	}
+	if isHTMLContentType(x.contentType) || IsDocumentContentType(x.contentType) || IsArchiveContentType(x.contentType) {
+		return
+	}
+	if x.result.SanitizedText == string(x.scanBody) {
+		return
+	}
+	body := []byte(x.result.SanitizedText)
+	out.Body.Close()
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	out.TransferEncoding = nil
+	out.Header.Del("Content-Encoding")
+	out.Header.Set("X-Stronghold-Sanitized", "true")
+}
+
+// drainICAPBody reads the rest of an encapsulated body so the next request
+// on the connection can be read
+func drainICAPBody(chunks *icapChunkReader) error {
+	if chunks == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, chunks); err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+	return nil
+}
+
+// writeICAPOptions answers OPTIONS for the service handling method
+func (s *Server) writeICAPOptions(bw *bufio.Writer, method string) {
+	writeICAPHead(bw, s.icapTag, 200, "OK", [][2]string{
+		{"Methods", method},
+		{"Service", "Stronghold content scanning"},
+		{"Allow", "204"},
+		{"Preview", strconv.Itoa(s.config.ICAP.Preview)},
+		{"Transfer-Preview", "*"},
+		{"Options-TTL", strconv.Itoa(icapOptionsTTL)},
+		{"Encapsulated", "null-body=0"},
+	})
+}
+
+// writeICAPHead writes a status line, the ISTag and header
+func writeICAPHead(bw *bufio.Writer, tag string, code int, text string, header [][2]string) {
+	fmt.Fprintf(bw, "ICAP/1.0 %d %s\r\n", code, text)
+	fmt.Fprintf(bw, "ISTag: %s\r\n", tag)
+	for _, h := range header {
+		fmt.Fprintf(bw, "%s: %s\r\n", h[0], h[1])
+	}
+	bw.WriteString("\r\n")
+}
+
+func writeICAPError(bw *bufio.Writer, tag string, code int, text string) {
+	writeICAPHead(bw, tag, code, text, [][2]string{{"Connection", "close"}, {"Encapsulated", "null-body=0"}})
+}
+
+func writeICAPNoContent(bw *bufio.Writer, tag string) {
+	writeICAPHead(bw, tag, 204, "No Content", [][2]string{{"Encapsulated", "null-body=0"}})
+}
+
+// writeICAPResponse sends resp as the encapsulated HTTP response, either in
+// place of a REQMOD request or as the modified RESPMOD response
+func writeICAPResponse(bw *bufio.Writer, tag string, resp *http.Response) error {
+	defer resp.Body.Close()
+	hasBody := resp.Body != http.NoBody && resp.ContentLength != 0
+	return writeICAPEcho(bw, tag, "res", httpResponseHeader(resp), hasBody, resp.Body)
+}
+
+// writeICAPEcho sends an encapsulated HTTP header and body. kind is "req"
+// or "res".
+func writeICAPEcho(bw *bufio.Writer, tag, kind string, hdr []byte, hasBody bool, body io.Reader) error {
+	encapsulated := fmt.Sprintf("%s-hdr=0, null-body=%d", kind, len(hdr))
+	if hasBody {
+		encapsulated = fmt.Sprintf("%s-hdr=0, %s-body=%d", kind, kind, len(hdr))
+	}
+	writeICAPHead(bw, tag, 200, "OK", [][2]string{{"Encapsulated", encapsulated}})
+	bw.Write(hdr)
+	if !hasBody {
+		return nil
+	}
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(bw, "%x\r\n", n)
+			bw.Write(buf[:n])
+			bw.WriteString("\r\n")
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy body: %w", err)
+		}
+	}
+	_, err := bw.WriteString("0\r\n\r\n")
+	return err
+}
+
+// httpRequestHeader serializes the request line and header of req, with
+// framing headers matching its body as the pipeline left it
+func httpRequestHeader(req *http.Request, hasBody bool) []byte {
+	var b bytes.Buffer
+	major, minor := req.ProtoMajor, req.ProtoMinor
+	if major == 0 {
+		major, minor = 1, 1
+	}
+	target := req.RequestURI
+	if target == "" {
+		target = req.URL.RequestURI()
+	}
+	fmt.Fprintf(&b, "%s %s HTTP/%d.%d\r\n", req.Method, target, major, minor)
+
+	header := req.Header.Clone()
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+	if req.Host != "" {
+		header.Set("Host", req.Host)
+	}
+	if hasBody {
+		if req.ContentLength >= 0 {
+			header.Set("Content-Length", strconv.FormatInt(req.ContentLength, 10))
+		} else {
+			header.Set("Transfer-Encoding", "chunked")
+		}
+	}
+	header.Write(&b)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// httpResponseHeader serializes the status line and header of resp, with
+// framing headers matching its body
+func httpResponseHeader(resp *http.Response) []byte {
+	var b bytes.Buffer
+	major, minor := resp.ProtoMajor, resp.ProtoMinor
+	if major == 0 {
+		major, minor = 1, 1
+	}
+	status := resp.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	fmt.Fprintf(&b, "HTTP/%d.%d %s\r\n", major, minor, status)
+
+	header := resp.Header.Clone()
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+	if resp.ContentLength >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	} else {
+		header.Set("Transfer-Encoding", "chunked")
+	}
+	header.Write(&b)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
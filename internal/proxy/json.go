@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// JSONConfig configures how JSON flagged by a field-by-field scan is
+// handled
+type JSONConfig struct {
+	Sanitize bool `yaml:"sanitize"` // Forward JSON with the offending fields blanked instead of blocking or warning
+}
+
+// jsonPathsKey is the ScanResult metadata key listing the JSON paths of
+// offending fields
+const jsonPathsKey = "json_paths"
+
+// offendingFields returns the JSON paths of the fields that caused a verdict
+func offendingFields(result *ScanResult) []string {
+	if result == nil || result.Metadata == nil {
+		return nil
+	}
+	switch v := result.Metadata[jsonPathsKey].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		paths := make([]string, 0, len(v))
+		for _, p := range v {
+			if s, ok := p.(string); ok {
+				paths = append(paths, s)
+			}
+		}
+		return paths
+	}
+	return nil
+}
+
+// sanitizeJSON replaces a flagged JSON body with the scanner's sanitized
+// text, the document with the offending fields blanked, and reports whether
+// it did. MCP messages and LLM API calls have their own replies.
+func sanitizeJSON(x *interception) bool {
+	if x.mcp != nil || x.llm != "" || !strings.Contains(strings.ToLower(x.contentType), "json") {
+		return false
+	}
+	if len(offendingFields(x.result)) == 0 {
+		return false
+	}
+	body := []byte(x.result.SanitizedText)
+	if len(body) == 0 || bytes.Equal(body, x.scanBody) || !json.Valid(body) {
+		return false
+	}
+	if x.shadow {
+		return true // Would be sanitized; the body is forwarded as it is
+	}
+	x.setBody(io.NopCloser(bytes.NewReader(body)), int64(len(body)))
+	x.header().Del("Content-Encoding")
+	return true
+}
@@ -0,0 +1,518 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// LLMConfig configures the LLM API provider profiles. Calls matching a
+// profile are scanned message by message: tool results sent to the model
+// are content-scanned and the model's completions are checked for leaks by
+// the output scan, instead of one generic scan of the whole JSON. Streamed
+// completions ("stream": true) are passed through without an output scan.
+type LLMConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	Providers []string `yaml:"providers"` // Profiles applied: "openai" (Chat Completions), "anthropic" (Messages)
+}
+
+// applyDefaultLLMConfig sets default values for LLMConfig if not already set
+func applyDefaultLLMConfig(cfg *LLMConfig) {
+	// If Providers is empty, this is an old config without the llm section
+	if len(cfg.Providers) == 0 {
+		cfg.Enabled = true
+		cfg.Providers = []string{string(providerOpenAI), string(providerAnthropic)}
+	}
+}
+
+// llmProvider names an LLM API schema the proxy can parse
+type llmProvider string
+
+const (
+	providerOpenAI    llmProvider = "openai"    // Chat Completions and compatible APIs
+	providerAnthropic llmProvider = "anthropic" // Messages
+)
+
+// LLMProviders lists the provider profiles that can be configured
+var LLMProviders = []string{string(providerOpenAI), string(providerAnthropic)}
+
+// maxLLMMessageScans caps how many messages of one call are scanned
+// individually. Later messages are scanned together.
+const maxLLMMessageScans = 16
+
+// maxLLMScannedResults bounds the tool results remembered as scanned clean
+const maxLLMScannedResults = 4096
+
+// llmScannedResults remembers tool results that scanned clean. Agents
+// resend the whole conversation with every call, so every tool result is
+// checked but only new ones are paid for. The oldest are forgotten first.
+type llmScannedResults struct {
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	order []string // Ring of the hashes in seen, oldest at next
+	next  int
+}
+
+func newLLMScannedResults() *llmScannedResults {
+	return &llmScannedResults{seen: make(map[string]struct{})}
+}
+
+// llmResultKey identifies a tool result sent to url
+func llmResultKey(url, text string) string {
+	return HashContent([]byte(url + "\n" + text))
+}
+
+// has reports whether the tool result with key scanned clean before
+func (r *llmScannedResults) has(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.seen[key]
+	return ok
+}
+
+// add remembers that the tool result with key scanned clean
+func (r *llmScannedResults) add(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.seen[key]; ok {
+		return
+	}
+	if len(r.order) < maxLLMScannedResults {
+		r.order = append(r.order, key)
+	} else {
+		delete(r.seen, r.order[r.next])
+		r.order[r.next] = key
+		r.next = (r.next + 1) % maxLLMScannedResults
+	}
+	r.seen[key] = struct{}{}
+}
+
+// llmMessage is a part of an LLM API call scanned on its own
+type llmMessage struct {
+	Index    int    // Position in the request's messages, or the response's choices or content blocks
+	Location string // JSON path, e.g. messages[3] or choices[0].message
+	Role     string // "tool" or "function" for tool results, "assistant" for completions
+	Tool     string // Tool name, when known
+	Text     string
+}
+
+// llmVerdict reports the scan of one message
+type llmVerdict struct {
+	Index    int      `json:"index"`
+	Location string   `json:"location"`
+	Role     string   `json:"role"`
+	Tool     string   `json:"tool,omitempty"`
+	Decision Decision `json:"decision"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// llmMessagesKey holds the per-message verdicts in a result's metadata
+const llmMessagesKey = "llm_messages"
+
+// llmProviderFor returns the profile whose API path req is sent to, or ""
+func (p *pipeline) llmProviderFor(req *http.Request) llmProvider {
+	cfg := &p.config.Scanning.LLM
+	if !cfg.Enabled || req.URL == nil {
+		return ""
+	}
+	var provider llmProvider
+	switch path := strings.TrimSuffix(req.URL.Path, "/"); {
+	case strings.HasSuffix(path, "/chat/completions"):
+		provider = providerOpenAI
+	case strings.HasSuffix(path, "/v1/messages"):
+		provider = providerAnthropic
+	default:
+		return ""
+	}
+	for _, name := range cfg.Providers {
+		if name == string(provider) {
+			return provider
+		}
+	}
+	return ""
+}
+
+// llmStage parses a call matching a provider profile into the messages to
+// scan. A body that does not fit the profile's schema is scanned as usual.
+func llmStage(p *pipeline, x *interception) error {
+	if x.llm == "" || len(x.scanBody) == 0 {
+		return nil
+	}
+	var messages []llmMessage
+	var ok bool
+	if x.resp == nil {
+		messages, ok = parseLLMRequest(x.llm, x.scanBody)
+	} else {
+		messages, ok = parseLLMResponse(x.llm, x.scanBody)
+	}
+	if !ok {
+		p.logger.Debug("body does not match LLM profile", "url", x.url, "provider", x.llm, "direction", x.direction())
+		x.llm = ""
+		if !p.config.Scanning.Content.Enabled && x.scanType == "" {
+			// Admitted for the output scan, e.g. an API error
+			x.scanType = "disabled"
+		}
+		return nil
+	}
+	x.llmMessages = messages
+	return nil
+}
+
+// llmContent is message content: a string, or an array of parts of which
+// the text parts are kept
+type llmContent string
+
+func (c *llmContent) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*c = llmContent(s)
+		return nil
+	}
+	var parts []struct {
+		Type    string     `json:"type"`
+		Text    string     `json:"text"`
+		Content llmContent `json:"content"` // Nested in Anthropic tool_result blocks
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		// null and other shapes carry no text
+		return nil
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	*c = llmContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+// openAIRequest is the part of a Chat Completions request that is scanned
+type openAIRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role       string     `json:"role"`
+		Name       string     `json:"name"`
+		Content    llmContent `json:"content"`
+		ToolCallID string     `json:"tool_call_id"`
+		ToolCalls  []struct {
+			ID       string `json:"id"`
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"messages"`
+}
+
+// anthropicRequest is the part of a Messages request that is scanned
+type anthropicRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+}
+
+// anthropicBlock is a content block of a Messages request or response
+type anthropicBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseID string          `json:"tool_use_id"`
+	Content   llmContent      `json:"content"`
+}
+
+// parseLLMRequest returns every tool result of a request. A client can
+// rewrite the history it resends, so earlier results are checked as well;
+// scanLLM skips those that already scanned clean.
+func parseLLMRequest(provider llmProvider, body []byte) ([]llmMessage, bool) {
+	switch provider {
+	case providerOpenAI:
+		var req openAIRequest
+		if err := json.Unmarshal(body, &req); err != nil || req.Model == "" || req.Messages == nil {
+			return nil, false
+		}
+		tools := make(map[string]string)
+		var messages []llmMessage
+		for i, m := range req.Messages {
+			switch m.Role {
+			case "assistant":
+				for _, call := range m.ToolCalls {
+					tools[call.ID] = call.Function.Name
+				}
+			case "tool", "function":
+				if m.Content == "" {
+					continue
+				}
+				tool := m.Name
+				if tool == "" {
+					tool = tools[m.ToolCallID]
+				}
+				messages = append(messages, llmMessage{
+					Index:    i,
+					Location: fmt.Sprintf("messages[%d]", i),
+					Role:     m.Role,
+					Tool:     tool,
+					Text:     string(m.Content),
+				})
+			}
+		}
+		return messages, true
+
+	case providerAnthropic:
+		var req anthropicRequest
+		if err := json.Unmarshal(body, &req); err != nil || req.Model == "" || req.Messages == nil {
+			return nil, false
+		}
+		tools := make(map[string]string)
+		var messages []llmMessage
+		for i, m := range req.Messages {
+			var blocks []anthropicBlock
+			json.Unmarshal(m.Content, &blocks) // String content holds no tool results
+			if m.Role == "assistant" {
+				for _, b := range blocks {
+					if b.Type == "tool_use" {
+						tools[b.ID] = b.Name
+					}
+				}
+				continue
+			}
+			for j, b := range blocks {
+				if b.Type != "tool_result" || b.Content == "" {
+					continue
+				}
+				messages = append(messages, llmMessage{
+					Index:    i,
+					Location: fmt.Sprintf("messages[%d].content[%d]", i, j),
+					Role:     "tool",
+					Tool:     tools[b.ToolUseID],
+					Text:     string(b.Content),
+				})
+			}
+		}
+		return messages, true
+	}
+	return nil, false
+}
+
+// parseLLMResponse returns the completions of a response: the text and tool
+// call arguments of each choice, or each content block
+func parseLLMResponse(provider llmProvider, body []byte) ([]llmMessage, bool) {
+	switch provider {
+	case providerOpenAI:
+		var resp struct {
+			Object  string `json:"object"`
+			Choices []struct {
+				Index   int `json:"index"`
+				Message struct {
+					Content   llmContent `json:"content"`
+					Refusal   string     `json:"refusal"`
+					ToolCalls []struct {
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil || resp.Object != "chat.completion" {
+			return nil, false
+		}
+		var messages []llmMessage
+		for _, choice := range resp.Choices {
+			texts := []string{string(choice.Message.Content), choice.Message.Refusal}
+			var tools []string
+			for _, call := range choice.Message.ToolCalls {
+				texts = append(texts, call.Function.Arguments)
+				tools = append(tools, call.Function.Name)
+			}
+			text := joinNonEmpty(texts)
+			if text == "" {
+				continue
+			}
+			messages = append(messages, llmMessage{
+				Index:    choice.Index,
+				Location: fmt.Sprintf("choices[%d].message", choice.Index),
+				Role:     "assistant",
+				Tool:     strings.Join(tools, ","),
+				Text:     text,
+			})
+		}
+		return messages, true
+
+	case providerAnthropic:
+		var resp struct {
+			Type    string           `json:"type"`
+			Content []anthropicBlock `json:"content"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil || resp.Type != "message" {
+			return nil, false
+		}
+		var messages []llmMessage
+		for i, b := range resp.Content {
+			m := llmMessage{Index: i, Location: fmt.Sprintf("content[%d]", i), Role: "assistant"}
+			switch b.Type {
+			case "text":
+				m.Text = b.Text
+			case "tool_use":
+				m.Tool = b.Name
+				m.Text = string(b.Input)
+			}
+			if m.Text == "" {
+				continue
+			}
+			messages = append(messages, m)
+		}
+		return messages, true
+	}
+	return nil, false
+}
+
+// joinNonEmpty joins the non-empty strings with newlines
+func joinNonEmpty(texts []string) string {
+	var kept []string
+	for _, t := range texts {
+		if t != "" {
+			kept = append(kept, t)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// scanLLM scans the messages of a profiled call concurrently, so batching
+// can combine them. Tool results are content-scanned, completions
+// output-scanned. The worst verdict wins; threats and the reason name the
+// message, and every verdict is kept in the result's metadata. It returns
+// nil when no message was scanned. Tool results that scanned clean in an
+// earlier call are not scanned again.
+func (p *pipeline) scanLLM(x *interception) *ScanResult {
+	messages := x.llmMessages
+	if x.resp == nil {
+		messages = messages[:0:0]
+		for _, m := range x.llmMessages {
+			if !p.llmScanned.has(llmResultKey(x.url, m.Text)) {
+				messages = append(messages, m)
+			}
+		}
+	}
+	single := len(messages) // Messages scanned on their own rather than joined
+	if len(messages) > maxLLMMessageScans {
+		single = maxLLMMessageScans - 1
+		rest := messages[maxLLMMessageScans-1:]
+		texts := make([]string, len(rest))
+		for i, m := range rest {
+			texts[i] = m.Text
+		}
+		merged := rest[0]
+		merged.Location += " (and later)"
+		merged.Text = strings.Join(texts, "\n")
+		messages = append(messages[:maxLLMMessageScans-1:maxLLMMessageScans-1], merged)
+	}
+
+	results := make([]*ScanResult, len(messages))
+	var wg sync.WaitGroup
+	for i, m := range messages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if x.resp != nil {
+				results[i] = p.scanOutput([]byte(m.Text), x.url, x.ruleDirection())
+			} else {
+				results[i] = p.scan([]byte(m.Text), x.url, "text/plain", x.ruleDirection(), nil)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var merged *ScanResult
+	var worst *llmMessage
+	verdicts := make([]llmVerdict, 0, len(messages))
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		m := &messages[i]
+		if x.resp == nil && i < single && result.Decision == DecisionAllow && result.Metadata["budget_exceeded"] == nil {
+			p.llmScanned.add(llmResultKey(x.url, m.Text))
+		}
+		verdicts = append(verdicts, llmVerdict{
+			Index:    m.Index,
+			Location: m.Location,
+			Role:     m.Role,
+			Tool:     m.Tool,
+			Decision: result.Decision,
+			Reason:   result.Reason,
+		})
+		if merged == nil {
+			merged = &ScanResult{Decision: DecisionAllow, Scores: map[string]float64{}}
+		}
+		for _, threat := range result.ThreatsFound {
+			if threat.Location == "" {
+				threat.Location = m.Location
+			} else {
+				threat.Location = m.Location + " " + threat.Location
+			}
+			merged.ThreatsFound = append(merged.ThreatsFound, threat)
+		}
+		if score := primaryScore(result); score > merged.Scores["combined"] {
+			merged.Scores["combined"] = score
+		}
+		if worst == nil || decisionRank(result.Decision) > decisionRank(merged.Decision) {
+			worst = m
+			merged.Decision = result.Decision
+			merged.Reason = result.Reason
+			merged.RecommendedAction = result.RecommendedAction
+		}
+	}
+	if merged == nil {
+		return nil
+	}
+	if merged.Decision != DecisionAllow {
+		merged.Reason = fmt.Sprintf("%s: %s", llmMessageLabel(worst), merged.Reason)
+	}
+	merged.Metadata = map[string]interface{}{
+		"llm_provider": string(x.llm),
+		llmMessagesKey: verdicts,
+	}
+	return merged
+}
+
+// llmMessageLabel names a message in reasons, e.g. "messages[3] (tool search)"
+func llmMessageLabel(m *llmMessage) string {
+	if m.Tool != "" {
+		return fmt.Sprintf("%s (tool %s)", m.Location, m.Tool)
+	}
+	return m.Location
+}
+
+// primaryScore returns the headline score of a result
+func primaryScore(result *ScanResult) float64 {
+	if score, ok := result.Scores["combined"]; ok {
+		return score
+	}
+	return result.Scores["heuristic"]
+}
+
+// llmVerdicts returns the per-message verdicts of a profiled call's result
+func llmVerdicts(result *ScanResult) []llmVerdict {
+	if result == nil || result.Metadata == nil {
+		return nil
+	}
+	verdicts, _ := result.Metadata[llmMessagesKey].([]llmVerdict)
+	return verdicts
+}
+
+// llmVerdictHeader formats per-message verdicts for X-Stronghold-Messages,
+// e.g. "3=BLOCK, 5=ALLOW"
+func llmVerdictHeader(verdicts []llmVerdict) string {
+	parts := make([]string, len(verdicts))
+	for i, v := range verdicts {
+		parts[i] = fmt.Sprintf("%d=%s", v.Index, v.Decision)
+	}
+	return strings.Join(parts, ", ")
+}
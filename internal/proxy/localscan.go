@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/TryMightyAI/citadel/pkg/patterns"
+)
+
+// localScanCategories are the pattern categories that indicate injection
+// in fetched content
+var localScanCategories = []patterns.Category{
+	patterns.CategoryIndirectInj,
+	patterns.CategoryJailbreak,
+	patterns.CategoryPromptExtraction,
+	patterns.CategoryInjectionAttack,
+}
+
+// localOutputCategories are the pattern categories that indicate a leak in
+// model output
+var localOutputCategories = []patterns.Category{
+	patterns.CategoryCredential,
+	patterns.CategoryExfiltration,
+}
+
+// localWarnThreshold is the lowest pattern score reported as WARN
+const localWarnThreshold = 0.4
+
+// LocalScan scans content with the built-in pattern registry, without
+// calling the API. It is much weaker than the API scan and is used when
+// the API cannot be paid for.
+func LocalScan(content []byte, sourceURL string, blockThreshold float64) *ScanResult {
+	return localScan(content, sourceURL, blockThreshold, localScanCategories, "known prompt injection patterns")
+}
+
+// LocalOutputScan scans model output for credentials with the built-in
+// pattern registry. It stands in for an output scan the budget cannot pay
+// for, as LocalScan does for content.
+func LocalOutputScan(content []byte, sourceURL string, blockThreshold float64) *ScanResult {
+	return localScan(content, sourceURL, blockThreshold, localOutputCategories, "known credential patterns")
+}
+
+// localScan matches content against categories of the pattern registry.
+// matched describes the patterns in the recommended action of a verdict.
+func localScan(content []byte, sourceURL string, blockThreshold float64, categories []patterns.Category, matched string) *ScanResult {
+	matches := patterns.Get().MatchAll(string(content), categories...)
+
+	var score float64
+	var top string
+	threats := make([]Threat, 0, len(matches))
+	for _, p := range matches {
+		if s := float64(p.Severity) / 100; s > score {
+			score = s
+			top = p.Description
+		}
+		threats = append(threats, Threat{
+			Category:    string(p.Category),
+			Pattern:     p.Name,
+			Severity:    localSeverity(p.Severity),
+			Description: p.Description,
+		})
+	}
+
+	result := &ScanResult{
+		Decision:          DecisionAllow,
+		Scores:            map[string]float64{"heuristic": score},
+		Reason:            "No threats detected by local scan",
+		RecommendedAction: "Content is safe to process",
+		Metadata: map[string]interface{}{
+			"source_url": sourceURL,
+			"detection":  "local",
+		},
+	}
+	switch {
+	case score > 0 && score >= blockThreshold:
+		result.Decision = DecisionBlock
+		result.Reason = fmt.Sprintf("Local scan: %s (Score: %.2f)", top, score)
+		result.RecommendedAction = "DO NOT PROCEED - Content matches " + matched + "."
+		result.ThreatsFound = threats
+	case score >= localWarnThreshold:
+		result.Decision = DecisionWarn
+		result.Reason = fmt.Sprintf("Local scan: %s (Score: %.2f)", top, score)
+		result.RecommendedAction = "Caution advised - Review content manually before processing."
+		result.ThreatsFound = threats
+	}
+	return result
+}
+
+func localSeverity(severity int) string {
+	switch {
+	case severity >= 70:
+		return "high"
+	case severity >= 50:
+		return "medium"
+	default:
+		return "low"
+	}
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"stronghold/internal/mcptext"
+)
+
+// mcpBlockedCode is the JSON-RPC error code of a response withheld after a
+// scan, from the range JSON-RPC reserves for server errors
+const mcpBlockedCode = -32050
+
+// mcpStage recognizes MCP traffic. The tools a request calls are remembered
+// so threats in their results can name the tool; a response that is MCP is
+// scanned item by item and, when blocked, answered with JSON-RPC errors the
+// agent's MCP client can read instead of a 403.
+func mcpStage(p *pipeline, x *interception) error {
+	if len(x.scanBody) == 0 {
+		return nil
+	}
+	if x.resp == nil {
+		x.mcpTools, x.mcpRequest = mcptext.ToolCalls(x.scanBody)
+		return nil
+	}
+	if msg, ok := mcptext.Parse(x.scanBody); ok {
+		x.mcp = msg
+	}
+	return nil
+}
+
+// mcpToolNames returns the tools the request called, by JSON-RPC id, when
+// the response is MCP, and nil when it is not
+func (x *interception) mcpToolNames() map[string]string {
+	if x.mcp == nil {
+		return nil
+	}
+	if x.mcpTools == nil {
+		return map[string]string{}
+	}
+	return x.mcpTools
+}
+
+// isEventStreamContentType reports whether a content type is a Server-Sent
+// Events stream
+func isEventStreamContentType(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "text/event-stream")
+}
+
+// mcpErrorResponse answers each JSON-RPC response of a blocked MCP message
+// with an error, in the framing the server used
+func (p *pipeline) mcpErrorResponse(x *interception) *http.Response {
+	type errorData struct {
+		Reason            string `json:"reason"`
+		Tool              string `json:"tool,omitempty"`
+		URL               string `json:"url"`
+		RequestID         string `json:"request_id"`
+		RecommendedAction string `json:"recommended_action,omitempty"`
+		QuarantineID      string `json:"quarantine_id,omitempty"`
+	}
+	type rpcError struct {
+		Code    int       `json:"code"`
+		Message string    `json:"message"`
+		Data    errorData `json:"data"`
+	}
+
+	messages := make([][]byte, 0, len(x.mcp.IDs))
+	for _, id := range x.mcp.IDs {
+		msg, _ := json.Marshal(struct {
+			JSONRPC string          `json:"jsonrpc"`
+			ID      json.RawMessage `json:"id"`
+			Error   rpcError        `json:"error"`
+		}{
+			JSONRPC: "2.0",
+			ID:      id,
+			Error: rpcError{
+				Code:    mcpBlockedCode,
+				Message: "Content blocked by Stronghold security scan",
+				Data: errorData{
+					Reason:            x.result.Reason,
+					Tool:              x.mcpTools[mcptext.IDString(id)],
+					URL:               x.url,
+					RequestID:         x.requestID,
+					RecommendedAction: x.result.RecommendedAction,
+					QuarantineID:      x.quarantineID,
+				},
+			},
+		})
+		messages = append(messages, msg)
+	}
+
+	var body []byte
+	contentType := "application/json"
+	switch {
+	case x.mcp.Stream:
+		var b bytes.Buffer
+		for _, msg := range messages {
+			fmt.Fprintf(&b, "event: message\ndata: %s\n\n", msg)
+		}
+		body = b.Bytes()
+		contentType = "text/event-stream"
+	case len(messages) == 1:
+		body = messages[0]
+	default:
+		body = append(append([]byte("["), bytes.Join(messages, []byte(","))...), ']')
+	}
+
+	resp := &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       x.req,
+	}
+	resp.Header.Set("Content-Type", contentType)
+	return resp
+}
@@ -2,10 +2,7 @@ package proxy
 
 import (
 	"bufio"
-	"bytes"
-	"context"
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
@@ -18,21 +15,38 @@ import (
 // MITMHandler handles transparent HTTPS interception (Man-In-The-Middle)
 type MITMHandler struct {
 	certCache *CertCache
-	scanner   *ScannerClient
-	config    *Config
 	logger    *slog.Logger
+	capture   *CaptureStore
+	pipeline  *pipeline       // Inspects requests and responses
+	upstream  *http.Transport // Pooled connections to origin servers
 }
 
 // NewMITMHandler creates a new MITM handler
 func NewMITMHandler(certCache *CertCache, scanner *ScannerClient, config *Config, logger *slog.Logger) *MITMHandler {
 	return &MITMHandler{
 		certCache: certCache,
-		scanner:   scanner,
-		config:    config,
 		logger:    logger,
+		upstream:  newUpstreamTransport(config.Upstream),
+		pipeline:  newPipeline(config, scanner, logger),
 	}
 }
 
+// SetPipeline shares the pipeline plain HTTP requests go through, so both
+// transports count, quarantine and annotate traffic together
+func (m *MITMHandler) SetPipeline(p *pipeline) {
+	m.pipeline = p
+}
+
+// SetCapture sets the store that recorded flows are written to
+func (m *MITMHandler) SetCapture(c *CaptureStore) {
+	m.capture = c
+}
+
+// CloseIdleConnections closes pooled origin connections that are not in use
+func (m *MITMHandler) CloseIdleConnections() {
+	m.upstream.CloseIdleConnections()
+}
+
 // HandleTLS intercepts a TLS connection for content inspection
 func (m *MITMHandler) HandleTLS(clientConn net.Conn, originalDst string) error {
 	defer clientConn.Close()
@@ -71,25 +85,21 @@ func (m *MITMHandler) HandleTLS(clientConn net.Conn, originalDst string) error {
 	tlsClientConn.SetDeadline(time.Time{})
 	defer tlsClientConn.Close()
 
-	// Connect to actual server with TLS (with connection timeout)
-	serverConn, err := tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", originalDst, &tls.Config{
-		ServerName: host,
-		MinVersion: tls.VersionTLS12,
-	})
-	if err != nil {
-		m.logger.Error("failed to connect to server", "host", host, "error", err)
-		return fmt.Errorf("failed to connect to server: %w", err)
+	// Requests are sent over pooled connections to the origin, which
+	// outlive this client connection
+	upstreamHost := host
+	if port != "443" {
+		upstreamHost = net.JoinHostPort(host, port)
 	}
-	defer serverConn.Close()
 
 	// Handle HTTP requests over the TLS connection
-	return m.proxyHTTPS(tlsClientConn, serverConn, host)
+	return m.proxyHTTPS(tlsClientConn, upstreamHost)
 }
 
-// proxyHTTPS proxies HTTP requests over established TLS connections
-func (m *MITMHandler) proxyHTTPS(clientConn, serverConn net.Conn, host string) error {
+// proxyHTTPS proxies HTTP requests from an established client TLS connection
+// to host through the upstream pool
+func (m *MITMHandler) proxyHTTPS(clientConn net.Conn, host string) error {
 	clientReader := bufio.NewReader(clientConn)
-	serverReader := bufio.NewReader(serverConn)
 
 	for {
 		// Set read deadline to detect closed connections
@@ -111,145 +121,97 @@ func (m *MITMHandler) proxyHTTPS(clientConn, serverConn net.Conn, host string) e
 
 		m.logger.Debug("MITM request", "method", req.Method, "url", req.URL.String())
 
-		// Scan request body if it exists (for prompt injection in POST data)
-		var requestBody []byte
-		if req.Body != nil && req.ContentLength != 0 && m.config.Scanning.Content.Enabled {
-			var readErr error
-			requestBody, readErr = io.ReadAll(io.LimitReader(req.Body, 1024*1024+1))
-			req.Body.Close()
-			if readErr != nil {
-				m.logger.Error("failed to read request body", "url", req.URL.String(), "error", readErr)
-			}
+		// Record the flow if a capture is running
+		flow := m.capture.begin(req, req.URL.String(), "mitm")
+		req.Body = flow.teeRequestBody(req.Body)
 
-			// Scan the request content (skip if over 1MB)
-			if len(requestBody) > 0 && len(requestBody) <= 1024*1024 {
-				result := m.scanContent(requestBody, req.URL.String(), req.Header.Get("Content-Type"))
-				if result != nil && result.Decision == DecisionBlock {
-					// Block the request
-					m.sendBlockResponse(clientConn, result, req)
-					continue
-				}
+		// Inspect the request before it leaves
+		x := m.pipeline.begin(req, req.URL.String(), "mitm", time.Now(), flow)
+		reply, err := m.pipeline.handleRequest(x)
+		if err != nil {
+			flow.fail(err)
+			flow.finish(m.logger)
+			m.sendBadGateway(clientConn, req)
+			return err
+		}
+		if reply != nil {
+			if err := m.writeResponse(clientConn, reply, flow); err != nil {
+				return err
 			}
-
-			// Restore body for forwarding
-			req.Body = io.NopCloser(strings.NewReader(string(requestBody)))
+			if req.Close {
+				return nil
+			}
+			continue
 		}
 
+		// The client's connection headers describe its connection to us,
+		// not the pooled one to the origin
+		clientClose := req.Close
+		req.Close = false
+		removeHopHeaders(req.Header)
+
 		// Forward request to server
-		if err := req.Write(serverConn); err != nil {
+		resp, err := m.upstream.RoundTrip(req)
+		if err != nil {
+			flow.fail(err)
+			flow.finish(m.logger)
+			m.sendBadGateway(clientConn, req)
 			return fmt.Errorf("failed to forward request: %w", err)
 		}
+		flow.responseStarted()
+		upstreamBody := resp.Body
 
-		// Read response from server
-		resp, err := http.ReadResponse(serverReader, req)
+		out, err := m.pipeline.handleResponse(x, resp)
 		if err != nil {
-			return fmt.Errorf("failed to read response: %w", err)
+			upstreamBody.Close()
+			flow.fail(err)
+			flow.finish(m.logger)
+			m.sendBadGateway(clientConn, req)
+			return err
+		}
+		err = m.writeResponse(clientConn, out, flow)
+		upstreamBody.Close()
+		if err != nil {
+			return err
 		}
 
-		// Check if response should be scanned before reading the full body
-		contentType := resp.Header.Get("Content-Type")
-		shouldScan := m.config.Scanning.Content.Enabled &&
-			ShouldScanContentType(contentType) && !IsBinaryContentType(contentType)
-
-		if shouldScan {
-			// Read body for scanning (with 1MB limit + 1 byte to detect oversized)
-			responseBody, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024+1))
-			resp.Body.Close()
-			if err != nil {
-				return fmt.Errorf("failed to read response body: %w", err)
-			}
-
-			// Scan if within size limit
-			var scanResult *ScanResult
-			if len(responseBody) > 0 && len(responseBody) <= 1024*1024 {
-				scanResult = m.scanContent(responseBody, req.URL.String(), contentType)
-			}
-
-			// Add Stronghold headers
-			resp.Header.Set("X-Stronghold-Proxy", "mitm")
-			if scanResult != nil {
-				resp.Header.Set("X-Stronghold-Decision", string(scanResult.Decision))
-				resp.Header.Set("X-Stronghold-Reason", scanResult.Reason)
-
-				// Block if needed
-				action := getAction(scanResult.Decision, m.config.Scanning.Content)
-				if action == "block" {
-					m.sendBlockResponse(clientConn, scanResult, req)
-					continue
-				}
-			}
-
-			// Forward response to client with the read body
-			resp.Body = io.NopCloser(bytes.NewReader(responseBody))
-			resp.ContentLength = int64(len(responseBody))
-
-			if err := resp.Write(clientConn); err != nil {
-				return fmt.Errorf("failed to forward response: %w", err)
-			}
-		} else {
-			// Non-scannable content: stream directly without buffering
-			resp.Header.Set("X-Stronghold-Proxy", "mitm")
-			if err := resp.Write(clientConn); err != nil {
-				resp.Body.Close()
-				return fmt.Errorf("failed to forward response: %w", err)
-			}
-			resp.Body.Close()
+		if clientClose {
+			return nil
 		}
 	}
 }
 
-// scanContent scans content for threats
-func (m *MITMHandler) scanContent(body []byte, sourceURL, contentType string) *ScanResult {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	result, err := m.scanner.ScanContent(ctx, body, sourceURL, contentType)
+// writeResponse sends a response produced by the pipeline to the client
+// connection and finishes its flow
+func (m *MITMHandler) writeResponse(conn net.Conn, resp *http.Response, flow *captureFlow) error {
+	toHTTP1(resp)
+	flow.captureResponse(resp)
+	err := resp.Write(conn)
+	resp.Body.Close()
+	flow.fail(err)
+	flow.finish(m.logger)
 	if err != nil {
-		m.logger.Error("scan error", "error", err)
-		if m.config.Scanning.FailOpen {
-			return nil
-		}
-		return &ScanResult{
-			Decision: DecisionBlock,
-			Reason:   "Scan failed - blocking for safety",
-		}
+		return fmt.Errorf("failed to forward response: %w", err)
 	}
-
-	return result
+	return nil
 }
 
-// sendBlockResponse sends a block response to the client
-func (m *MITMHandler) sendBlockResponse(conn net.Conn, result *ScanResult, req *http.Request) {
-	m.logger.Warn("content blocked", "url", req.URL.String(), "reason", result.Reason)
-
-	bodyBytes, _ := json.Marshal(struct {
-		Error  string `json:"error"`
-		Reason string `json:"reason"`
-		URL    string `json:"url"`
-	}{
-		Error:  "Content blocked by Stronghold security scan",
-		Reason: result.Reason,
-		URL:    req.URL.String(),
-	})
-	body := string(bodyBytes)
-
+// sendBadGateway tells the client the origin could not be reached
+func (m *MITMHandler) sendBadGateway(conn net.Conn, req *http.Request) {
+	body := "Bad Gateway"
 	resp := &http.Response{
-		StatusCode:    http.StatusForbidden,
-		Status:        "403 Forbidden",
+		StatusCode:    http.StatusBadGateway,
+		Status:        "502 Bad Gateway",
 		Proto:         "HTTP/1.1",
 		ProtoMajor:    1,
 		ProtoMinor:    1,
 		Header:        make(http.Header),
 		Body:          io.NopCloser(strings.NewReader(body)),
 		ContentLength: int64(len(body)),
+		Close:         true,
 		Request:       req,
 	}
-
-	resp.Header.Set("Content-Type", "application/json")
-	resp.Header.Set("X-Stronghold-Decision", string(result.Decision))
-	resp.Header.Set("X-Stronghold-Reason", result.Reason)
-
-	if err := resp.Write(conn); err != nil {
-		m.logger.Error("failed to send block response", "url", req.URL.String(), "error", err)
-	}
+	resp.Header.Set("Content-Type", "text/plain")
+	resp.Header.Set("X-Stronghold-Proxy", "mitm")
+	resp.Write(conn)
 }
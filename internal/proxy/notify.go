@@ -0,0 +1,572 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification events
+const (
+	EventBlock           = "block"            // Content was blocked
+	EventWarn            = "warn"             // Content was passed with a warning
+	EventBudgetExhausted = "budget_exhausted" // A spending cap stopped paid scans
+	EventFailClosed      = "fail_closed"      // Content was blocked because it could not be scanned
+	EventCircuitOpen     = "circuit_open"     // The circuit breaker stopped calls to the scanning API
+	EventNewHost         = "new_host"         // First contact with a destination host was flagged
+	EventHeld            = "held"             // Content is held for a human decision
+	EventTest            = "test"             // Sent by 'stronghold notify test'
+)
+
+// NotificationEvents lists the events targets can subscribe to
+var NotificationEvents = []string{EventBlock, EventWarn, EventBudgetExhausted, EventFailClosed, EventCircuitOpen, EventNewHost, EventHeld}
+
+// Notification target formats
+const (
+	NotifyFormatJSON  = "json"  // Batch of notifications as JSON
+	NotifyFormatSlack = "slack" // Slack incoming webhook message
+	NotifyFormatTeams = "teams" // Microsoft Teams incoming webhook card
+)
+
+const (
+	notifyQueueSize   = 1000             // Notifications queued per target before new ones are dropped
+	notifyQuietPeriod = 15 * time.Minute // Repeats of a keyed notification are dropped for this long
+	notifyTimeout     = 10 * time.Second // Per delivery attempt
+	notifyMaxBackoff  = 30 * time.Second
+)
+
+// NotificationsConfig controls the notifications the proxy delivers to
+// webhooks
+type NotificationsConfig struct {
+	Enabled     bool           `yaml:"enabled"`
+	BatchWindow time.Duration  `yaml:"batch_window"` // Notifications collected into one delivery
+	MaxBatch    int            `yaml:"max_batch"`    // Most notifications in one delivery
+	RateLimit   int            `yaml:"rate_limit"`   // Most deliveries per minute to each target
+	Retries     int            `yaml:"retries"`      // Retries of a failed delivery, with backoff
+	Targets     []NotifyTarget `yaml:"targets"`
+}
+
+// NotifyTarget is a webhook notifications are delivered to
+type NotifyTarget struct {
+	Name   string   `yaml:"name"`
+	URL    string   `yaml:"url"`
+	Format string   `yaml:"format"`           // json, slack or teams
+	Secret string   `yaml:"secret,omitempty"` // Signs deliveries with HMAC-SHA256
+	Events []string `yaml:"events,omitempty"` // Events delivered; all when empty
+}
+
+// applyDefaultNotificationsConfig sets default values for NotificationsConfig if not already set
+func applyDefaultNotificationsConfig(cfg *NotificationsConfig) {
+	if cfg.BatchWindow == 0 {
+		cfg.BatchWindow = 10 * time.Second
+	}
+	if cfg.MaxBatch == 0 {
+		cfg.MaxBatch = 20
+	}
+	if cfg.RateLimit == 0 {
+		cfg.RateLimit = 10
+	}
+	if cfg.Retries == 0 {
+		cfg.Retries = 3
+	}
+}
+
+// Validate checks the target's URL, format and events
+func (t NotifyTarget) Validate() error {
+	if t.Name == "" {
+		return errors.New("notification target has no name")
+	}
+	if !strings.HasPrefix(t.URL, "http://") && !strings.HasPrefix(t.URL, "https://") {
+		return fmt.Errorf("invalid URL for target %s: %q (must start with http:// or https://)", t.Name, t.URL)
+	}
+	switch t.Format {
+	case NotifyFormatJSON, NotifyFormatSlack, NotifyFormatTeams:
+	default:
+		return fmt.Errorf("invalid format for target %s: %q (must be json, slack or teams)", t.Name, t.Format)
+	}
+	for _, event := range t.Events {
+		if !isNotificationEvent(event) {
+			return fmt.Errorf("invalid event for target %s: %q (must be one of %s)", t.Name, event, strings.Join(NotificationEvents, ", "))
+		}
+	}
+	return nil
+}
+
+func isNotificationEvent(event string) bool {
+	for _, e := range NotificationEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// wants reports whether the target subscribes to event
+func (t NotifyTarget) wants(event string) bool {
+	if len(t.Events) == 0 || event == EventTest {
+		return true
+	}
+	for _, e := range t.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification is one event delivered to targets
+type Notification struct {
+	Event        string    `json:"event"`
+	At           time.Time `json:"at"`
+	Summary      string    `json:"summary"` // One line for chat messages
+	Host         string    `json:"host,omitempty"`
+	URL          string    `json:"url,omitempty"`
+	Direction    string    `json:"direction,omitempty"` // "request" or "response"
+	Decision     string    `json:"decision,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	ScanType     string    `json:"scan_type,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Transport    string    `json:"transport,omitempty"`
+	QuarantineID string    `json:"quarantine_id,omitempty"`
+
+	// Key identifies repeats of a condition, such as a cap being reached,
+	// that are only notified once per quiet period; empty for events
+	// notified every time
+	Key string `json:"-"`
+}
+
+// Notifier delivers notifications to webhooks. Each target has a queue
+// drained by its own goroutine: notifications arriving within the batch
+// window go out in one delivery, deliveries beyond the rate limit wait and
+// grow the next batch instead, and failed deliveries are retried with
+// backoff. Notify never blocks the traffic it reports on.
+type Notifier struct {
+	config  NotificationsConfig
+	logger  *slog.Logger
+	client  *http.Client
+	targets []*notifyQueue
+
+	mu   sync.Mutex
+	seen map[string]time.Time // When keyed notifications were last queued
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     sync.WaitGroup
+	ctx      context.Context // Canceled when Close gives up on pending deliveries
+	cancel   context.CancelFunc
+}
+
+// notifyQueue is one target with its pending notifications
+type notifyQueue struct {
+	target NotifyTarget
+	queue  chan Notification
+	sent   []time.Time // Deliveries in the last minute, for the rate limit
+}
+
+// NewNotifier validates the targets in cfg and returns a notifier for them.
+// Call Start to deliver queued notifications.
+func NewNotifier(cfg NotificationsConfig, logger *slog.Logger) (*Notifier, error) {
+	applyDefaultNotificationsConfig(&cfg)
+	n := &Notifier{
+		config: cfg,
+		logger: logger,
+		client: &http.Client{
+			Timeout: notifyTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		seen: make(map[string]time.Time),
+		stop: make(chan struct{}),
+	}
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+
+	names := make(map[string]bool)
+	for _, t := range cfg.Targets {
+		if err := t.Validate(); err != nil {
+			return nil, err
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("duplicate notification target %q", t.Name)
+		}
+		names[t.Name] = true
+		n.targets = append(n.targets, &notifyQueue{target: t, queue: make(chan Notification, notifyQueueSize)})
+	}
+	return n, nil
+}
+
+// Start delivers queued notifications until Close
+func (n *Notifier) Start() {
+	if n == nil {
+		return
+	}
+	for _, q := range n.targets {
+		n.done.Add(1)
+		go n.run(q)
+	}
+}
+
+// Close delivers what is still queued, giving up when ctx is done
+func (n *Notifier) Close(ctx context.Context) {
+	if n == nil {
+		return
+	}
+	n.stopOnce.Do(func() { close(n.stop) })
+	finished := make(chan struct{})
+	go func() {
+		n.done.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		n.cancel()
+		<-finished
+	}
+	n.cancel()
+}
+
+// Notify queues note for every target subscribed to its event. A keyed
+// notification repeated within the quiet period is dropped, and so is any
+// notification for a target whose queue is full.
+func (n *Notifier) Notify(note Notification) {
+	if n == nil {
+		return
+	}
+	if note.At.IsZero() {
+		note.At = time.Now().UTC()
+	}
+	if note.Key != "" {
+		n.mu.Lock()
+		last, ok := n.seen[note.Key]
+		if ok && note.At.Sub(last) < notifyQuietPeriod {
+			n.mu.Unlock()
+			return
+		}
+		n.seen[note.Key] = note.At
+		n.mu.Unlock()
+	}
+
+	for _, q := range n.targets {
+		if !q.target.wants(note.Event) {
+			continue
+		}
+		select {
+		case q.queue <- note:
+		default:
+			n.logger.Debug("notification queue full, dropping", "target", q.target.Name, "event", note.Event)
+		}
+	}
+}
+
+// Test delivers a test notification to each target at once, without
+// batching or retries, and returns the outcome by target name
+func (n *Notifier) Test(ctx context.Context) map[string]error {
+	note := Notification{
+		Event:   EventTest,
+		At:      time.Now().UTC(),
+		Summary: "Test notification from Stronghold",
+	}
+	results := make(map[string]error)
+	for _, q := range n.targets {
+		results[q.target.Name] = n.deliver(ctx, q.target, []Notification{note})
+	}
+	return results
+}
+
+// run batches and delivers the notifications queued for q until the
+// notifier is closed, then delivers what is left
+func (n *Notifier) run(q *notifyQueue) {
+	defer n.done.Done()
+	for {
+		var batch []Notification
+		select {
+		case note := <-q.queue:
+			batch = append(batch, note)
+		case <-n.stop:
+			n.drain(q)
+			return
+		}
+
+		window := time.NewTimer(n.config.BatchWindow)
+		stopping := false
+	collect:
+		for len(batch) < n.config.MaxBatch {
+			select {
+			case note := <-q.queue:
+				batch = append(batch, note)
+			case <-window.C:
+				break collect
+			case <-n.stop:
+				stopping = true
+				break collect
+			}
+		}
+		window.Stop()
+
+		if !stopping && !n.waitForSlot(q) {
+			stopping = true
+		}
+		n.send(q, batch)
+		if stopping {
+			n.drain(q)
+			return
+		}
+	}
+}
+
+// drain delivers everything left in q's queue
+func (n *Notifier) drain(q *notifyQueue) {
+	for {
+		var batch []Notification
+	collect:
+		for len(batch) < n.config.MaxBatch {
+			select {
+			case note := <-q.queue:
+				batch = append(batch, note)
+			default:
+				break collect
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		n.send(q, batch)
+	}
+}
+
+// waitForSlot waits until a delivery to q fits the rate limit. It returns
+// false if the notifier was closed meanwhile.
+func (n *Notifier) waitForSlot(q *notifyQueue) bool {
+	now := time.Now()
+	recent := q.sent[:0]
+	for _, t := range q.sent {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	q.sent = recent
+	if len(q.sent) < n.config.RateLimit {
+		return true
+	}
+
+	wait := time.NewTimer(time.Minute - now.Sub(q.sent[0]))
+	defer wait.Stop()
+	select {
+	case <-wait.C:
+		q.sent = q.sent[1:]
+		return true
+	case <-n.stop:
+		return false
+	}
+}
+
+// send delivers batch to q, retrying with backoff
+func (n *Notifier) send(q *notifyQueue, batch []Notification) {
+	q.sent = append(q.sent, time.Now())
+	backoff := time.Second
+	var err error
+	for attempt := 0; attempt <= n.config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-n.ctx.Done():
+				n.logger.Warn("notifications not delivered", "target", q.target.Name, "count", len(batch), "error", err)
+				return
+			}
+			backoff = min(backoff*2, notifyMaxBackoff)
+		}
+		err = n.deliver(n.ctx, q.target, batch)
+		if err == nil || !retryableNotifyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		n.logger.Warn("notifications not delivered", "target", q.target.Name, "count", len(batch), "error", err)
+	}
+}
+
+// notifyStatusError is a delivery the target answered with an error status
+type notifyStatusError struct {
+	StatusCode int
+}
+
+func (e *notifyStatusError) Error() string {
+	return fmt.Sprintf("target answered %d", e.StatusCode)
+}
+
+// retryableNotifyError reports whether a failed delivery may succeed when
+// repeated: network errors, rate limiting and server errors
+func retryableNotifyError(err error) bool {
+	var status *notifyStatusError
+	if errors.As(err, &status) {
+		return status.StatusCode == http.StatusTooManyRequests || status.StatusCode >= 500
+	}
+	return true
+}
+
+// deliver POSTs batch to target in its format. With a secret, the body is
+// signed: X-Stronghold-Signature is sha256= and the hex HMAC-SHA256 of the
+// X-Stronghold-Timestamp value, a dot and the body.
+func (n *Notifier) deliver(ctx context.Context, target NotifyTarget, batch []Notification) error {
+	body, err := notificationPayload(target.Format, batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "stronghold-proxy")
+	if target.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Stronghold-Timestamp", timestamp)
+		req.Header.Set("X-Stronghold-Signature", "sha256="+signNotification(target.Secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver notification: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &notifyStatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// signNotification returns the hex HMAC-SHA256 of timestamp, a dot and body
+func signNotification(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// notificationPayload encodes batch in format
+func notificationPayload(format string, batch []Notification) ([]byte, error) {
+	switch format {
+	case NotifyFormatSlack:
+		return json.Marshal(struct {
+			Text string `json:"text"`
+		}{chatText(batch, "*", "\n")})
+	case NotifyFormatTeams:
+		return json.Marshal(struct {
+			Type       string `json:"@type"`
+			Context    string `json:"@context"`
+			Summary    string `json:"summary"`
+			ThemeColor string `json:"themeColor"`
+			Title      string `json:"title"`
+			Text       string `json:"text"`
+		}{
+			Type:       "MessageCard",
+			Context:    "https://schema.org/extensions",
+			Summary:    chatTitle(batch),
+			ThemeColor: "D93F0B",
+			Title:      chatTitle(batch),
+			Text:       chatText(batch, "**", "\n\n"),
+		})
+	default:
+		return json.Marshal(struct {
+			Source        string         `json:"source"`
+			Notifications []Notification `json:"notifications"`
+		}{"stronghold", batch})
+	}
+}
+
+// chatTitle names a batch in chat messages
+func chatTitle(batch []Notification) string {
+	if len(batch) == 1 {
+		return "Stronghold: " + strings.ReplaceAll(batch[0].Event, "_", " ")
+	}
+	return fmt.Sprintf("Stronghold: %d events", len(batch))
+}
+
+// chatText lists a batch for chat messages, one line per notification,
+// with events in bold markup
+func chatText(batch []Notification, bold, newline string) string {
+	lines := make([]string, 0, len(batch)+1)
+	if len(batch) > 1 {
+		lines = append(lines, chatTitle(batch))
+	}
+	for _, note := range batch {
+		line := fmt.Sprintf("%s%s%s %s", bold, strings.ToUpper(strings.ReplaceAll(note.Event, "_", " ")), bold, note.Summary)
+		if note.URL != "" {
+			line += " (" + note.URL + ")"
+		}
+		if note.RequestID != "" {
+			line += " " + note.RequestID
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, newline)
+}
+
+// notifyAction notifies a block or warn applied to x, and a spending cap
+// the scan ran into
+func (p *pipeline) notifyAction(x *interception) {
+	if p.notifier == nil || x.result == nil {
+		return
+	}
+	host := spendHost(x.url)
+	if limit, ok := x.result.Metadata["budget_exceeded"].(string); ok {
+		key := EventBudgetExhausted + ":" + limit
+		if limit == "host" {
+			key += ":" + host
+		}
+		p.notifier.Notify(Notification{
+			Event:     EventBudgetExhausted,
+			Summary:   fmt.Sprintf("The %s scan budget is exhausted; budget.on_exceeded is %s", limit, p.config.Budget.OnExceeded),
+			Host:      host,
+			URL:       x.url,
+			RequestID: x.requestID,
+			Key:       key,
+		})
+	}
+
+	event := x.action
+	if event != EventBlock && event != EventWarn {
+		return
+	}
+	verb := "Blocked"
+	if event == EventWarn {
+		verb = "Warned on"
+	}
+	target := "response from"
+	if x.resp == nil {
+		target = "request to"
+	}
+	p.notifier.Notify(Notification{
+		Event:        event,
+		Summary:      fmt.Sprintf("%s %s %s: %s", verb, target, host, x.result.Reason),
+		Host:         host,
+		URL:          x.url,
+		Direction:    x.direction(),
+		Decision:     string(x.result.Decision),
+		Reason:       x.result.Reason,
+		ScanType:     x.scanType,
+		RequestID:    x.requestID,
+		Transport:    x.transport,
+		QuarantineID: x.quarantineID,
+	})
+}
+
+// failModeText describes what happens to content that cannot be scanned
+func failModeText(failOpen bool) string {
+	if failOpen {
+		return "passed unscanned"
+	}
+	return "blocked"
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+
+	"stronghold/internal/pii"
+)
+
+// PIIConfig configures the personal data detectors run on outbound request
+// bodies. Each category is allow, redact or block; empty follows the
+// default policy.
+type PIIConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Email      string `yaml:"email"`       // Default redact
+	Phone      string `yaml:"phone"`       // Default redact
+	NationalID string `yaml:"national_id"` // US SSNs and UK NI numbers; default block
+	Card       string `yaml:"card"`        // Luhn-valid card numbers; default block
+	IBAN       string `yaml:"iban"`        // Default block
+	Address    string `yaml:"address"`     // Street addresses; default redact
+}
+
+// Policy returns the configured actions by category
+func (c PIIConfig) Policy() pii.Policy {
+	policy := pii.Policy{}
+	for category, action := range map[string]string{
+		pii.Email:      c.Email,
+		pii.Phone:      c.Phone,
+		pii.NationalID: c.NationalID,
+		pii.Card:       c.Card,
+		pii.IBAN:       c.IBAN,
+		pii.Address:    c.Address,
+	} {
+		if action != "" {
+			policy[category] = action
+		}
+	}
+	return policy
+}
+
+// piiStage checks text request bodies for personal data before anything
+// else reads them, the scanner included. A category the policy blocks
+// blocks the request; redacted categories are replaced in the body, which
+// is then forwarded and scanned as redacted.
+func piiStage(p *pipeline, x *interception) error {
+	if p.piiPolicy == nil || x.resp != nil || len(x.scanBody) == 0 || x.scanType == "canary" {
+		return nil
+	}
+	if !ShouldScanContentType(x.contentType) {
+		return nil
+	}
+
+	text := string(x.scanBody)
+	findings := pii.Find(text, p.piiPolicy)
+	if len(findings) == 0 {
+		return nil
+	}
+	result := piiResult(findings, x.url)
+	if result.Decision == DecisionBlock {
+		x.result = result
+		x.scanType = "pii"
+		return nil
+	}
+
+	redacted := []byte(pii.Redact(text, findings))
+	x.piiResult = result
+	if p.config.Shadow.Enabled {
+		// Forwarded as it is, but the scanner still never sees the data
+		x.scanBody = redacted
+		return nil
+	}
+	x.setBody(io.NopCloser(bytes.NewReader(redacted)), int64(len(redacted)))
+	x.header().Del("Content-Encoding")
+	x.body, x.scanBody = redacted, redacted
+	return nil
+}
+
+// piiResult is the verdict on a request body holding findings. The
+// threats locate the data without repeating it.
+func piiResult(findings []pii.Finding, sourceURL string) *ScanResult {
+	report := pii.Describe(findings)
+	threats := make([]Threat, len(report.Threats))
+	for i, threat := range report.Threats {
+		threats[i] = Threat{
+			Category:    "pii",
+			Pattern:     threat.Category,
+			Location:    threat.Location,
+			Severity:    threat.Severity,
+			Description: threat.Description,
+		}
+	}
+
+	result := &ScanResult{
+		Decision:     DecisionWarn,
+		Scores:       map[string]float64{"pii_findings": float64(len(findings))},
+		Reason:       report.Reason,
+		ThreatsFound: threats,
+		Metadata: map[string]interface{}{
+			"source_url": sourceURL,
+			"detection":  "pii",
+		},
+	}
+	if report.Block {
+		result.Decision = DecisionBlock
+		result.RecommendedAction = "DO NOT PROCEED - The request carries personal data the PII policy blocks."
+	}
+	return result
+}
+
+// mergePIIResult reports personal data redacted from the request body in
+// the scan result, or as the result when the scan found nothing
+func mergePIIResult(x *interception) {
+	if x.piiResult == nil {
+		return
+	}
+	if x.result == nil || x.result.Decision == DecisionAllow {
+		x.result = x.piiResult
+		return
+	}
+	x.result.ThreatsFound = append(x.result.ThreatsFound, x.piiResult.ThreatsFound...)
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newPIITestServer returns a proxy server with PII detection on, in front
+// of an upstream recording the request bodies that reach it, and whose
+// scanner records the text it is sent. shadow turns on global shadow mode.
+func newPIITestServer(t *testing.T, shadow bool) (*Server, string, *[]string, *stubScanner) {
+	t.Helper()
+	var forwarded []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		forwarded = append(forwarded, string(body))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(upstream.Close)
+	scanner := newStubScanner(t, func(ScanRequest) ScanResult {
+		return ScanResult{Decision: DecisionAllow}
+	})
+
+	config := newTestConfig(scanner.URL)
+	config.Scanning.PII = PIIConfig{Enabled: true, Phone: "allow"}
+	if shadow {
+		config.Shadow = ShadowConfig{Enabled: true, File: filepath.Join(t.TempDir(), "shadow.jsonl")}
+	}
+	return newTestServer(t, config), upstream.URL, &forwarded, scanner
+}
+
+func TestPII_BlocksCardNumbers(t *testing.T) {
+	s, upstream, forwarded, scanner := newPIITestServer(t, false)
+
+	req := httptest.NewRequest("POST", upstream+"/orders", strings.NewReader(`{"card":"4111 1111 1111 1111"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-Stronghold-Scan-Type"); got != "pii" {
+		t.Errorf("expected scan type pii, got %q", got)
+	}
+	if scanned := scanner.Texts(""); len(*forwarded) != 0 || len(scanned) != 0 {
+		t.Errorf("expected the body to reach neither upstream nor the scanner, got %q and %q", *forwarded, scanned)
+	}
+	if strings.Contains(rec.Body.String(), "4111") {
+		t.Errorf("the block response should not repeat the card number: %s", rec.Body.String())
+	}
+}
+
+func TestPII_RedactsBeforeForwardingAndScanning(t *testing.T) {
+	s, upstream, forwarded, scanner := newPIITestServer(t, false)
+
+	req := httptest.NewRequest("POST", upstream+"/notes", strings.NewReader(`{"note":"mail jane@example.com or call (555) 123-4567"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	scanned := scanner.Texts("")
+	if len(scanned) != 1 {
+		t.Fatalf("expected the redacted body to be scanned once, got %q", scanned)
+	}
+	want := `{"note":"mail [REDACTED_EMAIL] or call (555) 123-4567"}`
+	if len(*forwarded) != 1 || (*forwarded)[0] != want {
+		t.Errorf("expected the redacted body upstream, got %q", *forwarded)
+	}
+	for _, text := range scanned {
+		if strings.Contains(text, "jane@example.com") {
+			t.Errorf("the scanner was sent the email address: %q", text)
+		}
+	}
+}
+
+func TestPII_ShadowForwardsUnredacted(t *testing.T) {
+	s, upstream, forwarded, scanner := newPIITestServer(t, true)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", upstream+"/notes", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	redacted := `{"note":"mail jane@example.com"}`
+	if rec := send(redacted); rec.Code != http.StatusOK {
+		t.Fatalf("expected a would-be redaction to be forwarded, got %d", rec.Code)
+	}
+	if scanned := scanner.Texts(""); len(scanned) != 1 || strings.Contains(scanned[0], "jane@example.com") {
+		t.Errorf("expected the scanner to see the redacted body only, got %q", scanned)
+	}
+
+	blocked := `{"card":"4111 1111 1111 1111"}`
+	rec := send(blocked)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected a would-be block to be forwarded, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-Stronghold-Shadow-Request-Action"); got != "block" {
+		t.Errorf("expected the would-be block reported, got %q", got)
+	}
+
+	if len(*forwarded) != 2 || (*forwarded)[0] != redacted || (*forwarded)[1] != blocked {
+		t.Errorf("expected the original bodies upstream, got %q", *forwarded)
+	}
+}
@@ -0,0 +1,711 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"stronghold/internal/mcptext"
+	"stronghold/internal/pii"
+)
+
+// interception is one request and its response moving through the pipeline.
+// The request is inspected first; once forwarded, the same stages run again
+// on the upstream response.
+type interception struct {
+	transport string // "http", "mitm", "icap" or "ext_authz"
+	url       string
+	req       *http.Request
+	requestID string
+	start     time.Time
+	flow      *captureFlow
+
+	resp         *http.Response // Upstream response; nil while the request is inspected
+	contentType  string
+	readLimit    int64  // Body bytes buffered for scanning
+	readBody     bool   // Buffer the body even when it is not scanned
+	body         []byte // Body as received, kept for quarantine and forwarding
+	scanBody     []byte // Body with any Content-Encoding undone
+	scanType     string // Reported in X-Stronghold-Scan-Type; scanning stops once set
+	result       *ScanResult
+	action       string
+	holdStatus   string // Outcome of a hold for a human decision; "" when not held
+	shadow       bool   // Policy is evaluated but not enforced; action stays "allow"
+	shadowAction string // Action policy would have taken in shadow mode
+	shadowPrior  string // Would-be action on the request, reported on its response
+	quarantineID string
+	reply        *http.Response // Sent to the client in place of forwarding
+
+	mcpRequest bool              // The request body is an MCP JSON-RPC message
+	mcpTools   map[string]string // Tools called by the request, by JSON-RPC id
+	mcp        *mcptext.Message  // The response as MCP; nil when it is not
+
+	llm         llmProvider  // Provider profile of an LLM API call; "" when none applies
+	llmMessages []llmMessage // Parts of the LLM API call scanned one by one
+
+	canaries  []Canary    // Active canaries, matched in the request
+	piiResult *ScanResult // Personal data redacted from the request body; nil when none
+
+	hostSeen bool // The destination host was recorded
+	newHost  bool // First contact with the destination host was flagged
+}
+
+// direction names the side being inspected, for logs
+func (x *interception) direction() string {
+	if x.resp != nil {
+		return "response"
+	}
+	return "request"
+}
+
+// ruleDirection returns the local rule direction of the side being
+// inspected: responses come in to the agent, requests go out
+func (x *interception) ruleDirection() string {
+	if x.resp != nil {
+		return RuleInbound
+	}
+	return RuleOutbound
+}
+
+// header returns the headers of the side being inspected
+func (x *interception) header() http.Header {
+	if x.resp != nil {
+		return x.resp.Header
+	}
+	return x.req.Header
+}
+
+// bodyReader returns the body of the side being inspected
+func (x *interception) bodyReader() io.ReadCloser {
+	if x.resp != nil {
+		return x.resp.Body
+	}
+	return x.req.Body
+}
+
+// setBody replaces the body of the side being inspected. A negative length
+// leaves the original framing in place.
+func (x *interception) setBody(body io.ReadCloser, length int64) {
+	if x.resp != nil {
+		x.resp.Body = body
+		if length >= 0 {
+			x.resp.ContentLength = length
+			x.resp.TransferEncoding = nil
+		}
+		return
+	}
+	x.req.Body = body
+	if length >= 0 {
+		x.req.ContentLength = length
+	}
+}
+
+// stage is one step of the pipeline. Returning an error abandons the
+// interception and the transport answers 502.
+type stage func(p *pipeline, x *interception) error
+
+// pipeline inspects intercepted traffic the same way whichever transport it
+// arrived on, so plain HTTP and MITM share policy, scanning, actions and
+// headers.
+type pipeline struct {
+	config     *Config
+	scanner    *ScannerClient
+	logger     *slog.Logger
+	quarantine *QuarantineStore
+	stats      *StatsStore
+	rules      *RuleSet           // Local rules evaluated before the remote scan; may be nil
+	canaries   *CanaryStore       // Canary credentials blocked in requests; may be nil
+	piiPolicy  pii.Policy         // Applied to request bodies; nil when PII detection is off
+	hosts      *HostStore         // Destination hosts; may be nil
+	notifier   *Notifier          // Delivers notifications of actions taken; may be nil
+	holds      *HoldStore         // Content held for a human decision; may be nil
+	shadow     *ShadowLog         // Would-be actions in shadow mode; may be nil
+	onDecision func(Decision)     // Counts scan decisions; may be nil
+	llmScanned *llmScannedResults // Tool results of LLM API calls that scanned clean
+
+	request  []stage // Run before the request is forwarded
+	response []stage // Run on the upstream response
+}
+
+func newPipeline(config *Config, scanner *ScannerClient, logger *slog.Logger) *pipeline {
+	return &pipeline{
+		config:     config,
+		scanner:    scanner,
+		logger:     logger,
+		llmScanned: newLLMScannedResults(),
+		request:    []stage{requestPolicyStage, decodeStage, canaryStage, piiStage, hostStage, mcpStage, llmStage, scanStage, actStage, annotateStage, recordStage},
+		response:   []stage{responsePolicyStage, hostStage, decodeStage, mcpStage, llmStage, scanStage, actStage, annotateStage, recordStage},
+	}
+}
+
+// begin starts an interception of req
+func (p *pipeline) begin(req *http.Request, url, transport string, start time.Time, flow *captureFlow) *interception {
+	return &interception{
+		transport: transport,
+		url:       url,
+		req:       req,
+		requestID: generateRequestID(),
+		start:     start,
+		flow:      flow,
+	}
+}
+
+// handleRequest inspects the request body. It returns the response to send
+// instead of forwarding, or nil when the request may go upstream.
+func (p *pipeline) handleRequest(x *interception) (*http.Response, error) {
+	if err := p.run(p.request, x); err != nil {
+		return nil, err
+	}
+	return x.reply, nil
+}
+
+// handleResponse inspects resp and returns what to send to the client:
+// resp itself, annotated, or a replacement when it was blocked
+func (p *pipeline) handleResponse(x *interception, resp *http.Response) (*http.Response, error) {
+	x.resp = resp
+	x.contentType = ""
+	x.readLimit = 0
+	x.readBody = false
+	x.body, x.scanBody = nil, nil
+	x.scanType = ""
+	x.result = nil
+	x.action = ""
+	x.reply = nil
+	x.mcp = nil
+	x.llmMessages = nil
+	x.piiResult = nil
+	x.holdStatus = ""
+	x.shadowPrior, x.shadow, x.shadowAction = x.shadowAction, false, ""
+
+	if err := p.run(p.response, x); err != nil {
+		return nil, err
+	}
+	if x.reply != nil {
+		return x.reply, nil
+	}
+	return resp, nil
+}
+
+func (p *pipeline) run(stages []stage, x *interception) error {
+	for _, st := range stages {
+		if err := st(p, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requestPolicyStage decides whether a request body is scanned
+func requestPolicyStage(p *pipeline, x *interception) error {
+	x.llm = p.llmProviderFor(x.req)
+	x.canaries = p.canaries.active()
+	if x.req.Body == nil || x.req.Body == http.NoBody || x.req.ContentLength == 0 {
+		x.scanType = "skipped-not-scannable"
+		return nil
+	}
+	x.contentType = x.req.Header.Get("Content-Type")
+	x.readLimit = maxScanBodySize
+	// Canaries and personal data are looked for in bodies that are not
+	// scanned too
+	x.readBody = len(x.canaries) > 0 || p.piiPolicy != nil
+	if !p.config.Scanning.Content.Enabled {
+		x.scanType = "disabled"
+	} else if !shouldScanResponse(&p.config.Scanning, x.contentType) {
+		x.scanType = "skipped-unscannable"
+	}
+	return nil
+}
+
+// responsePolicyStage decides whether a response body is scanned, before
+// any of it is read so large binaries are streamed
+func responsePolicyStage(p *pipeline, x *interception) error {
+	x.contentType = x.resp.Header.Get("Content-Type")
+	x.readLimit = scanReadLimit(&p.config.Scanning, x.contentType)
+	if x.llm != "" && strings.Contains(strings.ToLower(x.contentType), "json") {
+		// Completions are checked by the output scan; streamed ones are not
+		// buffered and pass through below
+		if !p.config.Scanning.Output.Enabled {
+			x.scanType = "disabled"
+		}
+		return nil
+	}
+	if !p.config.Scanning.Content.Enabled {
+		x.scanType = "disabled"
+	} else if !shouldScanResponse(&p.config.Scanning, x.contentType) && !(x.mcpRequest && isEventStreamContentType(x.contentType)) {
+		// An MCP server answers a request with a stream that ends after the
+		// response; other event streams are left streaming
+		x.scanType = "skipped-unscannable"
+	}
+	return nil
+}
+
+// decodeStage buffers the body up to the read limit and undoes gzip or
+// deflate Content-Encoding for the scanner. Bodies over the limit are
+// forwarded unscanned, including the unread remainder.
+func decodeStage(p *pipeline, x *interception) error {
+	if x.scanType != "" && !x.readBody {
+		return nil
+	}
+
+	src := x.bodyReader()
+	body, err := io.ReadAll(io.LimitReader(src, x.readLimit+1))
+	if err != nil {
+		src.Close()
+		return fmt.Errorf("failed to read %s body: %w", x.direction(), err)
+	}
+	if int64(len(body)) > x.readLimit {
+		if x.scanType == "" {
+			x.scanType = "skipped-oversized"
+		}
+		x.setBody(struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), src), src}, -1)
+		return nil
+	}
+	src.Close()
+	x.body = body
+	x.setBody(io.NopCloser(bytes.NewReader(body)), int64(len(body)))
+
+	x.scanBody = body
+	encoding := strings.ToLower(strings.TrimSpace(x.header().Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || len(body) == 0 {
+		return nil
+	}
+	decoded, err := decodeContent(encoding, body, x.readLimit)
+	switch {
+	case errors.Is(err, errDecodedTooLarge):
+		if x.scanType == "" {
+			x.scanType = "skipped-oversized"
+		}
+	case err != nil:
+		p.logger.Debug("scanning encoded body as received", "url", x.url, "encoding", encoding, "error", err)
+	default:
+		x.scanBody = decoded
+	}
+	return nil
+}
+
+// errDecodedTooLarge means a body decodes to more than the read limit
+var errDecodedTooLarge = errors.New("decoded body exceeds scan limit")
+
+// decodeContent undoes a gzip or deflate Content-Encoding, refusing to
+// expand past limit
+func decodeContent(encoding string, body []byte, limit int64) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) > limit {
+		return nil, errDecodedTooLarge
+	}
+	return decoded, nil
+}
+
+// scanStage scans the decoded body. Content released from quarantine
+// passes without a scan.
+func scanStage(p *pipeline, x *interception) error {
+	if x.scanType != "" {
+		return nil
+	}
+	if len(x.scanBody) == 0 {
+		x.scanType = "skipped-not-scannable"
+		return nil
+	}
+	if x.resp != nil && p.quarantine != nil && p.quarantine.IsReleased(x.body) {
+		x.scanType = "released"
+		return nil
+	}
+
+	if x.llm != "" {
+		x.result = p.scanLLM(x)
+		x.scanType = "llm"
+		if x.result == nil {
+			x.scanType = "skipped-not-scannable"
+		}
+		return nil
+	}
+
+	x.result = p.scan(x.scanBody, x.url, x.contentType, x.ruleDirection(), x.mcpToolNames())
+	if x.result == nil {
+		x.scanType = "skipped-not-scannable"
+		return nil
+	}
+	x.scanType = scanTypeFor(x.contentType)
+	return nil
+}
+
+// actStage applies the configured action for the scan decision. Blocked
+// responses are quarantined and replaced by a 403. Completions of LLM API
+// calls follow the output scan's actions. With JSON sanitizing on, flagged
+// JSON is forwarded with the offending fields blanked instead. Requests
+// carrying a canary or personal data the PII policy blocks, and requests
+// to hosts held for approval, are always blocked; requests with redacted
+// personal data are reported as sanitized.
+func actStage(p *pipeline, x *interception) error {
+	mergePIIResult(x)
+	if x.result == nil {
+		x.action = "allow"
+		return nil
+	}
+	result := x.result
+	actions := p.config.Scanning.Content
+	if x.llm != "" && x.resp != nil {
+		actions = p.config.Scanning.Output
+	}
+	x.action = getAction(result.Decision, actions)
+
+	// Per-policy shadowing covers the policy's own actions; canaries,
+	// personal data and new hosts are only shadowed globally
+	forced := x.scanType == "canary" || x.scanType == "pii" || x.scanType == "new-host" || x.result == x.piiResult
+	x.shadow = p.config.Shadow.Enabled || (actions.Shadow && !forced)
+
+	if x.scanType == "canary" || x.scanType == "pii" || x.scanType == "new-host" {
+		x.action = "block"
+	} else if x.result == x.piiResult {
+		x.action = "sanitize"
+	} else if x.action == "hold" {
+		if !x.shadow {
+			x.action = p.holdForDecision(x)
+		}
+	} else if x.action != "allow" && p.config.Scanning.JSON.Sanitize && sanitizeJSON(x) {
+		x.action = "sanitize"
+	}
+	if x.shadow {
+		x.shadowAction, x.action = x.action, "allow"
+		p.recordShadow(x)
+	}
+	x.flow.setVerdict(result, x.action)
+
+	// Counters follow the decision, not the configured action
+	if p.onDecision != nil {
+		p.onDecision(result.Decision)
+	}
+
+	switch x.action {
+	case "block":
+		p.logger.Warn("content blocked", "url", x.url, "direction", x.direction(), "reason", result.Reason, "decision", result.Decision)
+		if x.resp != nil {
+			x.quarantineID = quarantineBlocked(p.quarantine, p.logger, QuarantineEntry{
+				URL:         x.url,
+				Method:      x.req.Method,
+				StatusCode:  x.resp.StatusCode,
+				ContentType: x.contentType,
+				RequestID:   x.requestID,
+				Transport:   x.transport,
+				ScanResult:  result,
+			}, x.body)
+		}
+		x.reply = p.blockResponse(x)
+	case "sanitize":
+		p.logger.Warn("content sanitized", "url", x.url, "direction", x.direction(), "fields", offendingFields(result), "reason", result.Reason, "decision", result.Decision)
+	case "warn":
+		p.logger.Warn("content warned", "url", x.url, "direction", x.direction(), "reason", result.Reason, "decision", result.Decision)
+	default: // "allow"
+		p.logger.Debug("content allowed despite scan result", "url", x.url, "direction", x.direction(), "decision", result.Decision)
+	}
+	p.notifyAction(x)
+	return nil
+}
+
+// annotateStage sets the X-Stronghold headers on whatever is sent to the
+// client. Nothing is annotated for a request that is forwarded.
+func annotateStage(p *pipeline, x *interception) error {
+	out := x.reply
+	if out == nil {
+		out = x.resp
+	}
+	if out == nil {
+		return nil
+	}
+
+	h := out.Header
+	h.Set("X-Stronghold-Proxy", x.transport)
+	h.Set("X-Stronghold-Request-ID", x.requestID)
+	h.Set("X-Stronghold-Scan-Latency", fmt.Sprintf("%dms", time.Since(x.start).Milliseconds()))
+	h.Set("X-Stronghold-Scan-Type", x.scanType)
+	h.Set("X-Stronghold-Action", x.action)
+	if breaker, ok := p.scanner.Breaker(); ok {
+		h.Set("X-Stronghold-Breaker", breaker.State)
+	}
+
+	// Upstream servers cannot supply verdict headers of their own
+	h.Del("X-Stronghold-Reason")
+	h.Del("X-Stronghold-Score")
+	h.Del("X-Stronghold-Warning")
+	h.Del("X-Stronghold-Quarantine-ID")
+	h.Del("X-Stronghold-Messages")
+	h.Del("X-Stronghold-Sanitized")
+	h.Del("X-Stronghold-Fields")
+	h.Del("X-Stronghold-New-Host")
+	h.Del("X-Stronghold-Hold")
+	h.Del("X-Stronghold-Shadow-Action")
+	h.Del("X-Stronghold-Shadow-Request-Action")
+	if x.shadow {
+		h.Set("X-Stronghold-Shadow-Action", x.shadowAction)
+	}
+	if x.shadowPrior != "" && x.shadowPrior != "allow" {
+		h.Set("X-Stronghold-Shadow-Request-Action", x.shadowPrior)
+	}
+	if x.newHost {
+		h.Set("X-Stronghold-New-Host", "true")
+	}
+	if x.holdStatus != "" {
+		h.Set("X-Stronghold-Hold", x.holdStatus)
+	}
+
+	if x.result == nil {
+		h.Set("X-Stronghold-Decision", string(DecisionAllow))
+		return nil
+	}
+	h.Set("X-Stronghold-Decision", string(x.result.Decision))
+	h.Set("X-Stronghold-Reason", x.result.Reason)
+	if score, ok := x.result.Scores["combined"]; ok {
+		h.Set("X-Stronghold-Score", fmt.Sprintf("%.2f", score))
+	} else if score, ok := x.result.Scores["heuristic"]; ok {
+		h.Set("X-Stronghold-Score", fmt.Sprintf("%.2f", score))
+	}
+	if x.action == "warn" {
+		h.Set("X-Stronghold-Warning", x.result.Reason)
+	}
+	if x.quarantineID != "" {
+		h.Set("X-Stronghold-Quarantine-ID", x.quarantineID)
+	}
+	if x.action == "sanitize" {
+		h.Set("X-Stronghold-Sanitized", "true")
+	}
+	if fields := offendingFields(x.result); len(fields) > 0 {
+		h.Set("X-Stronghold-Fields", strings.Join(fields, ", "))
+	}
+	if verdicts := llmVerdicts(x.result); len(verdicts) > 0 {
+		h.Set("X-Stronghold-Messages", llmVerdictHeader(verdicts))
+	}
+	return nil
+}
+
+// recordStage counts the interception in the traffic statistics. Each
+// request is counted once: when it is blocked, or when its response is
+// handled.
+func recordStage(p *pipeline, x *interception) error {
+	if x.resp == nil && x.reply == nil {
+		return nil
+	}
+	var decision Decision
+	if x.result != nil {
+		decision = x.result.Decision
+	}
+	p.stats.recordRequest(spendHost(x.url), decision, x.result == nil)
+	p.hosts.record(spendHost(x.url), decision)
+	return nil
+}
+
+// blockResponse builds the 403 sent in place of blocked content. A blocked
+// MCP response is answered with JSON-RPC errors instead.
+func (p *pipeline) blockResponse(x *interception) *http.Response {
+	if x.mcp != nil && len(x.mcp.IDs) > 0 {
+		return p.mcpErrorResponse(x)
+	}
+	body, _ := json.Marshal(struct {
+		Error             string       `json:"error"`
+		Reason            string       `json:"reason"`
+		URL               string       `json:"url"`
+		RequestID         string       `json:"request_id"`
+		RecommendedAction string       `json:"recommended_action"`
+		OffendingMembers  []string     `json:"offending_members,omitempty"`
+		OffendingFields   []string     `json:"offending_fields,omitempty"`
+		Messages          []llmVerdict `json:"messages,omitempty"`
+		QuarantineID      string       `json:"quarantine_id,omitempty"`
+	}{
+		Error:             "Content blocked by Stronghold security scan",
+		Reason:            x.result.Reason,
+		URL:               x.url,
+		RequestID:         x.requestID,
+		RecommendedAction: x.result.RecommendedAction,
+		OffendingMembers:  offendingMembers(x.result),
+		OffendingFields:   offendingFields(x.result),
+		Messages:          llmVerdicts(x.result),
+		QuarantineID:      x.quarantineID,
+	})
+
+	resp := &http.Response{
+		StatusCode:    http.StatusForbidden,
+		Status:        "403 Forbidden",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       x.req,
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	return resp
+}
+
+// scan sends content to the scanner, extracting documents and archives
+// first. Local rules for direction are evaluated before the remote scan.
+// mcpTools is non-nil for MCP responses, which the API scans item by item.
+// It returns nil when the content is not scannable or a failure is let
+// through by fail_open.
+func (p *pipeline) scan(body []byte, sourceURL, contentType, direction string, mcpTools map[string]string) *ScanResult {
+	// Archives are scanned member by member
+	if IsArchiveContentType(contentType) {
+		if !p.config.Scanning.Archives.Enabled {
+			return nil
+		}
+		return p.scanArchive(body, sourceURL, contentType, direction)
+	}
+
+	// Documents are scanned through their extracted text
+	if IsDocumentContentType(contentType) {
+		if !p.config.Scanning.Documents.Enabled {
+			return nil
+		}
+		text, err := ExtractDocumentText(contentType, body)
+		if err != nil {
+			p.logger.Error("document extraction error", "url", sourceURL, "error", err)
+			if p.config.Scanning.FailOpen {
+				return nil
+			}
+			return &ScanResult{
+				Decision:          DecisionBlock,
+				Reason:            "Document could not be parsed - blocking for safety",
+				RecommendedAction: "Retry the request",
+			}
+		}
+		if len(text) == 0 {
+			return nil
+		}
+		body = text
+	}
+
+	// HTML is stripped of scripts and styles before segmentation by the API
+	if isHTMLContentType(contentType) {
+		body = prepareHTML(body)
+	}
+
+	// Skip binary content
+	if IsBinaryContentType(contentType) && !IsDocumentContentType(contentType) {
+		return nil
+	}
+
+	// Skip if content is too large (> 1MB)
+	if len(body) > maxScanBodySize {
+		p.logger.Debug("skipping scan: content too large", "bytes", len(body))
+		return nil
+	}
+
+	// Check if we should scan this content type
+	if !ShouldScanContentType(contentType) && !IsDocumentContentType(contentType) && mcpTools == nil {
+		return nil
+	}
+
+	return p.check(body, sourceURL, direction, func(ctx context.Context) (*ScanResult, error) {
+		if mcpTools != nil {
+			return p.scanner.ScanMCP(ctx, body, sourceURL, contentType, mcpTools)
+		}
+		return p.scanner.ScanContent(ctx, body, sourceURL, contentType)
+	})
+}
+
+// scanOutput checks model output for leaked credentials, after the local
+// rules for direction
+func (p *pipeline) scanOutput(body []byte, sourceURL, direction string) *ScanResult {
+	if len(body) > maxScanBodySize {
+		p.logger.Debug("skipping output scan: content too large", "bytes", len(body))
+		return nil
+	}
+	return p.check(body, sourceURL, direction, func(ctx context.Context) (*ScanResult, error) {
+		return p.scanner.ScanOutput(ctx, body, sourceURL)
+	})
+}
+
+// check evaluates the local rules for direction on body and, unless one
+// blocks, makes the remote scan. A failed scan is let through or blocked
+// as fail_open says.
+func (p *pipeline) check(body []byte, sourceURL, direction string, remote func(ctx context.Context) (*ScanResult, error)) *ScanResult {
+	// A blocking local rule makes the paid remote scan unnecessary
+	matches := p.rules.Match(body, direction)
+	if decision, _ := ruleDecision(matches); decision == DecisionBlock {
+		return ruleResult(matches, sourceURL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := remote(ctx)
+	if errors.Is(err, ErrBreakerOpen) {
+		// Logged once when the breaker opened, not for every request
+		if p.config.Scanning.FailOpen {
+			return failOpenResult(matches, sourceURL)
+		}
+		result = &ScanResult{
+			Decision:          DecisionBlock,
+			Reason:            "Scanning API unavailable - blocking for safety",
+			RecommendedAction: "Retry the request later",
+		}
+		p.notifyFailClosed(sourceURL, result.Reason)
+	} else if err != nil {
+		p.logger.Error("scan error", "error", err)
+
+		// Fail open or closed based on configuration
+		if p.config.Scanning.FailOpen {
+			return failOpenResult(matches, sourceURL)
+		}
+		result = &ScanResult{
+			Decision:          DecisionBlock,
+			Reason:            "Scan failed - blocking for safety",
+			RecommendedAction: "Retry the request",
+		}
+		p.notifyFailClosed(sourceURL, result.Reason)
+	}
+
+	mergeRuleMatches(result, matches)
+	return result
+}
+
+// notifyFailClosed notifies that content was blocked unscanned. Further
+// failures are not notified within the quiet period.
+func (p *pipeline) notifyFailClosed(sourceURL, reason string) {
+	p.notifier.Notify(Notification{
+		Event:   EventFailClosed,
+		Summary: "Content is blocked unscanned while scans fail (scanning.fail_open is false): " + reason,
+		Host:    spendHost(sourceURL),
+		URL:     sourceURL,
+		Reason:  reason,
+		Key:     EventFailClosed,
+	})
+}
+
+// failOpenResult is the result for content the remote scan failed on when
+// failures are let through: whatever local rules found, or nil
+func failOpenResult(matches []RuleMatch, sourceURL string) *ScanResult {
+	if len(matches) == 0 {
+		return nil
+	}
+	return ruleResult(matches, sourceURL)
+}
@@ -0,0 +1,436 @@
+package proxy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QuarantineConfig controls the local store of blocked response bodies
+type QuarantineConfig struct {
+	Enabled       bool   `yaml:"enabled"`        // Keep blocked bodies for review
+	Dir           string `yaml:"dir"`            // Where quarantined bodies are stored
+	RetentionDays int    `yaml:"retention_days"` // Entries older than this are pruned
+	MaxEntries    int    `yaml:"max_entries"`    // Oldest entries are pruned beyond this count
+}
+
+// applyDefaultQuarantineConfig sets default values for QuarantineConfig if not already set
+func applyDefaultQuarantineConfig(cfg *QuarantineConfig) {
+	// If RetentionDays is zero, this is an old config without the quarantine section
+	if cfg.RetentionDays == 0 {
+		cfg.Enabled = true
+		cfg.RetentionDays = 30
+		cfg.MaxEntries = 1000
+	}
+}
+
+// ErrQuarantineNotFound is returned when no entry matches an ID
+var ErrQuarantineNotFound = errors.New("quarantine entry not found")
+
+const (
+	quarantineKeyFile      = "quarantine.key"
+	quarantineReleasedFile = "released.json"
+	quarantineMetaExt      = ".meta"
+	quarantineBodyExt      = ".body"
+)
+
+// QuarantineEntry describes a blocked response kept for review
+type QuarantineEntry struct {
+	ID          string      `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	URL         string      `json:"url"`
+	Method      string      `json:"method"`
+	StatusCode  int         `json:"status_code"`
+	ContentType string      `json:"content_type"`
+	Size        int         `json:"size"`
+	SHA256      string      `json:"sha256"`
+	RequestID   string      `json:"request_id,omitempty"`
+	Transport   string      `json:"transport"` // "http" or "mitm"
+	ScanResult  *ScanResult `json:"scan_result"`
+}
+
+// QuarantineStore keeps blocked bodies encrypted on disk. Bodies are
+// encrypted with AES-256-GCM under a key kept next to the store so that
+// malicious content is never sitting in plaintext where an agent or
+// indexer could read it.
+type QuarantineStore struct {
+	dir        string
+	aead       cipher.AEAD
+	retention  time.Duration
+	maxEntries int
+
+	mu            sync.Mutex
+	released      map[string]time.Time
+	releasedMtime time.Time
+	releasedSize  int64
+}
+
+// OpenQuarantine opens (creating if needed) the quarantine store in cfg.Dir
+func OpenQuarantine(cfg QuarantineConfig) (*QuarantineStore, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("quarantine directory is not configured")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+
+	key, err := loadOrCreateQuarantineKey(filepath.Join(cfg.Dir, quarantineKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return &QuarantineStore{
+		dir:        cfg.Dir,
+		aead:       aead,
+		retention:  time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		maxEntries: cfg.MaxEntries,
+	}, nil
+}
+
+func loadOrCreateQuarantineKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid quarantine key in %s", path)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read quarantine key: %w", err)
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate quarantine key: %w", err)
+	}
+	if err := os.WriteFile(path, key, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write quarantine key: %w", err)
+	}
+	return key, nil
+}
+
+// HashContent returns the hex SHA-256 used to identify quarantined content
+func HashContent(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Add stores a blocked body with its metadata and prunes old entries
+func (q *QuarantineStore) Add(entry QuarantineEntry, body []byte) (*QuarantineEntry, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate quarantine id: %w", err)
+	}
+	entry.ID = hex.EncodeToString(id)
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	entry.Size = len(body)
+	entry.SHA256 = HashContent(body)
+
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode quarantine entry: %w", err)
+	}
+
+	if err := q.writeEncrypted(entry.ID+quarantineBodyExt, body); err != nil {
+		return nil, err
+	}
+	if err := q.writeEncrypted(entry.ID+quarantineMetaExt, meta); err != nil {
+		os.Remove(filepath.Join(q.dir, entry.ID+quarantineBodyExt))
+		return nil, err
+	}
+
+	if _, err := q.Prune(); err != nil {
+		return &entry, err
+	}
+	return &entry, nil
+}
+
+// List returns all quarantined entries, newest first
+func (q *QuarantineStore) List() ([]QuarantineEntry, error) {
+	files, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine directory: %w", err)
+	}
+
+	var entries []QuarantineEntry
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), quarantineMetaExt) {
+			continue
+		}
+		entry, err := q.readMeta(strings.TrimSuffix(f.Name(), quarantineMetaExt))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+// Get returns an entry and its decrypted body. id may be a unique prefix.
+func (q *QuarantineStore) Get(id string) (*QuarantineEntry, []byte, error) {
+	fullID, err := q.resolve(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry, err := q.readMeta(fullID)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := q.readEncrypted(fullID + quarantineBodyExt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry, body, nil
+}
+
+// Delete removes an entry. id may be a unique prefix.
+func (q *QuarantineStore) Delete(id string) error {
+	fullID, err := q.resolve(id)
+	if err != nil {
+		return err
+	}
+	return q.remove(fullID)
+}
+
+// Release whitelists an entry's content hash so the same content passes
+// the proxy on its next fetch, then removes the entry from quarantine
+func (q *QuarantineStore) Release(id string) (*QuarantineEntry, error) {
+	entry, _, err := q.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	released, err := q.loadReleasedLocked()
+	if err != nil {
+		return nil, err
+	}
+	released[entry.SHA256] = time.Now().UTC()
+
+	data, err := json.MarshalIndent(released, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode released hashes: %w", err)
+	}
+	path := filepath.Join(q.dir, quarantineReleasedFile)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write released hashes: %w", err)
+	}
+
+	if err := q.remove(entry.ID); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// IsReleased reports whether content was released from quarantine
+func (q *QuarantineStore) IsReleased(body []byte) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	released, err := q.loadReleasedLocked()
+	if err != nil || len(released) == 0 {
+		return false
+	}
+	_, ok := released[HashContent(body)]
+	return ok
+}
+
+// loadReleasedLocked returns the released hashes, rereading the file only
+// when the CLI has changed it. Callers must hold q.mu.
+func (q *QuarantineStore) loadReleasedLocked() (map[string]time.Time, error) {
+	path := filepath.Join(q.dir, quarantineReleasedFile)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		q.released = make(map[string]time.Time)
+		q.releasedMtime = time.Time{}
+		q.releasedSize = 0
+		return q.released, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat released hashes: %w", err)
+	}
+	if q.released != nil && info.ModTime().Equal(q.releasedMtime) && info.Size() == q.releasedSize {
+		return q.released, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read released hashes: %w", err)
+	}
+	released := make(map[string]time.Time)
+	if err := json.Unmarshal(data, &released); err != nil {
+		return nil, fmt.Errorf("failed to parse released hashes: %w", err)
+	}
+	q.released = released
+	q.releasedMtime = info.ModTime()
+	q.releasedSize = info.Size()
+	return released, nil
+}
+
+// Prune removes entries past the retention period and the oldest entries
+// beyond the maximum count. It returns the number of entries removed.
+func (q *QuarantineStore) Prune() (int, error) {
+	files, err := os.ReadDir(q.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read quarantine directory: %w", err)
+	}
+
+	type stored struct {
+		id      string
+		modTime time.Time
+	}
+	var all []stored
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), quarantineMetaExt) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		all = append(all, stored{id: strings.TrimSuffix(f.Name(), quarantineMetaExt), modTime: info.ModTime()})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].modTime.After(all[j].modTime) })
+
+	removed := 0
+	cutoff := time.Now().Add(-q.retention)
+	for i, s := range all {
+		expired := q.retention > 0 && s.modTime.Before(cutoff)
+		overflow := q.maxEntries > 0 && i >= q.maxEntries
+		if !expired && !overflow {
+			continue
+		}
+		if err := q.remove(s.id); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// resolve expands a unique ID prefix to a full entry ID
+func (q *QuarantineStore) resolve(prefix string) (string, error) {
+	prefix = strings.TrimSpace(prefix)
+	if prefix == "" || strings.ContainsAny(prefix, `/\.`) {
+		return "", ErrQuarantineNotFound
+	}
+	files, err := os.ReadDir(q.dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read quarantine directory: %w", err)
+	}
+
+	var matches []string
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasSuffix(name, quarantineMetaExt) && strings.HasPrefix(name, prefix) {
+			matches = append(matches, strings.TrimSuffix(name, quarantineMetaExt))
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", ErrQuarantineNotFound
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("quarantine id %q is ambiguous (%d matches)", prefix, len(matches))
+	}
+}
+
+func (q *QuarantineStore) remove(id string) error {
+	for _, ext := range []string{quarantineMetaExt, quarantineBodyExt} {
+		if err := os.Remove(filepath.Join(q.dir, id+ext)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove quarantine entry: %w", err)
+		}
+	}
+	return nil
+}
+
+func (q *QuarantineStore) readMeta(id string) (*QuarantineEntry, error) {
+	data, err := q.readEncrypted(id + quarantineMetaExt)
+	if err != nil {
+		return nil, err
+	}
+	var entry QuarantineEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse quarantine entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// writeEncrypted seals data with a random nonce prefix
+func (q *QuarantineStore) writeEncrypted(name string, data []byte) error {
+	nonce := make([]byte, q.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := q.aead.Seal(nonce, nonce, data, []byte(name))
+	if err := os.WriteFile(filepath.Join(q.dir, name), sealed, 0600); err != nil {
+		return fmt.Errorf("failed to write quarantine file: %w", err)
+	}
+	return nil
+}
+
+func (q *QuarantineStore) readEncrypted(name string) ([]byte, error) {
+	sealed, err := os.ReadFile(filepath.Join(q.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrQuarantineNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine file: %w", err)
+	}
+	n := q.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, fmt.Errorf("quarantine file %s is corrupt", name)
+	}
+	data, err := q.aead.Open(nil, sealed[:n], sealed[n:], []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt quarantine file %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// quarantineBlocked stores a blocked body and returns its quarantine ID,
+// or "" when quarantine is disabled or the body could not be stored
+func quarantineBlocked(q *QuarantineStore, logger *slog.Logger, entry QuarantineEntry, body []byte) string {
+	if q == nil {
+		return ""
+	}
+	stored, err := q.Add(entry, body)
+	if err != nil {
+		logger.Error("failed to quarantine blocked content", "url", entry.URL, "error", err)
+		if stored == nil {
+			return ""
+		}
+	}
+	logger.Info("blocked content quarantined", "url", entry.URL, "quarantine_id", stored.ID)
+	return stored.ID
+}
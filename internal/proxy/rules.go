@@ -0,0 +1,386 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule types
+const (
+	RuleRegex   = "regex"   // Pattern is a regular expression
+	RuleKeyword = "keyword" // Any of Keywords appears as a word
+	RuleEntropy = "entropy" // A token looks random, such as a key or secret
+)
+
+// Rule directions
+const (
+	RuleInbound  = "inbound"  // Responses fetched by the agent
+	RuleOutbound = "outbound" // Request bodies sent by the agent
+	RuleBoth     = "both"
+)
+
+// Defaults for entropy rules
+const (
+	defaultRuleMinEntropy = 4.0
+	defaultRuleMinLength  = 24
+)
+
+// ruleSeverityScores map rule severities to a threat score
+var ruleSeverityScores = map[string]float64{
+	"low":      0.3,
+	"medium":   0.5,
+	"high":     0.8,
+	"critical": 1.0,
+}
+
+// RulesConfig points at the file of local detection rules
+type RulesConfig struct {
+	File string `yaml:"file"` // YAML rules file; no local rules if it does not exist
+}
+
+// Rule is a local detection rule from the rules file
+type Rule struct {
+	ID            string   `yaml:"id"`
+	Description   string   `yaml:"description"`
+	Type          string   `yaml:"type"`           // regex, keyword or entropy
+	Pattern       string   `yaml:"pattern"`        // For regex rules
+	Keywords      []string `yaml:"keywords"`       // For keyword rules
+	CaseSensitive bool     `yaml:"case_sensitive"` // Keyword rules match any case unless set
+	MinEntropy    float64  `yaml:"min_entropy"`    // For entropy rules, bits per character
+	MinLength     int      `yaml:"min_length"`     // For entropy rules, shortest token considered
+	Category      string   `yaml:"category"`
+	Severity      string   `yaml:"severity"`  // low, medium, high or critical
+	Direction     string   `yaml:"direction"` // inbound, outbound or both
+	Action        string   `yaml:"action"`    // allow, warn or block
+}
+
+// rulesFile is the content of the rules file
+type rulesFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// compiledRule is a Rule ready to match
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp // Regex and keyword rules
+}
+
+// RuleSet is the compiled local rules, evaluated before the remote scan
+type RuleSet struct {
+	rules []compiledRule
+}
+
+// RuleMatch is a rule that matched content
+type RuleMatch struct {
+	Rule   Rule
+	Offset int // Byte offset of the first match
+}
+
+// LoadRules reads and compiles the rules file at path. A missing file
+// yields no rules.
+func LoadRules(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &RuleSet{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	return ParseRules(data)
+}
+
+// ParseRules compiles rules from YAML
+func ParseRules(data []byte) (*RuleSet, error) {
+	var file rulesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+
+	set := &RuleSet{}
+	seen := make(map[string]bool)
+	for i, rule := range file.Rules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			if rule.ID == "" {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			return nil, fmt.Errorf("rule %q: %w", rule.ID, err)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("rule %q: duplicate id", rule.ID)
+		}
+		seen[rule.ID] = true
+		set.rules = append(set.rules, compiled)
+	}
+	return set, nil
+}
+
+// compileRule validates rule, fills in defaults and compiles its pattern
+func compileRule(rule Rule) (compiledRule, error) {
+	if rule.ID == "" {
+		return compiledRule{}, errors.New("id is required")
+	}
+	if rule.Category == "" {
+		rule.Category = "custom"
+	}
+	if rule.Severity == "" {
+		rule.Severity = "medium"
+	}
+	if _, ok := ruleSeverityScores[rule.Severity]; !ok {
+		return compiledRule{}, fmt.Errorf("invalid severity %q (must be low, medium, high or critical)", rule.Severity)
+	}
+	if rule.Direction == "" {
+		rule.Direction = RuleBoth
+	}
+	if rule.Direction != RuleInbound && rule.Direction != RuleOutbound && rule.Direction != RuleBoth {
+		return compiledRule{}, fmt.Errorf("invalid direction %q (must be inbound, outbound or both)", rule.Direction)
+	}
+	if rule.Action == "" {
+		rule.Action = "warn"
+	}
+	if rule.Action != "allow" && rule.Action != "warn" && rule.Action != "block" {
+		return compiledRule{}, fmt.Errorf("invalid action %q (must be allow, warn or block)", rule.Action)
+	}
+	if rule.Description == "" {
+		rule.Description = "Matched local rule " + rule.ID
+	}
+
+	compiled := compiledRule{Rule: rule}
+	switch rule.Type {
+	case RuleRegex:
+		if rule.Pattern == "" {
+			return compiledRule{}, errors.New("regex rules need a pattern")
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return compiledRule{}, fmt.Errorf("invalid pattern: %w", err)
+		}
+		compiled.re = re
+	case RuleKeyword:
+		if len(rule.Keywords) == 0 {
+			return compiledRule{}, errors.New("keyword rules need keywords")
+		}
+		compiled.re = keywordPattern(rule.Keywords, rule.CaseSensitive)
+	case RuleEntropy:
+		if compiled.MinEntropy == 0 {
+			compiled.MinEntropy = defaultRuleMinEntropy
+		}
+		if compiled.MinLength == 0 {
+			compiled.MinLength = defaultRuleMinLength
+		}
+	default:
+		return compiledRule{}, fmt.Errorf("invalid type %q (must be regex, keyword or entropy)", rule.Type)
+	}
+	return compiled, nil
+}
+
+// keywordPattern matches any of keywords as whole words
+func keywordPattern(keywords []string, caseSensitive bool) *regexp.Regexp {
+	alternatives := make([]string, 0, len(keywords))
+	for _, k := range keywords {
+		quoted := regexp.QuoteMeta(k)
+		// Word boundaries only apply next to word characters
+		if r := []rune(k); len(r) > 0 && isWordRune(r[0]) {
+			quoted = `\b` + quoted
+		}
+		if r := []rune(k); len(r) > 0 && isWordRune(r[len(r)-1]) {
+			quoted += `\b`
+		}
+		alternatives = append(alternatives, quoted)
+	}
+	pattern := "(?:" + strings.Join(alternatives, "|") + ")"
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.MustCompile(pattern)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || (r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)))
+}
+
+// Len returns the number of rules
+func (s *RuleSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.rules)
+}
+
+// Rules returns the rules with defaults filled in, in file order
+func (s *RuleSet) Rules() []Rule {
+	if s == nil {
+		return nil
+	}
+	rules := make([]Rule, 0, len(s.rules))
+	for _, r := range s.rules {
+		rules = append(rules, r.Rule)
+	}
+	return rules
+}
+
+// Match returns the rules for direction that match text
+func (s *RuleSet) Match(text []byte, direction string) []RuleMatch {
+	if s == nil {
+		return nil
+	}
+	var matches []RuleMatch
+	for _, rule := range s.rules {
+		if rule.Direction != RuleBoth && rule.Direction != direction {
+			continue
+		}
+		offset := -1
+		if rule.re != nil {
+			if loc := rule.re.FindIndex(text); loc != nil {
+				offset = loc[0]
+			}
+		} else {
+			offset = highEntropyToken(text, rule.MinLength, rule.MinEntropy)
+		}
+		if offset >= 0 {
+			matches = append(matches, RuleMatch{Rule: rule.Rule, Offset: offset})
+		}
+	}
+	return matches
+}
+
+// highEntropyToken returns the offset of the first token of at least
+// minLength characters whose Shannon entropy reaches minEntropy, or -1
+func highEntropyToken(text []byte, minLength int, minEntropy float64) int {
+	start := -1
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) && isTokenByte(text[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= minLength && shannonEntropy(text[start:i]) >= minEntropy {
+			return start
+		}
+		start = -1
+	}
+	return -1
+}
+
+// isTokenByte reports whether c can be part of a key, token or encoded secret
+func isTokenByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		c == '+' || c == '/' || c == '=' || c == '_' || c == '-'
+}
+
+// shannonEntropy returns the entropy of token in bits per character
+func shannonEntropy(token []byte) float64 {
+	var counts [256]int
+	for _, c := range token {
+		counts[c]++
+	}
+	var entropy float64
+	n := float64(len(token))
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// ruleThreats converts matches into threats, identified by rule ID
+func ruleThreats(matches []RuleMatch) []Threat {
+	threats := make([]Threat, 0, len(matches))
+	for _, m := range matches {
+		threats = append(threats, Threat{
+			Category:    m.Rule.Category,
+			Pattern:     m.Rule.ID,
+			Location:    fmt.Sprintf("offset %d", m.Offset),
+			Severity:    m.Rule.Severity,
+			Description: m.Rule.Description,
+		})
+	}
+	return threats
+}
+
+// ruleDecision returns the strongest decision the matched rules call for
+// and the match that set it. Rules with the allow action only report.
+func ruleDecision(matches []RuleMatch) (Decision, *RuleMatch) {
+	decision := DecisionAllow
+	var top *RuleMatch
+	for i := range matches {
+		m := &matches[i]
+		switch {
+		case m.Rule.Action == "block" && decision != DecisionBlock:
+			decision, top = DecisionBlock, m
+		case m.Rule.Action == "warn" && decision == DecisionAllow:
+			decision, top = DecisionWarn, m
+		}
+	}
+	return decision, top
+}
+
+// ruleIDs lists the IDs of matched rules
+func ruleIDs(matches []RuleMatch) []string {
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, m.Rule.ID)
+	}
+	return ids
+}
+
+// ruleResult builds the result for content matched by local rules without
+// a remote scan
+func ruleResult(matches []RuleMatch, sourceURL string) *ScanResult {
+	decision, top := ruleDecision(matches)
+	result := &ScanResult{
+		Decision:          decision,
+		Scores:            map[string]float64{},
+		Reason:            "Matched local rules",
+		RecommendedAction: "Content is safe to process",
+		ThreatsFound:      ruleThreats(matches),
+		Metadata: map[string]interface{}{
+			"source_url":  sourceURL,
+			"detection":   "rules",
+			"local_rules": ruleIDs(matches),
+		},
+	}
+	if top != nil {
+		result.Reason = fmt.Sprintf("Local rule %s: %s", top.Rule.ID, top.Rule.Description)
+		result.Scores["heuristic"] = ruleSeverityScores[top.Rule.Severity]
+		if decision == DecisionBlock {
+			result.RecommendedAction = "DO NOT PROCEED - Content matches an organization rule."
+		} else {
+			result.RecommendedAction = "Caution advised - Review content manually before processing."
+		}
+	}
+	return result
+}
+
+// mergeRuleMatches adds local rule matches to a remote scan result. The
+// decision is raised if a rule calls for a stronger one.
+func mergeRuleMatches(result *ScanResult, matches []RuleMatch) {
+	if result == nil || len(matches) == 0 {
+		return
+	}
+	result.ThreatsFound = append(result.ThreatsFound, ruleThreats(matches)...)
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	result.Metadata["local_rules"] = ruleIDs(matches)
+
+	decision, top := ruleDecision(matches)
+	if top == nil || decisionRank(decision) <= decisionRank(result.Decision) {
+		return
+	}
+	local := ruleResult(matches, "")
+	result.Decision = decision
+	result.Reason = local.Reason
+	result.RecommendedAction = local.RecommendedAction
+}
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net/http"
 	"time"
 
+	"stronghold/internal/usdc"
 	"stronghold/internal/wallet"
 )
 
@@ -28,6 +31,8 @@ type Threat struct {
 	Location    string `json:"location"`
 	Severity    string `json:"severity"`
 	Description string `json:"description"`
+	Tool        string `json:"tool,omitempty"`
+	CallID      string `json:"call_id,omitempty"`
 }
 
 // ScanResult represents the result of a security scan
@@ -45,10 +50,11 @@ type ScanResult struct {
 
 // ScanRequest represents a scan request
 type ScanRequest struct {
-	Text        string `json:"text"`
-	SourceURL   string `json:"source_url,omitempty"`
-	SourceType  string `json:"source_type,omitempty"`
-	ContentType string `json:"content_type,omitempty"`
+	Text        string            `json:"text"`
+	SourceURL   string            `json:"source_url,omitempty"`
+	SourceType  string            `json:"source_type,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	MCPTools    map[string]string `json:"mcp_tools,omitempty"` // Tool names by JSON-RPC id, so threats in MCP tool results name their tool
 }
 
 // X402Wallet defines the interface for x402 payment creation
@@ -65,6 +71,12 @@ type ScannerClient struct {
 	wallet         X402Wallet // EVM wallet (Base)
 	solanaWallet   X402Wallet // Solana wallet
 	facilitatorURL string
+	budget         *SpendLedger
+	blockThreshold float64 // Used by the local scan when the budget is exhausted
+	batcher        *scanBatcher
+	session        *prepaidSession
+	stats          *StatsStore
+	breaker        *circuitBreaker
 }
 
 // NewScannerClient creates a new scanner client
@@ -97,111 +109,329 @@ func (c *ScannerClient) SetSolanaWallet(w X402Wallet) {
 	c.solanaWallet = w
 }
 
+// SetBudget sets the ledger that caps x402 spending. blockThreshold is
+// used by the local scan fallback.
+func (c *ScannerClient) SetBudget(l *SpendLedger, blockThreshold float64) {
+	c.budget = l
+	c.blockThreshold = blockThreshold
+}
+
+// SetStats counts x402 payments in the traffic statistics
+func (c *ScannerClient) SetStats(s *StatsStore) {
+	c.stats = s
+}
+
+// SetBreaker stops calling the API for a while after repeated failures,
+// so scans fail fast instead of each waiting for a timeout. onChange, if
+// not nil, is called whenever the breaker changes state.
+func (c *ScannerClient) SetBreaker(cfg BreakerConfig, onChange func(BreakerState)) {
+	c.breaker = newCircuitBreaker(cfg, onChange)
+}
+
+// Breaker returns the state of the circuit breaker, and false if there is none
+func (c *ScannerClient) Breaker() (BreakerState, bool) {
+	if c.breaker == nil {
+		return BreakerState{}, false
+	}
+	return c.breaker.snapshot(), true
+}
+
+// SetBatching coalesces concurrent small content scans into batch requests
+func (c *ScannerClient) SetBatching(cfg BatchConfig) {
+	c.batcher = newScanBatcher(c, cfg)
+}
+
+// SetSession pays for scans from prepaid sessions opened with a deposit of
+// cfg.Deposit, instead of paying for each scan
+func (c *ScannerClient) SetSession(cfg SessionConfig) {
+	c.session = newPrepaidSession(c, cfg)
+}
+
 // ScanContent scans external content for prompt injection attacks
 func (c *ScannerClient) ScanContent(ctx context.Context, content []byte, sourceURL, contentType string) (*ScanResult, error) {
-	req := ScanRequest{
+	return c.scanContent(ctx, content, ScanRequest{
 		Text:        string(content),
 		SourceURL:   sourceURL,
 		SourceType:  "http_proxy",
 		ContentType: contentType,
+	})
+}
+
+// ScanMCP scans an MCP message, which the API scores item by item. tools
+// names the tool called by each JSON-RPC id.
+func (c *ScannerClient) ScanMCP(ctx context.Context, content []byte, sourceURL, contentType string, tools map[string]string) (*ScanResult, error) {
+	return c.scanContent(ctx, content, ScanRequest{
+		Text:        string(content),
+		SourceURL:   sourceURL,
+		SourceType:  "http_proxy",
+		ContentType: contentType,
+		MCPTools:    tools,
+	})
+}
+
+// ScanOutputRequest is the request body of an output scan
+type ScanOutputRequest struct {
+	Text string `json:"text"`
+}
+
+// ScanOutput scans model output for leaked credentials. Output scans are
+// not batched; the batch endpoint only scans content.
+func (c *ScannerClient) ScanOutput(ctx context.Context, content []byte, sourceURL string) (*ScanResult, error) {
+	result, err := c.scanWithPayment(ctx, "/v1/scan/output", spendHost(sourceURL), ScanOutputRequest{Text: string(content)})
+
+	var exceeded *BudgetExceededError
+	if errors.As(err, &exceeded) {
+		return c.budgetFallback(content, sourceURL, exceeded, LocalOutputScan), nil
+	}
+	return result, err
+}
+
+// scanContent sends req to the content endpoint, batched when possible
+func (c *ScannerClient) scanContent(ctx context.Context, content []byte, req ScanRequest) (*ScanResult, error) {
+	sourceURL := req.SourceURL
+	var result *ScanResult
+	var err error
+	if c.batcher.accepts(len(content)) {
+		result, err = c.batcher.submit(ctx, req, spendHost(sourceURL))
+	} else {
+		result, err = c.scanWithPayment(ctx, "/v1/scan/content", spendHost(sourceURL), req)
 	}
 
-	return c.scanWithPayment(ctx, "/v1/scan/content", req)
+	var exceeded *BudgetExceededError
+	if errors.As(err, &exceeded) {
+		return c.budgetFallback(content, sourceURL, exceeded, LocalScan), nil
+	}
+	return result, err
 }
 
-// scanWithPayment performs a scan request with automatic x402 payment handling
-func (c *ScannerClient) scanWithPayment(ctx context.Context, endpoint string, reqBody interface{}) (*ScanResult, error) {
-	// Try the request first (might already have credit or in dev mode)
-	result, statusCode, paymentReq, err := c.scan(ctx, endpoint, reqBody, "")
+// budgetFallback returns the result used in place of a scan the budget
+// could not pay for. local is the local stand-in for the kind of scan.
+func (c *ScannerClient) budgetFallback(content []byte, sourceURL string, exceeded *BudgetExceededError, local func([]byte, string, float64) *ScanResult) *ScanResult {
+	switch c.budget.OnExceeded() {
+	case BudgetFailOpen:
+		return &ScanResult{
+			Decision: DecisionAllow,
+			Reason:   "Not scanned: " + exceeded.Error(),
+			Metadata: map[string]interface{}{"budget_exceeded": exceeded.Limit},
+		}
+	case BudgetFailClosed:
+		return &ScanResult{
+			Decision:          DecisionBlock,
+			Reason:            "Blocked unscanned: " + exceeded.Error(),
+			RecommendedAction: "Raise the budget with 'stronghold config set budget.daily_limit' or wait for it to reset",
+			Metadata:          map[string]interface{}{"budget_exceeded": exceeded.Limit},
+		}
+	default:
+		result := local(content, sourceURL, c.blockThreshold)
+		result.Metadata["budget_exceeded"] = exceeded.Limit
+		return result
+	}
+}
+
+// scanWithPayment performs a scan request with automatic x402 payment handling.
+// Payments are attributed to host in the spend ledger.
+func (c *ScannerClient) scanWithPayment(ctx context.Context, endpoint, host string, reqBody interface{}) (*ScanResult, error) {
+	// Try the request first (might already have credit, a prepaid session or be in dev mode)
+	token, charged, err := c.chargeHost(c.session.current(), endpoint, host)
+	if err != nil {
+		return nil, err
+	}
+	result, statusCode, paymentReq, err := c.scan(ctx, endpoint, reqBody, sessionHeaders(token))
+	if statusCode != http.StatusOK {
+		c.refundHost(host, charged)
+	}
 
 	// If successful or error other than 402, return immediately
 	if err != nil || statusCode != http.StatusPaymentRequired {
 		return result, err
 	}
+	c.session.drop(token)
+	if paymentReq != nil {
+		if price, err := paymentAmount(paymentReq); err == nil {
+			c.session.setPrice(endpoint, price)
+		}
+	}
+
+	// Open a new session rather than paying for this scan alone
+	if token, ok := c.session.open(ctx); ok {
+		token, charged, err := c.chargeHost(token, endpoint, host)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			result, statusCode, _, err = c.scan(ctx, endpoint, reqBody, sessionHeaders(token))
+			if statusCode != http.StatusOK {
+				c.refundHost(host, charged)
+			}
+			if err != nil || statusCode != http.StatusPaymentRequired {
+				return result, err
+			}
+			c.session.drop(token)
+		}
+	}
 
 	// Handle 402 Payment Required
 	if paymentReq == nil {
 		return nil, fmt.Errorf("payment required but no requirements received")
 	}
 
-	// Select wallet based on network
-	selectedWallet := c.wallet
-	if wallet.IsSolanaNetwork(paymentReq.Network) {
-		selectedWallet = c.solanaWallet
+	selectedWallet, err := c.walletFor(paymentReq)
+	if err != nil {
+		return nil, err
 	}
 
-	if selectedWallet == nil {
-		return nil, fmt.Errorf("payment required but no wallet configured for network %s. Run 'stronghold wallet list' or 'stronghold wallet balance' to check wallet status, or visit https://getstronghold.xyz/dashboard to add funds", paymentReq.Network)
+	// Reserve the payment against the budget before signing it
+	amount, err := c.reserve(host, paymentReq)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create x402 payment
 	paymentHeader, err := selectedWallet.CreateX402Payment(paymentReq)
 	if err != nil {
+		c.refund(host, amount)
 		return nil, fmt.Errorf("failed to create payment: %w", err)
 	}
 
 	// Retry with payment
-	result, statusCode, _, err = c.scan(ctx, endpoint, reqBody, paymentHeader)
+	result, statusCode, _, err = c.scan(ctx, endpoint, reqBody, paymentHeaders(paymentHeader))
 	if err != nil {
 		return nil, err
 	}
 
 	if statusCode == http.StatusPaymentRequired {
+		c.refund(host, amount)
 		return nil, fmt.Errorf("payment was rejected - insufficient funds or invalid payment. Check your balance with 'stronghold wallet balance'")
 	}
 
 	return result, nil
 }
 
+// reserve records the payment in paymentReq against the budget for host
+// and in the traffic statistics. It returns a *BudgetExceededError when the payment does not fit.
+func (c *ScannerClient) reserve(host string, paymentReq *wallet.PaymentRequirements) (usdc.MicroUSDC, error) {
+	if c.budget == nil && c.stats == nil {
+		return 0, nil
+	}
+	amount, err := paymentAmount(paymentReq)
+	if err != nil {
+		return 0, err
+	}
+	if c.budget != nil {
+		var exceeded *BudgetExceededError
+		if err := c.budget.Reserve(host, amount); errors.As(err, &exceeded) {
+			return 0, err
+		}
+	}
+	c.stats.recordSpend(host, amount)
+	return amount, nil
+}
+
+// paymentAmount returns the amount paymentReq asks for
+func paymentAmount(paymentReq *wallet.PaymentRequirements) (usdc.MicroUSDC, error) {
+	onChain, ok := new(big.Int).SetString(paymentReq.Amount, 10)
+	if !ok {
+		return 0, fmt.Errorf("invalid payment amount: %s", paymentReq.Amount)
+	}
+	return usdc.FromBigInt(onChain, paymentReq.Network), nil
+}
+
+// walletFor selects the wallet that pays on the requested network
+func (c *ScannerClient) walletFor(paymentReq *wallet.PaymentRequirements) (X402Wallet, error) {
+	selectedWallet := c.wallet
+	if wallet.IsSolanaNetwork(paymentReq.Network) {
+		selectedWallet = c.solanaWallet
+	}
+
+	if selectedWallet == nil {
+		return nil, fmt.Errorf("payment required but no wallet configured for network %s. Run 'stronghold wallet list' or 'stronghold wallet balance' to check wallet status, or visit https://getstronghold.xyz/dashboard to add funds", paymentReq.Network)
+	}
+	return selectedWallet, nil
+}
+
+// refund releases a reservation for a payment that was not made
+func (c *ScannerClient) refund(host string, amount usdc.MicroUSDC) {
+	if amount <= 0 {
+		return
+	}
+	if c.budget != nil {
+		c.budget.Refund(host, amount)
+	}
+	c.stats.recordSpend(host, -amount)
+}
+
 // scan performs the actual scan request
 // Returns: result, statusCode, paymentRequirements (if 402), error
-func (c *ScannerClient) scan(ctx context.Context, endpoint string, reqBody interface{}, paymentHeader string) (*ScanResult, int, *wallet.PaymentRequirements, error) {
+func (c *ScannerClient) scan(ctx context.Context, endpoint string, reqBody interface{}, headers map[string]string) (*ScanResult, int, *wallet.PaymentRequirements, error) {
+	var result ScanResult
+	statusCode, paymentReq, err := c.post(ctx, endpoint, reqBody, headers, &result)
+	if err != nil || statusCode != http.StatusOK {
+		return nil, statusCode, paymentReq, err
+	}
+	return &result, statusCode, nil, nil
+}
+
+// paymentHeaders returns the headers that carry a signed x402 payment
+func paymentHeaders(paymentHeader string) map[string]string {
+	return map[string]string{"X-Payment": paymentHeader}
+}
+
+// post sends a request to the API and decodes a 200 or 201 response into out
+// Returns: statusCode, paymentRequirements (if 402), error
+func (c *ScannerClient) post(ctx context.Context, endpoint string, reqBody interface{}, headers map[string]string, out interface{}) (int, *wallet.PaymentRequirements, error) {
 	url := c.baseURL + endpoint
 
 	body, err := json.Marshal(reqBody)
 	if err != nil {
-		return nil, 0, nil, fmt.Errorf("failed to marshal request: %w", err)
+		return 0, nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
-		return nil, 0, nil, fmt.Errorf("failed to create request: %w", err)
+		return 0, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	if c.token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
-	if paymentHeader != "" {
-		req.Header.Set("X-Payment", paymentHeader)
+	for name, value := range headers {
+		req.Header.Set(name, value)
 	}
 
+	probe, err := c.breaker.allow()
+	if err != nil {
+		return 0, nil, err
+	}
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, 0, nil, fmt.Errorf("failed to send request: %w", err)
+		c.breaker.done(probe, breakerFailure(ctx, 0, err))
+		return 0, nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
+	c.breaker.done(probe, breakerFailure(ctx, resp.StatusCode, nil))
+
+	c.session.updateBalance(resp.Header)
 
 	// Handle 402 Payment Required
 	if resp.StatusCode == http.StatusPaymentRequired {
 		paymentReq, err := c.parsePaymentRequired(resp)
 		if err != nil {
-			return nil, resp.StatusCode, nil, fmt.Errorf("payment required but failed to parse requirements: %w", err)
+			return resp.StatusCode, nil, fmt.Errorf("payment required but failed to parse requirements: %w", err)
 		}
-		return nil, resp.StatusCode, paymentReq, nil
+		return resp.StatusCode, paymentReq, nil
 	}
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, resp.StatusCode, nil, fmt.Errorf("scan failed: %s - %s", resp.Status, string(body))
+		return resp.StatusCode, nil, fmt.Errorf("scan failed: %s - %s", resp.Status, string(body))
 	}
 
-	var result ScanResult
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, resp.StatusCode, nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return &result, resp.StatusCode, nil, nil
+	return resp.StatusCode, nil, nil
 }
 
 // paymentOption represents a single payment option from the 402 response
@@ -253,7 +253,7 @@ func TestScannerClient_ParsePaymentRequired(t *testing.T) {
 			defer server.Close()
 
 			client := NewScannerClient(server.URL, "")
-			_, _, paymentReq, _ := client.scan(context.Background(), "/v1/scan/content", ScanRequest{Text: "test"}, "")
+			_, _, paymentReq, _ := client.scan(context.Background(), "/v1/scan/content", ScanRequest{Text: "test"}, nil)
 
 			if tt.wantErr {
 				if paymentReq != nil {
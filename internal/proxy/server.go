@@ -12,12 +12,14 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"gopkg.in/yaml.v3"
+	"stronghold/internal/pii"
 	"stronghold/internal/wallet"
 )
 
@@ -28,8 +30,21 @@ type Config struct {
 	Auth      AuthConfig      `yaml:"auth"`
 	Wallet    WalletConfig    `yaml:"wallet"`
 	Scanning  ScanningConfig  `yaml:"scanning"`
-	Logging   LoggingConfig   `yaml:"logging"`
-	CA        CAConfig        `yaml:"ca"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	CA         CAConfig         `yaml:"ca"`
+	Quarantine QuarantineConfig `yaml:"quarantine"`
+	Capture    CaptureConfig    `yaml:"capture"`
+	Budget     BudgetConfig     `yaml:"budget"`
+	Upstream   UpstreamConfig   `yaml:"upstream"`
+	Stats      StatsConfig      `yaml:"stats"`
+	Rules      RulesConfig      `yaml:"rules"`
+	ICAP       ICAPConfig       `yaml:"icap"`
+	ExtAuthz   ExtAuthzConfig   `yaml:"ext_authz"`
+	Canary     CanaryConfig     `yaml:"canary"`
+	Hosts      HostsConfig      `yaml:"hosts"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	Hold       HoldConfig       `yaml:"hold"`
+	Shadow     ShadowConfig     `yaml:"shadow"`
 }
 
 // CAConfig holds CA certificate configuration for MITM
@@ -71,6 +86,7 @@ type ScanTypeConfig struct {
 	Enabled       bool   `yaml:"enabled"`         // Whether this scan type is active
 	ActionOnWarn  string `yaml:"action_on_warn"`  // "allow", "warn", "block"
 	ActionOnBlock string `yaml:"action_on_block"` // "allow", "warn", "block"
+	Shadow        bool   `yaml:"shadow"`          // Record actions without enforcing them
 }
 
 // ScanningConfig holds scanning configuration
@@ -78,8 +94,16 @@ type ScanningConfig struct {
 	Mode           string         `yaml:"mode"`
 	BlockThreshold float64        `yaml:"block_threshold"`
 	FailOpen       bool           `yaml:"fail_open"`
-	Content        ScanTypeConfig `yaml:"content"` // Prompt injection scanning (incoming)
-	Output         ScanTypeConfig `yaml:"output"`  // Credential leak scanning (outgoing)
+	Content        ScanTypeConfig `yaml:"content"`   // Prompt injection scanning (incoming)
+	Output         ScanTypeConfig `yaml:"output"`    // Credential leak scanning (outgoing)
+	Documents      DocumentConfig `yaml:"documents"` // PDF/office document text extraction
+	Archives       ArchiveConfig  `yaml:"archives"`  // zip/tar/tar.gz member scanning
+	Batch          BatchConfig    `yaml:"batch"`     // Coalescing of small scans into batch calls
+	Session        SessionConfig  `yaml:"session"`   // Prepaid x402 sessions
+	Breaker        BreakerConfig  `yaml:"breaker"`   // Fail fast while the API is down
+	LLM            LLMConfig      `yaml:"llm"`       // Per-message scanning of LLM API calls
+	JSON           JSONConfig     `yaml:"json"`      // Handling of JSON flagged field by field
+	PII            PIIConfig      `yaml:"pii"`       // Personal data in outbound request bodies
 }
 
 // LoggingConfig holds logging configuration
@@ -103,6 +127,45 @@ func applyDefaultScanTypeConfig(cfg *ScanTypeConfig) {
 	}
 }
 
+// maxScanBodySize is the largest text body (bytes) buffered for scanning
+const maxScanBodySize = 1024 * 1024
+
+// shouldScanResponse determines if a response with this content type is buffered and scanned
+func shouldScanResponse(cfg *ScanningConfig, contentType string) bool {
+	if !cfg.Content.Enabled {
+		return false
+	}
+	if IsDocumentContentType(contentType) {
+		return cfg.Documents.Enabled
+	}
+	if IsArchiveContentType(contentType) {
+		return cfg.Archives.Enabled
+	}
+	return ShouldScanContentType(contentType) && !IsBinaryContentType(contentType)
+}
+
+// scanReadLimit returns how many body bytes to buffer for scanning a content type
+func scanReadLimit(cfg *ScanningConfig, contentType string) int64 {
+	if IsDocumentContentType(contentType) && cfg.Documents.MaxSize > 0 {
+		return cfg.Documents.MaxSize
+	}
+	if IsArchiveContentType(contentType) && cfg.Archives.MaxSize > 0 {
+		return cfg.Archives.MaxSize
+	}
+	return maxScanBodySize
+}
+
+// scanTypeFor returns the X-Stronghold-Scan-Type value for a scanned content type
+func scanTypeFor(contentType string) string {
+	if IsDocumentContentType(contentType) {
+		return "document"
+	}
+	if IsArchiveContentType(contentType) {
+		return "archive"
+	}
+	return "content"
+}
+
 // getAction determines what action to take based on scan decision and config
 func getAction(decision Decision, cfg ScanTypeConfig) string {
 	switch decision {
@@ -134,12 +197,22 @@ type Server struct {
 	ca             *CA
 	certCache      *CertCache
 	mitm           *MITMHandler
+	pipeline       *pipeline // Inspects traffic from both transports
+	quarantine     *QuarantineStore
+	capture        *CaptureStore
+	stats          *StatsStore
+	hosts          *HostStore
+	notifier       *Notifier
+	holds          *HoldStore
 	requestCount   int64
 	blockedCount   int64
 	warnedCount    int64
 	mu             sync.RWMutex
 	connSem        chan struct{}   // semaphore to limit concurrent connections
 	connWg         sync.WaitGroup // tracks active connections for graceful drain
+	icapListener   net.Listener
+	icapTag        string // ISTag sent to ICAP clients; changes on restart as config may have changed
+	extAuthzServer *http.Server
 }
 
 // NewServer creates a new proxy server
@@ -182,6 +255,7 @@ func NewServer(config *Config) (*Server, error) {
 		logFile:    logFile,
 		httpClient: httpClient,
 		connSem:    make(chan struct{}, 10000),
+		icapTag:    fmt.Sprintf(`"stronghold-%x"`, time.Now().Unix()),
 	}
 
 	// Load EVM wallet if configured
@@ -213,6 +287,156 @@ func NewServer(config *Config) (*Server, error) {
 		}
 	}
 
+	// Cap x402 spending with the persisted ledger
+	if config.Budget.Ledger != "" {
+		ledger, err := OpenSpendLedger(config.Budget)
+		if err != nil {
+			logger.Warn("failed to open spend ledger, spending caps are not enforced", "error", err)
+		} else {
+			scanner.SetBudget(ledger, config.Scanning.BlockThreshold)
+		}
+	}
+
+	// Coalesce concurrent small scans into batch calls with one payment
+	if config.Scanning.Batch.Enabled {
+		scanner.SetBatching(config.Scanning.Batch)
+	}
+
+	// Debit scans from a prepaid session instead of paying for each one
+	if config.Scanning.Session.Enabled {
+		scanner.SetSession(config.Scanning.Session)
+	}
+
+	// Deliver blocks, warnings and outages to webhooks
+	if config.Notifications.Enabled {
+		notifier, err := NewNotifier(config.Notifications, logger)
+		if err != nil {
+			logger.Error("invalid notifications config, notifications are not sent", "error", err)
+		} else {
+			s.notifier = notifier
+			logger.Info("notifications enabled", "targets", len(config.Notifications.Targets))
+		}
+	}
+
+	// Fail fast to the fail mode while the scanning API is down
+	if config.Scanning.Breaker.Enabled {
+		scanner.SetBreaker(config.Scanning.Breaker, func(state BreakerState) {
+			switch state.State {
+			case BreakerOpen:
+				logger.Warn("scanning API unavailable, failing fast", "failures", state.ConsecutiveFailures, "retry_at", state.RetryAt.Format(time.RFC3339), "fail_open", config.Scanning.FailOpen)
+				s.notifier.Notify(Notification{
+					Event:   EventCircuitOpen,
+					Summary: fmt.Sprintf("Scanning API unavailable after %d failures; content is %s until %s", state.ConsecutiveFailures, failModeText(config.Scanning.FailOpen), state.RetryAt.Format(time.RFC3339)),
+				})
+			case BreakerClosed:
+				logger.Info("scanning API recovered")
+			}
+		})
+	}
+
+	// Plain HTTP and MITM traffic go through the same pipeline
+	s.pipeline = newPipeline(config, scanner, logger)
+	s.pipeline.onDecision = s.countDecision
+	s.pipeline.notifier = s.notifier
+
+	// Organization rules run locally before any paid scan
+	if config.Rules.File != "" {
+		rules, err := LoadRules(config.Rules.File)
+		if err != nil {
+			logger.Error("failed to load rules, local rules are not applied", "file", config.Rules.File, "error", err)
+		} else if rules.Len() > 0 {
+			s.pipeline.rules = rules
+			logger.Info("local rules loaded", "file", config.Rules.File, "rules", rules.Len())
+		}
+	}
+
+	// Personal data is checked locally, before request bodies reach the scanner
+	if config.Scanning.PII.Enabled {
+		policy := config.Scanning.PII.Policy()
+		if err := policy.Validate(); err != nil {
+			logger.Error("invalid PII policy, using the default", "error", err)
+			policy = nil
+		}
+		s.pipeline.piiPolicy = pii.DefaultPolicy()
+		for category, action := range policy {
+			s.pipeline.piiPolicy[category] = action
+		}
+		logger.Info("PII detection enabled", "policy", s.pipeline.piiPolicy)
+	}
+
+	// Canary credentials are matched in every request, scanned or not
+	if config.Canary.File != "" {
+		canaries, err := OpenCanaries(config.Canary)
+		if err != nil {
+			logger.Error("failed to open canaries, canary credentials are not matched", "error", err)
+		} else {
+			s.pipeline.canaries = canaries
+			logger.Info("canary registry opened", "file", config.Canary.File, "active", len(canaries.active()))
+		}
+	}
+
+	// Keep per-day traffic statistics for 'stronghold status --history'
+	if config.Stats.File != "" {
+		st, err := OpenStats(config.Stats)
+		if err != nil {
+			logger.Warn("failed to open stats, traffic history will not be kept", "error", err)
+		} else {
+			s.stats = st
+			s.pipeline.stats = st
+			scanner.SetStats(st)
+		}
+	}
+
+	// Record every destination host for 'stronghold hosts'
+	if config.Hosts.File != "" {
+		switch config.Hosts.OnFirstSeen {
+		case FirstSeenAllow, FirstSeenFlag, FirstSeenHold:
+		default:
+			logger.Error("invalid hosts.on_first_seen, new hosts are not flagged", "value", config.Hosts.OnFirstSeen)
+			config.Hosts.OnFirstSeen = FirstSeenAllow
+		}
+		hosts, err := OpenHosts(config.Hosts)
+		if err != nil {
+			logger.Warn("failed to open hosts, destination hosts will not be recorded", "error", err)
+		} else {
+			s.hosts = hosts
+			s.pipeline.hosts = hosts
+		}
+	}
+
+	// Hold WARN content for a human decision where an action_on_warn is hold
+	if config.Scanning.Content.ActionOnBlock == "hold" || config.Scanning.Output.ActionOnBlock == "hold" {
+		logger.Error("hold applies to WARN decisions only, blocking instead", "action_on_block", "hold")
+		if config.Scanning.Content.ActionOnBlock == "hold" {
+			config.Scanning.Content.ActionOnBlock = "block"
+		}
+		if config.Scanning.Output.ActionOnBlock == "hold" {
+			config.Scanning.Output.ActionOnBlock = "block"
+		}
+	}
+	if config.Scanning.Content.ActionOnWarn == "hold" || config.Scanning.Output.ActionOnWarn == "hold" {
+		switch config.Hold.OnTimeout {
+		case "allow", "warn", "block":
+		default:
+			logger.Error("invalid hold.on_timeout, blocking held content that times out", "value", config.Hold.OnTimeout)
+			config.Hold.OnTimeout = "block"
+		}
+		holds, err := OpenHolds(config.Hold)
+		if err != nil {
+			logger.Error("failed to open hold store, held content gets hold.on_timeout", "error", err)
+		} else {
+			s.holds = holds
+			s.pipeline.holds = holds
+			logger.Info("holding WARN content for approval", "timeout", config.Hold.Timeout, "on_timeout", config.Hold.OnTimeout, "api", config.Hold.APIToken != "")
+		}
+	}
+
+	// Record what policy would do in shadow mode instead of doing it
+	if config.Shadow.Enabled || config.Scanning.Content.Shadow || config.Scanning.Output.Shadow {
+		s.pipeline.shadow = OpenShadowLog(config.Shadow.File)
+		logger.Warn("shadow mode: policy is recorded, not enforced", "all", config.Shadow.Enabled, "content", config.Scanning.Content.Shadow, "output", config.Scanning.Output.Shadow, "file", config.Shadow.File)
+	}
+
 	// Load or create CA for MITM
 	if config.CA.CertPath != "" && config.CA.KeyPath != "" {
 		ca, err := LoadCA(config.CA.CertPath, config.CA.KeyPath)
@@ -222,6 +446,7 @@ func NewServer(config *Config) (*Server, error) {
 			s.ca = ca
 			s.certCache = NewCertCache(ca)
 			s.mitm = NewMITMHandler(s.certCache, scanner, config, logger)
+			s.mitm.SetPipeline(s.pipeline)
 			logger.Info("MITM enabled with CA certificate")
 		}
 	} else {
@@ -235,14 +460,43 @@ func NewServer(config *Config) (*Server, error) {
 			s.ca = ca
 			s.certCache = NewCertCache(ca)
 			s.mitm = NewMITMHandler(s.certCache, scanner, config, logger)
+			s.mitm.SetPipeline(s.pipeline)
 			logger.Info("MITM enabled with CA certificate", "ca_dir", caDir)
 		}
 	}
 
+	// Open the quarantine store for blocked content
+	if config.Quarantine.Enabled {
+		q, err := OpenQuarantine(config.Quarantine)
+		if err != nil {
+			logger.Warn("failed to open quarantine, blocked content will not be kept", "error", err)
+		} else {
+			s.quarantine = q
+			s.pipeline.quarantine = q
+			logger.Info("quarantine enabled", "dir", config.Quarantine.Dir)
+		}
+	}
+
+	// Open the capture store; captures can be started on demand from the CLI
+	// even when capture.mode is off
+	if config.Capture.Dir != "" {
+		c, err := OpenCapture(config.Capture)
+		if err != nil {
+			logger.Warn("failed to open capture store, flows will not be recorded", "error", err)
+		} else {
+			s.capture = c
+			if s.mitm != nil {
+				s.mitm.SetCapture(c)
+			}
+		}
+	}
+
 	// Setup HTTP server
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleRequest)
 	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc(holdAPIPrefix, s.handleHoldAPI)
+	mux.HandleFunc(holdAPIPrefix+"/", s.handleHoldAPI)
 
 	s.httpServer = &http.Server{
 		Handler:      mux,
@@ -279,10 +533,89 @@ func LoadConfig() (*Config, error) {
 				ActionOnWarn:  "warn",
 				ActionOnBlock: "block",
 			},
+			Documents: DocumentConfig{
+				Enabled: true,
+				MaxSize: 10 * 1024 * 1024,
+			},
+			Archives: ArchiveConfig{
+				Enabled:    false,
+				MaxSize:    50 * 1024 * 1024,
+				MaxDepth:   2,
+				MaxMembers: 1000,
+			},
+			Batch: BatchConfig{
+				Enabled:     false,
+				WindowMs:    25,
+				MaxItems:    16,
+				MaxItemSize: 32 * 1024,
+			},
+			Session: SessionConfig{
+				Enabled: false,
+				Deposit: 0.10,
+			},
+			Breaker: BreakerConfig{
+				Enabled:          true,
+				FailureThreshold: 5,
+				Cooldown:         10 * time.Second,
+				MaxCooldown:      5 * time.Minute,
+			},
+			LLM: LLMConfig{
+				Enabled:   true,
+				Providers: []string{"openai", "anthropic"},
+			},
 		},
 		Logging: LoggingConfig{
 			Level: "info",
 		},
+		Quarantine: QuarantineConfig{
+			Enabled:       true,
+			RetentionDays: 30,
+			MaxEntries:    1000,
+		},
+		Capture: CaptureConfig{
+			Mode:        CaptureOff,
+			MaxEntries:  500,
+			MaxBodySize: 256 * 1024,
+		},
+		Budget: BudgetConfig{
+			DailyLimit:        5,
+			MonthlyLimit:      50,
+			PerHostDailyLimit: 1,
+			OnExceeded:        BudgetLocalScan,
+		},
+		Upstream: UpstreamConfig{
+			MaxIdlePerHost:  8,
+			MaxConnsPerHost: 64,
+			IdleTimeout:     90 * time.Second,
+			HTTP2:           true,
+		},
+		Stats: StatsConfig{
+			RetentionDays: 90,
+		},
+		Hosts: HostsConfig{
+			OnFirstSeen: FirstSeenAllow,
+		},
+		Notifications: NotificationsConfig{
+			BatchWindow: 10 * time.Second,
+			MaxBatch:    20,
+			RateLimit:   10,
+			Retries:     3,
+		},
+		Hold: HoldConfig{
+			Timeout:   2 * time.Minute,
+			OnTimeout: "block",
+		},
+		ICAP: ICAPConfig{
+			Enabled: false,
+			Bind:    "127.0.0.1",
+			Port:    1344,
+			Preview: 4096,
+		},
+		ExtAuthz: ExtAuthzConfig{
+			Enabled: false,
+			Bind:    "127.0.0.1",
+			Port:    9191,
+		},
 	}
 
 	// Try to load from config file
@@ -299,6 +632,52 @@ func LoadConfig() (*Config, error) {
 		// Apply defaults for new ScanTypeConfig fields if not set (migration)
 		applyDefaultScanTypeConfig(&config.Scanning.Content)
 		applyDefaultScanTypeConfig(&config.Scanning.Output)
+		applyDefaultDocumentConfig(&config.Scanning.Documents)
+		applyDefaultArchiveConfig(&config.Scanning.Archives)
+		applyDefaultBatchConfig(&config.Scanning.Batch)
+		applyDefaultSessionConfig(&config.Scanning.Session)
+		applyDefaultBreakerConfig(&config.Scanning.Breaker)
+		applyDefaultLLMConfig(&config.Scanning.LLM)
+		applyDefaultQuarantineConfig(&config.Quarantine)
+		applyDefaultCaptureConfig(&config.Capture)
+		applyDefaultBudgetConfig(&config.Budget)
+		applyDefaultUpstreamConfig(&config.Upstream)
+		applyDefaultStatsConfig(&config.Stats)
+		applyDefaultHostsConfig(&config.Hosts)
+		migrateHostsWebhook(&config.Hosts, &config.Notifications)
+		applyDefaultNotificationsConfig(&config.Notifications)
+		applyDefaultHoldConfig(&config.Hold)
+		applyDefaultICAPConfig(&config.ICAP)
+		applyDefaultExtAuthzConfig(&config.ExtAuthz)
+	}
+
+	// Quarantine, captures, the spend ledger, stats, hosts, holds, the shadow log, rules and canaries live next to the config file unless configured otherwise
+	if config.Quarantine.Dir == "" {
+		config.Quarantine.Dir = filepath.Join(filepath.Dir(configPath), "quarantine")
+	}
+	if config.Capture.Dir == "" {
+		config.Capture.Dir = filepath.Join(filepath.Dir(configPath), "capture")
+	}
+	if config.Budget.Ledger == "" {
+		config.Budget.Ledger = filepath.Join(filepath.Dir(configPath), "spend.json")
+	}
+	if config.Stats.File == "" {
+		config.Stats.File = filepath.Join(filepath.Dir(configPath), "stats.json")
+	}
+	if config.Hosts.File == "" {
+		config.Hosts.File = filepath.Join(filepath.Dir(configPath), "hosts.json")
+	}
+	if config.Hold.Dir == "" {
+		config.Hold.Dir = filepath.Join(filepath.Dir(configPath), "holds")
+	}
+	if config.Shadow.File == "" {
+		config.Shadow.File = filepath.Join(filepath.Dir(configPath), "shadow.jsonl")
+	}
+	if config.Rules.File == "" {
+		config.Rules.File = filepath.Join(filepath.Dir(configPath), "rules.yaml")
+	}
+	if config.Canary.File == "" {
+		config.Canary.File = filepath.Join(filepath.Dir(configPath), "canaries.json")
 	}
 
 	// Override with environment variables
@@ -316,6 +695,18 @@ func LoadConfig() (*Config, error) {
 		config.API.Endpoint = endpoint
 	}
 
+	// Setting the ext_authz port enables the adapter, for sidecars configured by environment
+	if port := os.Getenv("STRONGHOLD_EXT_AUTHZ_PORT"); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			config.ExtAuthz.Enabled = true
+			config.ExtAuthz.Port = p
+		}
+	}
+
+	if bind := os.Getenv("STRONGHOLD_EXT_AUTHZ_BIND"); bind != "" {
+		config.ExtAuthz.Bind = bind
+	}
+
 	return config, nil
 }
 
@@ -351,6 +742,34 @@ func (s *Server) Start(ctx context.Context) error {
 	// Start accepting raw connections for transparent proxy mode
 	go s.acceptConnections(ctx)
 
+	// Serve ICAP for proxies that do their own interception
+	if s.config.ICAP.Enabled {
+		if err := s.startICAP(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Answer Envoy ext_authz checks for meshes that route egress themselves
+	if s.config.ExtAuthz.Enabled {
+		if err := s.startExtAuthz(ctx); err != nil {
+			return err
+		}
+	}
+
+	s.notifier.Start()
+
+	// Write traffic statistics and destination hosts periodically
+	if s.stats != nil {
+		go s.stats.flushEvery(ctx, statsFlushInterval, func(err error) {
+			s.logger.Warn("failed to write stats", "error", err)
+		})
+	}
+	if s.hosts != nil {
+		go s.hosts.flushEvery(ctx, statsFlushInterval, func(err error) {
+			s.logger.Warn("failed to write hosts", "error", err)
+		})
+	}
+
 	// Wait for context cancellation
 	<-ctx.Done()
 	return nil
@@ -610,6 +1029,12 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	if s.icapListener != nil {
+		s.icapListener.Close()
+	}
+
+	// Held content stops waiting so its connections can drain
+	s.holds.Close()
 
 	// Wait for active connections to drain with a 30s timeout
 	drainDone := make(chan struct{})
@@ -628,11 +1053,32 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		s.logger.Warn("shutdown context cancelled during drain")
 	}
 
+	// Write the traffic counted since the last flush
+	if err := s.stats.Flush(); err != nil {
+		s.logger.Warn("failed to write stats", "error", err)
+	}
+	if err := s.hosts.Flush(); err != nil {
+		s.logger.Warn("failed to write hosts", "error", err)
+	}
+
+	// Deliver queued notifications, within the shutdown deadline
+	s.notifier.Close(ctx)
+
+	// Drop pooled origin connections
+	if s.mitm != nil {
+		s.mitm.CloseIdleConnections()
+	}
+
 	if s.httpServer != nil {
 		if err := s.httpServer.Shutdown(ctx); err != nil {
 			return err
 		}
 	}
+	if s.extAuthzServer != nil {
+		if err := s.extAuthzServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
 
 	// Close log file handle if we opened one
 	if s.logFile != nil {
@@ -685,20 +1131,44 @@ func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request, start time.T
 		targetURL = "http://" + r.Host + r.URL.String()
 	}
 
+	// Record the flow if a capture is running
+	flow := s.capture.begin(r, targetURL, "http")
+	defer flow.finish(s.logger)
+	w = flow.wrapWriter(w)
+
 	_, err := url.Parse(targetURL)
 	if err != nil {
 		s.logger.Error("error parsing URL", "error", err)
+		flow.fail(err)
 		http.Error(w, "Invalid URL", http.StatusBadRequest)
 		return
 	}
 
+	// Inspect the request before it leaves
+	r.Body = flow.teeRequestBody(r.Body)
+	x := s.pipeline.begin(r, targetURL, "http", start, flow)
+	reply, err := s.pipeline.handleRequest(x)
+	if err != nil {
+		s.logger.Error("error inspecting request", "error", err)
+		flow.fail(err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	if reply != nil {
+		s.extendHeldWrite(w)
+		s.writeResponse(w, reply, x.requestID)
+		return
+	}
+
 	// Create the outgoing request
 	outReq, err := http.NewRequest(r.Method, targetURL, r.Body)
 	if err != nil {
 		s.logger.Error("error creating request", "error", err)
+		flow.fail(err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	outReq.ContentLength = r.ContentLength
 
 	// Copy headers
 	for key, values := range r.Header {
@@ -716,152 +1186,63 @@ func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request, start time.T
 	resp, err := s.httpClient.Do(outReq)
 	if err != nil {
 		s.logger.Error("error forwarding request", "error", err)
+		flow.fail(err)
 		http.Error(w, "Bad Gateway", http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
+	flow.responseStarted()
 
-	// Add base Stronghold headers
-	requestID := generateRequestID()
-	w.Header().Set("X-Stronghold-Request-ID", requestID)
-	w.Header().Set("X-Stronghold-Scan-Latency", fmt.Sprintf("%dms", time.Since(start).Milliseconds()))
-
-	// Check content type BEFORE reading the body to avoid buffering large binaries
-	contentType := resp.Header.Get("Content-Type")
-	shouldScan := s.config.Scanning.Content.Enabled &&
-		ShouldScanContentType(contentType) && !IsBinaryContentType(contentType)
-
-	if !shouldScan {
-		// Non-scannable content: stream directly without buffering
-		w.Header().Set("X-Stronghold-Decision", "ALLOW")
-		w.Header().Set("X-Stronghold-Action", "allow")
-		if !s.config.Scanning.Content.Enabled {
-			w.Header().Set("X-Stronghold-Scan-Type", "disabled")
-		} else {
-			w.Header().Set("X-Stronghold-Scan-Type", "skipped-unscannable")
-		}
-
-		// Copy response headers
-		copyResponseHeaders(w.Header(), resp.Header)
-
-		w.WriteHeader(resp.StatusCode)
-		if _, err := io.Copy(w, resp.Body); err != nil {
-			s.logger.Error("error streaming response", "error", err, "requestID", requestID)
-		}
-		return
-	}
-
-	// Scannable content: read with 1MB limit (+ 1 byte to detect oversized)
-	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024+1))
+	out, err := s.pipeline.handleResponse(x, resp)
 	if err != nil {
 		s.logger.Error("error reading response body", "error", err)
+		flow.fail(err)
 		http.Error(w, "Bad Gateway", http.StatusBadGateway)
 		return
 	}
+	s.extendHeldWrite(w)
+	s.writeResponse(w, out, x.requestID)
+}
 
-	// If body exceeds 1MB, skip scanning and forward as-is
-	if len(body) > 1024*1024 {
-		w.Header().Set("X-Stronghold-Decision", "ALLOW")
-		w.Header().Set("X-Stronghold-Action", "allow")
-		w.Header().Set("X-Stronghold-Scan-Type", "skipped-oversized")
-
-		// Copy response headers
-		copyResponseHeaders(w.Header(), resp.Header)
-
-		w.WriteHeader(resp.StatusCode)
-		if _, err := w.Write(body); err != nil {
-			s.logger.Error("error writing oversized response body", "error", err, "requestID", requestID)
-			return
-		}
-		// Write any remaining bytes beyond what LimitReader returned
-		if _, err := io.Copy(w, resp.Body); err != nil {
-			s.logger.Error("error streaming response", "error", err, "requestID", requestID)
-		}
+// extendHeldWrite moves the write deadline past any time the request or
+// response was held for a decision, which can outlast the server's
+// WriteTimeout
+func (s *Server) extendHeldWrite(w http.ResponseWriter) {
+	if s.holds == nil {
 		return
 	}
-
-	// Scan the response body
-	scanResult := s.scanResponse(body, targetURL, contentType)
-
-	// Determine action based on scan result and config
-	var action string
-	if scanResult != nil {
-		action = getAction(scanResult.Decision, s.config.Scanning.Content)
-
-		// Always add scan result headers (even when not blocking)
-		w.Header().Set("X-Stronghold-Decision", string(scanResult.Decision))
-		w.Header().Set("X-Stronghold-Reason", scanResult.Reason)
-		w.Header().Set("X-Stronghold-Action", action)
-		w.Header().Set("X-Stronghold-Scan-Type", "content")
-		if score, ok := scanResult.Scores["combined"]; ok {
-			w.Header().Set("X-Stronghold-Score", fmt.Sprintf("%.2f", score))
-		} else if score, ok := scanResult.Scores["heuristic"]; ok {
-			w.Header().Set("X-Stronghold-Score", fmt.Sprintf("%.2f", score))
-		}
-
-		// Update counters based on original decision
-		if scanResult.Decision == DecisionBlock {
-			s.mu.Lock()
-			s.blockedCount++
-			s.mu.Unlock()
-		} else if scanResult.Decision == DecisionWarn {
-			s.mu.Lock()
-			s.warnedCount++
-			s.mu.Unlock()
-		}
-
-		// Handle action
-		switch action {
-		case "block":
-			s.logger.Warn("content blocked", "url", targetURL, "reason", scanResult.Reason, "decision", scanResult.Decision)
-			blockBody, _ := json.Marshal(struct {
-				Error             string `json:"error"`
-				Reason            string `json:"reason"`
-				RequestID         string `json:"request_id"`
-				RecommendedAction string `json:"recommended_action"`
-			}{
-				Error:             "Content blocked by Stronghold security scan",
-				Reason:            scanResult.Reason,
-				RequestID:         requestID,
-				RecommendedAction: scanResult.RecommendedAction,
-			})
-			w.WriteHeader(http.StatusForbidden)
-			w.Write(blockBody)
-			return
-		case "warn":
-			s.logger.Warn("content warned", "url", targetURL, "reason", scanResult.Reason, "decision", scanResult.Decision)
-			w.Header().Set("X-Stronghold-Warning", scanResult.Reason)
-			// Continue to forward response
-		default: // "allow"
-			s.logger.Debug("content allowed despite scan result", "url", targetURL, "decision", scanResult.Decision)
-			// Continue to forward response (headers still present)
-		}
-	} else {
-		// scanResponse returned nil (content not scannable or no scanner configured)
-		w.Header().Set("X-Stronghold-Decision", "ALLOW")
-		w.Header().Set("X-Stronghold-Action", "allow")
-		w.Header().Set("X-Stronghold-Scan-Type", "skipped-not-scannable")
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		s.logger.Debug("cannot extend write deadline after hold", "error", err)
 	}
+}
 
-	// Copy response headers
+// writeResponse sends a response produced by the pipeline to w
+func (s *Server) writeResponse(w http.ResponseWriter, resp *http.Response, requestID string) {
+	defer resp.Body.Close()
 	copyResponseHeaders(w.Header(), resp.Header)
-
-	// Write response
 	w.WriteHeader(resp.StatusCode)
-	w.Write(body)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		s.logger.Error("error streaming response", "error", err, "requestID", requestID)
+	}
 }
 
 // handleConnect handles HTTPS CONNECT requests (explicit proxy mode)
 func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
-	// Use standard dialer (no socket marks needed - we use user-based filtering)
-	dialer := &net.Dialer{Timeout: 10 * time.Second}
-	destConn, err := dialer.Dial("tcp", r.Host)
-	if err != nil {
-		s.logger.Error("error connecting to host", "host", r.Host, "error", err)
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
-		return
+	// With MITM, origin connections come from the shared upstream pool when
+	// a request needs one, so only a plain tunnel dials here
+	var destConn net.Conn
+	if s.mitm == nil {
+		// Use standard dialer (no socket marks needed - we use user-based filtering)
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		var err error
+		destConn, err = dialer.Dial("tcp", r.Host)
+		if err != nil {
+			s.logger.Error("error connecting to host", "host", r.Host, "error", err)
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			return
+		}
+		defer destConn.Close()
 	}
-	defer destConn.Close()
 
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
@@ -905,56 +1286,27 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 	<-done
 }
 
-// scanResponse scans the response content
-func (s *Server) scanResponse(body []byte, sourceURL, contentType string) *ScanResult {
-	// Skip binary content
-	if IsBinaryContentType(contentType) {
-		return nil
-	}
-
-	// Skip if content is too large (> 1MB)
-	if len(body) > 1024*1024 {
-		s.logger.Debug("skipping scan: content too large", "bytes", len(body))
-		return nil
-	}
-
-	// Check if we should scan this content type
-	if !ShouldScanContentType(contentType) {
-		return nil
-	}
-
-	// Perform the scan
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	result, err := s.scanner.ScanContent(ctx, body, sourceURL, contentType)
-	if err != nil {
-		s.logger.Error("scan error", "error", err)
-
-		// Fail open or closed based on configuration
-		if s.config.Scanning.FailOpen {
-			return nil // Allow through
-		}
-
-		// Fail closed - block the request
-		return &ScanResult{
-			Decision:          DecisionBlock,
-			Reason:            "Scan failed - blocking for safety",
-			RecommendedAction: "Retry the request",
-		}
+// countDecision updates the blocked and warned counters for a scan decision
+func (s *Server) countDecision(decision Decision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch decision {
+	case DecisionBlock:
+		s.blockedCount++
+	case DecisionWarn:
+		s.warnedCount++
 	}
-
-	return result
 }
 
 // handleHealth handles health check requests
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	s.mu.RLock()
 	stats := struct {
-		Status        string `json:"status"`
-		RequestsTotal int64  `json:"requests_total"`
-		Blocked       int64  `json:"blocked"`
-		Warned        int64  `json:"warned"`
+		Status        string        `json:"status"`
+		RequestsTotal int64         `json:"requests_total"`
+		Blocked       int64         `json:"blocked"`
+		Warned        int64         `json:"warned"`
+		Breaker       *BreakerState `json:"breaker,omitempty"`
 	}{
 		Status:        "healthy",
 		RequestsTotal: s.requestCount,
@@ -963,6 +1315,13 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 	s.mu.RUnlock()
 
+	if breaker, ok := s.scanner.Breaker(); ok {
+		stats.Breaker = &breaker
+		if breaker.State != BreakerClosed {
+			stats.Status = "degraded"
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(stats)
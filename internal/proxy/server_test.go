@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -56,6 +57,57 @@ func newTestServer(t *testing.T, config *Config) *Server {
 	return s
 }
 
+// stubScanner is a scanning API stub that records the requests it answers
+type stubScanner struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []stubRequest
+}
+
+// stubRequest is a scan request received by a stubScanner, with the
+// endpoint it was sent to
+type stubRequest struct {
+	Path string
+	ScanRequest
+}
+
+// newStubScanner starts a scanning API stub that answers every scan, on any
+// endpoint, with respond. It is closed when the test ends.
+func newStubScanner(t *testing.T, respond func(ScanRequest) ScanResult) *stubScanner {
+	t.Helper()
+	stub := &stubScanner{}
+	stub.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ScanRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		stub.mu.Lock()
+		stub.requests = append(stub.requests, stubRequest{Path: r.URL.Path, ScanRequest: req})
+		stub.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(respond(req))
+	}))
+	t.Cleanup(stub.Close)
+	return stub
+}
+
+// Requests returns the scan requests received so far, in order
+func (s *stubScanner) Requests() []stubRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]stubRequest(nil), s.requests...)
+}
+
+// Texts returns the text of the scans sent to path, or of every scan when
+// path is empty
+func (s *stubScanner) Texts(path string) []string {
+	var texts []string
+	for _, req := range s.Requests() {
+		if path == "" || req.Path == path {
+			texts = append(texts, req.Text)
+		}
+	}
+	return texts
+}
+
 func TestHandleHTTP_ForwardsRequest(t *testing.T) {
 	// Mock upstream that returns a known response
 	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -675,6 +727,8 @@ func TestHandleConnect_BasicTunnel(t *testing.T) {
 func TestHandleConnect_DialFailure(t *testing.T) {
 	config := newTestConfig("http://localhost:1")
 	s := newTestServer(t, config)
+	// Only the plain tunnel dials on CONNECT; MITM dials per request
+	s.mitm = nil
 
 	// Listen on a port and immediately close the listener to get a port that
 	// will refuse connections quickly (much faster than non-routable address timeout).
@@ -735,13 +789,9 @@ func TestHandleConnect_MITMIntercept(t *testing.T) {
 
 	config := newTestConfig(scanner.URL)
 
-	// Set up MITM handler - but we need to customize it because the MITM handler
-	// will try to connect to the real upstream. We need to make the upstream server
-	// accept connections from the MITM handler. The issue is that MITM's HandleTLS
-	// dials the original destination with tls.Dial, which will fail because the
-	// upstream uses a self-signed cert.
-	//
-	// Instead, we test the MITM TLS handshake on the client side only.
+	// The MITM handler's upstream pool does not trust the upstream's
+	// self-signed cert, so requests to it would fail. TestMITM_UpstreamPoolReusesConnections
+	// covers forwarding; here we test the MITM TLS handshake on the client side only.
 	// We verify that the MITM handler performs a TLS handshake using a cert
 	// signed by our CA.
 
@@ -754,8 +804,7 @@ func TestHandleConnect_MITMIntercept(t *testing.T) {
 	serverSide, testSide := net.Pipe()
 	defer testSide.Close()
 
-	// Run HandleTLS in a goroutine - it will try to TLS-handshake with our test
-	// then attempt to dial the real upstream (which will fail because of self-signed cert).
+	// Run HandleTLS in a goroutine - it will TLS-handshake with our test side.
 	// We only care that the TLS handshake with our test side succeeds using the CA cert.
 	mitmDone := make(chan error, 1)
 	go func() {
@@ -796,18 +845,10 @@ func TestHandleConnect_MITMIntercept(t *testing.T) {
 		t.Errorf("expected cert CN=%s, got %s", upstreamHost, peerCert.Subject.CommonName)
 	}
 
-	// Clean up - the MITM handler will fail when trying to dial upstream
-	// (self-signed cert), which is expected
+	// Clean up - no request was sent, so HandleTLS returns once the client goes away
 	tlsConn.Close()
 	testSide.Close()
-
-	// Wait for HandleTLS to finish (it should error on upstream dial)
-	mitmErr := <-mitmDone
-	// We expect an error from dialing the test server (self-signed cert or connection reset)
-	// This is fine - we verified the client-side TLS handshake works
-	if mitmErr == nil {
-		t.Log("HandleTLS returned nil error (upstream dial succeeded unexpectedly)")
-	}
+	<-mitmDone
 }
 
 func TestHandleConnect_HijackNotSupported(t *testing.T) {
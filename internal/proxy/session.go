@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"stronghold/internal/usdc"
+)
+
+// Headers used by prepaid sessions
+const (
+	sessionTokenHeader   = "X-Session-Token"
+	sessionBalanceHeader = "X-Session-Balance"
+)
+
+// sessionRetryDelay is how long scans pay one by one after a session could
+// not be opened
+const sessionRetryDelay = time.Minute
+
+// SessionConfig controls prepaid x402 sessions. The proxy pays a deposit once
+// and later scans are debited from it, skipping the 402 round trip.
+type SessionConfig struct {
+	Enabled bool    `yaml:"enabled"` // Pay for scans from prepaid sessions
+	Deposit float64 `yaml:"deposit"` // USDC paid to open each session
+}
+
+// applyDefaultSessionConfig sets default values for SessionConfig if not already set
+func applyDefaultSessionConfig(cfg *SessionConfig) {
+	// If Deposit is zero, this is an old config without the session section
+	if cfg.Deposit == 0 {
+		cfg.Deposit = 0.10
+	}
+}
+
+// prepaidSession holds the session scans are currently debited from
+type prepaidSession struct {
+	client      *ScannerClient
+	deposit     usdc.MicroUSDC
+	unsupported atomic.Bool // The API has no session endpoint
+
+	opening sync.Mutex // Serializes opening so concurrent scans share one session
+
+	mu      sync.Mutex
+	token   string
+	balance usdc.MicroUSDC
+	retryAt time.Time                 // Scans pay one by one until then after a failed open
+	prices  map[string]usdc.MicroUSDC // Scan price per endpoint, from its last 402
+	now     func() time.Time
+}
+
+func newPrepaidSession(client *ScannerClient, cfg SessionConfig) *prepaidSession {
+	return &prepaidSession{
+		client:  client,
+		deposit: usdc.FromFloat(cfg.Deposit),
+		prices:  make(map[string]usdc.MicroUSDC),
+		now:     time.Now,
+	}
+}
+
+// current returns the token of the open session, or "" if there is none
+func (s *prepaidSession) current() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+// drop forgets token after the API refused it. A session opened since by
+// another scan is kept.
+func (s *prepaidSession) drop(token string) {
+	if s == nil || token == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+		s.balance = 0
+	}
+}
+
+// updateBalance records the balance the API reports for the session
+func (s *prepaidSession) updateBalance(h http.Header) {
+	if s == nil {
+		return
+	}
+	value := h.Get(sessionBalanceHeader)
+	if value == "" {
+		return
+	}
+	balance, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.balance = usdc.MicroUSDC(balance)
+	s.mu.Unlock()
+}
+
+// setPrice records what a scan at endpoint costs. Session scans are charged
+// to their host at that price.
+func (s *prepaidSession) setPrice(endpoint string, price usdc.MicroUSDC) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.prices[endpoint] = price
+	s.mu.Unlock()
+}
+
+// price returns what a scan at endpoint costs, if a 402 has told us yet
+func (s *prepaidSession) price(endpoint string) (usdc.MicroUSDC, bool) {
+	if s == nil {
+		return 0, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	price, ok := s.prices[endpoint]
+	return price, ok
+}
+
+// open returns the token of the open session, paying for a new one if
+// needed. It reports false when scans should be paid for one by one instead.
+func (s *prepaidSession) open(ctx context.Context) (string, bool) {
+	if s == nil || s.unsupported.Load() {
+		return "", false
+	}
+
+	s.opening.Lock()
+	defer s.opening.Unlock()
+
+	// Another scan may have opened a session while this one waited
+	s.mu.Lock()
+	token, retryAt := s.token, s.retryAt
+	s.mu.Unlock()
+	if token != "" {
+		return token, true
+	}
+	if s.now().Before(retryAt) {
+		return "", false
+	}
+
+	token, balance, err := s.client.openSession(ctx, s.deposit)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		if errors.Is(err, errSessionUnsupported) {
+			s.unsupported.Store(true)
+		}
+		s.retryAt = s.now().Add(sessionRetryDelay)
+		return "", false
+	}
+	s.token = token
+	s.balance = balance
+	return token, true
+}
+
+// sessionHeaders returns the headers that debit a scan from the session
+// with token, or nil when there is no session
+func sessionHeaders(token string) map[string]string {
+	if token == "" {
+		return nil
+	}
+	return map[string]string{sessionTokenHeader: token}
+}
+
+// errSessionUnsupported means the API predates /v1/sessions
+var errSessionUnsupported = errors.New("prepaid sessions not supported by the API")
+
+// openSessionRequest is the body of a /v1/sessions call
+type openSessionRequest struct {
+	DepositMicroUSDC usdc.MicroUSDC `json:"deposit_micro_usdc"`
+}
+
+// openSessionResponse describes a newly opened session
+type openSessionResponse struct {
+	Token            string         `json:"token"`
+	BalanceMicroUSDC usdc.MicroUSDC `json:"balance_micro_usdc"`
+}
+
+// openSession pays deposit to open a prepaid session and returns its token
+// and balance. The deposit counts against the daily and monthly budget but
+// not against any host; each scan debited from the session is charged to
+// its host by chargeHost instead.
+func (c *ScannerClient) openSession(ctx context.Context, deposit usdc.MicroUSDC) (string, usdc.MicroUSDC, error) {
+	req := openSessionRequest{DepositMicroUSDC: deposit}
+
+	var resp openSessionResponse
+	statusCode, paymentReq, err := c.post(ctx, "/v1/sessions", req, nil, &resp)
+	if statusCode == http.StatusNotFound || statusCode == http.StatusMethodNotAllowed {
+		return "", 0, errSessionUnsupported
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if statusCode != http.StatusPaymentRequired || paymentReq == nil {
+		return "", 0, fmt.Errorf("unexpected response opening session: %d", statusCode)
+	}
+
+	selectedWallet, err := c.walletFor(paymentReq)
+	if err != nil {
+		return "", 0, err
+	}
+
+	amount, err := c.reserve("", paymentReq)
+	if err != nil {
+		return "", 0, err
+	}
+
+	paymentHeader, err := selectedWallet.CreateX402Payment(paymentReq)
+	if err != nil {
+		c.refund("", amount)
+		return "", 0, fmt.Errorf("failed to create payment: %w", err)
+	}
+
+	statusCode, _, err = c.post(ctx, "/v1/sessions", req, paymentHeaders(paymentHeader), &resp)
+	if err != nil {
+		return "", 0, err
+	}
+	if statusCode == http.StatusPaymentRequired {
+		c.refund("", amount)
+		return "", 0, fmt.Errorf("session payment was rejected")
+	}
+	if resp.Token == "" {
+		return "", 0, fmt.Errorf("session opened without a token")
+	}
+	return resp.Token, resp.BalanceMicroUSDC, nil
+}
+
+// chargeHost charges a scan debited from the session with token to host, so
+// the per-host cap holds for session scans too. It returns the token to
+// send and the amount charged. The token is "" when the scan's price is not
+// known yet, so the scan goes without the session and its 402 reveals it.
+func (c *ScannerClient) chargeHost(token, endpoint, host string) (string, usdc.MicroUSDC, error) {
+	if token == "" || c.budget == nil || host == "" {
+		return token, 0, nil
+	}
+	price, ok := c.session.price(endpoint)
+	if !ok {
+		return "", 0, nil
+	}
+	var exceeded *BudgetExceededError
+	if err := c.budget.ReserveHost(host, price); errors.As(err, &exceeded) {
+		return "", 0, err
+	}
+	return token, price, nil
+}
+
+// refundHost reverses chargeHost for a scan the session did not pay for
+func (c *ScannerClient) refundHost(host string, amount usdc.MicroUSDC) {
+	if amount <= 0 || host == "" {
+		return
+	}
+	c.budget.RefundHost(host, amount)
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"stronghold/internal/usdc"
+	"stronghold/internal/wallet"
+)
+
+// newSessionScanServer returns an API that prices scans at $0.001 and sells
+// sessions worth two scans each
+func newSessionScanServer(t *testing.T, sessionsOpened, scanPayments *int32) *httptest.Server {
+	t.Helper()
+	var balance int64
+	var token atomic.Value
+	token.Store("")
+
+	paymentRequired := func(w http.ResponseWriter, amount string) {
+		w.WriteHeader(http.StatusPaymentRequired)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"payment_requirements": map[string]interface{}{
+				"scheme":    "x402",
+				"network":   "base-sepolia",
+				"recipient": "0x1234567890123456789012345678901234567890",
+				"amount":    amount,
+				"currency":  "USDC",
+			},
+		})
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/sessions":
+			var req openSessionRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			if r.Header.Get("X-Payment") == "" {
+				paymentRequired(w, "2000")
+				return
+			}
+			n := atomic.AddInt32(sessionsOpened, 1)
+			newToken := "ps_test" + strconv.Itoa(int(n))
+			token.Store(newToken)
+			atomic.StoreInt64(&balance, 2000)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(openSessionResponse{Token: newToken, BalanceMicroUSDC: 2000})
+		case "/v1/scan/content":
+			if r.Header.Get("X-Payment") != "" {
+				atomic.AddInt32(scanPayments, 1)
+				json.NewEncoder(w).Encode(ScanResult{Decision: DecisionAllow, Reason: "paid"})
+				return
+			}
+			if t := r.Header.Get(sessionTokenHeader); t != "" && t == token.Load().(string) {
+				if remaining := atomic.AddInt64(&balance, -1000); remaining >= 0 {
+					w.Header().Set(sessionBalanceHeader, strconv.FormatInt(remaining, 10))
+					json.NewEncoder(w).Encode(ScanResult{Decision: DecisionAllow, Reason: "session"})
+					return
+				}
+				atomic.StoreInt64(&balance, 0)
+			}
+			paymentRequired(w, "1000")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestScannerClient_Session(t *testing.T) {
+	testWallet, err := wallet.NewTestWallet()
+	if err != nil {
+		t.Fatalf("failed to create test wallet: %v", err)
+	}
+
+	var sessionsOpened, scanPayments int32
+	server := newSessionScanServer(t, &sessionsOpened, &scanPayments)
+	defer server.Close()
+
+	client := NewScannerClient(server.URL, "")
+	client.SetWallet(testWallet)
+	client.SetSession(SessionConfig{Enabled: true, Deposit: 0.002})
+
+	// Two sessions cover four scans
+	for i := 0; i < 4; i++ {
+		result, err := client.ScanContent(context.Background(), []byte("hello"), "http://example.com", "text/plain")
+		if err != nil {
+			t.Fatalf("scan %d failed: %v", i, err)
+		}
+		if result.Reason != "session" {
+			t.Errorf("scan %d: expected to be debited from the session, got %q", i, result.Reason)
+		}
+	}
+	if sessionsOpened != 2 {
+		t.Errorf("expected 2 sessions to be opened, got %d", sessionsOpened)
+	}
+	if scanPayments != 0 {
+		t.Errorf("expected no per-scan payments, got %d", scanPayments)
+	}
+	if client.session.balance != 0 {
+		t.Errorf("expected the reported balance to be 0, got %d", client.session.balance)
+	}
+}
+
+func TestScannerClient_SessionBudget(t *testing.T) {
+	testWallet, err := wallet.NewTestWallet()
+	if err != nil {
+		t.Fatalf("failed to create test wallet: %v", err)
+	}
+
+	var sessionsOpened, scanPayments int32
+	server := newSessionScanServer(t, &sessionsOpened, &scanPayments)
+	defer server.Close()
+
+	client := NewScannerClient(server.URL, "")
+	client.SetWallet(testWallet)
+	ledger := newTestLedger(t, BudgetConfig{DailyLimit: 0.0015, OnExceeded: BudgetFailClosed})
+	client.SetBudget(ledger, 0.55)
+	client.SetSession(SessionConfig{Enabled: true, Deposit: 0.002})
+
+	// The deposit does not fit the daily cap, so the scan is paid on its own
+	result, err := client.ScanContent(context.Background(), []byte("hello"), "http://example.com", "text/plain")
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if result.Reason != "paid" {
+		t.Errorf("expected a per-scan payment, got %q", result.Reason)
+	}
+	if sessionsOpened != 0 {
+		t.Errorf("expected no session to be opened, got %d", sessionsOpened)
+	}
+	if spent := ledger.Summary().Today; spent != usdc.MicroUSDC(1000) {
+		t.Errorf("expected 0.001 spent today, got %s", spent)
+	}
+}
+
+func TestScannerClient_SessionPerHostLimit(t *testing.T) {
+	testWallet, err := wallet.NewTestWallet()
+	if err != nil {
+		t.Fatalf("failed to create test wallet: %v", err)
+	}
+
+	var sessionsOpened, scanPayments int32
+	server := newSessionScanServer(t, &sessionsOpened, &scanPayments)
+	defer server.Close()
+
+	client := NewScannerClient(server.URL, "")
+	client.SetWallet(testWallet)
+	ledger := newTestLedger(t, BudgetConfig{DailyLimit: 1, PerHostDailyLimit: 0.0015, OnExceeded: BudgetFailClosed})
+	client.SetBudget(ledger, 0.55)
+	client.SetSession(SessionConfig{Enabled: true, Deposit: 0.002})
+
+	result, err := client.ScanContent(context.Background(), []byte("hello"), "http://example.com", "text/plain")
+	if err != nil || result.Reason != "session" {
+		t.Fatalf("expected the first scan to be debited from the session, got %+v, %v", result, err)
+	}
+
+	// The session still has balance, but the host is at its cap
+	result, err = client.ScanContent(context.Background(), []byte("hello"), "http://example.com/page", "text/plain")
+	if err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if result.Decision != DecisionBlock || result.Metadata["budget_exceeded"] != "host" {
+		t.Errorf("expected the per-host cap to block the scan, got %+v", result)
+	}
+
+	// Other hosts can still use the session
+	result, err = client.ScanContent(context.Background(), []byte("hello"), "http://example.org", "text/plain")
+	if err != nil || result.Reason != "session" {
+		t.Errorf("expected another host to be debited from the session, got %+v, %v", result, err)
+	}
+
+	summary := ledger.Summary()
+	if summary.Today != usdc.MicroUSDC(2000) {
+		t.Errorf("expected only the deposit in today's total, got %s", summary.Today)
+	}
+	if len(summary.Hosts) != 2 || summary.Hosts[0].Amount != usdc.MicroUSDC(1000) {
+		t.Errorf("expected each host to be charged one scan, got %+v", summary.Hosts)
+	}
+}
+
+func TestScannerClient_SessionUnsupported(t *testing.T) {
+	testWallet, err := wallet.NewTestWallet()
+	if err != nil {
+		t.Fatalf("failed to create test wallet: %v", err)
+	}
+
+	var scanPayments int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/scan/content" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("X-Payment") == "" {
+			w.WriteHeader(http.StatusPaymentRequired)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"payment_requirements": map[string]interface{}{
+					"scheme":    "x402",
+					"network":   "base-sepolia",
+					"recipient": "0x1234567890123456789012345678901234567890",
+					"amount":    "1000",
+					"currency":  "USDC",
+				},
+			})
+			return
+		}
+		atomic.AddInt32(&scanPayments, 1)
+		json.NewEncoder(w).Encode(ScanResult{Decision: DecisionAllow, Reason: "paid"})
+	}))
+	defer server.Close()
+
+	client := NewScannerClient(server.URL, "")
+	client.SetWallet(testWallet)
+	client.SetSession(SessionConfig{Enabled: true, Deposit: 0.1})
+
+	for i := 0; i < 2; i++ {
+		result, err := client.ScanContent(context.Background(), []byte("hello"), "http://example.com", "text/plain")
+		if err != nil || result.Reason != "paid" {
+			t.Fatalf("scan %d: expected fallback to a per-scan payment, got %+v, %v", i, result, err)
+		}
+	}
+	if scanPayments != 2 {
+		t.Errorf("expected 2 per-scan payments, got %d", scanPayments)
+	}
+	if !client.session.unsupported.Load() {
+		t.Error("expected sessions to be disabled after the API rejected them")
+	}
+}
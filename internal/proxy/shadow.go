@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// shadowMaxSize is the size at which the shadow log is rotated. One
+// rotated file is kept, so the log takes at most twice this on disk.
+const shadowMaxSize = 64 << 20
+
+// ShadowConfig controls shadow mode, in which policy is evaluated and
+// recorded but not enforced
+type ShadowConfig struct {
+	Enabled bool   `yaml:"enabled"` // Shadow every policy; scanning.content.shadow and scanning.output.shadow shadow one
+	File    string `yaml:"file"`    // Where would-be actions are recorded
+}
+
+// ShadowRecord is one scan evaluated in shadow mode and the action policy
+// would have taken on it
+type ShadowRecord struct {
+	At         time.Time `json:"at"`
+	Host       string    `json:"host"`
+	URL        string    `json:"url"`
+	Direction  string    `json:"direction"`
+	ScanType   string    `json:"scan_type"`
+	Decision   Decision  `json:"decision"`
+	Action     string    `json:"action"` // Would-be action: allow, warn, sanitize, hold or block
+	Reason     string    `json:"reason,omitempty"`
+	Categories []string  `json:"categories,omitempty"` // Threat categories, or the scan type when none were reported
+	RequestID  string    `json:"request_id,omitempty"`
+	Transport  string    `json:"transport,omitempty"`
+}
+
+// ShadowLog appends shadow records to a JSON lines file
+type ShadowLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// OpenShadowLog opens the shadow log at path. The file is created on the
+// first record.
+func OpenShadowLog(path string) *ShadowLog {
+	return &ShadowLog{path: path}
+}
+
+// Record appends rec, rotating the log once it reaches shadowMaxSize
+func (l *ShadowLog) Record(rec ShadowRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode shadow record: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if info, err := os.Stat(l.path); err == nil && info.Size() >= shadowMaxSize {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate shadow log: %w", err)
+		}
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open shadow log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write shadow record: %w", err)
+	}
+	return nil
+}
+
+// Records returns the records made at or after since, oldest first,
+// including those in the rotated file
+func (l *ShadowLog) Records(since time.Time) ([]ShadowRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var records []ShadowRecord
+	for _, path := range []string{l.path + ".1", l.path} {
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open shadow log: %w", err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec ShadowRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue // A torn write loses one record, not the log
+			}
+			if !rec.At.Before(since) {
+				records = append(records, rec)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read shadow log: %w", err)
+		}
+	}
+	return records, nil
+}
+
+// ShadowCount tallies would-be actions over a set of shadow records
+type ShadowCount struct {
+	Name     string           // Host or category
+	Scans    int64            // Scans evaluated
+	Actions  map[string]int64 // Scans by would-be action
+	Category string           // Most frequent category of would-be blocks; hosts only
+}
+
+// Blocked returns the number of scans that would have been blocked
+func (c ShadowCount) Blocked() int64 { return c.Actions["block"] }
+
+// Flagged returns the number of scans that would have been warned,
+// sanitized or held
+func (c ShadowCount) Flagged() int64 {
+	return c.Actions["warn"] + c.Actions["sanitize"] + c.Actions["hold"]
+}
+
+// ShadowSummary aggregates shadow records by host and by category
+type ShadowSummary struct {
+	Total      ShadowCount
+	Hosts      []ShadowCount // Most would-be blocks first
+	Categories []ShadowCount // Categories of would-be blocks, most frequent first
+}
+
+// SummarizeShadow aggregates records for 'stronghold shadow report'
+func SummarizeShadow(records []ShadowRecord) ShadowSummary {
+	summary := ShadowSummary{Total: ShadowCount{Actions: make(map[string]int64)}}
+	hosts := make(map[string]*ShadowCount)
+	hostCategories := make(map[string]map[string]int)
+	categories := make(map[string]*ShadowCount)
+	for _, rec := range records {
+		summary.Total.Scans++
+		summary.Total.Actions[rec.Action]++
+
+		h := hosts[rec.Host]
+		if h == nil {
+			h = &ShadowCount{Name: rec.Host, Actions: make(map[string]int64)}
+			hosts[rec.Host] = h
+			hostCategories[rec.Host] = make(map[string]int)
+		}
+		h.Scans++
+		h.Actions[rec.Action]++
+
+		if rec.Action != "block" {
+			continue
+		}
+		for _, category := range rec.Categories {
+			hostCategories[rec.Host][category]++
+			c := categories[category]
+			if c == nil {
+				c = &ShadowCount{Name: category, Actions: make(map[string]int64)}
+				categories[category] = c
+			}
+			c.Scans++
+			c.Actions["block"]++
+		}
+	}
+
+	for name, h := range hosts {
+		h.Category = topCategory(hostCategories[name])
+		summary.Hosts = append(summary.Hosts, *h)
+	}
+	sort.Slice(summary.Hosts, func(i, j int) bool {
+		a, b := summary.Hosts[i], summary.Hosts[j]
+		if a.Blocked() != b.Blocked() {
+			return a.Blocked() > b.Blocked()
+		}
+		if a.Scans != b.Scans {
+			return a.Scans > b.Scans
+		}
+		return a.Name < b.Name
+	})
+	for _, c := range categories {
+		summary.Categories = append(summary.Categories, *c)
+	}
+	sort.Slice(summary.Categories, func(i, j int) bool {
+		a, b := summary.Categories[i], summary.Categories[j]
+		if a.Blocked() != b.Blocked() {
+			return a.Blocked() > b.Blocked()
+		}
+		return a.Name < b.Name
+	})
+	return summary
+}
+
+// topCategory returns the most frequent category, the first by name on a tie
+func topCategory(counts map[string]int) string {
+	top := ""
+	for name, n := range counts {
+		if top == "" || n > counts[top] || (n == counts[top] && name < top) {
+			top = name
+		}
+	}
+	return top
+}
+
+// shadowCategories lists the distinct threat categories of a result,
+// falling back to the scan type for verdicts that report none
+func shadowCategories(result *ScanResult, scanType string) []string {
+	var categories []string
+	seen := make(map[string]bool)
+	for _, t := range result.ThreatsFound {
+		if t.Category != "" && !seen[t.Category] {
+			seen[t.Category] = true
+			categories = append(categories, t.Category)
+		}
+	}
+	if len(categories) == 0 && scanType != "" {
+		categories = append(categories, scanType)
+	}
+	return categories
+}
+
+// recordShadow logs and records the action policy would have taken on x
+func (p *pipeline) recordShadow(x *interception) {
+	result := x.result
+	if x.shadowAction != "allow" {
+		p.logger.Info("content would be "+shadowVerb(x.shadowAction)+" (shadow mode)", "url", x.url, "direction", x.direction(), "reason", result.Reason, "decision", result.Decision)
+	}
+	if p.shadow == nil {
+		return
+	}
+	err := p.shadow.Record(ShadowRecord{
+		At:         time.Now().UTC(),
+		Host:       spendHost(x.url),
+		URL:        x.url,
+		Direction:  x.direction(),
+		ScanType:   x.scanType,
+		Decision:   result.Decision,
+		Action:     x.shadowAction,
+		Reason:     result.Reason,
+		Categories: shadowCategories(result, x.scanType),
+		RequestID:  x.requestID,
+		Transport:  x.transport,
+	})
+	if err != nil {
+		p.logger.Warn("failed to record shadow action", "url", x.url, "error", err)
+	}
+}
+
+// shadowVerb describes a would-be action in logs
+func shadowVerb(action string) string {
+	switch action {
+	case "block":
+		return "blocked"
+	case "warn":
+		return "warned"
+	case "sanitize":
+		return "sanitized"
+	case "hold":
+		return "held"
+	}
+	return "allowed"
+}
@@ -0,0 +1,336 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"stronghold/internal/usdc"
+)
+
+// statsFlushInterval is how often counted traffic is written to the stats file
+const statsFlushInterval = 30 * time.Second
+
+// maxStatsHostsPerDay bounds the hosts tracked for one day; traffic from
+// further hosts is counted under statsOtherHosts
+const maxStatsHostsPerDay = 1000
+
+// statsOtherHosts collects traffic from hosts past maxStatsHostsPerDay
+const statsOtherHosts = "(other)"
+
+// StatsConfig controls the traffic statistics the proxy keeps per day
+type StatsConfig struct {
+	File          string `yaml:"file"`           // Where statistics are stored
+	RetentionDays int    `yaml:"retention_days"` // Days kept in full before rolling up into months
+}
+
+// applyDefaultStatsConfig sets default values for StatsConfig if not already set
+func applyDefaultStatsConfig(cfg *StatsConfig) {
+	// If RetentionDays is zero, this is an old config without the stats section
+	if cfg.RetentionDays == 0 {
+		cfg.RetentionDays = 90
+	}
+}
+
+// TrafficCounts are the counters kept for a day, a host or a month
+type TrafficCounts struct {
+	Requests int64          `json:"requests"`
+	Blocked  int64          `json:"blocked"`
+	Warned   int64          `json:"warned"`
+	Skipped  int64          `json:"skipped"` // Passed without a scan
+	Spend    usdc.MicroUSDC `json:"spend"`   // x402 scan payments
+}
+
+func (c *TrafficCounts) add(o TrafficCounts) {
+	c.Requests += o.Requests
+	c.Blocked += o.Blocked
+	c.Warned += o.Warned
+	c.Skipped += o.Skipped
+	c.Spend += o.Spend
+}
+
+// DayStats is the traffic counted on one calendar day
+type DayStats struct {
+	TrafficCounts
+	Hosts map[string]*TrafficCounts `json:"hosts,omitempty"`
+}
+
+// MonthStats is the traffic of the days of a month that were rolled up
+type MonthStats struct {
+	TrafficCounts
+	First string `json:"first,omitempty"` // Earliest day rolled up; files written before it was kept leave it empty
+}
+
+// statsData is the content of the stats file. Days past the retention
+// period are rolled up into months without their per-host breakdown.
+type statsData struct {
+	Days   map[string]*DayStats   `json:"days"`
+	Months map[string]*MonthStats `json:"months"`
+}
+
+// StatsStore counts proxied traffic per day and host. The proxy keeps the
+// counts in memory and writes them periodically; the CLI reads the file for
+// status reports.
+type StatsStore struct {
+	path      string
+	retention int
+
+	mu    sync.Mutex
+	data  statsData
+	dirty bool
+	now   func() time.Time
+}
+
+// OpenStats loads the stats file at cfg.File, starting empty statistics if
+// the file does not exist yet
+func OpenStats(cfg StatsConfig) (*StatsStore, error) {
+	if cfg.File == "" {
+		return nil, errors.New("stats file is not configured")
+	}
+
+	s := &StatsStore{
+		path:      cfg.File,
+		retention: cfg.RetentionDays,
+		data: statsData{
+			Days:   make(map[string]*DayStats),
+			Months: make(map[string]*MonthStats),
+		},
+		now: time.Now,
+	}
+
+	data, err := os.ReadFile(cfg.File)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.data); err != nil {
+		return nil, fmt.Errorf("failed to parse stats: %w", err)
+	}
+	if s.data.Days == nil {
+		s.data.Days = make(map[string]*DayStats)
+	}
+	if s.data.Months == nil {
+		s.data.Months = make(map[string]*MonthStats)
+	}
+	return s, nil
+}
+
+// count adds counts to today's totals and to host
+func (s *StatsStore) count(host string, counts TrafficCounts) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day, ok := s.data.Days[dayKey(s.now())]
+	if !ok {
+		day = &DayStats{}
+		s.data.Days[dayKey(s.now())] = day
+	}
+	day.add(counts)
+	if host != "" {
+		if day.Hosts == nil {
+			day.Hosts = make(map[string]*TrafficCounts)
+		}
+		h, ok := day.Hosts[host]
+		if !ok && len(day.Hosts) >= maxStatsHostsPerDay {
+			h, ok = day.Hosts[statsOtherHosts]
+			host = statsOtherHosts
+		}
+		if !ok {
+			h = &TrafficCounts{}
+			day.Hosts[host] = h
+		}
+		h.add(counts)
+	}
+	s.dirty = true
+}
+
+// recordRequest counts one intercepted request and its outcome
+func (s *StatsStore) recordRequest(host string, decision Decision, skipped bool) {
+	counts := TrafficCounts{Requests: 1}
+	switch {
+	case skipped:
+		counts.Skipped = 1
+	case decision == DecisionBlock:
+		counts.Blocked = 1
+	case decision == DecisionWarn:
+		counts.Warned = 1
+	}
+	s.count(host, counts)
+}
+
+// recordSpend counts an x402 payment made to scan content from host. A
+// negative amount reverses a payment that was not made.
+func (s *StatsStore) recordSpend(host string, amount usdc.MicroUSDC) {
+	s.count(host, TrafficCounts{Spend: amount})
+}
+
+// Flush rolls up days past the retention period and writes the stats file
+// if anything changed since the last write
+func (s *StatsStore) Flush() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.rollUpLocked(s.now()) && !s.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode stats: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create stats directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write stats: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
+
+// flushEvery writes the stats file every interval until ctx is done
+func (s *StatsStore) flushEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// rollUpLocked folds days older than the retention period into their
+// month. It reports whether anything was rolled up. Callers must hold s.mu.
+func (s *StatsStore) rollUpLocked(now time.Time) bool {
+	if s.retention <= 0 {
+		return false
+	}
+	cutoff := dayKey(now.AddDate(0, 0, -s.retention))
+	rolled := false
+	for key, day := range s.data.Days {
+		if key >= cutoff {
+			continue
+		}
+		month := key[:len("2006-01")]
+		m, ok := s.data.Months[month]
+		if !ok {
+			m = &MonthStats{}
+			s.data.Months[month] = m
+		}
+		m.add(day.TrafficCounts)
+		if m.First == "" || key < m.First {
+			m.First = key
+		}
+		delete(s.data.Days, key)
+		rolled = true
+	}
+	return rolled
+}
+
+// DayHistory is the traffic counted on one day
+type DayHistory struct {
+	Date string
+	TrafficCounts
+}
+
+// MonthHistory is the traffic of a month whose days were rolled up
+type MonthHistory struct {
+	Month string
+	TrafficCounts
+}
+
+// HostHistory is the traffic counted for one host over a period
+type HostHistory struct {
+	Host string
+	TrafficCounts
+}
+
+// StatsHistory reports traffic over the last few days
+type StatsHistory struct {
+	Days   []DayHistory   // One entry per day, oldest first, including quiet days
+	Months []MonthHistory // Rolled-up months within the period, oldest first
+	Hosts  []HostHistory  // Per-host totals over the days kept in full, most requests first
+	Total  TrafficCounts  // Sum of Days and Months
+}
+
+// History returns the traffic of the last days days, today included. Days
+// past the retention period are reported through their rolled-up month,
+// which is only included when the period covers every day rolled into it.
+func (s *StatsStore) History(days int) StatsHistory {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var history StatsHistory
+	hosts := make(map[string]*TrafficCounts)
+	oldest := now.AddDate(0, 0, -(days - 1))
+
+	for i := days - 1; i >= 0; i-- {
+		key := dayKey(now.AddDate(0, 0, -i))
+		entry := DayHistory{Date: key}
+		if day, ok := s.data.Days[key]; ok {
+			entry.TrafficCounts = day.TrafficCounts
+			for host, counts := range day.Hosts {
+				h, ok := hosts[host]
+				if !ok {
+					h = &TrafficCounts{}
+					hosts[host] = h
+				}
+				h.add(*counts)
+			}
+		}
+		history.Days = append(history.Days, entry)
+		history.Total.add(entry.TrafficCounts)
+	}
+
+	// A month cannot be split by day, so one that starts before the period
+	// is left out rather than overcounted
+	oldestKey := dayKey(oldest)
+	for month, m := range s.data.Months {
+		first := m.First
+		if first == "" {
+			first = month + "-01"
+		}
+		if first >= oldestKey {
+			history.Months = append(history.Months, MonthHistory{Month: month, TrafficCounts: m.TrafficCounts})
+			history.Total.add(m.TrafficCounts)
+		}
+	}
+	sort.Slice(history.Months, func(i, j int) bool {
+		return history.Months[i].Month < history.Months[j].Month
+	})
+
+	for host, counts := range hosts {
+		history.Hosts = append(history.Hosts, HostHistory{Host: host, TrafficCounts: *counts})
+	}
+	sort.Slice(history.Hosts, func(i, j int) bool {
+		if history.Hosts[i].Requests != history.Hosts[j].Requests {
+			return history.Hosts[i].Requests > history.Hosts[j].Requests
+		}
+		return history.Hosts[i].Host < history.Hosts[j].Host
+	})
+	return history
+}
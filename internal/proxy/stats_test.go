@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStats(t *testing.T, cfg StatsConfig) *StatsStore {
+	t.Helper()
+	if cfg.File == "" {
+		cfg.File = filepath.Join(t.TempDir(), "stats.json")
+	}
+	s, err := OpenStats(cfg)
+	if err != nil {
+		t.Fatalf("OpenStats failed: %v", err)
+	}
+	return s
+}
+
+func TestStatsStore_PersistsHistory(t *testing.T) {
+	cfg := StatsConfig{File: filepath.Join(t.TempDir(), "stats.json"), RetentionDays: 90}
+	s := newTestStats(t, cfg)
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	s.now = func() time.Time { return now }
+
+	s.recordRequest("a.example", DecisionAllow, false)
+	s.recordRequest("a.example", DecisionBlock, false)
+	s.recordSpend("a.example", 1000)
+	now = now.AddDate(0, 0, 1)
+	s.recordRequest("b.example", DecisionWarn, false)
+	s.recordRequest("b.example", "", true)
+	s.recordSpend("b.example", 2000)
+	s.recordSpend("b.example", -2000)
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	reopened := newTestStats(t, cfg)
+	reopened.now = s.now
+	history := reopened.History(3)
+
+	if len(history.Days) != 3 || history.Days[0].Date != "2026-03-09" || history.Days[2].Date != "2026-03-11" {
+		t.Fatalf("expected 3 days ending today, got %+v", history.Days)
+	}
+	if history.Days[0].Requests != 0 {
+		t.Errorf("expected a quiet first day, got %+v", history.Days[0])
+	}
+	day := history.Days[1].TrafficCounts
+	if day != (TrafficCounts{Requests: 2, Blocked: 1, Spend: 1000}) {
+		t.Errorf("unexpected counts for 2026-03-10: %+v", day)
+	}
+	today := history.Days[2].TrafficCounts
+	if today != (TrafficCounts{Requests: 2, Warned: 1, Skipped: 1}) {
+		t.Errorf("unexpected counts for today: %+v", today)
+	}
+	if history.Total.Requests != 4 {
+		t.Errorf("expected 4 requests in total, got %d", history.Total.Requests)
+	}
+	if len(history.Hosts) != 2 || history.Hosts[0].Host != "a.example" || history.Hosts[0].Blocked != 1 {
+		t.Errorf("unexpected hosts: %+v", history.Hosts)
+	}
+}
+
+func TestStatsStore_RollsUpOldDays(t *testing.T) {
+	s := newTestStats(t, StatsConfig{RetentionDays: 7})
+	now := time.Date(2026, 1, 30, 12, 0, 0, 0, time.Local)
+	s.now = func() time.Time { return now }
+
+	s.recordRequest("a.example", DecisionBlock, false)
+	now = now.AddDate(0, 0, 1)
+	s.recordRequest("a.example", DecisionAllow, false)
+
+	// Both January days are past retention by mid-February
+	now = time.Date(2026, 2, 15, 12, 0, 0, 0, time.Local)
+	s.recordRequest("b.example", DecisionAllow, false)
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	if len(s.data.Days) != 1 {
+		t.Errorf("expected only today to be kept in full, got %d days", len(s.data.Days))
+	}
+	history := s.History(30)
+	if len(history.Months) != 1 || history.Months[0].Month != "2026-01" {
+		t.Fatalf("expected January to be rolled up, got %+v", history.Months)
+	}
+	if history.Months[0].TrafficCounts != (TrafficCounts{Requests: 2, Blocked: 1}) {
+		t.Errorf("unexpected rolled-up counts: %+v", history.Months[0].TrafficCounts)
+	}
+	if history.Total.Requests != 3 {
+		t.Errorf("expected rolled-up months in the total, got %d", history.Total.Requests)
+	}
+
+	// A period that starts after January 30 only covers part of the month
+	for _, days := range []int{1, 16} {
+		history = s.History(days)
+		if len(history.Months) != 0 || history.Total.Requests != 1 {
+			t.Errorf("History(%d): expected only today's traffic, got %+v", days, history)
+		}
+	}
+}
+
+func TestStatsStore_BoundsHostsPerDay(t *testing.T) {
+	s := newTestStats(t, StatsConfig{RetentionDays: 7})
+	for i := 0; i < maxStatsHostsPerDay+5; i++ {
+		s.recordRequest(fmt.Sprintf("host%d.example", i), DecisionAllow, false)
+	}
+	day := s.data.Days[dayKey(s.now())]
+	if len(day.Hosts) != maxStatsHostsPerDay+1 {
+		t.Errorf("expected %d hosts plus %q, got %d", maxStatsHostsPerDay, statsOtherHosts, len(day.Hosts))
+	}
+	if day.Hosts[statsOtherHosts].Requests != 5 {
+		t.Errorf("expected 5 requests under %q, got %d", statsOtherHosts, day.Hosts[statsOtherHosts].Requests)
+	}
+}
+
+func TestHandleHTTP_RecordsStats(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/image" {
+			w.Header().Set("Content-Type", "image/png")
+		} else {
+			w.Header().Set("Content-Type", "text/plain")
+		}
+		w.Write([]byte("content"))
+	}))
+	defer upstream.Close()
+
+	scanner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ScanResult{Decision: DecisionBlock, Reason: "Prompt injection detected"})
+	}))
+	defer scanner.Close()
+
+	config := newTestConfig(scanner.URL)
+	config.Stats = StatsConfig{File: filepath.Join(t.TempDir(), "stats.json"), RetentionDays: 90}
+	s := newTestServer(t, config)
+	if s.stats == nil {
+		t.Fatal("expected stats to be opened")
+	}
+
+	for _, path := range []string{"/page", "/image"} {
+		rec := httptest.NewRecorder()
+		s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest("GET", upstream.URL+path, nil))
+	}
+
+	history := s.stats.History(1)
+	if history.Total != (TrafficCounts{Requests: 2, Blocked: 1, Skipped: 1}) {
+		t.Errorf("unexpected counts: %+v", history.Total)
+	}
+	if len(history.Hosts) != 1 || history.Hosts[0].Host != "127.0.0.1" {
+		t.Errorf("expected traffic attributed to the upstream host, got %+v", history.Hosts)
+	}
+}
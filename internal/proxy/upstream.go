@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UpstreamConfig controls the pool of connections the MITM path keeps to
+// origin servers. Connections are shared by every intercepted client.
+type UpstreamConfig struct {
+	MaxIdlePerHost  int           `yaml:"max_idle_per_host"`  // Idle connections kept per host
+	MaxConnsPerHost int           `yaml:"max_conns_per_host"` // Requests wait beyond this many connections per host (0 = no limit)
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`       // Idle connections are closed after this
+	HTTP2           bool          `yaml:"http2"`              // Negotiate HTTP/2 with origins that support it
+}
+
+// applyDefaultUpstreamConfig sets default values for UpstreamConfig if not already set
+func applyDefaultUpstreamConfig(cfg *UpstreamConfig) {
+	// If MaxIdlePerHost is zero, this is an old config without the upstream section
+	if cfg.MaxIdlePerHost == 0 {
+		cfg.MaxIdlePerHost = 8
+		cfg.MaxConnsPerHost = 64
+		cfg.IdleTimeout = 90 * time.Second
+		cfg.HTTP2 = true
+	}
+}
+
+// newUpstreamTransport returns the transport intercepted requests are sent
+// through. Compression is left to the client so bodies are scanned and
+// forwarded exactly as the origin sent them.
+func newUpstreamTransport(cfg UpstreamConfig) *http.Transport {
+	t := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     &tls.Config{MinVersion: tls.VersionTLS12},
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        cfg.MaxIdlePerHost * 32,
+		MaxIdleConnsPerHost: cfg.MaxIdlePerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.IdleTimeout,
+		DisableCompression:  true,
+		ForceAttemptHTTP2:   cfg.HTTP2,
+	}
+	if !cfg.HTTP2 {
+		// A non-nil empty map disables HTTP/2
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// hopHeaders are connection-specific headers that are not forwarded to a
+// pooled upstream connection
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopHeaders strips connection-specific headers, including any the
+// Connection header names
+func removeHopHeaders(h http.Header) {
+	for _, value := range h.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// toHTTP1 rewrites an upstream response, which may have arrived over
+// HTTP/2, so it can be written to an HTTP/1.1 client connection that stays open
+func toHTTP1(resp *http.Response) {
+	removeHopHeaders(resp.Header)
+	resp.Proto = "HTTP/1.1"
+	resp.ProtoMajor = 1
+	resp.ProtoMinor = 1
+	resp.Close = false
+	resp.TransferEncoding = nil
+	if resp.ContentLength < 0 && responseHasBody(resp) {
+		resp.TransferEncoding = []string{"chunked"}
+	}
+}
+
+// responseHasBody reports whether HTTP/1.1 allows resp to carry a body
+func responseHasBody(resp *http.Response) bool {
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return false
+	}
+	code := resp.StatusCode
+	return code >= 200 && code != http.StatusNoContent && code != http.StatusNotModified
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mitmGet sends one GET through a fresh client connection to the MITM
+// handler and returns the response and its body
+func mitmGet(t *testing.T, m *MITMHandler, ca *CA, dst, path string) (*http.Response, string) {
+	t.Helper()
+	serverSide, testSide := net.Pipe()
+	defer testSide.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- m.HandleTLS(serverSide, dst) }()
+
+	caPool := x509.NewCertPool()
+	caPool.AddCert(ca.cert)
+	conn := tls.Client(testSide, &tls.Config{ServerName: "localhost", RootCAs: caPool})
+	if err := conn.Handshake(); err != nil {
+		t.Fatalf("TLS handshake with MITM failed: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "https://localhost"+path, nil)
+	req.Close = true
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("failed to write request: %v", err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// Close the pipe rather than the TLS connection: both sides sending
+	// close_notify over an unbuffered pipe would wait for each other
+	testSide.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("HandleTLS did not return after the client closed")
+	}
+	return resp, string(body)
+}
+
+func TestMITM_UpstreamPoolReusesConnections(t *testing.T) {
+	var newConns int32
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Upstream-Proto", r.Proto)
+		w.Write([]byte("upstream " + r.URL.Path))
+	}))
+	upstream.EnableHTTP2 = true
+	upstream.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&newConns, 1)
+		}
+	}
+	upstream.StartTLS()
+	defer upstream.Close()
+	_, upstreamPort, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+
+	ca, err := NewCA()
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	certCache := NewCertCache(ca)
+	defer certCache.Stop()
+
+	scanner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ScanResult{Decision: DecisionAllow})
+	}))
+	defer scanner.Close()
+
+	config := newTestConfig(scanner.URL)
+	applyDefaultUpstreamConfig(&config.Upstream)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := NewMITMHandler(certCache, NewScannerClient(scanner.URL, ""), config, logger)
+	m.upstream.TLSClientConfig.RootCAs = x509.NewCertPool()
+	m.upstream.TLSClientConfig.RootCAs.AddCert(upstream.Certificate())
+	m.upstream.TLSClientConfig.ServerName = "example.com" // Name in the httptest certificate
+	defer m.CloseIdleConnections()
+
+	dst := "localhost:" + upstreamPort
+	for _, path := range []string{"/one", "/two", "/three"} {
+		resp, body := mitmGet(t, m, ca, dst, path)
+		if body != "upstream "+path {
+			t.Errorf("expected body %q, got %q", "upstream "+path, body)
+		}
+		if resp.ProtoMajor != 1 {
+			t.Errorf("expected an HTTP/1.x response to the client, got %s", resp.Proto)
+		}
+		if got := resp.Header.Get("X-Upstream-Proto"); got != "HTTP/2.0" {
+			t.Errorf("expected HTTP/2 to the origin, got %q", got)
+		}
+	}
+
+	if n := atomic.LoadInt32(&newConns); n != 1 {
+		t.Errorf("expected 3 client connections to share 1 origin connection, got %d", n)
+	}
+}
+
+func TestRemoveHopHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Connection", "keep-alive, X-Hop")
+	h.Set("X-Hop", "1")
+	h.Set("Keep-Alive", "timeout=5")
+	h.Set("X-End-To-End", "1")
+
+	removeHopHeaders(h)
+
+	for _, name := range []string{"Connection", "X-Hop", "Keep-Alive"} {
+		if h.Get(name) != "" {
+			t.Errorf("expected %s to be removed", name)
+		}
+	}
+	if h.Get("X-End-To-End") == "" {
+		t.Error("expected end-to-end header to be kept")
+	}
+}
@@ -254,10 +254,18 @@ func (s *Server) setupRoutes() {
 	scanHandler := handlers.NewScanHandlerWithPaymentRouter(s.scanner, x402, s.database, &s.config.Pricing, paymentRouter)
 	scanHandler.RegisterRoutes(s.app)
 
+	// Prepaid sessions (one x402 payment funds many scans)
+	sessionHandler := handlers.NewPrepaidSessionHandler(x402, s.database, &s.config.Pricing, s.config.X402.SessionTTL)
+	sessionHandler.RegisterRoutes(s.app)
+
 	// Account settings handlers (session auth required)
 	settingsHandler := handlers.NewSettingsHandler(s.database)
 	settingsHandler.RegisterRoutes(s.app, s.authHandler)
 
+	// Custom detection rules (session auth required)
+	accountRulesHandler := handlers.NewAccountRulesHandler(s.database)
+	accountRulesHandler.RegisterRoutes(s.app, s.authHandler)
+
 	// API documentation
 	docsHandler := handlers.NewDocsHandler()
 	docsHandler.RegisterRoutes(s.app)
@@ -156,6 +156,7 @@ func (w *Worker) runExpirationLoop(ctx context.Context) {
 			return
 		case <-ticker.C:
 			w.expireStaleReservations(ctx)
+			w.cleanupPrepaidSessions(ctx)
 		}
 	}
 }
@@ -250,6 +251,19 @@ func (w *Worker) expireStaleReservations(ctx context.Context) {
 	}
 }
 
+// cleanupPrepaidSessions removes prepaid sessions that expired a day or more ago
+func (w *Worker) cleanupPrepaidSessions(ctx context.Context) {
+	count, err := w.db.CleanupExpiredPrepaidSessions(ctx)
+	if err != nil {
+		slog.Error("failed to clean up prepaid sessions", "error", err)
+		return
+	}
+
+	if count > 0 {
+		slog.Info("removed expired prepaid sessions", "count", count)
+	}
+}
+
 // calculateBackoff returns the backoff duration for a given attempt number.
 // Uses exponential backoff with jitter to prevent thundering herd:
 // Base delays: 2s, 4s, 8s, 16s, capped at 30s, plus random jitter up to 50% of delay.
@@ -11,6 +11,7 @@ import (
 	citadelConfig "github.com/TryMightyAI/citadel/pkg/config"
 	"github.com/TryMightyAI/citadel/pkg/ml"
 	"stronghold/internal/config"
+	"stronghold/internal/pii"
 )
 
 // Decision represents the scan decision
@@ -37,11 +38,13 @@ type ScanResult struct {
 
 // Threat represents a detected threat with location info
 type Threat struct {
-	Category    string `json:"category"`    // Broad category: "prompt_injection", "credential_leak"
-	Pattern     string `json:"pattern"`     // What matched (the specific pattern)
-	Location    string `json:"location"`    // Where in text (line/offset if available)
-	Severity    string `json:"severity"`    // "high", "medium", "low"
-	Description string `json:"description"` // Human-readable explanation
+	Category    string `json:"category"`          // Broad category: "prompt_injection", "credential_leak"
+	Pattern     string `json:"pattern"`           // What matched (the specific pattern)
+	Location    string `json:"location"`          // Where in text (line/offset if available)
+	Severity    string `json:"severity"`          // "high", "medium", "low"
+	Description string `json:"description"`       // Human-readable explanation
+	Tool        string `json:"tool,omitempty"`    // MCP tool whose result held the threat
+	CallID      string `json:"call_id,omitempty"` // JSON-RPC id of the MCP response holding the threat
 }
 
 // Scanner wraps the Citadel security scanner
@@ -207,8 +210,10 @@ func (s *Scanner) scanWithThreatScorer(text, sourceURL, sourceType, contentType
 	}, nil
 }
 
-// ScanOutput scans LLM output for credential leaks using Citadel
-func (s *Scanner) ScanOutput(ctx context.Context, text string) (*ScanResult, error) {
+// ScanOutput scans LLM output for credential leaks using Citadel, and for
+// personal data according to policy when one is given. The sanitized text
+// has credentials and any personal data redacted.
+func (s *Scanner) ScanOutput(ctx context.Context, text string, policy pii.Policy) (*ScanResult, error) {
 	start := time.Now()
 
 	// Use Citadel's output scanner for credential detection
@@ -233,22 +238,25 @@ func (s *Scanner) ScanOutput(ctx context.Context, text string) (*ScanResult, err
 	// Convert findings to threats
 	threats := convertOutputFindings(result.Details)
 
-	return &ScanResult{
+	scanResult := &ScanResult{
 		Decision: decision,
 		Scores: map[string]float64{
 			"credential_score": score,
 			"findings_count":   float64(len(result.Details)),
 		},
-		Reason:    reason,
-		LatencyMs: time.Since(start).Milliseconds(),
-		ThreatsFound: threats,
+		Reason:        reason,
+		SanitizedText: s.sanitizeText(text, threats),
+		ThreatsFound:  threats,
 		Metadata: map[string]interface{}{
-			"findings":     len(result.Details),
-			"risk_level":   result.RiskLevel,
-			"is_safe":      result.IsSafe,
-			"categories":   result.ThreatCategories,
+			"findings":   len(result.Details),
+			"risk_level": result.RiskLevel,
+			"is_safe":    result.IsSafe,
+			"categories": result.ThreatCategories,
 		},
-	}, nil
+	}
+	ApplyPII(scanResult, text, policy)
+	scanResult.LatencyMs = time.Since(start).Milliseconds()
+	return scanResult, nil
 }
 
 // sanitizeText sanitizes text based on detected threats
@@ -0,0 +1,246 @@
+package stronghold
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Custom rule types
+const (
+	CustomRuleRegex   = "regex"   // Pattern is a regular expression
+	CustomRuleKeyword = "keyword" // Any of Keywords appears as a whole word
+	CustomRulePhrase  = "phrase"  // Any of Keywords appears, with any whitespace between words
+)
+
+// CustomThreatCategory is the threat category of custom rule matches
+const CustomThreatCategory = "custom"
+
+// Custom rule limits, checked when a rule is saved
+const (
+	maxCustomRuleNameLength    = 100
+	maxCustomRuleDescLength    = 500
+	maxCustomRulePatternLength = 1024
+	maxCustomRuleKeywords      = 50
+	maxCustomRuleKeywordLength = 200
+	// maxCustomRuleProgramSize bounds the compiled size of a rule's regular
+	// expression. Matching is linear in the input, but large programs such
+	// as a run of \w{1000} cost memory and time on every scan.
+	maxCustomRuleProgramSize = 5000
+)
+
+// customSeverityScores are the severities a custom rule may carry
+var customSeverityScores = map[string]float64{
+	"low":      0.3,
+	"medium":   0.5,
+	"high":     0.8,
+	"critical": 1.0,
+}
+
+// CustomRule is an account's own detection rule
+type CustomRule struct {
+	ID            string
+	Name          string
+	Description   string
+	Type          string
+	Pattern       string
+	Keywords      []string
+	CaseSensitive bool
+	Severity      string
+	Action        string // "warn" or "block"
+}
+
+// CompiledCustomRule is a validated CustomRule ready to match
+type CompiledCustomRule struct {
+	CustomRule
+	re *regexp.Regexp
+}
+
+// CompileCustomRule validates rule, fills in its defaults and compiles it.
+// Errors describe what is wrong with the rule and can be shown to the user.
+func CompileCustomRule(rule CustomRule) (*CompiledCustomRule, error) {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if len(rule.Name) > maxCustomRuleNameLength {
+		return nil, fmt.Errorf("name must be at most %d characters", maxCustomRuleNameLength)
+	}
+	if len(rule.Description) > maxCustomRuleDescLength {
+		return nil, fmt.Errorf("description must be at most %d characters", maxCustomRuleDescLength)
+	}
+	if rule.Severity == "" {
+		rule.Severity = "medium"
+	}
+	if _, ok := customSeverityScores[rule.Severity]; !ok {
+		return nil, errors.New("severity must be low, medium, high or critical")
+	}
+	if rule.Action == "" {
+		rule.Action = "warn"
+	}
+	if rule.Action != "warn" && rule.Action != "block" {
+		return nil, errors.New("action must be warn or block")
+	}
+
+	var pattern string
+	switch rule.Type {
+	case CustomRuleRegex:
+		if rule.Pattern == "" {
+			return nil, errors.New("pattern is required for regex rules")
+		}
+		if len(rule.Pattern) > maxCustomRulePatternLength {
+			return nil, fmt.Errorf("pattern must be at most %d characters", maxCustomRulePatternLength)
+		}
+		rule.Keywords = nil
+		pattern = rule.Pattern
+	case CustomRuleKeyword, CustomRulePhrase:
+		keywords, err := cleanCustomKeywords(rule.Keywords)
+		if err != nil {
+			return nil, err
+		}
+		rule.Keywords = keywords
+		rule.Pattern = ""
+		pattern = keywordsPattern(keywords, rule.Type == CustomRulePhrase, rule.CaseSensitive)
+	default:
+		return nil, errors.New("type must be regex, keyword or phrase")
+	}
+
+	if err := checkPatternComplexity(pattern); err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	return &CompiledCustomRule{CustomRule: rule, re: re}, nil
+}
+
+// cleanCustomKeywords trims keywords and checks their number and length
+func cleanCustomKeywords(keywords []string) ([]string, error) {
+	cleaned := make([]string, 0, len(keywords))
+	for _, k := range keywords {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		if len(k) > maxCustomRuleKeywordLength {
+			return nil, fmt.Errorf("keywords must be at most %d characters", maxCustomRuleKeywordLength)
+		}
+		cleaned = append(cleaned, k)
+	}
+	if len(cleaned) == 0 {
+		return nil, errors.New("keywords are required for keyword and phrase rules")
+	}
+	if len(cleaned) > maxCustomRuleKeywords {
+		return nil, fmt.Errorf("at most %d keywords per rule", maxCustomRuleKeywords)
+	}
+	return cleaned, nil
+}
+
+// keywordsPattern builds a regular expression matching any of keywords.
+// Keywords match as whole words; phrases match wherever they appear, with
+// any run of whitespace between their words.
+func keywordsPattern(keywords []string, phrases, caseSensitive bool) string {
+	alternatives := make([]string, 0, len(keywords))
+	for _, k := range keywords {
+		if phrases {
+			words := strings.Fields(k)
+			for i, w := range words {
+				words[i] = regexp.QuoteMeta(w)
+			}
+			alternatives = append(alternatives, strings.Join(words, `\s+`))
+			continue
+		}
+		quoted := regexp.QuoteMeta(k)
+		if isWordByte(k[0]) {
+			quoted = `\b` + quoted
+		}
+		if isWordByte(k[len(k)-1]) {
+			quoted += `\b`
+		}
+		alternatives = append(alternatives, quoted)
+	}
+	pattern := "(?:" + strings.Join(alternatives, "|") + ")"
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return pattern
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// checkPatternComplexity rejects regular expressions whose compiled program
+// exceeds maxCustomRuleProgramSize instructions
+func checkPatternComplexity(pattern string) error {
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	if len(prog.Inst) > maxCustomRuleProgramSize {
+		return errors.New("rule is too complex; use smaller repetitions or fewer keywords")
+	}
+	return nil
+}
+
+// ApplyCustomRules matches rules against text and adds their matches to
+// result as threats in the custom category. A matching rule raises the
+// decision to its action if that is stronger.
+func ApplyCustomRules(result *ScanResult, text string, rules []*CompiledCustomRule) {
+	var matched []string
+	var top *CompiledCustomRule
+	topDecision := DecisionAllow
+
+	for _, rule := range rules {
+		loc := rule.re.FindStringIndex(text)
+		if loc == nil {
+			continue
+		}
+		description := rule.Name
+		if rule.Description != "" {
+			description += ": " + rule.Description
+		}
+		result.ThreatsFound = append(result.ThreatsFound, Threat{
+			Category:    CustomThreatCategory,
+			Pattern:     rule.ID,
+			Location:    fmt.Sprintf("offset %d", loc[0]),
+			Severity:    rule.Severity,
+			Description: description,
+		})
+		matched = append(matched, rule.ID)
+
+		decision := DecisionWarn
+		if rule.Action == "block" {
+			decision = DecisionBlock
+		}
+		if decisionRank(decision) > decisionRank(topDecision) {
+			top, topDecision = rule, decision
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	result.Metadata["custom_rules"] = matched
+
+	if decisionRank(topDecision) <= decisionRank(result.Decision) {
+		return
+	}
+	result.Decision = topDecision
+	result.Reason = fmt.Sprintf("Custom rule matched: %s", top.Name)
+	if topDecision == DecisionBlock {
+		result.RecommendedAction = "DO NOT PROCEED - Content matches a rule defined for this account."
+	} else {
+		result.RecommendedAction = "Caution advised - Review content manually before processing."
+	}
+}
@@ -0,0 +1,110 @@
+package stronghold
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompileCustomRule_Validation(t *testing.T) {
+	rule, err := CompileCustomRule(CustomRule{Name: " Codename ", Type: CustomRuleKeyword, Keywords: []string{" falcon ", ""}})
+	if err != nil {
+		t.Fatalf("CompileCustomRule failed: %v", err)
+	}
+	if rule.Name != "Codename" || rule.Severity != "medium" || rule.Action != "warn" {
+		t.Errorf("expected a trimmed name and defaults, got %+v", rule.CustomRule)
+	}
+	if len(rule.Keywords) != 1 || rule.Keywords[0] != "falcon" {
+		t.Errorf("expected cleaned keywords, got %q", rule.Keywords)
+	}
+
+	invalid := []CustomRule{
+		{Type: CustomRuleKeyword, Keywords: []string{"x"}},
+		{Name: "n", Type: "glob", Pattern: "*"},
+		{Name: "n", Type: CustomRuleRegex},
+		{Name: "n", Type: CustomRuleRegex, Pattern: "("},
+		{Name: "n", Type: CustomRulePhrase, Keywords: []string{" "}},
+		{Name: "n", Type: CustomRuleKeyword, Keywords: []string{"x"}, Severity: "urgent"},
+		{Name: "n", Type: CustomRuleKeyword, Keywords: []string{"x"}, Action: "allow"},
+		{Name: strings.Repeat("n", 101), Type: CustomRuleKeyword, Keywords: []string{"x"}},
+	}
+	for _, r := range invalid {
+		if _, err := CompileCustomRule(r); err == nil {
+			t.Errorf("expected %+v to be rejected", r)
+		}
+	}
+}
+
+func TestCompileCustomRule_ComplexityLimit(t *testing.T) {
+	if _, err := CompileCustomRule(CustomRule{Name: "n", Type: CustomRuleRegex, Pattern: `(?i)sk-[a-z0-9]{32,64}`}); err != nil {
+		t.Errorf("expected an ordinary pattern to be accepted, got %v", err)
+	}
+	_, err := CompileCustomRule(CustomRule{Name: "n", Type: CustomRuleRegex, Pattern: strings.Repeat(`\w{1000}`, 6)})
+	if err == nil || !strings.Contains(err.Error(), "too complex") {
+		t.Errorf("expected long repetitions to be rejected as too complex, got %v", err)
+	}
+}
+
+func TestApplyCustomRules(t *testing.T) {
+	compile := func(r CustomRule) *CompiledCustomRule {
+		t.Helper()
+		c, err := CompileCustomRule(r)
+		if err != nil {
+			t.Fatalf("CompileCustomRule(%s) failed: %v", r.Name, err)
+		}
+		return c
+	}
+	rules := []*CompiledCustomRule{
+		compile(CustomRule{ID: "kw", Name: "Codename", Type: CustomRuleKeyword, Keywords: []string{"falcon"}}),
+		compile(CustomRule{ID: "ph", Name: "Leak phrase", Type: CustomRulePhrase, Keywords: []string{"internal use only"}, Action: "block", Severity: "high"}),
+		compile(CustomRule{ID: "re", Name: "Ticket", Type: CustomRuleRegex, Pattern: `OPS-\d{4}`, CaseSensitive: true}),
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		want     string
+		decision Decision
+	}{
+		{"keyword any case", "the FALCON rollout", "kw", DecisionWarn},
+		{"keyword inside a word", "falconry", "", DecisionAllow},
+		{"phrase across whitespace", "Internal\n  use only", "ph", DecisionBlock},
+		{"regex", "see OPS-1234", "re", DecisionWarn},
+		{"strongest action wins", "falcon: internal use only", "kw,ph", DecisionBlock},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &ScanResult{Decision: DecisionAllow, Reason: "No threats detected"}
+			ApplyCustomRules(result, tt.text, rules)
+
+			var got []string
+			for _, threat := range result.ThreatsFound {
+				if threat.Category != CustomThreatCategory {
+					t.Errorf("expected the custom category, got %q", threat.Category)
+				}
+				got = append(got, threat.Pattern)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("expected matches %q, got %q", tt.want, got)
+			}
+			if result.Decision != tt.decision {
+				t.Errorf("expected %s, got %s", tt.decision, result.Decision)
+			}
+		})
+	}
+}
+
+func TestApplyCustomRules_KeepsStrongerDecision(t *testing.T) {
+	rule, err := CompileCustomRule(CustomRule{ID: "kw", Name: "Codename", Type: CustomRuleKeyword, Keywords: []string{"falcon"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &ScanResult{Decision: DecisionBlock, Reason: "Prompt injection"}
+	ApplyCustomRules(result, "falcon", []*CompiledCustomRule{rule})
+
+	if result.Decision != DecisionBlock || result.Reason != "Prompt injection" {
+		t.Errorf("expected the stronger decision to stand, got %s (%s)", result.Decision, result.Reason)
+	}
+	if len(result.ThreatsFound) != 1 {
+		t.Errorf("expected the match reported, got %+v", result.ThreatsFound)
+	}
+}
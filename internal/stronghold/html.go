@@ -0,0 +1,134 @@
+package stronghold
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"stronghold/internal/htmltext"
+)
+
+// minHTMLSegmentLength skips trivially short segments such as alt="logo"
+const minHTMLSegmentLength = 12
+
+// IsHTMLContentType reports whether a scan request's content type is HTML
+func IsHTMLContentType(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(contentType))
+	return ct == "html" || strings.Contains(ct, "text/html") || strings.Contains(ct, "xhtml")
+}
+
+// htmlKindLabels describes each segment kind in threat descriptions
+var htmlKindLabels = map[htmltext.Kind]string{
+	htmltext.KindVisible:     "visible text",
+	htmltext.KindComment:     "HTML comment",
+	htmltext.KindHidden:      "hidden element",
+	htmltext.KindAriaHidden:  "aria-hidden element",
+	htmltext.KindAttribute:   "attribute",
+	htmltext.KindMeta:        "meta tag",
+	htmltext.KindLowContrast: "low-contrast text",
+}
+
+// ScanHTML scans an HTML document by segment instead of as raw markup.
+// Visible text and each hiding spot (comments, hidden elements, aria-hidden,
+// alt/title attributes, meta tags, low-contrast text) are scored separately;
+// the worst verdict wins and threats carry the DOM path they were found at.
+func (s *Scanner) ScanHTML(ctx context.Context, text, sourceURL, sourceType, contentType string) (*ScanResult, error) {
+	start := time.Now()
+
+	doc, err := htmltext.Extract(strings.NewReader(text))
+	if err != nil {
+		// Unparseable markup is scanned as plain text
+		return s.ScanContent(ctx, text, sourceURL, sourceType, contentType)
+	}
+
+	scan := s.newSegmentScan(ctx, sourceURL, sourceType, contentType)
+	defer scan.close()
+
+	record := func(seg htmltext.Segment, result *ScanResult) {
+		label := htmlKindLabels[seg.Kind]
+		if seg.Reason != "" && seg.Kind != htmltext.KindVisible {
+			label = fmt.Sprintf("%s (%s)", label, seg.Reason)
+		}
+		scan.record("html_"+string(seg.Kind), result, func(threat Threat) Threat {
+			threat.Location = seg.Path
+			threat.Description = fmt.Sprintf("In %s: %s", label, threat.Description)
+			return threat
+		})
+	}
+
+	// Visible text is scored as one body, located at the document body
+	visible := doc.Text(htmltext.KindVisible)
+	visibleResult, err := scan.score(visible)
+	if err != nil {
+		return nil, err
+	}
+	record(htmltext.Segment{Kind: htmltext.KindVisible, Path: "html>body"}, visibleResult)
+
+	var segments []htmltext.Segment
+	var texts []string
+	for _, kind := range htmltext.HiddenKinds {
+		for _, seg := range doc.ByKind(kind) {
+			if len(seg.Text) < minHTMLSegmentLength {
+				continue
+			}
+			segments = append(segments, seg)
+			texts = append(texts, seg.Text)
+		}
+	}
+	err = scan.scoreEach(texts, 0, func(first, n int, result *ScanResult) error {
+		seg := segments[first]
+		if n > 1 {
+			seg.Path += " (and later)"
+		}
+		record(seg, result)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for kind, n := range doc.Counts() {
+		counts[string(kind)] = n
+	}
+	metadata := scan.metadata()
+	metadata["html_segments"] = counts
+
+	return &ScanResult{
+		Decision:          scan.worst.Decision,
+		Scores:            scan.combinedScores(),
+		Reason:            scan.worst.Reason,
+		LatencyMs:         time.Since(start).Milliseconds(),
+		SanitizedText:     s.sanitizeText(visible, scan.threats),
+		ThreatsFound:      scan.threats,
+		RecommendedAction: scan.worst.RecommendedAction,
+		Metadata:          metadata,
+	}, nil
+}
+
+// scanText runs the configured detector over plain text
+func (s *Scanner) scanText(ctx context.Context, text, sourceURL, sourceType, contentType string) (*ScanResult, error) {
+	if s.hybridDetector != nil {
+		return s.scanWithHybrid(ctx, text, sourceURL, sourceType, contentType)
+	}
+	return s.scanWithThreatScorer(text, sourceURL, sourceType, contentType)
+}
+
+// primaryScore returns the headline score of a detector result
+func primaryScore(result *ScanResult) float64 {
+	if score, ok := result.Scores["combined"]; ok {
+		return score
+	}
+	return result.Scores["heuristic"]
+}
+
+func decisionRank(d Decision) int {
+	switch d {
+	case DecisionBlock:
+		return 2
+	case DecisionWarn:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,182 @@
+package stronghold
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"stronghold/internal/jsontext"
+)
+
+const (
+	// jsonRescanReserve is how many of a document's detector passes are
+	// kept back for rescoring flagged groups field by field
+	jsonRescanReserve = 8
+
+	// jsonLeafScanLength is the length from which a string field is scored
+	// on its own. Shorter fields are grouped so ids, dates and labels do not
+	// each cost a scan.
+	jsonLeafScanLength = 256
+
+	// jsonGroupSize caps the text of a group of short fields
+	jsonGroupSize = 4096
+)
+
+// jsonPathsKey holds the paths of the fields that caused a verdict in a
+// result's metadata
+const jsonPathsKey = "json_paths"
+
+// IsJSONContentType reports whether a scan request's content type is JSON
+func IsJSONContentType(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(contentType))
+	return ct == "json" || strings.Contains(ct, "json")
+}
+
+// jsonUnit is a field, or a group of short fields, scored as one text
+type jsonUnit struct {
+	leaves []jsontext.Leaf
+}
+
+func (u jsonUnit) text() string {
+	texts := make([]string, len(u.leaves))
+	for i, leaf := range u.leaves {
+		texts[i] = leaf.Text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// path locates the unit in threats: its field, or the first field of a group
+func (u jsonUnit) path() string {
+	if len(u.leaves) == 1 {
+		return u.leaves[0].Path
+	}
+	return fmt.Sprintf("%s (and %d more)", u.leaves[0].Path, len(u.leaves)-1)
+}
+
+// ScanJSON scans a JSON document by string field instead of as flat text,
+// so an injection in one long field is not diluted by the rest. Long fields
+// are scored on their own and short ones in groups; a flagged group is
+// rescored field by field to find the culprit. The worst verdict wins,
+// threats carry the JSON path they were found at, and the sanitized text
+// is the document with only the offending fields blanked. Anything that is
+// not a JSON object or array is scanned as plain text.
+func (s *Scanner) ScanJSON(ctx context.Context, text, sourceURL, sourceType, contentType string) (*ScanResult, error) {
+	start := time.Now()
+
+	leaves, ok := jsontext.Leaves([]byte(text))
+	if !ok || len(leaves) == 0 {
+		return s.ScanContent(ctx, text, sourceURL, sourceType, contentType)
+	}
+
+	scan := s.newSegmentScan(ctx, sourceURL, sourceType, contentType)
+	defer scan.close()
+
+	offending := make(map[string]bool)
+	var paths []string
+	record := func(u jsonUnit, result *ScanResult) {
+		scan.record("json_fields", result, func(threat Threat) Threat {
+			threat.Location = u.path()
+			threat.Description = fmt.Sprintf("In field %s: %s", u.path(), threat.Description)
+			return threat
+		})
+		if result.Decision != DecisionAllow {
+			for _, leaf := range u.leaves {
+				if !offending[leaf.Path] {
+					offending[leaf.Path] = true
+					paths = append(paths, leaf.Path)
+				}
+			}
+		}
+	}
+
+	units := groupJSONLeaves(leaves)
+	texts := make([]string, len(units))
+	for i, u := range units {
+		texts[i] = u.text()
+	}
+	err := scan.scoreEach(texts, jsonRescanReserve, func(first, n int, result *ScanResult) error {
+		u := units[first]
+		for _, more := range units[first+1 : first+n] {
+			u.leaves = append(u.leaves[:len(u.leaves):len(u.leaves)], more.leaves...)
+		}
+		// A flagged group is rescored field by field while a pass is left
+		// for the units after it
+		if result.Decision == DecisionAllow || len(u.leaves) == 1 || len(u.leaves) >= scan.remaining() {
+			record(u, result)
+			return nil
+		}
+
+		// Find the fields of a flagged group that are flagged on their own
+		found := false
+		for _, leaf := range u.leaves {
+			leafResult, err := scan.score(leaf.Text)
+			if err != nil {
+				return err
+			}
+			if leafResult.Decision != DecisionAllow {
+				found = true
+				record(jsonUnit{leaves: []jsontext.Leaf{leaf}}, leafResult)
+			}
+		}
+		if !found {
+			// The group is only flagged as a whole
+			record(u, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sanitized := text
+	if len(offending) > 0 {
+		if blanked, err := jsontext.Blank([]byte(text), offending); err == nil {
+			sanitized = string(blanked)
+		}
+	}
+
+	metadata := scan.metadata()
+	metadata["json_fields"] = len(leaves)
+	if len(paths) > 0 {
+		metadata[jsonPathsKey] = paths
+	}
+
+	return &ScanResult{
+		Decision:          scan.worst.Decision,
+		Scores:            scan.combinedScores(),
+		Reason:            scan.worst.Reason,
+		LatencyMs:         time.Since(start).Milliseconds(),
+		SanitizedText:     sanitized,
+		ThreatsFound:      scan.threats,
+		RecommendedAction: scan.worst.RecommendedAction,
+		Metadata:          metadata,
+	}, nil
+}
+
+// groupJSONLeaves puts each long field in a unit of its own and gathers
+// short fields, in document order, into groups of up to jsonGroupSize
+func groupJSONLeaves(leaves []jsontext.Leaf) []jsonUnit {
+	var units []jsonUnit
+	var group []jsontext.Leaf
+	size := 0
+	flush := func() {
+		if len(group) > 0 {
+			units = append(units, jsonUnit{leaves: group})
+			group, size = nil, 0
+		}
+	}
+	for _, leaf := range leaves {
+		if len(leaf.Text) >= jsonLeafScanLength {
+			units = append(units, jsonUnit{leaves: []jsontext.Leaf{leaf}})
+			continue
+		}
+		if size+len(leaf.Text) > jsonGroupSize {
+			flush()
+		}
+		group = append(group, leaf)
+		size += len(leaf.Text) + 1
+	}
+	flush()
+	return units
+}
@@ -0,0 +1,91 @@
+package stronghold
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"stronghold/internal/mcptext"
+)
+
+// IsMCPContentType reports whether a scan request's content type can carry
+// MCP messages: JSON, or the event stream of an SSE transport
+func IsMCPContentType(contentType string) bool {
+	return IsJSONContentType(contentType) || strings.Contains(strings.ToLower(contentType), "text/event-stream")
+}
+
+// ScanMCP scans an MCP message by content item instead of as raw JSON. Each
+// text item and resource body of a tool result is scored separately; the
+// worst verdict wins and threats carry the JSON path and call ID they were
+// found at, and the tool when tools names the tool of that call. Anything
+// that is not an MCP message with text content is scanned as JSON, or as
+// plain text when it is not JSON either.
+func (s *Scanner) ScanMCP(ctx context.Context, text, sourceURL, sourceType, contentType string, tools map[string]string) (*ScanResult, error) {
+	start := time.Now()
+
+	msg, ok := mcptext.Parse([]byte(text))
+	if !ok || len(msg.Items) == 0 {
+		return s.ScanJSON(ctx, text, sourceURL, sourceType, contentType)
+	}
+
+	scan := s.newSegmentScan(ctx, sourceURL, sourceType, contentType)
+	defer scan.close()
+
+	texts := make([]string, len(msg.Items))
+	for i, item := range msg.Items {
+		texts[i] = item.Text
+	}
+	err := scan.scoreEach(texts, 0, func(first, n int, result *ScanResult) error {
+		item := msg.Items[first]
+		if n > 1 {
+			item.Path += " (and later)"
+		}
+		tool := tools[item.CallID]
+		scan.record("mcp_"+string(item.Kind), result, func(threat Threat) Threat {
+			threat.Location = item.Path
+			threat.CallID = item.CallID
+			threat.Tool = tool
+			threat.Description = fmt.Sprintf("In %s: %s", mcpItemLabel(item, tool), threat.Description)
+			return threat
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for kind, n := range msg.Counts() {
+		counts[string(kind)] = n
+	}
+	metadata := scan.metadata()
+	metadata["mcp_items"] = counts
+
+	// No sanitized text: the message would have to be rebuilt around it
+	return &ScanResult{
+		Decision:          scan.worst.Decision,
+		Scores:            scan.combinedScores(),
+		Reason:            scan.worst.Reason,
+		LatencyMs:         time.Since(start).Milliseconds(),
+		ThreatsFound:      scan.threats,
+		RecommendedAction: scan.worst.RecommendedAction,
+		Metadata:          metadata,
+	}, nil
+}
+
+// mcpItemLabel describes where an item came from in threat descriptions,
+// e.g. "text content of search_docs (call 7)"
+func mcpItemLabel(item mcptext.Item, tool string) string {
+	label := "text content"
+	if item.Kind == mcptext.KindResource {
+		label = "resource"
+		if item.URI != "" {
+			label += " " + item.URI
+		}
+	}
+	if tool != "" {
+		return fmt.Sprintf("%s of %s (call %s)", label, tool, item.CallID)
+	}
+	return fmt.Sprintf("%s of call %s", label, item.CallID)
+}
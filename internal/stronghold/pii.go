@@ -0,0 +1,65 @@
+package stronghold
+
+import "stronghold/internal/pii"
+
+// PIIThreatCategory is the threat category of personal data findings
+const PIIThreatCategory = "pii"
+
+// ApplyPII finds personal data in text and adds it to result as threats in
+// the pii category, located by offset but without the data itself. Every
+// finding is replaced in the result's sanitized text; findings the policy
+// blocks raise the decision to BLOCK, redacted ones to at least WARN. PII
+// detection is opt-in: a nil policy leaves result unchanged.
+func ApplyPII(result *ScanResult, text string, policy pii.Policy) {
+	if policy == nil {
+		return
+	}
+	findings := pii.Find(text, policy)
+	if len(findings) == 0 {
+		return
+	}
+
+	report := pii.Describe(findings)
+	for _, threat := range report.Threats {
+		result.ThreatsFound = append(result.ThreatsFound, Threat{
+			Category:    PIIThreatCategory,
+			Pattern:     threat.Category,
+			Location:    threat.Location,
+			Severity:    threat.Severity,
+			Description: threat.Description,
+		})
+	}
+
+	sanitized := result.SanitizedText
+	if sanitized == "" || sanitized == text {
+		sanitized = pii.Redact(text, findings)
+	} else {
+		// Offsets refer to text, so find the data again in the sanitized text
+		sanitized = pii.Redact(sanitized, pii.Find(sanitized, policy))
+	}
+	result.SanitizedText = sanitized
+
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	result.Metadata["pii_categories"] = report.Categories
+	if result.Scores == nil {
+		result.Scores = make(map[string]float64)
+	}
+	result.Scores["pii_findings"] = float64(len(findings))
+
+	topDecision := DecisionWarn
+	if report.Block {
+		topDecision = DecisionBlock
+	}
+	if decisionRank(topDecision) <= decisionRank(result.Decision) {
+		return
+	}
+	result.Decision = topDecision
+	result.Reason = report.Reason
+	if topDecision == DecisionBlock {
+		result.RecommendedAction = "DO NOT PROCEED - Content contains personal data the PII policy blocks."
+	} else {
+		result.RecommendedAction = "Use sanitized_text - Personal data has been redacted."
+	}
+}
@@ -0,0 +1,59 @@
+package stronghold
+
+import (
+	"strings"
+	"testing"
+
+	"stronghold/internal/pii"
+)
+
+func TestApplyPII_RedactsAndRaisesDecision(t *testing.T) {
+	text := "Contact jane@example.com or card 4111 1111 1111 1111"
+
+	result := &ScanResult{Decision: DecisionAllow}
+	ApplyPII(result, text, pii.Policy{pii.Card: pii.ActionRedact})
+	if result.Decision != DecisionWarn {
+		t.Errorf("expected redacted PII to warn, got %s", result.Decision)
+	}
+	if result.SanitizedText != "Contact [REDACTED_EMAIL] or card [REDACTED_CARD]" {
+		t.Errorf("unexpected sanitized text %q", result.SanitizedText)
+	}
+	if len(result.ThreatsFound) != 2 || result.ThreatsFound[0].Category != PIIThreatCategory || result.ThreatsFound[1].Pattern != pii.Card {
+		t.Errorf("unexpected threats %+v", result.ThreatsFound)
+	}
+	for _, threat := range result.ThreatsFound {
+		if strings.Contains(threat.Description, "4111") || strings.Contains(threat.Description, "jane") {
+			t.Errorf("threat %+v should not repeat the personal data", threat)
+		}
+	}
+
+	result = &ScanResult{Decision: DecisionAllow}
+	ApplyPII(result, text, pii.Policy{})
+	if result.Decision != DecisionBlock || !strings.Contains(result.Reason, "payment card number") {
+		t.Errorf("expected the default policy to block cards, got %s: %s", result.Decision, result.Reason)
+	}
+
+	result = &ScanResult{Decision: DecisionAllow}
+	ApplyPII(result, text, nil)
+	if result.Decision != DecisionAllow || len(result.ThreatsFound) != 0 || result.SanitizedText != "" {
+		t.Errorf("expected no PII detection without a policy, got %+v", result)
+	}
+
+	result = &ScanResult{Decision: DecisionAllow}
+	ApplyPII(result, text, pii.Policy{pii.Card: pii.ActionAllow, pii.Email: pii.ActionAllow})
+	if result.Decision != DecisionAllow || len(result.ThreatsFound) != 0 || result.SanitizedText != "" {
+		t.Errorf("expected allowed PII to be ignored, got %+v", result)
+	}
+}
+
+func TestApplyPII_KeepsCredentialRedaction(t *testing.T) {
+	text := "key sk-live-1234 for jane@example.com"
+	result := &ScanResult{Decision: DecisionBlock, SanitizedText: "key [REDACTED] for jane@example.com"}
+	ApplyPII(result, text, pii.Policy{})
+	if result.SanitizedText != "key [REDACTED] for [REDACTED_EMAIL]" {
+		t.Errorf("unexpected sanitized text %q", result.SanitizedText)
+	}
+	if result.Decision != DecisionBlock {
+		t.Errorf("expected the stronger decision to stay, got %s", result.Decision)
+	}
+}
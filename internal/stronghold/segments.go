@@ -0,0 +1,130 @@
+package stronghold
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const (
+	// maxSegmentScans caps the detector passes of one HTML, JSON or MCP
+	// scan, rescans included. Segments beyond it are scored together.
+	maxSegmentScans = 32
+
+	// segmentScanBudget bounds the time one segmented scan spends in the
+	// detector, well inside the proxy's 5s client timeout. Once it is spent,
+	// the remaining segments are scored by the heuristic scorer alone, which
+	// makes no model or LLM calls.
+	segmentScanBudget = 3 * time.Second
+)
+
+// segmentScan scores the segments of one document within a shared budget
+// of detector passes and time. It gathers their threats, the highest
+// score per key and the worst verdict.
+type segmentScan struct {
+	s                                  *Scanner
+	ctx                                context.Context
+	cancel                             context.CancelFunc
+	sourceURL, sourceType, contentType string
+
+	passes    int // Detector passes made
+	heuristic int // Passes scored by the heuristic scorer after the time budget ran out
+	scores    map[string]float64
+	threats   []Threat
+	worst     *ScanResult
+}
+
+// newSegmentScan starts a segmented scan. close must be called when it is done.
+func (s *Scanner) newSegmentScan(ctx context.Context, sourceURL, sourceType, contentType string) *segmentScan {
+	ctx, cancel := context.WithTimeout(ctx, segmentScanBudget)
+	return &segmentScan{
+		s:           s,
+		ctx:         ctx,
+		cancel:      cancel,
+		sourceURL:   sourceURL,
+		sourceType:  sourceType,
+		contentType: contentType,
+		scores:      make(map[string]float64),
+	}
+}
+
+func (g *segmentScan) close() { g.cancel() }
+
+// remaining returns how many detector passes are left
+func (g *segmentScan) remaining() int { return maxSegmentScans - g.passes }
+
+// score runs the detector over one text, or the heuristic scorer once the
+// time budget is spent
+func (g *segmentScan) score(text string) (*ScanResult, error) {
+	g.passes++
+	if g.ctx.Err() != nil {
+		g.heuristic++
+		return g.s.scanWithThreatScorer(text, g.sourceURL, g.sourceType, g.contentType)
+	}
+	return g.s.scanText(g.ctx, text, g.sourceURL, g.sourceType, g.contentType)
+}
+
+// scoreEach scores texts one by one, keeping reserve passes back for
+// rescans. Once the budget is down to that, the remaining texts are
+// joined and scored in one pass. each gets the index of the first text a
+// result covers and how many texts it covers.
+func (g *segmentScan) scoreEach(texts []string, reserve int, each func(first, n int, result *ScanResult) error) error {
+	for i := 0; i < len(texts); {
+		n := 1
+		if len(texts)-i > 1 && g.remaining()-reserve <= 1 {
+			n = len(texts) - i
+		}
+		result, err := g.score(strings.Join(texts[i:i+n], "\n"))
+		if err != nil {
+			return err
+		}
+		if err := each(i, n, result); err != nil {
+			return err
+		}
+		i += n
+	}
+	return nil
+}
+
+// record adds a result under a score key. locate places each of its
+// threats in the document.
+func (g *segmentScan) record(key string, result *ScanResult, locate func(Threat) Threat) {
+	if score := primaryScore(result); score > g.scores[key] {
+		g.scores[key] = score
+	}
+	for _, threat := range result.ThreatsFound {
+		g.threats = append(g.threats, locate(threat))
+	}
+	if g.worst == nil || decisionRank(result.Decision) > decisionRank(g.worst.Decision) {
+		g.worst = result
+	}
+}
+
+// combinedScores returns the scores per key with the highest as combined
+func (g *segmentScan) combinedScores() map[string]float64 {
+	combined := 0.0
+	for _, score := range g.scores {
+		if score > combined {
+			combined = score
+		}
+	}
+	g.scores["combined"] = combined
+	return g.scores
+}
+
+// metadata returns the metadata shared by segmented scan results
+func (g *segmentScan) metadata() map[string]interface{} {
+	metadata := map[string]interface{}{
+		"source_url":    g.sourceURL,
+		"source_type":   g.sourceType,
+		"content_type":  g.contentType,
+		"segment_scans": g.passes,
+	}
+	if g.heuristic > 0 {
+		metadata["heuristic_only_scans"] = g.heuristic
+	}
+	if detection, ok := g.worst.Metadata["detection"]; ok {
+		metadata["detection"] = detection
+	}
+	return metadata
+}
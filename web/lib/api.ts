@@ -221,6 +221,8 @@ export async function createBillingPortalSession(): Promise<{ portal_url: string
 export interface AccountSettings {
   jailbreak_detection_enabled: boolean;
   has_api_keys: boolean;
+  /** Action per personal data category in output scans */
+  pii_policy: Record<string, 'allow' | 'redact' | 'block'>;
 }
 
 /**
@@ -238,7 +240,7 @@ export async function getAccountSettings(): Promise<AccountSettings> {
  * Update account settings.
  */
 export async function updateAccountSettings(
-  settings: Partial<Pick<AccountSettings, 'jailbreak_detection_enabled'>>
+  settings: Partial<Pick<AccountSettings, 'jailbreak_detection_enabled' | 'pii_policy'>>
 ): Promise<AccountSettings> {
   const response = await fetchWithAuth(`${API_URL}/v1/account/settings`, {
     method: 'PUT',